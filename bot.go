@@ -0,0 +1,226 @@
+package nakama
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	nkapi "github.com/heroiclabs/nakama-common/api"
+)
+
+// Behavior is a bot behavior, triggered by the bot's events. Nil funcs are
+// ignored. Errors returned by a behavior are logged, and do not stop the bot.
+type Behavior struct {
+	// OnStart is called after the bot connects.
+	OnStart func(context.Context, *Bot) error
+	// OnTick is called at the bot's tick interval.
+	OnTick func(context.Context, *Bot) error
+	// OnMatchData is called with received match data.
+	OnMatchData func(context.Context, *Bot, *MatchDataMsg) error
+	// OnChannelMessage is called with received channel messages.
+	OnChannelMessage func(context.Context, *Bot, *ChannelMessageMsg) error
+	// OnNotification is called with each received notification.
+	OnNotification func(context.Context, *Bot, *nkapi.Notification) error
+}
+
+// Bot is a realtime bot, such as an AI opponent or a test bot, that runs its
+// behaviors from a single event loop, so that behaviors do not need to
+// synchronize access to their state. The bot's connection is persistent,
+// reconnecting and rejoining matches and channels after a disconnect.
+type Bot struct {
+	cl        *Client
+	conn      *Conn
+	behaviors []*Behavior
+	connOpts  []ConnOption
+	tick      time.Duration
+	queue     int
+	events    chan func(context.Context)
+
+	startHandlers      callbacks[*Bot]
+	stopHandlers       callbacks[*Bot]
+	connectHandlers    callbacks[*Bot]
+	disconnectHandlers callbacks[*DisconnectReason]
+}
+
+// NewBot creates a bot for the authenticated client.
+func NewBot(cl *Client, opts ...BotOption) *Bot {
+	b := &Bot{
+		cl:    cl,
+		queue: 256,
+	}
+	for _, o := range opts {
+		o(b)
+	}
+	b.events = make(chan func(context.Context), b.queue)
+	return b
+}
+
+// Client returns the bot's client.
+func (b *Bot) Client() *Client {
+	return b.cl
+}
+
+// Conn returns the bot's realtime connection, or nil when the bot is not
+// running.
+func (b *Bot) Conn() *Conn {
+	return b.conn
+}
+
+// Run connects the bot and runs its event loop until the context is closed,
+// calling the start hooks and behaviors after connecting, and the stop hooks
+// before returning.
+func (b *Bot) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	opts := append([]ConnOption{WithConnPersist(true), WithConnAutoRejoin(true)}, b.connOpts...)
+	conn, err := b.cl.NewConn(ctx, opts...)
+	if err != nil {
+		return fmt.Errorf("unable to connect bot: %w", err)
+	}
+	defer conn.Close()
+	b.conn = conn
+	conn.OnConnect(ctx, func() {
+		b.connectHandlers.dispatch(b)
+	})
+	conn.OnDisconnect(ctx, b.disconnectHandlers.dispatch)
+	for _, behavior := range b.behaviors {
+		b.register(ctx, behavior)
+	}
+	b.startHandlers.dispatch(b)
+	defer b.stopHandlers.dispatch(b)
+	var tick <-chan time.Time
+	if b.tick != 0 {
+		t := time.NewTicker(b.tick)
+		defer t.Stop()
+		tick = t.C
+	}
+	for _, behavior := range b.behaviors {
+		if behavior.OnStart != nil {
+			b.handle("start", behavior.OnStart(ctx, b))
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case f := <-b.events:
+			f(ctx)
+		case <-tick:
+			for _, behavior := range b.behaviors {
+				if behavior.OnTick != nil {
+					b.handle("tick", behavior.OnTick(ctx, b))
+				}
+			}
+		}
+	}
+}
+
+// register adds the connection callbacks for the behavior, queuing the
+// behavior's funcs to the event loop.
+func (b *Bot) register(ctx context.Context, behavior *Behavior) {
+	if f := behavior.OnMatchData; f != nil {
+		b.conn.OnMatchData(ctx, func(msg *MatchDataMsg) {
+			b.push(ctx, func(ctx context.Context) {
+				b.handle("match data", f(ctx, b, msg))
+			})
+		})
+	}
+	if f := behavior.OnChannelMessage; f != nil {
+		b.conn.OnChannelMessage(ctx, func(msg *ChannelMessageMsg) {
+			b.push(ctx, func(ctx context.Context) {
+				b.handle("channel message", f(ctx, b, msg))
+			})
+		})
+	}
+	if f := behavior.OnNotification; f != nil {
+		b.conn.OnNotifications(ctx, func(msg *NotificationsMsg) {
+			b.push(ctx, func(ctx context.Context) {
+				for _, n := range msg.GetNotifications() {
+					b.handle("notification", f(ctx, b, n))
+				}
+			})
+		})
+	}
+}
+
+// push queues f to the event loop.
+func (b *Bot) push(ctx context.Context, f func(context.Context)) {
+	select {
+	case <-ctx.Done():
+	case b.events <- f:
+	}
+}
+
+// Do queues f to run on the bot's event loop, such as to update behavior
+// state from another goroutine.
+func (b *Bot) Do(ctx context.Context, f func(context.Context)) {
+	b.push(ctx, f)
+}
+
+// handle logs a behavior error.
+func (b *Bot) handle(event string, err error) {
+	if err != nil {
+		b.cl.logger.Log(LevelError, "bot behavior error", "event", event, "err", err)
+	}
+}
+
+// OnStart adds a lifecycle hook called after the bot connects. The hook is
+// called from the bot's goroutine.
+func (b *Bot) OnStart(ctx context.Context, f func(*Bot)) {
+	b.startHandlers.add(ctx, f)
+}
+
+// OnStop adds a lifecycle hook called before the bot's Run returns.
+func (b *Bot) OnStop(ctx context.Context, f func(*Bot)) {
+	b.stopHandlers.add(ctx, f)
+}
+
+// OnConnect adds a lifecycle hook called when the bot reconnects.
+func (b *Bot) OnConnect(ctx context.Context, f func(*Bot)) {
+	b.connectHandlers.add(ctx, f)
+}
+
+// OnDisconnect adds a lifecycle hook called when the bot is disconnected.
+func (b *Bot) OnDisconnect(ctx context.Context, f func(*DisconnectReason)) {
+	b.disconnectHandlers.add(ctx, f)
+}
+
+// BotOption is a bot option.
+type BotOption func(*Bot)
+
+// WithBotBehavior is a bot option to add a behavior.
+func WithBotBehavior(behavior *Behavior) BotOption {
+	return func(b *Bot) {
+		b.behaviors = append(b.behaviors, behavior)
+	}
+}
+
+// WithBotTick is a bot option to set the interval at which the behaviors'
+// OnTick funcs are called.
+func WithBotTick(tick time.Duration) BotOption {
+	return func(b *Bot) {
+		b.tick = tick
+	}
+}
+
+// WithBotRateLimit is a bot option to limit the rate of messages sent by the
+// bot (see WithConnRateLimit).
+func WithBotRateLimit(msgsPerSec float64, burst int) BotOption {
+	return func(b *Bot) {
+		b.connOpts = append(b.connOpts, WithConnRateLimit(msgsPerSec, burst))
+	}
+}
+
+// WithBotQueue is a bot option to set the size of the event loop's queue.
+func WithBotQueue(queue int) BotOption {
+	return func(b *Bot) {
+		b.queue = queue
+	}
+}
+
+// WithBotConnOptions is a bot option to set the realtime connection options.
+func WithBotConnOptions(opts ...ConnOption) BotOption {
+	return func(b *Bot) {
+		b.connOpts = append(b.connOpts, opts...)
+	}
+}
@@ -0,0 +1,122 @@
+package nakama
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/rtapi"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// CaptureDirection is the direction of a captured envelope.
+type CaptureDirection string
+
+// CaptureDirection values.
+const (
+	// CaptureIn is an envelope received from the server.
+	CaptureIn CaptureDirection = "in"
+	// CaptureOut is an envelope sent to the server.
+	CaptureOut CaptureDirection = "out"
+)
+
+// CaptureRecord is a captured realtime envelope, written as a line of json.
+type CaptureRecord struct {
+	Time      time.Time        `json:"time"`
+	Direction CaptureDirection `json:"direction"`
+	Cid       string           `json:"cid,omitempty"`
+	Type      string           `json:"type"`
+	Envelope  json.RawMessage  `json:"envelope"`
+}
+
+// capture writes captured envelopes.
+type capture struct {
+	enc    *json.Encoder
+	logger func() Logger
+	mu     sync.Mutex
+}
+
+// record writes a capture record for the envelope.
+func (c *capture) record(dir CaptureDirection, env *rtapi.Envelope) {
+	buf, err := protojson.Marshal(env)
+	if err != nil {
+		c.logger().Log(LevelError, "unable to capture envelope", "err", err)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.enc.Encode(CaptureRecord{
+		Time:      time.Now(),
+		Direction: dir,
+		Cid:       env.Cid,
+		Type:      envelopeType(env),
+		Envelope:  buf,
+	}); err != nil {
+		c.logger().Log(LevelError, "unable to capture envelope", "err", err)
+	}
+}
+
+// WithConnCapture is a nakama websocket connection option to capture every
+// sent and received envelope to w, as lines of json (see CaptureRecord). The
+// capture can be replayed with Replay.
+func WithConnCapture(w io.Writer) ConnOption {
+	return func(conn *Conn) {
+		conn.capture = &capture{
+			enc: json.NewEncoder(w),
+			logger: func() Logger {
+				return conn.logger
+			},
+		}
+	}
+}
+
+// NewReplayConn creates a realtime connection that is not opened, for use
+// with Replay. Callbacks can be added to the connection as usual.
+func NewReplayConn(opts ...ConnOption) *Conn {
+	return newConn(opts...)
+}
+
+// Replay reads a capture (see WithConnCapture), dispatching the received
+// notifications to the connection's callbacks, in order. Captured responses
+// and sent envelopes are skipped. When realtime is true, the recorded delays
+// between notifications are reproduced.
+func (conn *Conn) Replay(ctx context.Context, r io.Reader, realtime bool) error {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	var last time.Time
+	for {
+		var rec CaptureRecord
+		switch err := dec.Decode(&rec); {
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return fmt.Errorf("unable to read capture: %w", err)
+		}
+		if rec.Direction != CaptureIn || rec.Cid != "" {
+			continue
+		}
+		env := new(rtapi.Envelope)
+		if err := protojson.Unmarshal(rec.Envelope, env); err != nil {
+			return fmt.Errorf("unable to read capture: %w", err)
+		}
+		if realtime && !last.IsZero() {
+			t := time.NewTimer(rec.Time.Sub(last))
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return ctx.Err()
+			case <-t.C:
+			}
+		}
+		last = rec.Time
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := conn.recv(env); err != nil {
+			conn.logger.Log(LevelError, "unable to dispatch replayed message", "err", err)
+		}
+	}
+}
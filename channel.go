@@ -0,0 +1,239 @@
+package nakama
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/heroiclabs/nakama-common/rtapi"
+	"google.golang.org/protobuf/proto"
+)
+
+// ChannelHandle is a handle to a joined chat channel, tracking the channel's
+// presences and scoping message and presence callbacks to the channel.
+type ChannelHandle struct {
+	conn      *Conn
+	channel   *ChannelMsg
+	ctx       context.Context
+	cancel    func()
+	presences *PresenceSet
+}
+
+// ChannelHandle creates a handle for a joined channel. The handle's callbacks
+// are removed when the context is closed, or the channel is left.
+func (conn *Conn) ChannelHandle(ctx context.Context, channel *ChannelMsg) *ChannelHandle {
+	ctx, cancel := context.WithCancel(ctx)
+	h := &ChannelHandle{
+		conn:      conn,
+		channel:   channel,
+		ctx:       ctx,
+		cancel:    cancel,
+		presences: NewPresenceSet(channel.Presences...),
+	}
+	conn.OnChannelPresenceEvent(ctx, h.update)
+	return h
+}
+
+// ChannelJoinHandle sends a message to join a chat channel, returning a
+// handle to the channel.
+func (conn *Conn) ChannelJoinHandle(ctx context.Context, target string, typ ChannelJoinType, persistence, hidden bool) (*ChannelHandle, error) {
+	channel, err := conn.ChannelJoin(ctx, target, typ, persistence, hidden)
+	if err != nil {
+		return nil, err
+	}
+	return conn.ChannelHandle(context.Background(), channel), nil
+}
+
+// ErrNotGroupMember is the error returned by GroupChannelHandle when the user
+// is not a member of the group.
+var ErrNotGroupMember = errors.New("not a group member")
+
+// GroupChannelHandle sends a message to join the group's chat channel,
+// returning a handle to the channel. The client is first used to verify the
+// session user is a member of the group, returning ErrNotGroupMember when
+// the user is not a member (or has only requested to join).
+func (conn *Conn) GroupChannelHandle(ctx context.Context, cl *Client, groupId string, persistence, hidden bool) (*ChannelHandle, error) {
+	member := false
+	p := UserGroups(cl.SessionUserId()).Pager(cl)
+	for !member && p.Next(ctx) {
+		for _, g := range p.Page().UserGroups {
+			if g.Group.GetId() == groupId && GroupUserState(g.State.GetValue()) <= GroupUserMember {
+				member = true
+				break
+			}
+		}
+	}
+	switch {
+	case p.Err() != nil:
+		return nil, fmt.Errorf("unable to verify group membership: %w", p.Err())
+	case !member:
+		return nil, ErrNotGroupMember
+	}
+	return conn.ChannelJoinHandle(ctx, groupId, ChannelJoinGroup, persistence, hidden)
+}
+
+// DirectMessage sends a message to join the direct message channel with a
+// user, identified by user id or username, returning a handle to the
+// channel. Usernames are resolved to user ids with the client. Messages sent
+// to the channel are persisted.
+func (conn *Conn) DirectMessage(ctx context.Context, cl *Client, user string) (*ChannelHandle, error) {
+	userId := user
+	if _, err := uuid.Parse(user); err != nil {
+		res, err := Users().WithUsernames(user).Do(ctx, cl)
+		switch {
+		case err != nil:
+			return nil, fmt.Errorf("unable to resolve username %q: %w", user, err)
+		case len(res.Users) == 0:
+			return nil, fmt.Errorf("unable to resolve username %q: %w", user, ErrNotFound)
+		}
+		userId = res.Users[0].Id
+	}
+	return conn.ChannelJoinHandle(ctx, userId, ChannelJoinDirectMessage, true, false)
+}
+
+// update updates the channel's presences from a presence event.
+func (h *ChannelHandle) update(msg *ChannelPresenceEventMsg) {
+	if msg.ChannelId == h.channel.Id {
+		h.presences.Apply(msg)
+	}
+}
+
+// Id returns the channel id.
+func (h *ChannelHandle) Id() string {
+	return h.channel.Id
+}
+
+// Channel returns the channel message the handle was created with.
+func (h *ChannelHandle) Channel() *ChannelMsg {
+	return h.channel
+}
+
+// Self returns the user's presence in the channel.
+func (h *ChannelHandle) Self() *rtapi.UserPresence {
+	return h.channel.Self
+}
+
+// Presences returns the channel's current presences.
+func (h *ChannelHandle) Presences() []*rtapi.UserPresence {
+	return h.presences.Presences()
+}
+
+// Roster returns the set of the channel's current presences.
+func (h *ChannelHandle) Roster() *PresenceSet {
+	return h.presences
+}
+
+// SendMessage sends a message to the channel.
+func (h *ChannelHandle) SendMessage(ctx context.Context, content string) (*ChannelMessageAckMsg, error) {
+	return h.conn.ChannelMessageSend(ctx, h.channel.Id, content)
+}
+
+// UpdateMessage updates a message on the channel.
+func (h *ChannelHandle) UpdateMessage(ctx context.Context, messageId, content string) (*ChannelMessageAckMsg, error) {
+	return h.conn.ChannelMessageUpdate(ctx, h.channel.Id, messageId, content)
+}
+
+// RemoveMessage removes a message from the channel.
+func (h *ChannelHandle) RemoveMessage(ctx context.Context, messageId string) (*ChannelMessageAckMsg, error) {
+	return h.conn.ChannelMessageRemove(ctx, h.channel.Id, messageId)
+}
+
+// OnMessage adds a callback for messages received on the channel. The
+// callback is removed when the channel is left.
+func (h *ChannelHandle) OnMessage(f func(*ChannelMessageMsg)) {
+	h.onMessage(h.ctx, f)
+}
+
+// Messages returns a channel receiving the messages received on the channel.
+// The returned channel is closed when the channel is left.
+func (h *ChannelHandle) Messages(opts ...SubscribeOption) <-chan *ChannelMessageMsg {
+	return subscribe(h.ctx, h.onMessage, opts...)
+}
+
+// MessagesWithHistory returns a channel receiving up to limit of the
+// channel's most recent messages (retrieved with the client), in
+// chronological order, followed by the messages received on the channel.
+// Messages are not repeated. The returned channel is closed when the context
+// is closed, or the channel is left.
+func (h *ChannelHandle) MessagesWithHistory(ctx context.Context, cl *Client, limit int, opts ...SubscribeOption) (<-chan *ChannelMessageMsg, error) {
+	// close the subscription when either context is closed
+	sctx, cancel := context.WithCancel(h.ctx)
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-sctx.Done():
+		}
+	}()
+	live := subscribe(sctx, h.onMessage, opts...)
+	res, err := cl.ChannelMessagesList(ctx, h.channel.Id, limit, false, "")
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	seen := make(map[string]bool, len(res.Messages))
+	history := make([]*ChannelMessageMsg, 0, len(res.Messages))
+	for i := len(res.Messages) - 1; i >= 0; i-- {
+		msg := new(ChannelMessageMsg)
+		proto.Merge(&msg.ChannelMessage, res.Messages[i])
+		seen[msg.MessageId] = true
+		history = append(history, msg)
+	}
+	ch := make(chan *ChannelMessageMsg)
+	go func() {
+		defer cancel()
+		defer close(ch)
+		for _, msg := range history {
+			select {
+			case <-sctx.Done():
+				return
+			case ch <- msg:
+			}
+		}
+		for msg := range live {
+			if seen[msg.MessageId] {
+				continue
+			}
+			select {
+			case <-sctx.Done():
+				return
+			case ch <- msg:
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// onMessage adds a message callback filtered to the channel.
+func (h *ChannelHandle) onMessage(ctx context.Context, f func(*ChannelMessageMsg)) {
+	id := h.channel.Id
+	h.conn.OnChannelMessage(ctx, func(msg *ChannelMessageMsg) {
+		if msg.ChannelId == id {
+			f(msg)
+		}
+	})
+}
+
+// OnPresenceEvent adds a callback for the channel's presence events. The
+// callback is removed when the channel is left.
+func (h *ChannelHandle) OnPresenceEvent(f func(*ChannelPresenceEventMsg)) {
+	id := h.channel.Id
+	h.conn.OnChannelPresenceEvent(h.ctx, func(msg *ChannelPresenceEventMsg) {
+		if msg.ChannelId == id {
+			f(msg)
+		}
+	})
+}
+
+// Done returns a channel that is closed when the channel is left.
+func (h *ChannelHandle) Done() <-chan struct{} {
+	return h.ctx.Done()
+}
+
+// Leave sends a message to leave the channel, removing the handle's
+// callbacks.
+func (h *ChannelHandle) Leave(ctx context.Context) error {
+	defer h.cancel()
+	return h.conn.ChannelLeave(ctx, h.channel.Id)
+}
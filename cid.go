@@ -0,0 +1,56 @@
+package nakama
+
+import (
+	"strconv"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+)
+
+// CidGenerator generates the cid of a request, from the connection's epoch
+// (incremented each time the websocket connection is opened) and the
+// request's counter (incremented for each request sent by the connection).
+type CidGenerator func(epoch, n uint64) string
+
+// CidGenerator values.
+var (
+	// SequentialCid generates cids from the request counter. Used by default.
+	SequentialCid CidGenerator = func(_, n uint64) string {
+		return strconv.FormatUint(n, 10)
+	}
+	// EpochCid generates cids from the connection epoch and the request
+	// counter (ie, "2.15"), so that responses to requests sent on a previous
+	// websocket connection are not attributed to requests sent after
+	// reconnecting.
+	EpochCid CidGenerator = func(epoch, n uint64) string {
+		return strconv.FormatUint(epoch, 10) + "." + strconv.FormatUint(n, 10)
+	}
+	// UuidCid generates a random uuid for each cid.
+	UuidCid CidGenerator = func(uint64, uint64) string {
+		return uuid.NewString()
+	}
+)
+
+// WithConnCidGenerator is a nakama websocket connection option to set the
+// generator of request cids. Defaults to SequentialCid.
+func WithConnCidGenerator(gen CidGenerator) ConnOption {
+	return func(conn *Conn) {
+		conn.cidGen = gen
+	}
+}
+
+// nextCid returns the cid for the next request, and the request counter.
+func (conn *Conn) nextCid() (string, uint64) {
+	n := atomic.AddUint64(&conn.id, 1)
+	if conn.cidGen == nil {
+		return SequentialCid(conn.epoch.Load(), n), n
+	}
+	return conn.cidGen(conn.epoch.Load(), n), n
+}
+
+// CidCounter returns the connection's epoch (the number of times the
+// websocket connection has been opened) and request counter (the number of
+// requests sent), for diagnostics.
+func (conn *Conn) CidCounter() (uint64, uint64) {
+	return conn.epoch.Load(), atomic.LoadUint64(&conn.id)
+}
@@ -5,18 +5,26 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
+	"net"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/net/publicsuffix"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 )
@@ -29,12 +37,20 @@ type Client struct {
 	cl          *http.Client
 	url         string
 	serverKey   string
+	httpKey     string
+	serverMode  bool
 	username    string
 	password    string
 	refreshAuto bool
 	expiryGrace time.Duration
 
+	retries            int
+	retryBackoff       Backoff
+	retryNonIdempotent bool
+
+	store               SessionStore
 	session             *SessionResponse
+	userId              string
 	expiry              time.Time
 	expiryGraced        time.Time
 	expiryRefresh       time.Time
@@ -43,9 +59,16 @@ type Client struct {
 	marshaler   *protojson.MarshalOptions
 	unmarshaler *protojson.UnmarshalOptions
 
-	logf func(string, ...interface{})
+	logger   Logger
+	tracer   trace.Tracer
+	metrics  Metrics
+	metadata MetadataInjector
+
+	rw       sync.RWMutex
+	refresh  sync.Mutex
+	sessionc chan struct{}
 
-	rw sync.RWMutex
+	tokenHandlers callbacks[string]
 }
 
 // New creates a new nakama client.
@@ -57,9 +80,14 @@ func New(opts ...Option) *Client {
 		cl: &http.Client{
 			Jar: jar,
 		},
-		url:         "http://127.0.0.1:7350",
-		refreshAuto: true,
-		expiryGrace: 5 * time.Second,
+		url:          "http://127.0.0.1:7350",
+		logger:       NopLogger,
+		tracer:       trace.NewNoopTracerProvider().Tracer(""),
+		metrics:      NopMetrics,
+		sessionc:     make(chan struct{}, 1),
+		refreshAuto:  true,
+		expiryGrace:  5 * time.Second,
+		retryBackoff: ExponentialBackoff(250*time.Millisecond, 10*time.Second),
 		marshaler: &protojson.MarshalOptions{
 			UseProtoNames:  true,
 			UseEnumNumbers: true,
@@ -72,19 +100,27 @@ func New(opts ...Option) *Client {
 		o(cl)
 	}
 	cl.url = strings.TrimSuffix(cl.url, "/")
+	if cl.store != nil {
+		if _, err := cl.SessionRestore(); err != nil {
+			cl.logger.Log(LevelWarn, "unable to restore session", "err", err)
+		}
+	}
 	return cl
 }
 
-// Logf satisfies the Handler interface.
+// Log satisfies the Logger and Handler interfaces.
+func (cl *Client) Log(level Level, msg string, keyvals ...interface{}) {
+	cl.logger.Log(level, msg, keyvals...)
+}
+
+// Logf logs a formatted message at the info level.
 func (cl *Client) Logf(s string, v ...interface{}) {
-	if cl.logf != nil {
-		cl.logf(s, v...)
-	}
+	cl.logger.Log(LevelInfo, fmt.Sprintf(s, v...))
 }
 
-// Errf satisfies the handler interface.
+// Errf logs a formatted message at the error level.
 func (cl *Client) Errf(s string, v ...interface{}) {
-	cl.Logf("ERROR: "+s, v...)
+	cl.logger.Log(LevelError, fmt.Sprintf(s, v...))
 }
 
 // HttpClient satisfies the handler interface.
@@ -106,7 +142,7 @@ func (cl *Client) SocketURL() (string, error) {
 	default:
 		return "", fmt.Errorf("invalid scheme %q", u.Scheme)
 	}
-	return scheme + "://" + u.Host + DefaultWsPath, nil
+	return scheme + "://" + u.Host + strings.TrimSuffix(u.Path, "/") + DefaultWsPath, nil
 }
 
 // Token returns the current session token. Satisfies the Handler interface.
@@ -114,7 +150,7 @@ func (cl *Client) Token(ctx context.Context) (string, error) {
 	if err := cl.SessionRefresh(ctx); err != nil {
 		return "", err
 	}
-	return cl.session.Token, nil
+	return cl.SessionToken(), nil
 }
 
 // BuildRequest builds a http request.
@@ -146,17 +182,60 @@ func (cl *Client) BuildRequest(ctx context.Context, method, typ string, query ur
 }
 
 // Exec executes the request http request.
+//
+// When retries are enabled (see WithRetries), requests that fail with a
+// network error, a 429 or a 5xx status are retried after waiting the longer of
+// the backoff and the response's Retry-After. Only idempotent requests are
+// retried, unless the request's context was marked with Idempotent or the
+// client was created with WithRetryNonIdempotent.
 func (cl *Client) Exec(req *http.Request) (*http.Response, error) {
-	res, err := cl.cl.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	switch {
-	case res.StatusCode != http.StatusOK:
-		defer res.Body.Close()
-		return nil, NewClientErrorFromReader(res.StatusCode, res.Body)
+	ctx := req.Context()
+	retry := cl.retries != 0 &&
+		(req.Body == nil || req.GetBody != nil) &&
+		(cl.retryNonIdempotent || isIdempotent(req))
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		res, err := cl.cl.Do(req)
+		var wait time.Duration
+		var cause interface{}
+		switch {
+		case err != nil:
+			cl.Log(LevelDebug, "http request failed", "method", req.Method, "path", req.URL.Path, "duration", time.Since(start), "err", err)
+			if !retry || attempt > cl.retries || ctx.Err() != nil {
+				return nil, err
+			}
+			cause = err
+		case res.StatusCode == http.StatusOK:
+			cl.Log(LevelDebug, "http request", "method", req.Method, "path", req.URL.Path, "status", res.StatusCode, "duration", time.Since(start))
+			return res, nil
+		case !retry || attempt > cl.retries || !isRetryableStatus(res.StatusCode):
+			cl.Log(LevelDebug, "http request", "method", req.Method, "path", req.URL.Path, "status", res.StatusCode, "duration", time.Since(start))
+			defer res.Body.Close()
+			return nil, NewClientErrorFromReader(res.StatusCode, res.Body)
+		default:
+			wait, cause = parseRetryAfter(res.Header.Get("Retry-After")), res.StatusCode
+			_, _ = io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+		}
+		if d := cl.retryBackoff(attempt); wait < d {
+			wait = d
+		}
+		cl.Log(LevelWarn, "retrying http request", "method", req.Method, "path", req.URL.Path, "attempt", attempt, "retries", cl.retries, "wait", wait, "cause", cause)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		// rewind body
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
 	}
-	return res, nil
 }
 
 // Do executes a http request with method, type and url query values, passing
@@ -169,20 +248,37 @@ func (cl *Client) Exec(req *http.Request) (*http.Response, error) {
 // encoding/json package to encode/decode.
 //
 // See: Marshal and Unmarshal.
-func (cl *Client) Do(ctx context.Context, method, typ string, session bool, query url.Values, msg, v interface{}) error {
+func (cl *Client) Do(ctx context.Context, method, typ string, session bool, query url.Values, msg, v interface{}) (err error) {
 	// marshal
 	var body io.Reader
 	if msg != nil {
-		var err error
 		if body, err = cl.Marshal(msg); err != nil {
 			return err
 		}
 	}
+	// trace and measure
+	name, reqSize, statusCode, resSize, start := operationName(method, typ), -1, 0, -1, time.Now()
+	if l, ok := body.(interface{ Len() int }); ok {
+		reqSize = l.Len()
+	}
+	ctx, span := cl.startSpan(ctx, name, method, typ, reqSize)
+	defer func() {
+		var cerr *ClientError
+		if errors.As(err, &cerr) {
+			statusCode = cerr.StatusCode
+		}
+		cl.metrics.HttpRequest(name, statusCode, reqSize, resSize, time.Since(start), err)
+		endSpan(span, err)
+	}()
 	// build request
 	req, err := cl.BuildRequest(ctx, method, typ, query, body)
 	if err != nil {
 		return err
 	}
+	inject(ctx, propagation.HeaderCarrier(req.Header))
+	if md := MetadataFrom(ctx); cl.metadata != nil && len(md) != 0 {
+		cl.metadata.InjectHeader(md, req.Header)
+	}
 	// refresh
 	if session && cl.refreshAuto {
 		if err := cl.SessionRefresh(ctx); err != nil {
@@ -190,12 +286,9 @@ func (cl *Client) Do(ctx context.Context, method, typ string, session bool, quer
 		}
 	}
 	// check active session
-	switch {
-	case session && cl.session == nil:
-		// error here ?
-	case session && cl.session != nil:
+	if token := cl.SessionToken(); session && token != "" {
 		// add auth token
-		req.Header.Set("Authorization", "Bearer "+cl.session.Token)
+		req.Header.Set("Authorization", "Bearer "+token)
 	}
 	// exec
 	res, err := cl.Exec(req)
@@ -203,6 +296,8 @@ func (cl *Client) Do(ctx context.Context, method, typ string, session bool, quer
 		return err
 	}
 	defer res.Body.Close()
+	statusCode, resSize = res.StatusCode, int(res.ContentLength)
+	span.SetAttributes(attribute.Int("http.status_code", res.StatusCode))
 	if v == nil {
 		return nil
 	}
@@ -210,10 +305,27 @@ func (cl *Client) Do(ctx context.Context, method, typ string, session bool, quer
 	return cl.Unmarshal(res.Body, v)
 }
 
+// operationName returns the operation name for the http method and type, as
+// the name of the equivalent gRPC method (ie, "GetAccount"), or the method and
+// type when there is no equivalent.
+func operationName(method, typ string) string {
+	if r, _ := grpcMatch(method, typ); r != nil {
+		return r.name
+	}
+	return method + " " + typ
+}
+
 // Marshal marshals v. If v is a proto.Message, will use Protobuf's
-// google.golang.org/protobuf/encoding/protojson package to encode the message,
-// otherwise uses Go's encoding/json package.
+// google.golang.org/protobuf/encoding/protojson package to encode the message.
+// If v is a string or []byte, it is used as is. Otherwise uses Go's
+// encoding/json package.
 func (cl *Client) Marshal(v interface{}) (io.Reader, error) {
+	switch z := v.(type) {
+	case string:
+		return strings.NewReader(z), nil
+	case []byte:
+		return bytes.NewReader(z), nil
+	}
 	// protojson encode
 	msg, ok := v.(proto.Message)
 	if ok {
@@ -235,9 +347,26 @@ func (cl *Client) Marshal(v interface{}) (io.Reader, error) {
 }
 
 // Unmarshal unmarshals r to v. If v is a proto.Message, will use Protobuf's
-// google.golang.org/protobuf/encoding/protojson package to decode the message,
-// otherwise uses Go's encoding/json package.
+// google.golang.org/protobuf/encoding/protojson package to decode the message.
+// If v is a *string or *[]byte, it is set to the raw contents of r. Otherwise
+// uses Go's encoding/json package.
 func (cl *Client) Unmarshal(r io.Reader, v interface{}) error {
+	switch z := v.(type) {
+	case *string:
+		buf, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		*z = string(buf)
+		return nil
+	case *[]byte:
+		buf, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		*z = buf
+		return nil
+	}
 	// protojson decode
 	if msg, ok := v.(proto.Message); ok {
 		buf, err := ioutil.ReadAll(r)
@@ -287,8 +416,42 @@ func (cl *Client) UnmarshalBytes(buf []byte, v interface{}) error {
 }
 */
 
-// SessionStart starts a session.
+// SessionStart starts a session, saving it to the session store (if any).
 func (cl *Client) SessionStart(session *SessionResponse) error {
+	if err := cl.sessionStart(session); err != nil {
+		return err
+	}
+	if cl.store != nil {
+		if err := cl.store.Save(session); err != nil {
+			cl.logger.Log(LevelWarn, "unable to save session", "err", err)
+		}
+	}
+	return nil
+}
+
+// SessionRestore restores the session from the session store, returning true
+// when a session was restored. A stored session with an expired refresh
+// token is cleared from the store.
+func (cl *Client) SessionRestore() (bool, error) {
+	if cl.store == nil {
+		return false, nil
+	}
+	session, err := cl.store.Load()
+	if err != nil || session == nil {
+		return false, err
+	}
+	if err := cl.sessionStart(session); err != nil {
+		return false, err
+	}
+	if cl.SessionRefreshExpired() {
+		cl.sessionEnd()
+		return false, nil
+	}
+	return true, nil
+}
+
+// sessionStart starts a session.
+func (cl *Client) sessionStart(session *SessionResponse) error {
 	expiry, expiryGraced, err := ParseTokenExpiry(session.Token, "session", cl.expiryGrace)
 	if err != nil {
 		return fmt.Errorf("unable to start session: %w", err)
@@ -297,23 +460,47 @@ func (cl *Client) SessionStart(session *SessionResponse) error {
 	if err != nil {
 		return fmt.Errorf("unable to start session: %w", err)
 	}
+	claims, err := parseToken(session.Token, "session")
+	if err != nil {
+		return fmt.Errorf("unable to start session: %w", err)
+	}
 	cl.rw.Lock()
-	defer cl.rw.Unlock()
+	prev := cl.session
+	cl.userId = claims.UserId
 	cl.session, cl.expiry, cl.expiryGraced, cl.expiryRefresh, cl.expiryRefreshGraced = session, expiry, expiryGraced, expiryRefresh, expiryRefreshGraced
+	select {
+	case cl.sessionc <- struct{}{}:
+	default:
+	}
+	cl.rw.Unlock()
+	if prev != nil && prev.Token != session.Token {
+		cl.tokenHandlers.dispatch(session.Token)
+	}
 	return nil
 }
 
-// SessionRefresh refreshes auth token for the session.
+// OnTokenRefresh adds a callback called with the new session token when the
+// session token is rotated, such as when the session is refreshed. The
+// callback is removed when the context is closed. Satisfies the
+// TokenProvider interface.
+func (cl *Client) OnTokenRefresh(ctx context.Context, f func(token string)) {
+	cl.tokenHandlers.add(ctx, f)
+}
+
+// SessionRefresh refreshes auth token for the session. Concurrent calls are
+// serialized, so that the session is only refreshed once.
 func (cl *Client) SessionRefresh(ctx context.Context) error {
+	cl.refresh.Lock()
+	defer cl.refresh.Unlock()
 	switch {
-	case cl.session == nil:
+	case cl.SessionToken() == "":
 		return fmt.Errorf("unable to refresh session: no active session")
 	case !cl.SessionExpired():
 		return nil
 	case cl.SessionRefreshExpired():
 		return fmt.Errorf("unable to refresh session: refresh token expired")
 	}
-	res, err := SessionRefresh(cl.session.RefreshToken).Do(ctx, cl)
+	res, err := SessionRefresh(cl.SessionRefreshToken()).Do(ctx, cl)
 	if err != nil {
 		return fmt.Errorf("unable to refresh session: %w", err)
 	}
@@ -325,16 +512,34 @@ func (cl *Client) SessionRefresh(ctx context.Context) error {
 
 // SessionLogout logs out the session.
 func (cl *Client) SessionLogout(ctx context.Context) error {
-	cl.rw.Lock()
-	defer cl.rw.Unlock()
-	if cl.session == nil {
+	token, refreshToken := cl.SessionToken(), cl.SessionRefreshToken()
+	if token == "" {
 		return nil
 	}
-	_ = SessionLogout(cl.session.Token, cl.session.RefreshToken).Do(ctx, cl)
-	cl.session, cl.expiry, cl.expiryGraced, cl.expiryRefresh, cl.expiryRefreshGraced = nil, time.Time{}, time.Time{}, time.Time{}, time.Time{}
+	_ = SessionLogout(token, refreshToken).Do(ctx, cl)
+	cl.sessionEnd()
 	return nil
 }
 
+// SessionClear clears the session, and the session store (if any), without
+// logging out the session.
+func (cl *Client) SessionClear() {
+	cl.sessionEnd()
+}
+
+// sessionEnd clears the session, and the session store (if any).
+func (cl *Client) sessionEnd() {
+	cl.rw.Lock()
+	cl.userId = ""
+	cl.session, cl.expiry, cl.expiryGraced, cl.expiryRefresh, cl.expiryRefreshGraced = nil, time.Time{}, time.Time{}, time.Time{}, time.Time{}
+	cl.rw.Unlock()
+	if cl.store != nil {
+		if err := cl.store.Clear(); err != nil {
+			cl.logger.Log(LevelWarn, "unable to clear session", "err", err)
+		}
+	}
+}
+
 // SessionToken returns the session token.
 func (cl *Client) SessionToken() string {
 	cl.rw.RLock()
@@ -347,32 +552,113 @@ func (cl *Client) SessionToken() string {
 
 // SessionRefreshToken returns the session refresh token.
 func (cl *Client) SessionRefreshToken() string {
+	cl.rw.RLock()
+	defer cl.rw.RUnlock()
 	if cl.session != nil {
 		return cl.session.RefreshToken
 	}
 	return ""
 }
 
+// SessionUserId returns the session user id.
+func (cl *Client) SessionUserId() string {
+	cl.rw.RLock()
+	defer cl.rw.RUnlock()
+	return cl.userId
+}
+
 // SessionExpiry returns the session expiry time.
 func (cl *Client) SessionExpiry() time.Time {
+	cl.rw.RLock()
+	defer cl.rw.RUnlock()
 	return cl.expiry
 }
 
 // SessionRefreshExpiry returns the session refresh expiry time.
 func (cl *Client) SessionRefreshExpiry() time.Time {
+	cl.rw.RLock()
+	defer cl.rw.RUnlock()
 	return cl.expiryRefresh
 }
 
 // SessionExpired returns whether or not the session is expired.
 func (cl *Client) SessionExpired() bool {
+	cl.rw.RLock()
+	defer cl.rw.RUnlock()
 	return cl.session == nil || cl.expiry.IsZero() || time.Now().After(cl.expiryGraced)
 }
 
 // SessionRefreshExpired returns whether or not the session refresh token is expired.
 func (cl *Client) SessionRefreshExpired() bool {
+	cl.rw.RLock()
+	defer cl.rw.RUnlock()
 	return cl.session == nil || cl.expiryRefresh.IsZero() || time.Now().After(cl.expiryRefreshGraced)
 }
 
+// Session returns the current session, or nil when there is no active
+// session.
+func (cl *Client) Session() *Session {
+	cl.rw.RLock()
+	defer cl.rw.RUnlock()
+	if cl.session == nil {
+		return nil
+	}
+	return &Session{
+		Token:         cl.session.Token,
+		RefreshToken:  cl.session.RefreshToken,
+		Created:       cl.session.Created,
+		UserId:        cl.userId,
+		Expiry:        cl.expiry,
+		RefreshExpiry: cl.expiryRefresh,
+	}
+}
+
+// StartSessionRefresher starts a goroutine that refreshes the session before
+// the session token expires (see WithExpiryGrace), until the context is
+// closed. Realtime connections created by the client use the refreshed
+// session token when reconnecting.
+func (cl *Client) StartSessionRefresher(ctx context.Context) {
+	go cl.runSessionRefresher(ctx)
+}
+
+// runSessionRefresher refreshes the session before the session token expires.
+func (cl *Client) runSessionRefresher(ctx context.Context) {
+	const backoffMin, backoffMax = 1 * time.Second, 30 * time.Second
+	backoff := backoffMin
+	for {
+		// wait for a session, or the refresh time
+		var wait <-chan time.Time
+		cl.rw.RLock()
+		if cl.session != nil && time.Now().Before(cl.expiryRefreshGraced) {
+			wait = time.After(time.Until(cl.expiryGraced))
+		}
+		cl.rw.RUnlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-cl.sessionc:
+			continue
+		case <-wait:
+		}
+		if err := cl.SessionRefresh(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			cl.Log(LevelError, "unable to refresh session", "err", err, "backoff", backoff)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > backoffMax {
+				backoff = backoffMax
+			}
+			continue
+		}
+		backoff = backoffMin
+	}
+}
+
 // NewConn creates a new a nakama realtime websocket connection, and runs until
 // the context is closed.
 func (cl *Client) NewConn(ctx context.Context, opts ...ConnOption) (*Conn, error) {
@@ -389,6 +675,22 @@ func (cl *Client) AccountAsync(ctx context.Context, f func(*AccountResponse, err
 	Account().Async(ctx, cl, f)
 }
 
+// DeleteAccount deletes the user's account, ending the session.
+func (cl *Client) DeleteAccount(ctx context.Context) error {
+	if err := DeleteAccount().Do(ctx, cl); err != nil {
+		return err
+	}
+	cl.sessionEnd()
+	return nil
+}
+
+// DeleteAccountAsync deletes the user's account, ending the session.
+func (cl *Client) DeleteAccountAsync(ctx context.Context, f func(error)) {
+	go func() {
+		f(cl.DeleteAccount(ctx))
+	}()
+}
+
 // Healthcheck checks the health of the server.
 func (cl *Client) Healthcheck(ctx context.Context) error {
 	return Healthcheck().Do(ctx, cl)
@@ -429,6 +731,27 @@ func (cl *Client) AddFriendsUsernamesAsync(ctx context.Context, usernames []stri
 	AddFriends().WithUsernames(usernames...).Async(ctx, cl, f)
 }
 
+// Authenticate authenticates a user with the authenticate request, starting
+// the session. Use to authenticate with options not exposed by the other
+// Authenticate methods, such as vars:
+//
+//	err := cl.Authenticate(ctx, nakama.AuthenticateDevice(id).WithCreate(true).WithVars(vars))
+func (cl *Client) Authenticate(ctx context.Context, req Authenticator) error {
+	res, err := req.Do(ctx, cl)
+	if err != nil {
+		return err
+	}
+	return cl.SessionStart(res)
+}
+
+// AuthenticateAsync authenticates a user with the authenticate request,
+// starting the session.
+func (cl *Client) AuthenticateAsync(ctx context.Context, req Authenticator, f func(err error)) {
+	go func() {
+		f(cl.Authenticate(ctx, req))
+	}()
+}
+
 // AuthenticateApple authenticates a user with a Apple token.
 func (cl *Client) AuthenticateApple(ctx context.Context, token string, create bool, username string) error {
 	res, err := AuthenticateApple(token).
@@ -772,6 +1095,18 @@ func (cl *Client) EventAsync(ctx context.Context, req *EventRequest, f func(erro
 	req.Async(ctx, cl, f)
 }
 
+// SendEvent sends an event with the name and properties, timestamped with the
+// current time.
+func (cl *Client) SendEvent(ctx context.Context, name string, properties map[string]string, external bool) error {
+	return Event(name).WithProperties(properties).WithTimestamp(time.Now()).WithExternal(external).Do(ctx, cl)
+}
+
+// SendEventAsync sends an event with the name and properties, timestamped with
+// the current time.
+func (cl *Client) SendEventAsync(ctx context.Context, name string, properties map[string]string, external bool, f func(error)) {
+	Event(name).WithProperties(properties).WithTimestamp(time.Now()).WithExternal(external).Async(ctx, cl, f)
+}
+
 // ImportFacebookFriends imports Facebook friends.
 func (cl *Client) ImportFacebookFriends(ctx context.Context, token string, reset bool) error {
 	return ImportFacebookFriends(token).WithReset(reset).Do(ctx, cl)
@@ -812,6 +1147,16 @@ func (cl *Client) UsersUsernamesAsync(ctx context.Context, usernames []string, f
 	Users().WithUsernames(usernames...).Async(ctx, cl, f)
 }
 
+// UsersFacebookIds retrieves users by Facebook id.
+func (cl *Client) UsersFacebookIds(ctx context.Context, facebookIds ...string) (*UsersResponse, error) {
+	return Users().WithFacebookIds(facebookIds...).Do(ctx, cl)
+}
+
+// UsersFacebookIdsAsync retrieves users by Facebook id.
+func (cl *Client) UsersFacebookIdsAsync(ctx context.Context, facebookIds []string, f func(*UsersResponse, error)) {
+	Users().WithFacebookIds(facebookIds...).Async(ctx, cl, f)
+}
+
 // JoinGroup joins a group.
 func (cl *Client) JoinGroup(ctx context.Context, groupId string) error {
 	return JoinGroup(groupId).Do(ctx, cl)
@@ -857,6 +1202,24 @@ func (cl *Client) ChannelMessages(ctx context.Context, req *ChannelMessagesReque
 	return req.Do(ctx, cl)
 }
 
+// ChannelMessagesList retrieves a page of a channel's messages.
+func (cl *Client) ChannelMessagesList(ctx context.Context, channelId string, limit int, forward bool, cursor string) (*ChannelMessagesResponse, error) {
+	return ChannelMessages(channelId).
+		WithLimit(limit).
+		WithForward(forward).
+		WithCursor(cursor).
+		Do(ctx, cl)
+}
+
+// ChannelHistory returns a pager for a channel's messages, paging backwards
+// from the most recent message.
+func (cl *Client) ChannelHistory(channelId string, limit int) *Pager[*ChannelMessagesResponse] {
+	return ChannelMessages(channelId).
+		WithLimit(limit).
+		WithForward(false).
+		Pager(cl)
+}
+
 // ChannelMessagesAsync retrieves a channel's messages.
 func (cl *Client) ChannelMessagesAsync(ctx context.Context, req *ChannelMessagesRequest, f func(*ChannelMessagesResponse, error)) {
 	req.Async(ctx, cl, f)
@@ -1029,11 +1392,78 @@ func (cl *Client) MatchesAsync(ctx context.Context, req *MatchesRequest, f func(
 	req.Async(ctx, cl, f)
 }
 
+// MatchesList retrieves matches using the specified parameters. An empty label
+// or query will not be sent.
+func (cl *Client) MatchesList(ctx context.Context, limit int, authoritative bool, label string, minSize, maxSize int, query string) (*MatchesResponse, error) {
+	return matchesList(limit, authoritative, label, minSize, maxSize, query).Do(ctx, cl)
+}
+
+// MatchesListAsync retrieves matches using the specified parameters.
+func (cl *Client) MatchesListAsync(ctx context.Context, limit int, authoritative bool, label string, minSize, maxSize int, query string, f func(*MatchesResponse, error)) {
+	matchesList(limit, authoritative, label, minSize, maxSize, query).Async(ctx, cl, f)
+}
+
+// MatchesIter returns an iterator over the matches using the specified
+// parameters. See MatchesRequest.Iter.
+func (cl *Client) MatchesIter(limit int, authoritative bool, label string, minSize, maxSize int, query string) *MatchIterator {
+	return matchesList(limit, authoritative, label, minSize, maxSize, query).Iter(cl)
+}
+
+// matchesList builds a matches request.
+func matchesList(limit int, authoritative bool, label string, minSize, maxSize int, query string) *MatchesRequest {
+	req := Matches().
+		WithLimit(limit).
+		WithAuthoritative(authoritative).
+		WithMinSize(minSize).
+		WithMaxSize(maxSize)
+	if label != "" {
+		req = req.WithLabel(label)
+	}
+	if query != "" {
+		req = req.WithQuery(query)
+	}
+	return req
+}
+
 // Notifications retrieves notifications.
 func (cl *Client) Notifications(ctx context.Context, req *NotificationsRequest) (*NotificationsResponse, error) {
 	return req.Do(ctx, cl)
 }
 
+// NotificationsSince retrieves all notifications after the cacheable cursor,
+// returning the cacheable cursor to use to retrieve later notifications. When
+// the cacheable cursor is empty, all notifications are retrieved.
+func (cl *Client) NotificationsSince(ctx context.Context, cacheableCursor string) ([]*Notification, string, error) {
+	const limit = 100
+	var notifications []*Notification
+	for {
+		res, err := Notifications().
+			WithLimit(limit).
+			WithCacheableCursor(cacheableCursor).
+			Do(ctx, cl)
+		if err != nil {
+			return nil, "", err
+		}
+		notifications = append(notifications, res.Notifications...)
+		// stop when the page is not full, or the cursor does not advance
+		if len(res.Notifications) < limit || res.CacheableCursor == "" || res.CacheableCursor == cacheableCursor {
+			if res.CacheableCursor != "" {
+				cacheableCursor = res.CacheableCursor
+			}
+			return notifications, cacheableCursor, nil
+		}
+		cacheableCursor = res.CacheableCursor
+	}
+}
+
+// NotificationsSinceAsync retrieves all notifications after the cacheable
+// cursor.
+func (cl *Client) NotificationsSinceAsync(ctx context.Context, cacheableCursor string, f func([]*Notification, string, error)) {
+	go func() {
+		f(cl.NotificationsSince(ctx, cacheableCursor))
+	}()
+}
+
 // NotificationsAsync retrieves notifications.
 func (cl *Client) NotificationsAsync(ctx context.Context, req *NotificationsRequest, f func(*NotificationsResponse, error)) {
 	req.Async(ctx, cl, f)
@@ -1251,6 +1681,61 @@ func (cl *Client) ValidatePurchaseHuaweiAsync(ctx context.Context, purchase, sig
 	ValidatePurchaseHuawei(purchase, signature).WithPersist(persist).Async(ctx, cl, f)
 }
 
+// ValidatePurchaseGoogleReceipt validates a Google purchase receipt.
+func (cl *Client) ValidatePurchaseGoogleReceipt(ctx context.Context, receipt GoogleReceipt, persist bool) (*ValidatePurchaseResponse, error) {
+	return ValidatePurchaseGoogle(receipt.String()).WithPersist(persist).Do(ctx, cl)
+}
+
+// ValidatePurchaseHuaweiReceipt validates a Huawei purchase receipt.
+func (cl *Client) ValidatePurchaseHuaweiReceipt(ctx context.Context, receipt HuaweiReceipt, persist bool) (*ValidatePurchaseResponse, error) {
+	return ValidatePurchaseHuawei(receipt.PurchaseData, receipt.Signature).WithPersist(persist).Do(ctx, cl)
+}
+
+// ValidateSubscriptionApple validates a Apple subscription.
+func (cl *Client) ValidateSubscriptionApple(ctx context.Context, receipt string, persist bool) (*ValidateSubscriptionResponse, error) {
+	return ValidateSubscriptionApple(receipt).WithPersist(persist).Do(ctx, cl)
+}
+
+// ValidateSubscriptionAppleAsync validates a Apple subscription.
+func (cl *Client) ValidateSubscriptionAppleAsync(ctx context.Context, receipt string, persist bool, f func(*ValidateSubscriptionResponse, error)) {
+	ValidateSubscriptionApple(receipt).WithPersist(persist).Async(ctx, cl, f)
+}
+
+// ValidateSubscriptionGoogle validates a Google subscription.
+func (cl *Client) ValidateSubscriptionGoogle(ctx context.Context, receipt string, persist bool) (*ValidateSubscriptionResponse, error) {
+	return ValidateSubscriptionGoogle(receipt).WithPersist(persist).Do(ctx, cl)
+}
+
+// ValidateSubscriptionGoogleAsync validates a Google subscription.
+func (cl *Client) ValidateSubscriptionGoogleAsync(ctx context.Context, receipt string, persist bool, f func(*ValidateSubscriptionResponse, error)) {
+	ValidateSubscriptionGoogle(receipt).WithPersist(persist).Async(ctx, cl, f)
+}
+
+// ValidateSubscriptionGoogleReceipt validates a Google subscription receipt.
+func (cl *Client) ValidateSubscriptionGoogleReceipt(ctx context.Context, receipt GoogleReceipt, persist bool) (*ValidateSubscriptionResponse, error) {
+	return ValidateSubscriptionGoogle(receipt.String()).WithPersist(persist).Do(ctx, cl)
+}
+
+// Subscriptions retrieves the user's validated subscriptions.
+func (cl *Client) Subscriptions(ctx context.Context, req *SubscriptionsRequest) (*SubscriptionsResponse, error) {
+	return req.Do(ctx, cl)
+}
+
+// SubscriptionsAsync retrieves the user's validated subscriptions.
+func (cl *Client) SubscriptionsAsync(ctx context.Context, req *SubscriptionsRequest, f func(*SubscriptionsResponse, error)) {
+	req.Async(ctx, cl, f)
+}
+
+// Subscription retrieves the user's validated subscription for a product.
+func (cl *Client) Subscription(ctx context.Context, productId string) (*SubscriptionResponse, error) {
+	return Subscription(productId).Do(ctx, cl)
+}
+
+// SubscriptionAsync retrieves the user's validated subscription for a product.
+func (cl *Client) SubscriptionAsync(ctx context.Context, productId string, f func(*SubscriptionResponse, error)) {
+	Subscription(productId).Async(ctx, cl, f)
+}
+
 // WriteLeaderboardRecord writes a leaderboard record.
 func (cl *Client) WriteLeaderboardRecord(ctx context.Context, req *WriteLeaderboardRecordRequest) (*WriteLeaderboardRecordResponse, error) {
 	return req.Do(ctx, cl)
@@ -1291,6 +1776,48 @@ func WithURL(urlstr string) Option {
 	}
 }
 
+// WithServer is a nakama client option to set the url from the server's host,
+// port, ssl, and path prefix (such as when nakama is served behind a reverse
+// proxy). A port of 0 uses the scheme's default port. The websocket url is
+// derived from the url (see SocketURL).
+func WithServer(host string, port int, ssl bool, path string) Option {
+	return func(cl *Client) {
+		u := &url.URL{
+			Scheme: "http",
+			Host:   host,
+			Path:   path,
+		}
+		if ssl {
+			u.Scheme = "https"
+		}
+		if port != 0 {
+			u.Host = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+		if u.Path != "" && !strings.HasPrefix(u.Path, "/") {
+			u.Path = "/" + u.Path
+		}
+		cl.url = u.String()
+	}
+}
+
+// WithSSL is a nakama client option to set whether or not the url uses https
+// (and the websocket url uses wss).
+func WithSSL(ssl bool) Option {
+	return func(cl *Client) {
+		u, err := url.Parse(cl.url)
+		if err != nil {
+			return
+		}
+		switch {
+		case ssl && u.Scheme == "http":
+			u.Scheme = "https"
+		case !ssl && u.Scheme == "https":
+			u.Scheme = "http"
+		}
+		cl.url = u.String()
+	}
+}
+
 // WithServerKey is a nakama client option to set the server key used.
 func WithServerKey(serverKey string) Option {
 	return func(cl *Client) {
@@ -1298,6 +1825,29 @@ func WithServerKey(serverKey string) Option {
 	}
 }
 
+// WithHttpKey is a nakama client option to set the http key used for remote
+// procedure calls when there is no active session.
+func WithHttpKey(httpKey string) Option {
+	return func(cl *Client) {
+		cl.httpKey = httpKey
+	}
+}
+
+// WithServerMode is a nakama client option for server-to-server usage, such
+// as backend tools calling the server directly. Remote procedure calls are
+// authenticated with the runtime http key, even when the client has an active
+// session. Authenticate requests continue to use the server key (see
+// WithServerKey), so users can be created and authenticated as usual.
+//
+// Nakama only accepts the http key for remote procedure calls: other endpoints
+// (such as Account) require a user session, obtained by authenticating.
+func WithServerMode(httpKey string) Option {
+	return func(cl *Client) {
+		cl.httpKey = httpKey
+		cl.serverMode = true
+	}
+}
+
 // WithUsername is a nakama client option to set the username used.
 func WithUsername(username string) Option {
 	return func(cl *Client) {
@@ -1352,71 +1902,297 @@ func WithTransport(transport http.RoundTripper) Option {
 	}
 }
 
-// WithLogger is a nakama client option to set a logger.
+// WithSessionStore is a nakama client option to set the session store used
+// to persist the session. The stored session is restored when the client is
+// created, and started and refreshed sessions are saved automatically.
+func WithSessionStore(store SessionStore) Option {
+	return func(cl *Client) {
+		cl.store = store
+	}
+}
+
+// WithRetries is a nakama client option to set the maximum number of times a
+// failed http request is retried. Retries are disabled by default.
+func WithRetries(retries int) Option {
+	return func(cl *Client) {
+		cl.retries = retries
+	}
+}
+
+// WithRetryBackoff is a nakama client option to set the backoff used between
+// retried http requests.
+func WithRetryBackoff(backoff Backoff) Option {
+	return func(cl *Client) {
+		cl.retryBackoff = backoff
+	}
+}
+
+// WithRetryNonIdempotent is a nakama client option to set whether or not to
+// retry non-idempotent (ie, POST) http requests.
+func WithRetryNonIdempotent(retryNonIdempotent bool) Option {
+	return func(cl *Client) {
+		cl.retryNonIdempotent = retryNonIdempotent
+	}
+}
+
+// WithLogger is a nakama client option to set a printf style logger. Debug
+// messages, such as each http request and realtime message, are not logged.
+// To log debug messages, use WithStructuredLogger with NewLogfLogger.
 func WithLogger(f func(string, ...interface{})) Option {
 	return func(cl *Client) {
-		cl.logf = f
+		cl.logger = NewLogfLogger(f, LevelInfo)
 	}
 }
 
-// ParseTokenExpiry parse the exp field on a jwt token.
-func ParseTokenExpiry(tokenstr, typ string, grace time.Duration) (time.Time, time.Time, error) {
-	if tokenstr == "" {
-		return time.Time{}, time.Time{}, fmt.Errorf("empty %s token", typ)
+// WithMetrics is a nakama client option to set the metrics used to measure
+// http requests.
+func WithMetrics(metrics Metrics) Option {
+	return func(cl *Client) {
+		cl.metrics = metrics
 	}
-	// split
-	token := strings.Split(tokenstr, ".")
-	if len(token) != 3 {
-		return time.Time{}, time.Time{}, fmt.Errorf("invalid %s token jwt encoding", typ)
+}
+
+// WithStructuredLogger is a nakama client option to set a structured logger.
+func WithStructuredLogger(logger Logger) Option {
+	return func(cl *Client) {
+		cl.logger = logger
 	}
-	// decode
-	buf, err := base64.RawStdEncoding.DecodeString(token[1])
-	if err != nil {
-		return time.Time{}, time.Time{}, fmt.Errorf("invalid %s token encoding: %w", typ, err)
+}
+
+// Backoff returns the delay to wait before a retry attempt, starting at 1.
+type Backoff func(attempt int) time.Duration
+
+// ExponentialBackoff creates a backoff that doubles from min to max, with a
+// random jitter of up to half the delay.
+func ExponentialBackoff(min, max time.Duration) Backoff {
+	return func(attempt int) time.Duration {
+		d := min
+		for i := 1; i < attempt && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+		return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
 	}
-	// unmarshal
-	var v struct {
-		Exp int64 `json:"exp"`
+}
+
+// ConstantBackoff creates a backoff with a constant delay.
+func ConstantBackoff(d time.Duration) Backoff {
+	return func(int) time.Duration {
+		return d
 	}
-	switch err := json.NewDecoder(bytes.NewReader(buf)).Decode(&v); {
-	case err != nil:
-		return time.Time{}, time.Time{}, fmt.Errorf("cannot decode %s token: %w", typ, err)
-	case v.Exp == 0:
+}
+
+// idempotentKey is the context key for marking requests as idempotent.
+type idempotentKey struct{}
+
+// Idempotent returns a context that marks http requests made with it as safe
+// to retry, regardless of the request method, and realtime requests as safe to
+// resend after reconnecting (see WithConnRetry).
+func Idempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+// isIdempotent returns true when the request is safe to retry.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	}
+	v, _ := req.Context().Value(idempotentKey{}).(bool)
+	return v
+}
+
+// isRetryableStatus returns true when the http status code is retryable.
+func isRetryableStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || 500 <= statusCode && statusCode <= 599
+}
+
+// parseRetryAfter parses a Retry-After header value, in either seconds or as a
+// http date.
+func parseRetryAfter(s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	if n, err := strconv.Atoi(s); err == nil && n > 0 {
+		return time.Duration(n) * time.Second
+	}
+	if t, err := http.ParseTime(s); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// Session is a nakama session.
+type Session struct {
+	Token         string
+	RefreshToken  string
+	Created       bool
+	UserId        string
+	Expiry        time.Time
+	RefreshExpiry time.Time
+}
+
+// ParseTokenExpiry parse the exp field on a jwt token.
+func ParseTokenExpiry(tokenstr, typ string, grace time.Duration) (time.Time, time.Time, error) {
+	claims, err := parseToken(tokenstr, typ)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if claims.Exp == 0 {
 		return time.Time{}, time.Time{}, fmt.Errorf("%s token expiry cannot be 0", typ)
 	}
 	// check
-	expiry := time.Unix(v.Exp, 0)
+	expiry := time.Unix(claims.Exp, 0)
 	expiryGraced := expiry.Add(-grace)
 	now := time.Now()
 	switch {
 	case now.After(expiry):
-		return time.Time{}, time.Time{}, fmt.Errorf("%s token expiry (%s [%d]) is in the past", typ, expiry, v.Exp)
+		return time.Time{}, time.Time{}, fmt.Errorf("%s token expiry (%s [%d]) is in the past", typ, expiry, claims.Exp)
 	case grace != 0 && now.After(expiryGraced):
-		return time.Time{}, time.Time{}, fmt.Errorf("%s token expiry (%s [%d]) is after the grace expiry (%s)", typ, expiry, v.Exp, grace)
+		return time.Time{}, time.Time{}, fmt.Errorf("%s token expiry (%s [%d]) is after the grace expiry (%s)", typ, expiry, claims.Exp, grace)
 	}
 	return expiry, expiryGraced, nil
 }
 
-// ClientError is a client error.
+// tokenClaims are the nakama jwt token claims.
+type tokenClaims struct {
+	UserId   string `json:"uid"`
+	Username string `json:"usn"`
+	Exp      int64  `json:"exp"`
+}
+
+// parseToken parses the claims of a jwt token.
+func parseToken(tokenstr, typ string) (*tokenClaims, error) {
+	if tokenstr == "" {
+		return nil, fmt.Errorf("empty %s token", typ)
+	}
+	// split
+	token := strings.Split(tokenstr, ".")
+	if len(token) != 3 {
+		return nil, fmt.Errorf("invalid %s token jwt encoding", typ)
+	}
+	// decode
+	buf, err := base64.RawURLEncoding.DecodeString(token[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s token encoding: %w", typ, err)
+	}
+	// unmarshal
+	claims := new(tokenClaims)
+	if err := json.NewDecoder(bytes.NewReader(buf)).Decode(claims); err != nil {
+		return nil, fmt.Errorf("cannot decode %s token: %w", typ, err)
+	}
+	return claims, nil
+}
+
+// ClientError is a client error, parsed from a Nakama error response.
 type ClientError struct {
 	StatusCode int
 	Code       codes.Code `json:"code"`
 	Message    string     `json:"message"`
 }
 
-// NewClientErrorFromReader reads a client error from a reader.
+// NewClientErrorFromReader reads a client error from a reader. When the
+// response body is not a Nakama error payload, the code is derived from the
+// http status code, and the message is the body's text.
 func NewClientErrorFromReader(statusCode int, r io.Reader) error {
-	dec := json.NewDecoder(r)
-	err := &ClientError{
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("status %d != 200 (and unable to read error: %w)", statusCode, err)
+	}
+	var v struct {
+		Code    codes.Code `json:"code"`
+		Message string     `json:"message"`
+		Error   string     `json:"error"`
+	}
+	if err := json.Unmarshal(buf, &v); err != nil {
+		v.Code, v.Message = 0, strings.TrimSpace(string(buf))
+	}
+	if v.Code == codes.OK {
+		v.Code = httpStatusCode(statusCode)
+	}
+	if v.Message == "" {
+		v.Message = v.Error
+	}
+	if v.Message == "" {
+		v.Message = http.StatusText(statusCode)
+	}
+	return &ClientError{
 		StatusCode: statusCode,
+		Code:       v.Code,
+		Message:    v.Message,
 	}
-	if e := dec.Decode(err); e != nil {
-		return fmt.Errorf("status %d != 200 (and unable to decode error: %w)", statusCode, e)
+}
+
+// httpStatusCode returns the gRPC code for a http status code, the inverse of
+// grpcStatusCode.
+func httpStatusCode(statusCode int) codes.Code {
+	switch statusCode {
+	case http.StatusOK:
+		return codes.OK
+	case 499:
+		return codes.Canceled
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable, http.StatusBadGateway:
+		return codes.Unavailable
 	}
-	return err
+	return codes.Unknown
 }
 
 // Error satisfies the error interface.
 func (err *ClientError) Error() string {
 	return fmt.Sprintf("http status %d != 200: %s: %s", err.StatusCode, err.Code, err.Message)
 }
+
+// Temporary returns true when the error is transient, and the request may
+// succeed when retried.
+func (err *ClientError) Temporary() bool {
+	switch err.Code {
+	case codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded, codes.Aborted:
+		return true
+	}
+	return isRetryableStatus(err.StatusCode)
+}
+
+// Is satisfies the errors.Is interface, matching client errors with the same
+// code, such as ErrNotFound.
+func (err *ClientError) Is(target error) bool {
+	t, ok := target.(*ClientError)
+	return ok && t.Code == err.Code
+}
+
+// GRPCStatus returns the gRPC status of the error, for use with
+// status.FromError and status.Code.
+func (err *ClientError) GRPCStatus() *status.Status {
+	return status.New(err.Code, err.Message)
+}
+
+// Client error sentinels, matched by code with errors.Is.
+var (
+	ErrInvalidArgument    = &ClientError{StatusCode: http.StatusBadRequest, Code: codes.InvalidArgument, Message: "invalid argument"}
+	ErrUnauthenticated    = &ClientError{StatusCode: http.StatusUnauthorized, Code: codes.Unauthenticated, Message: "unauthenticated"}
+	ErrPermissionDenied   = &ClientError{StatusCode: http.StatusForbidden, Code: codes.PermissionDenied, Message: "permission denied"}
+	ErrNotFound           = &ClientError{StatusCode: http.StatusNotFound, Code: codes.NotFound, Message: "not found"}
+	ErrAlreadyExists      = &ClientError{StatusCode: http.StatusConflict, Code: codes.AlreadyExists, Message: "already exists"}
+	ErrFailedPrecondition = &ClientError{StatusCode: http.StatusBadRequest, Code: codes.FailedPrecondition, Message: "failed precondition"}
+	ErrResourceExhausted  = &ClientError{StatusCode: http.StatusTooManyRequests, Code: codes.ResourceExhausted, Message: "resource exhausted"}
+	ErrUnimplemented      = &ClientError{StatusCode: http.StatusNotImplemented, Code: codes.Unimplemented, Message: "unimplemented"}
+	ErrInternal           = &ClientError{StatusCode: http.StatusInternalServerError, Code: codes.Internal, Message: "internal"}
+	ErrUnavailable        = &ClientError{StatusCode: http.StatusServiceUnavailable, Code: codes.Unavailable, Message: "unavailable"}
+)
@@ -0,0 +1,248 @@
+// Command nakama-cli is an interactive command line client for exploring and
+// debugging a Nakama server.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/ascii8/nakama-go"
+	"github.com/google/uuid"
+	"github.com/heroiclabs/nakama-common/rtapi"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func main() {
+	urlstr := flag.String("url", "http://127.0.0.1:7350", "server url")
+	serverKey := flag.String("key", "defaultkey", "server key")
+	deviceId := flag.String("device", "", "device id to authenticate with (default: random)")
+	email := flag.String("email", "", "email to authenticate with")
+	password := flag.String("password", "", "password to authenticate with")
+	username := flag.String("username", "", "username for created accounts")
+	session := flag.String("session", "", "file to persist the session to")
+	format := flag.String("format", "protobuf", "realtime format (protobuf, json)")
+	verbose := flag.Bool("v", false, "enable verbose logging")
+	flag.Parse()
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	if err := run(ctx, os.Stdin, os.Stdout, *urlstr, *serverKey, *deviceId, *email, *password, *username, *session, *format, *verbose); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run runs the client.
+func run(ctx context.Context, r io.Reader, w io.Writer, urlstr, serverKey, deviceId, email, password, username, session, format string, verbose bool) error {
+	// build client
+	opts := []nakama.Option{
+		nakama.WithURL(urlstr),
+		nakama.WithServerKey(serverKey),
+	}
+	if verbose {
+		opts = append(opts, nakama.WithStructuredLogger(nakama.NewLogfLogger(log.Printf, nakama.LevelDebug)))
+	}
+	if session != "" {
+		opts = append(opts, nakama.WithSessionStore(nakama.NewFileSessionStore(session)))
+	}
+	cl := nakama.New(opts...)
+	// authenticate
+	if cl.SessionToken() == "" {
+		var err error
+		switch {
+		case email != "":
+			err = cl.AuthenticateEmail(ctx, email, password, true, username)
+		default:
+			if deviceId == "" {
+				deviceId = uuid.New().String()
+			}
+			err = cl.AuthenticateDevice(ctx, deviceId, true, username)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(w, "authenticated as %s\n", cl.SessionUserId())
+	// open socket
+	conn, err := cl.NewConn(ctx, nakama.WithConnFormat(format))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	marshaler := protojson.MarshalOptions{Multiline: true, Indent: "  "}
+	conn.OnRawEnvelope(ctx, func(env *rtapi.Envelope) bool {
+		if env.Cid == "" {
+			buf, _ := marshaler.Marshal(env)
+			fmt.Fprintf(w, "<< %s\n", buf)
+		}
+		return false
+	})
+	conn.OnStateChange(ctx, func(state nakama.ConnState) {
+		fmt.Fprintf(w, "-- %s\n", state)
+	})
+	// read commands
+	fmt.Fprintln(w, `type "help" for commands`)
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		s := bufio.NewScanner(r)
+		for s.Scan() {
+			lines <- s.Text()
+		}
+	}()
+	for {
+		fmt.Fprint(w, "> ")
+		var line string
+		select {
+		case <-ctx.Done():
+			return nil
+		case l, ok := <-lines:
+			if !ok {
+				return nil
+			}
+			line = l
+		}
+		switch err := exec(ctx, w, cl, conn, marshaler, strings.Fields(line)); {
+		case errors.Is(err, io.EOF):
+			return nil
+		case err != nil:
+			fmt.Fprintf(w, "error: %v\n", err)
+		}
+	}
+}
+
+// usage is the command usage.
+const usage = `commands:
+  account                        show the account
+  ping                           ping the server
+  join <room>                    join a chat room
+  leave <channelId>              leave a chat channel
+  say <channelId> <message>      send a chat message
+  match create [name]            create a match
+  match join <matchId>           join a match
+  match leave <matchId>          leave a match
+  match list                     list matches
+  status <status>                update the user's status
+  follow <userId>...             follow users' status
+  rpc <id> [payload]             execute a realtime rpc
+  help                           show this help
+  quit                           exit`
+
+// exec executes a command.
+func exec(ctx context.Context, w io.Writer, cl *nakama.Client, conn *nakama.Conn, marshaler protojson.MarshalOptions, args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	switch cmd, args := args[0], args[1:]; {
+	case cmd == "help":
+		fmt.Fprintln(w, usage)
+	case cmd == "quit" || cmd == "exit":
+		return io.EOF
+	case cmd == "account":
+		res, err := cl.Account(ctx)
+		if err != nil {
+			return err
+		}
+		return show(w, marshaler, res)
+	case cmd == "ping":
+		if err := conn.Ping(ctx); err != nil {
+			return err
+		}
+		_, rtt := conn.Latency()
+		fmt.Fprintf(w, "pong (rtt %s)\n", rtt)
+	case cmd == "join" && len(args) == 1:
+		res, err := conn.ChannelJoin(ctx, args[0], nakama.ChannelJoinRoom, true, false)
+		if err != nil {
+			return err
+		}
+		return show(w, marshaler, res)
+	case cmd == "leave" && len(args) == 1:
+		return conn.ChannelLeave(ctx, args[0])
+	case cmd == "say" && len(args) > 1:
+		content, err := json.Marshal(map[string]string{
+			"message": strings.Join(args[1:], " "),
+		})
+		if err != nil {
+			return err
+		}
+		res, err := conn.ChannelMessageSend(ctx, args[0], string(content))
+		if err != nil {
+			return err
+		}
+		return show(w, marshaler, res)
+	case cmd == "match" && len(args) > 0:
+		return execMatch(ctx, w, cl, conn, marshaler, args[0], args[1:])
+	case cmd == "status":
+		return conn.StatusUpdate(ctx, strings.Join(args, " "))
+	case cmd == "follow" && len(args) > 0:
+		res, err := conn.StatusFollow(ctx, args...)
+		if err != nil {
+			return err
+		}
+		return show(w, marshaler, res)
+	case cmd == "rpc" && len(args) > 0:
+		var res string
+		if err := conn.Rpc(ctx, args[0], strings.Join(args[1:], " "), &res); err != nil {
+			return err
+		}
+		fmt.Fprintln(w, res)
+	default:
+		return fmt.Errorf("invalid command %q", strings.Join(append([]string{cmd}, args...), " "))
+	}
+	return nil
+}
+
+// execMatch executes a match command.
+func execMatch(ctx context.Context, w io.Writer, cl *nakama.Client, conn *nakama.Conn, marshaler protojson.MarshalOptions, cmd string, args []string) error {
+	switch {
+	case cmd == "create":
+		res, err := conn.MatchCreate(ctx, strings.Join(args, " "))
+		if err != nil {
+			return err
+		}
+		return show(w, marshaler, res)
+	case cmd == "join" && len(args) == 1:
+		res, err := conn.MatchJoin(ctx, args[0], nil)
+		if err != nil {
+			return err
+		}
+		return show(w, marshaler, res)
+	case cmd == "leave" && len(args) == 1:
+		return conn.MatchLeave(ctx, args[0])
+	case cmd == "list":
+		res, err := cl.MatchesList(ctx, 100, false, "", 0, 0, "")
+		if err != nil {
+			return err
+		}
+		return show(w, marshaler, res)
+	}
+	return fmt.Errorf("invalid command %q", strings.Join(append([]string{"match", cmd}, args...), " "))
+}
+
+// show pretty prints the message.
+func show(w io.Writer, marshaler protojson.MarshalOptions, msg interface{}) error {
+	var buf []byte
+	var err error
+	switch v := msg.(type) {
+	case nakama.EnvelopeBuilder:
+		buf, err = marshaler.Marshal(v.BuildEnvelope())
+	case proto.Message:
+		buf, err = marshaler.Marshal(v)
+	default:
+		buf, err = json.MarshalIndent(v, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%s\n", buf)
+	return nil
+}
@@ -1,10 +1,17 @@
 package nakama
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"sort"
@@ -12,10 +19,13 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
-	nkapi "github.com/heroiclabs/nakama-common/api"
 	"github.com/heroiclabs/nakama-common/rtapi"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 	"nhooyr.io/websocket"
@@ -26,44 +36,243 @@ type Handler interface {
 	HttpClient() *http.Client
 	SocketURL() (string, error)
 	Token(context.Context) (string, error)
-	Logf(string, ...interface{})
-	Errf(string, ...interface{})
+	Logger
+}
+
+// TokenProvider is the interface for handlers that notify of session token
+// rotation, such as when the session is refreshed. See WithConnTokenRefresh.
+type TokenProvider interface {
+	OnTokenRefresh(ctx context.Context, f func(token string))
+}
+
+// ConnState is a nakama realtime websocket connection state.
+type ConnState int32
+
+// ConnState values.
+const (
+	ConnConnecting ConnState = iota
+	ConnConnected
+	ConnReconnecting
+	ConnDisconnecting
+	ConnClosed
+)
+
+// String satisfies the fmt.Stringer interface.
+func (state ConnState) String() string {
+	switch state {
+	case ConnConnecting:
+		return "connecting"
+	case ConnConnected:
+		return "connected"
+	case ConnReconnecting:
+		return "reconnecting"
+	case ConnDisconnecting:
+		return "disconnecting"
+	case ConnClosed:
+		return "closed"
+	}
+	return fmt.Sprintf("ConnState(%d)", int32(state))
 }
 
 // Conn is a nakama realtime websocket connection.
 type Conn struct {
-	h      Handler
-	url    string
-	token  string
-	binary bool
-	query  url.Values
-	conn   *websocket.Conn
-	cancel func()
-	out    chan *req
-	in     chan []byte
-	l      map[string]*req
-	rw     sync.RWMutex
-	id     uint64
+	h            Handler
+	logger       Logger
+	tracer       trace.Tracer
+	metrics      Metrics
+	stats        connStats
+	metadata     MetadataInjector
+	url          string
+	token        string
+	endpoints    []string
+	endpoint     string
+	preferred    string
+	probe        bool
+	binary       bool
+	codec        EnvelopeCodec
+	jsonMarshal  protojson.MarshalOptions
+	jsonDecode   protojson.UnmarshalOptions
+	query        url.Values
+	header       http.Header
+	tlsConfig    *tls.Config
+	proxy        func(*http.Request) (*url.URL, error)
+	protocols    []string
+	coalesce     time.Duration
+	coalesceN    int
+	wconn        *coalescingConn
+	pool         *dispatchPool
+	capture      *capture
+	trace        *wireTrace
+	persist      bool
+	singleSocket bool
+	retry        bool
+	recent       map[string]bool
+	recentl      []string
+	rejoin       bool
+	appear       bool
+	online       bool
+	status       string
+	refresh      bool
+	expiry       time.Time
+	expiryLead   time.Duration
+	socket       *disconnect
+	backoffMin   time.Duration
+	backoffMax   time.Duration
+	timeout      time.Duration
+	interval     time.Duration
+	failures     int
+	rtt          atomic.Int64
+	srtt         atomic.Int64
+	conn         *websocket.Conn
+	cancel       func()
+	closed       atomic.Bool
+	closeErr     atomic.Pointer[DisconnectReason]
+	done         chan struct{}
+	state        atomic.Int32
+	out          [numPriorities]chan *req
+	in           *inbox
+	readBuf      int
+	writeBuf     int
+	readLimit    int64
+	maxSize      int
+	pooledLimit  int
+	limit        *rateLimiter
+	matchLimit   *rateLimiter
+	opCodes      *OpCodeRegistry
+	selector     MatchSelector
+	pressure     DropPolicy
+	unknown      UnknownPolicy
+	l            map[string]*req
+	rw           sync.RWMutex
+	id           uint64
+	epoch        atomic.Uint64
+	cidGen       CidGenerator
+	beforeSend   []WireHook
+	afterReceive []WireHook
+	queueSize    int
+	queueDrop    DropPolicy
+	queue        []EnvelopeBuilder
+	rejoining    bool
+	qmu          sync.Mutex
+
+	tickets       map[string]*activeTicket
+	ticketTimeout time.Duration
+	tmu           sync.Mutex
+
+	channels map[string]*ChannelJoinMsg
+	matches  map[string]*MatchJoinMsg
+	parties  map[string]*PartyJoinMsg
+	follows  map[string]bool
+	followsu map[string]bool
+
+	rawEnvelopeHandlers           callbacks[*rawEnvelope]
+	stateHandlers                 callbacks[ConnState]
+	connectHandlers               callbacks[struct{}]
+	disconnectHandlers            callbacks[*DisconnectReason]
+	oversizeHandlers              callbacks[*MessageSizeError]
+	orphanHandlers                callbacks[*rtapi.Envelope]
+	unknownHandlers               callbacks[*rtapi.Envelope]
+	ticketHandlers                callbacks[*TicketEvent]
+	expiringHandlers              callbacks[time.Duration]
+	errorHandlers                 callbacks[*ErrorMsg]
+	channelMessageHandlers        callbacks[*ChannelMessageMsg]
+	channelPresenceEventHandlers  callbacks[*ChannelPresenceEventMsg]
+	matchDataHandlers             callbacks[*MatchDataMsg]
+	matchDataMatchHandlers        keyedCallbacks[string, *MatchDataMsg]
+	matchDataOpCodeHandlers       keyedCallbacks[matchDataKey, *MatchDataMsg]
+	matchPresenceEventHandlers    callbacks[*MatchPresenceEventMsg]
+	matchmakerMatchedHandlers     callbacks[*MatchmakerMatchedMsg]
+	notificationsHandlers         callbacks[*NotificationsMsg]
+	partyHandlers                 callbacks[*PartyMsg]
+	partyDataHandlers             callbacks[*PartyDataMsg]
+	partyJoinRequestHandlers      callbacks[*PartyJoinRequestMsg]
+	partyLeaderHandlers           callbacks[*PartyLeaderMsg]
+	partyMatchmakerTicketHandlers callbacks[*PartyMatchmakerTicketMsg]
+	partyPresenceEventHandlers    callbacks[*PartyPresenceEventMsg]
+	statusPresenceEventHandlers   callbacks[*StatusPresenceEventMsg]
+	streamDataHandlers            callbacks[*StreamDataMsg]
+	streamDataStreamHandlers      keyedCallbacks[Stream, *StreamDataMsg]
+	streamPresenceEventHandlers   callbacks[*StreamPresenceEventMsg]
+	streamPresenceStreamHandlers  keyedCallbacks[Stream, *StreamPresenceEventMsg]
 }
 
 // NewConn creates a new nakama realtime websocket connection.
 func NewConn(ctx context.Context, opts ...ConnOption) (*Conn, error) {
+	conn := newConn(opts...)
+	if err := conn.dial(ctx); err != nil {
+		conn.setState(ConnClosed)
+		return nil, err
+	}
+	conn.setState(ConnConnected)
+	// run
+	ctx, conn.cancel = context.WithCancel(ctx)
+	if conn.pool != nil {
+		conn.pool.start(ctx, conn)
+	}
+	if tp, ok := conn.h.(TokenProvider); ok && conn.refresh && conn.token == "" {
+		tp.OnTokenRefresh(ctx, conn.tokenRefreshed)
+	}
+	go conn.run(ctx)
+	return conn, nil
+}
+
+// newConn creates a new, unopened, nakama realtime websocket connection.
+func newConn(opts ...ConnOption) *Conn {
 	conn := &Conn{
-		binary: true,
-		query:  url.Values{},
-		out:    make(chan *req),
-		in:     make(chan []byte),
-		l:      make(map[string]*req),
+		binary:     true,
+		codec:      ProtoCodec,
+		jsonDecode: protojson.UnmarshalOptions{DiscardUnknown: true},
+		query:      url.Values{},
+		backoffMin: 100 * time.Millisecond,
+		backoffMax: 10 * time.Second,
+		expiryLead: 30 * time.Second,
+		pressure:   DropNone,
+		l:          make(map[string]*req),
+		done:       make(chan struct{}),
+		channels:   make(map[string]*ChannelJoinMsg),
+		matches:    make(map[string]*MatchJoinMsg),
+		parties:    make(map[string]*PartyJoinMsg),
+		follows:    make(map[string]bool),
+		followsu:   make(map[string]bool),
 	}
 	for _, o := range opts {
 		o(conn)
 	}
+	for i := range conn.out {
+		conn.out[i] = make(chan *req, conn.writeBuf)
+	}
+	conn.in = newInbox(conn.readBuf, conn.pressure)
+	if conn.metrics == nil {
+		conn.metrics = NopMetrics
+	}
+	switch {
+	case conn.logger != nil:
+	case conn.h != nil:
+		conn.logger = conn.h
+	default:
+		conn.logger = NopLogger
+	}
+	return conn
+}
+
+// client returns the connection's handler as a client, for helpers that
+// combine realtime messages with http requests.
+func (conn *Conn) client() (*Client, error) {
+	cl, ok := conn.h.(*Client)
+	if !ok {
+		return nil, errors.New("connection handler is not a client")
+	}
+	return cl, nil
+}
+
+// dial opens the websocket connection.
+func (conn *Conn) dial(ctx context.Context) error {
 	// build url
 	urlstr := conn.url
-	if urlstr == "" && conn.h != nil {
+	if urlstr == "" && len(conn.endpoints) == 0 && conn.h != nil {
 		var err error
 		if urlstr, err = conn.h.SocketURL(); err != nil {
-			return nil, err
+			return err
 		}
 	}
 	// build token
@@ -71,7 +280,7 @@ func NewConn(ctx context.Context, opts ...ConnOption) (*Conn, error) {
 	if token == "" && conn.h != nil {
 		var err error
 		if token, err = conn.h.Token(ctx); err != nil {
-			return nil, err
+			return err
 		}
 	}
 	// build query
@@ -79,6 +288,11 @@ func NewConn(ctx context.Context, opts ...ConnOption) (*Conn, error) {
 	for k, v := range conn.query {
 		query[k] = v
 	}
+	conn.rw.RLock()
+	if conn.online {
+		query.Set("status", "true")
+	}
+	conn.rw.RUnlock()
 	query.Set("token", token)
 	format := "protobuf"
 	if !conn.binary {
@@ -90,66 +304,588 @@ func NewConn(ctx context.Context, opts ...ConnOption) (*Conn, error) {
 		httpClient = conn.h.HttpClient()
 	}
 	// open socket
-	var err error
-	conn.conn, _, err = websocket.Dial(ctx, urlstr+"?"+query.Encode(), &websocket.DialOptions{
-		HTTPClient: httpClient,
-	})
+	ws, urlstr, err := conn.dialEndpoints(ctx, conn.endpointURLs(ctx, urlstr), query.Encode(), conn.dialOptions(httpClient))
 	if err != nil {
-		return nil, fmt.Errorf("unable to open nakama websocket %s: %w", urlstr, err)
+		return err
+	}
+	if conn.readLimit != 0 {
+		ws.SetReadLimit(conn.readLimit)
+	}
+	conn.rw.Lock()
+	defer conn.rw.Unlock()
+	conn.conn, conn.endpoint, conn.expiry = ws, urlstr, tokenExpiry(token)
+	if conn.wconn != nil {
+		conn.wconn.hold.Store(true)
+	}
+	return nil
+}
+
+// redial reopens the websocket connection, backing off between failed
+// attempts. Returns false when the context is closed.
+func (conn *Conn) redial(ctx context.Context) bool {
+	backoff := conn.backoffMin
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+		err := conn.dial(ctx)
+		switch {
+		case err == nil:
+			return true
+		case conn.closed.Load() || errors.Is(err, context.Canceled):
+			return false
+		}
+		conn.logger.Log(LevelError, "unable to reconnect", "err", err, "backoff", backoff)
+		if backoff *= 2; backoff > conn.backoffMax {
+			backoff = conn.backoffMax
+		}
 	}
-	// run
-	ctx, conn.cancel = context.WithCancel(ctx)
-	go conn.run(ctx)
-	return conn, nil
 }
 
 // marshal marshals the message. If the format set on the connection is json,
 // then the message will be marshaled using json encoding.
 func (conn *Conn) marshal(env *rtapi.Envelope) ([]byte, error) {
-	f := proto.Marshal
 	if !conn.binary {
-		f = protojson.Marshal
+		return conn.jsonMarshal.Marshal(env)
 	}
-	return f(env)
+	return conn.codec.Marshal(env)
 }
 
 // unmarshal unmarshals the message. If the format set on the connection is
 // json, then v will be unmarshaled using json encoding.
 func (conn *Conn) unmarshal(buf []byte) (*rtapi.Envelope, error) {
-	f := proto.Unmarshal
+	f := conn.codec.Unmarshal
 	if !conn.binary {
-		f = protojson.Unmarshal
+		f = func(buf []byte, env *rtapi.Envelope) error {
+			return conn.jsonDecode.Unmarshal(buf, env)
+		}
 	}
-	env := new(rtapi.Envelope)
+	env := getEnvelope()
 	if err := f(buf, env); err != nil {
+		putEnvelope(env)
 		return nil, err
 	}
+	// a json message of an unknown type is discarded when discarding unknown
+	// fields, leaving an empty envelope
+	if !conn.binary && env.Message == nil && conn.jsonDecode.DiscardUnknown {
+		if typ := jsonMessageKey(buf); typ != "" {
+			putEnvelope(env)
+			return nil, &UnknownMessageError{Type: typ}
+		}
+	}
 	return env, nil
 }
 
-// run handles incoming and outgoing websocket messages.
+// jsonMessageKey returns the first key of a json envelope other than the cid,
+// or empty when the envelope has no other keys.
+func jsonMessageKey(buf []byte) string {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &m); err != nil {
+		return ""
+	}
+	keys := maps.Keys(m)
+	sort.Strings(keys)
+	for _, key := range keys {
+		if key != "cid" {
+			return key
+		}
+	}
+	return ""
+}
+
+// maxPooledBuffer is the capacity above which read buffers are not returned
+// to the pool.
+const maxPooledBuffer = 1 << 20
+
+// bufferPool is the pool of websocket read buffers. As the received messages
+// are similarly sized, a pooled buffer's capacity serves as the size hint for
+// the next read.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// getBuffer gets an empty read buffer from the pool.
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// putBuffer returns the read buffer to the pool.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		bufferPool.Put(buf)
+	}
+}
+
+// putBuffer returns the read buffer to the pool, when the buffer's capacity
+// is within the connection's pooled buffer limit (see
+// WithConnPooledBufferLimit), so that a burst of large messages does not
+// leave large buffers pinned in the pool.
+func (conn *Conn) putBuffer(buf *bytes.Buffer) {
+	if conn.pooledLimit == 0 || buf.Cap() <= conn.pooledLimit {
+		putBuffer(buf)
+	}
+}
+
+// readerPool is the pool of buffered readers used to peek at received json
+// messages.
+var readerPool = sync.Pool{
+	New: func() interface{} {
+		return bufio.NewReaderSize(nil, 4096)
+	},
+}
+
+// getReader gets a buffered reader for r from the pool.
+func getReader(r io.Reader) *bufio.Reader {
+	br := readerPool.Get().(*bufio.Reader)
+	br.Reset(r)
+	return br
+}
+
+// putReader returns the buffered reader to the pool.
+func putReader(br *bufio.Reader) {
+	br.Reset(nil)
+	readerPool.Put(br)
+}
+
+// notificationsPrefix is the prefix of a json notifications envelope.
+var notificationsPrefix = []byte(`"notifications"`)
+
+// isNotifications returns true when the buffered json message is a
+// notifications envelope.
+func isNotifications(br *bufio.Reader) bool {
+	buf, _ := br.Peek(32)
+	buf = bytes.TrimLeft(buf, " \t\r\n")
+	if len(buf) == 0 || buf[0] != '{' {
+		return false
+	}
+	return bytes.HasPrefix(bytes.TrimLeft(buf[1:], " \t\r\n"), notificationsPrefix)
+}
+
+// decodeNotifications decodes a json notifications envelope as a stream,
+// decoding each notification in turn, instead of reading the whole message
+// before unmarshaling it. Returns the envelope and the message size.
+func decodeNotifications(r io.Reader, opts protojson.UnmarshalOptions) (*rtapi.Envelope, int, error) {
+	cr := &countingReader{r: r}
+	dec := json.NewDecoder(cr)
+	env, msg := getEnvelope(), new(rtapi.Notifications)
+	var raw json.RawMessage
+	err := decodeObject(dec, func(key string) error {
+		switch key {
+		case "cid":
+			return dec.Decode(&env.Cid)
+		case "notifications":
+			return decodeObject(dec, func(key string) error {
+				if key != "notifications" {
+					return dec.Decode(&raw)
+				}
+				if err := expectDelim(dec, '['); err != nil {
+					return err
+				}
+				for dec.More() {
+					if err := dec.Decode(&raw); err != nil {
+						return err
+					}
+					n := new(Notification)
+					if err := opts.Unmarshal(raw, n); err != nil {
+						return err
+					}
+					msg.Notifications = append(msg.Notifications, n)
+				}
+				return expectDelim(dec, ']')
+			})
+		}
+		return dec.Decode(&raw)
+	})
+	// drain the remainder of the message
+	_, _ = io.Copy(ioutil.Discard, cr)
+	if err != nil {
+		putEnvelope(env)
+		return nil, cr.n, err
+	}
+	env.Message = &rtapi.Envelope_Notifications{Notifications: msg}
+	return env, cr.n, nil
+}
+
+// decodeObject decodes a json object, calling f to decode each key's value.
+func decodeObject(dec *json.Decoder, f func(string) error) error {
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return fmt.Errorf("expected object key, got: %v", tok)
+		}
+		if err := f(key); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+// expectDelim reads the json delimiter.
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	switch {
+	case err != nil:
+		return err
+	case tok != delim:
+		return fmt.Errorf("expected %v, got: %v", delim, tok)
+	}
+	return nil
+}
+
+// countingReader counts the bytes read.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+// Read satisfies the io.Reader interface.
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += n
+	return n, err
+}
+
+// readLimitExceeded returns true when the read size exceeds the read limit,
+// closing the connection.
+func (conn *Conn) readLimitExceeded(d *disconnect, n int) bool {
+	limit := conn.effectiveReadLimit()
+	if int64(n) <= limit {
+		return false
+	}
+	// the websocket is closed when the read limit is exceeded
+	serr := &MessageSizeError{Incoming: true, Size: n, Limit: int(limit)}
+	conn.logger.Log(LevelError, "message too large", "limit", limit)
+	conn.oversizeHandlers.dispatch(serr)
+	d.close(&DisconnectReason{Cause: DisconnectMessageTooLarge, Err: serr})
+	return true
+}
+
+// deliver pushes the received envelope to the inbox, returning false when the
+// context is closed.
+func (conn *Conn) deliver(ctx context.Context, env *rtapi.Envelope, size int) bool {
+	typ := envelopeType(env)
+	conn.logger.Log(LevelDebug, "recv", "type", typ, "cid", env.Cid, "size", size)
+	if conn.capture != nil {
+		conn.capture.record(CaptureIn, env)
+	}
+	if conn.trace != nil {
+		conn.trace.record(CaptureIn, env, size)
+	}
+	conn.metrics.MessageReceived(typ, size)
+	conn.stats.messageReceived(typ, size)
+	dropped, err := conn.in.push(ctx, env)
+	if err != nil {
+		putEnvelope(env)
+		return false
+	}
+	if dropped != nil {
+		conn.logger.Log(LevelWarn, "dropping notification", "type", envelopeType(dropped))
+		putEnvelope(dropped)
+	}
+	return true
+}
+
+// envelopePool is the pool of received envelopes. Received envelopes are
+// merged into the messages passed to callbacks and responses, and returned
+// to the pool once dispatched.
+var envelopePool = sync.Pool{
+	New: func() interface{} {
+		return new(rtapi.Envelope)
+	},
+}
+
+// getEnvelope gets an envelope from the pool.
+func getEnvelope() *rtapi.Envelope {
+	return envelopePool.Get().(*rtapi.Envelope)
+}
+
+// putEnvelope resets and returns the envelope to the pool.
+func putEnvelope(env *rtapi.Envelope) {
+	proto.Reset(env)
+	envelopePool.Put(env)
+}
+
+// run handles incoming and outgoing websocket messages, reconnecting when
+// the connection is persistent.
 func (conn *Conn) run(ctx context.Context) {
+	defer conn.setState(ConnClosed)
+	defer conn.teardown()
+	var queued []EnvelopeBuilder
+	var retry []*req
+	for {
+		conn.stats.opened(conn.epoch.Add(1) != 1)
+		sctx, cancel := context.WithCancel(ctx)
+		d := &disconnect{cancel: cancel}
+		conn.rw.Lock()
+		conn.socket = d
+		migrate := conn.preferred != ""
+		conn.rw.Unlock()
+		if migrate {
+			d.close(&DisconnectReason{Cause: DisconnectMigrate})
+		}
+		if conn.interval != 0 {
+			go conn.keepalive(sctx, d)
+		}
+		go conn.watchExpiry(sctx, d)
+		conn.runSocket(sctx, d, queued, retry)
+		cancel()
+		reason := d.get()
+		if reason == nil {
+			reason = &DisconnectReason{Cause: DisconnectCanceled, Err: ctx.Err()}
+		}
+		conn.logger.Log(LevelInfo, "disconnected", "reason", reason)
+		conn.closeErr.Store(reason)
+		conn.stats.closed(reason)
+		retry = nil
+		if conn.retry && conn.persist && !conn.closed.Load() && reason.Cause != DisconnectDisplaced {
+			retry = conn.takeRetryable()
+		}
+		conn.failPending(reason)
+		conn.invalidateTickets()
+		conn.notifyDisconnect(reason)
+		if !conn.persist || conn.closed.Load() || reason.Cause == DisconnectDisplaced {
+			return
+		}
+		conn.setState(ConnReconnecting)
+		conn.logger.Log(LevelInfo, "reconnecting")
+		if !conn.redial(ctx) {
+			return
+		}
+		conn.qmu.Lock()
+		conn.setState(ConnConnected)
+		if conn.rejoin {
+			// keep queuing until rejoined, as match and party data sent
+			// before rejoining is dropped by the server
+			conn.rejoining = true
+		} else {
+			queued, conn.queue = conn.queue, nil
+		}
+		conn.qmu.Unlock()
+		conn.logger.Log(LevelInfo, "reconnected")
+		conn.metrics.Reconnected()
+		conn.notifyConnect()
+		if conn.rejoin {
+			go func() {
+				conn.rejoinAll(ctx)
+				conn.flushQueue(ctx)
+			}()
+		}
+	}
+}
+
+// dialOptions builds the websocket dial options.
+func (conn *Conn) dialOptions(httpClient *http.Client) *websocket.DialOptions {
+	if conn.tlsConfig != nil || conn.proxy != nil || conn.coalesce != 0 {
+		transport, ok := httpClient.Transport.(*http.Transport)
+		if !ok {
+			transport = http.DefaultTransport.(*http.Transport)
+		}
+		transport = transport.Clone()
+		if conn.tlsConfig != nil {
+			transport.TLSClientConfig = conn.tlsConfig
+		}
+		if conn.proxy != nil {
+			transport.Proxy = conn.proxy
+		}
+		if conn.coalesce != 0 {
+			dial := transport.DialContext
+			if dial == nil {
+				dial = (&net.Dialer{}).DialContext
+			}
+			transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				nc, err := dial(ctx, network, addr)
+				if err != nil {
+					return nil, err
+				}
+				c := &coalescingConn{Conn: nc, window: conn.coalesce, size: conn.coalesceN}
+				conn.rw.Lock()
+				conn.wconn = c
+				conn.rw.Unlock()
+				return c, nil
+			}
+		}
+		c := *httpClient
+		c.Transport = transport
+		httpClient = &c
+	}
+	return &websocket.DialOptions{
+		HTTPClient:   httpClient,
+		HTTPHeader:   conn.header,
+		Subprotocols: conn.protocols,
+	}
+}
+
+// keepalive pings the websocket connection at the keepalive interval,
+// recording the round-trip time. Cancels the socket after the configured
+// number of consecutive failed pings.
+func (conn *Conn) keepalive(ctx context.Context, d *disconnect) {
+	t := time.NewTicker(conn.interval)
+	defer t.Stop()
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		err := conn.ping(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err == nil:
+			failures = 0
+			continue
+		}
+		failures++
+		conn.logger.Log(LevelWarn, "keepalive ping failed", "failures", failures, "max", conn.failures, "err", err)
+		if failures >= conn.failures {
+			d.close(&DisconnectReason{Cause: DisconnectPingTimeout, Err: err})
+			return
+		}
+	}
+}
+
+// tokenRefreshed closes the websocket connection when the handler's session
+// token is rotated, so that it is reopened with the new token.
+func (conn *Conn) tokenRefreshed(string) {
+	conn.rw.RLock()
+	d := conn.socket
+	conn.rw.RUnlock()
+	if d == nil || conn.closed.Load() {
+		return
+	}
+	conn.logger.Log(LevelInfo, "session token refreshed, reconnecting")
+	d.close(&DisconnectReason{Cause: DisconnectTokenRefresh})
+}
+
+// ping sends a ping, recording the round-trip time.
+func (conn *Conn) ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, conn.interval)
+	defer cancel()
+	start := time.Now()
+	if err := conn.Ping(ctx); err != nil {
+		return err
+	}
+	rtt := int64(time.Since(start))
+	conn.rtt.Store(rtt)
+	// smooth as per RFC 6298
+	if srtt := conn.srtt.Load(); srtt != 0 {
+		rtt = srtt + (rtt-srtt)/8
+	}
+	conn.srtt.Store(rtt)
+	return nil
+}
+
+// Latency returns the smoothed and last round-trip times of the keepalive
+// pings. Both are 0 until a keepalive ping has succeeded.
+func (conn *Conn) Latency() (time.Duration, time.Duration) {
+	return time.Duration(conn.srtt.Load()), time.Duration(conn.rtt.Load())
+}
+
+// runSocket handles incoming and outgoing websocket messages until the
+// context is closed or the websocket connection is closed.
+func (conn *Conn) runSocket(ctx context.Context, d *disconnect, queued []EnvelopeBuilder, retry []*req) {
+	conn.rw.RLock()
+	ws := conn.conn
+	conn.rw.RUnlock()
+	// flush messages queued while reconnecting, without a cid, as no response
+	// is awaited
+	for _, msg := range queued {
+		if _, _, err := conn.send(ctx, nil, ws, msg, ""); err != nil {
+			conn.logger.Log(LevelError, "unable to send queued message", "type", envelopeType(msg.BuildEnvelope()), "err", err)
+		}
+	}
+	// resend idempotent requests pending when disconnected, with their cid
+	for _, m := range retry {
+		conn.logger.Log(LevelDebug, "resending request", "cid", m.cid)
+		conn.write(ctx, ws, m)
+	}
 	// read incoming
+	done := make(chan struct{})
 	go func() {
+		defer close(done)
 		for {
-			select {
-			case <-ctx.Done():
-			default:
+			_, r, err := ws.Reader(ctx)
+			if err != nil {
+				reason := conn.disconnectReason(err)
+				if reason.Cause == DisconnectNetworkError {
+					conn.logger.Log(LevelError, "reader error", "err", err)
+				}
+				d.close(reason)
+				return
+			}
+			var br *bufio.Reader
+			if !conn.binary && len(conn.afterReceive) == 0 {
+				// decode json notification batches as a stream
+				br = getReader(r)
+				if isNotifications(br) {
+					env, size, err := decodeNotifications(br, conn.jsonDecode)
+					putReader(br)
+					switch {
+					case err != nil && conn.readLimitExceeded(d, size):
+						return
+					case err != nil:
+						conn.logger.Log(LevelError, "unable to decode notifications", "err", err)
+					case !conn.deliver(ctx, env, size):
+						return
+					}
+					continue
+				}
+				r = br
+			}
+			buf := getBuffer()
+			_, err = buf.ReadFrom(r)
+			if br != nil {
+				putReader(br)
+			}
+			if err != nil {
+				n := buf.Len()
+				conn.putBuffer(buf)
+				if conn.readLimitExceeded(d, n) {
+					return
+				}
+				conn.logger.Log(LevelError, "unable to read message", "err", err)
+				continue
 			}
-			_, r, err := conn.conn.Reader(ctx)
+			size := buf.Len()
+			env, err := conn.unmarshal(buf.Bytes())
+			var uerr *UnknownMessageError
 			switch {
-			case err != nil && (errors.Is(err, context.Canceled) || errors.As(err, &websocket.CloseError{})):
-				return
+			case errors.As(err, &uerr):
+				conn.putBuffer(buf)
+				if err := conn.unknownPolicy(uerr); err != nil {
+					conn.logger.Log(LevelError, "unable to dispatch incoming message", "err", err)
+				}
+				continue
 			case err != nil:
-				conn.h.Errf("reader error: %v", err)
+				conn.putBuffer(buf)
+				conn.logger.Log(LevelError, "unable to unmarshal message", "err", err)
 				continue
 			}
-			buf, err := ioutil.ReadAll(r)
+			if len(conn.afterReceive) != 0 {
+				env, err = conn.runAfterReceive(env, buf.Bytes())
+			}
+			conn.putBuffer(buf)
 			if err != nil {
-				conn.h.Errf("unable to read message: %v", err)
+				conn.logger.Log(LevelError, "dropping message", "err", err)
 				continue
 			}
-			conn.in <- buf
+			if !conn.deliver(ctx, env, size) {
+				return
+			}
 		}
 	}()
 	// dispatch outgoing/incoming
@@ -157,62 +893,81 @@ func (conn *Conn) run(ctx context.Context) {
 		select {
 		case <-ctx.Done():
 			return
-		case m := <-conn.out:
-			if m == nil {
-				continue
-			}
-			id, err := conn.send(ctx, m.msg)
-			if err != nil {
-				if !errors.Is(err, context.Canceled) {
-					conn.h.Errf("unable to send message: %v", err)
+		case <-done:
+			return
+		case m := <-conn.out[PriorityRealtime]:
+			conn.write(ctx, ws, m)
+		case m := <-conn.out[PriorityNormal]:
+			conn.writeAfter(ctx, ws, PriorityNormal, m)
+		case m := <-conn.out[PriorityLow]:
+			conn.writeAfter(ctx, ws, PriorityLow, m)
+		case <-conn.in.ready:
+			for _, env := range conn.in.pop() {
+				if conn.pool != nil && env.Cid == "" {
+					conn.pool.push(env)
+					continue
 				}
-				m.err <- fmt.Errorf("unable to send message: %w", err)
-				close(m.err)
-				continue
-			}
-			if m.v == nil || id == "" {
-				close(m.err)
-				continue
-			}
-			conn.rw.Lock()
-			conn.l[id] = m
-			conn.rw.Unlock()
-		case buf := <-conn.in:
-			if buf == nil {
-				continue
-			}
-			if err := conn.recv(buf); err != nil {
-				conn.h.Errf("unable to dispatch incoming message: %v", err)
-				continue
+				if err := conn.recv(env); err != nil {
+					conn.logger.Log(LevelError, "unable to dispatch incoming message", "err", err)
+				}
+				putEnvelope(env)
 			}
 		}
 	}
 }
 
-// send marshals the message and writes it to the websocket connection.
-func (conn *Conn) send(ctx context.Context, msg EnvelopeBuilder) (string, error) {
+// send marshals the message with the cid (if any) and writes it to the
+// websocket connection. The message is not written when the request context
+// (if any) is closed. The
+// write itself is not interrupted by the request context, as an interrupted
+// write closes the websocket connection.
+func (conn *Conn) send(ctx, rctx context.Context, ws *websocket.Conn, msg EnvelopeBuilder, cid string) (string, int, error) {
+	if rctx != nil && rctx.Err() != nil {
+		return "", 0, rctx.Err()
+	}
 	env := msg.BuildEnvelope()
-	env.Cid = strconv.FormatUint(atomic.AddUint64(&conn.id, 1), 10)
+	env.Cid = cid
 	buf, err := conn.marshal(env)
 	if err != nil {
-		return "", err
+		return "", 0, err
+	}
+	if len(conn.beforeSend) != 0 {
+		if buf, err = conn.runBeforeSend(envelopeType(env), buf); err != nil {
+			return "", 0, err
+		}
+	}
+	if conn.maxSize != 0 && len(buf) > conn.maxSize {
+		return "", 0, &MessageSizeError{Type: envelopeType(env), Size: len(buf), Limit: conn.maxSize}
 	}
 	typ := websocket.MessageBinary
 	if !conn.binary {
 		typ = websocket.MessageText
 	}
-	if err := conn.conn.Write(ctx, typ, buf); err != nil {
-		return "", err
+	if err := ws.Write(ctx, typ, buf); err != nil {
+		return "", 0, err
 	}
-	return env.Cid, nil
+	if conn.capture != nil {
+		conn.capture.record(CaptureOut, env)
+	}
+	if conn.trace != nil {
+		conn.trace.record(CaptureOut, env, len(buf))
+	}
+	name := envelopeType(env)
+	conn.logger.Log(LevelDebug, "send", "type", name, "cid", env.Cid, "size", len(buf))
+	conn.metrics.MessageSent(name, len(buf))
+	conn.stats.messageSent(name, len(buf))
+	return env.Cid, len(buf), nil
 }
 
-// recv unmarshals buf, dispatching the message.
-func (conn *Conn) recv(buf []byte) error {
-	env, err := conn.unmarshal(buf)
+// recv dispatches the received envelope.
+func (conn *Conn) recv(env *rtapi.Envelope) error {
+	if conn.notifyRawEnvelope(env) {
+		return nil
+	}
 	switch {
-	case err != nil:
-		return fmt.Errorf("unable to unmarshal: %w", err)
+	case env.Cid == "" && env.Message == nil && len(env.ProtoReflect().GetUnknown()) == 0:
+		// empty acknowledgement of a queued message sent without a cid
+		return nil
 	case env.Cid == "":
 		return conn.recvNotify(env)
 	}
@@ -223,135 +978,595 @@ func (conn *Conn) recv(buf []byte) error {
 func (conn *Conn) recvNotify(env *rtapi.Envelope) error {
 	switch v := env.Message.(type) {
 	case *rtapi.Envelope_Error:
-		conn.notifyError(v.Error)
+		conn.notifyError(env)
 		return NewRealtimeError(v.Error)
 	case *rtapi.Envelope_ChannelMessage:
-		conn.notifyChannelMessage(v.ChannelMessage)
+		conn.notifyChannelMessage(env)
 	case *rtapi.Envelope_ChannelPresenceEvent:
-		conn.notifyChannelPresenceEvent(v.ChannelPresenceEvent)
+		conn.notifyChannelPresenceEvent(env)
 	case *rtapi.Envelope_MatchData:
-		conn.notifyMatchData(v.MatchData)
+		conn.notifyMatchData(env)
 	case *rtapi.Envelope_MatchPresenceEvent:
-		conn.notifyMatchPresenceEvent(v.MatchPresenceEvent)
+		conn.notifyMatchPresenceEvent(env)
 	case *rtapi.Envelope_MatchmakerMatched:
-		conn.notifyMatchmakerMatched(v.MatchmakerMatched)
+		conn.resolveTicket(env)
+		conn.notifyMatchmakerMatched(env)
 	case *rtapi.Envelope_Notifications:
-		conn.notifyNotifications(v.Notifications)
+		conn.notifyNotifications(env)
+	case *rtapi.Envelope_Party:
+		conn.notifyParty(env)
+	case *rtapi.Envelope_PartyData:
+		conn.notifyPartyData(env)
+	case *rtapi.Envelope_PartyJoinRequest:
+		conn.notifyPartyJoinRequest(env)
+	case *rtapi.Envelope_PartyLeader:
+		conn.notifyPartyLeader(env)
+	case *rtapi.Envelope_PartyMatchmakerTicket:
+		conn.notifyPartyMatchmakerTicket(env)
+	case *rtapi.Envelope_PartyPresenceEvent:
+		conn.notifyPartyPresenceEvent(env)
 	case *rtapi.Envelope_StatusPresenceEvent:
-		conn.notifyStatusPresenceEvent(v.StatusPresenceEvent)
+		conn.notifyStatusPresenceEvent(env)
 	case *rtapi.Envelope_StreamData:
-		conn.notifyStreamData(v.StreamData)
+		conn.notifyStreamData(env)
 	case *rtapi.Envelope_StreamPresenceEvent:
-		conn.notifyStreamPresenceEvent(v.StreamPresenceEvent)
+		conn.notifyStreamPresenceEvent(env)
 	default:
-		return fmt.Errorf("unknown type %T", env.Message)
+		return conn.recvUnknown(env)
 	}
 	return nil
 }
 
+// recvUnknown handles a notification of an unknown type, such as a message
+// added by a newer server, passing it to the unknown callbacks, or handling it
+// as per the unknown policy.
+func (conn *Conn) recvUnknown(env *rtapi.Envelope) error {
+	if conn.unknownHandlers.len() != 0 {
+		conn.unknownHandlers.dispatch(proto.Clone(env).(*rtapi.Envelope))
+		return nil
+	}
+	return conn.unknownPolicy(&UnknownMessageError{Type: envelopeType(env)})
+}
+
+// unknownPolicy handles an unknown message as per the unknown policy.
+func (conn *Conn) unknownPolicy(err *UnknownMessageError) error {
+	switch conn.unknown {
+	case UnknownIgnore:
+		conn.logger.Log(LevelDebug, "ignoring unknown message", "type", err.Type)
+		return nil
+	case UnknownError:
+		conn.rw.RLock()
+		d := conn.socket
+		conn.rw.RUnlock()
+		if d != nil {
+			d.close(&DisconnectReason{Cause: DisconnectUnknownMessage, Err: err})
+		}
+	}
+	return err
+}
+
 // recvResponse dispatches a received a response (messages with cid != "").
 func (conn *Conn) recvResponse(env *rtapi.Envelope) error {
 	conn.rw.RLock()
 	req, ok := conn.l[env.Cid]
 	conn.rw.RUnlock()
+	if (!ok || req == nil) && conn.isDuplicate(env.Cid) {
+		conn.logger.Log(LevelDebug, "duplicate response", "cid", env.Cid, "type", envelopeType(env))
+		return nil
+	}
 	if !ok || req == nil {
-		return fmt.Errorf("no callback id %s (%T)", env.Cid, env.Message)
+		if conn.orphanHandlers.len() == 0 {
+			return fmt.Errorf("no callback id %s (%T)", env.Cid, env.Message)
+		}
+		conn.logger.Log(LevelDebug, "orphan response", "cid", env.Cid, "type", envelopeType(env))
+		conn.orphanHandlers.dispatch(proto.Clone(env).(*rtapi.Envelope))
+		return nil
 	}
 	// remove and close
 	defer func() {
 		close(req.err)
 		conn.rw.Lock()
 		delete(conn.l, env.Cid)
+		n := len(conn.l)
 		conn.rw.Unlock()
+		conn.complete(env.Cid)
+		conn.metrics.PendingRequests(n)
 	}()
 	// check error
 	switch v := env.Message.(type) {
 	case *rtapi.Envelope_Error:
-		conn.h.Logf("Error: %+v", v.Error)
+		conn.logger.Log(LevelWarn, "error response", "cid", env.Cid, "code", rtapi.Error_Code(v.Error.Code), "message", v.Error.Message)
 		req.err <- NewRealtimeError(v.Error)
 		return nil
-	case nil:
-		conn.h.Logf("Empty, Cid: %s", env.Cid)
-	case *rtapi.Envelope_Channel:
-		conn.h.Logf("Channel: %+v, Cid: %s", v.Channel, env.Cid)
-	case *rtapi.Envelope_ChannelMessageAck:
-		conn.h.Logf("ChannelMessageAck: %+v, Cid: %s", v.ChannelMessageAck, env.Cid)
-	case *rtapi.Envelope_MatchmakerTicket:
-		conn.h.Logf("MatchmakerTicket: %+v, Cid: %s", v.MatchmakerTicket, env.Cid)
-	case *rtapi.Envelope_Pong:
-		conn.h.Logf("Pong, Cid: %s", env.Cid)
-	case *rtapi.Envelope_Status:
-		conn.h.Logf("Status: %+v, Cid: %s", v.Status, env.Cid)
-	case *rtapi.Envelope_Rpc:
-		conn.h.Logf("Rpc: %+v, Cid: %s", v.Rpc, env.Cid)
+	case nil,
+		*rtapi.Envelope_Channel,
+		*rtapi.Envelope_ChannelMessageAck,
+		*rtapi.Envelope_Match,
+		*rtapi.Envelope_MatchmakerTicket,
+		*rtapi.Envelope_Party,
+		*rtapi.Envelope_PartyJoinRequest,
+		*rtapi.Envelope_PartyLeader,
+		*rtapi.Envelope_PartyMatchmakerTicket,
+		*rtapi.Envelope_Pong,
+		*rtapi.Envelope_Status,
+		*rtapi.Envelope_Rpc:
 	default:
-		return fmt.Errorf("unknown type %T cid: %s", env.Message, env.Cid)
+		if _, ok := req.v.(*rawResponse); !ok {
+			return fmt.Errorf("unknown type %T cid: %s", env.Message, env.Cid)
+		}
 	}
 	// merge
 	proto.Merge(req.v.BuildEnvelope(), env)
 	return nil
 }
 
-// Send sends a message.
-func (conn *Conn) Send(ctx context.Context, msg, v EnvelopeBuilder) error {
+// Send sends a message. When a request timeout is set on the connection, a
+// RequestTimeoutError is returned if the response is not received within the
+// timeout.
+func (conn *Conn) Send(ctx context.Context, msg, v EnvelopeBuilder) (err error) {
+	var typ string
+	if conn.tracer != nil || conn.metrics != NopMetrics {
+		typ = envelopeType(msg.BuildEnvelope())
+	}
+	ctx, span := conn.startSpan(ctx, typ)
+	if rpc, ok := msg.(*RpcRequest); ok {
+		// inject the metadata and span context into the payload
+		if msg, err = rpc.inject(ctx, conn); err != nil {
+			endSpan(span, err)
+			return err
+		}
+	}
+	start := time.Now()
+	// the request context is closed when Send returns, so that an unsent
+	// request is not written, and a pending request is removed
+	rctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	m := &req{
-		msg: msg,
-		v:   v,
-		err: make(chan error, 1),
+		ctx:   rctx,
+		msg:   msg,
+		v:     v,
+		err:   make(chan error, 1),
+		retry: conn.retry && isIdempotentContext(ctx),
+	}
+	defer func() {
+		if conn.tracer != nil {
+			conn.rw.RLock()
+			span.SetAttributes(attribute.String("nakama.cid", m.cid), attribute.Int("nakama.request_size", m.size))
+			conn.rw.RUnlock()
+		}
+		conn.metrics.RealtimeRequest(typ, time.Since(start), err)
+		conn.stats.error(err)
+		endSpan(span, err)
+	}()
+	// wait for the rate limit on the caller's goroutine, so that the run
+	// loop is not blocked
+	if err := conn.limiter(msg).wait(ctx); err != nil {
+		return err
+	}
+	if queued, err := conn.enqueue(msg); queued || err != nil {
+		return err
+	}
+	var timeout <-chan time.Time
+	if conn.timeout != 0 {
+		t := time.NewTimer(conn.timeout)
+		defer t.Stop()
+		timeout = t.C
 	}
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
-	case conn.out <- m:
+	case <-timeout:
+		return &RequestTimeoutError{Duration: conn.timeout}
+	case <-conn.done:
+		return ErrConnClosed
+	case conn.out[messagePriority(ctx, msg)] <- m:
 	}
-	var err error
 	select {
 	case <-ctx.Done():
+		cancel()
+		conn.forget(m)
 		return ctx.Err()
+	case <-timeout:
+		cancel()
+		return &RequestTimeoutError{Cid: conn.forget(m), Duration: conn.timeout}
+	case <-conn.done:
+		// prefer a response received before the connection was closed
+		select {
+		case err = <-m.err:
+		default:
+			cancel()
+			conn.forget(m)
+			return ErrConnClosed
+		}
 	case err = <-m.err:
 	}
+	if err == nil {
+		conn.track(msg, v)
+		conn.trackTicket(msg, v)
+	}
 	return err
 }
 
-// Close closes the websocket connection.
-func (conn *Conn) Close() error {
-	if conn.cancel != nil {
-		defer conn.cancel()
-	}
-	if conn.conn != nil {
-		return conn.conn.Close(websocket.StatusGoingAway, "going away")
+// SendEnvelope sends a prebuilt envelope, such as an envelope with a message
+// added by a custom server runtime, returning the response envelope. The
+// request's cid is set by the connection, and the envelope is not modified.
+// The envelope's message must be responded to by the server.
+func (conn *Conn) SendEnvelope(ctx context.Context, env *rtapi.Envelope) (*rtapi.Envelope, error) {
+	res := &rawResponse{env: new(rtapi.Envelope)}
+	if err := conn.Send(ctx, &rawEnvelopeMsg{env: env}, res); err != nil {
+		return nil, err
 	}
-	return nil
-}
-
-func (conn *Conn) notifyError(msg *rtapi.Error) {
-}
-
-func (conn *Conn) notifyChannelMessage(msg *nkapi.ChannelMessage) {
+	return res.env, nil
 }
 
-func (conn *Conn) notifyChannelPresenceEvent(msg *rtapi.ChannelPresenceEvent) {
+// rawEnvelopeMsg is a prebuilt envelope message.
+type rawEnvelopeMsg struct {
+	env *rtapi.Envelope
 }
 
-func (conn *Conn) notifyMatchData(msg *rtapi.MatchData) {
+// BuildEnvelope satisfies the EnvelopeBuilder interface, returning a copy of
+// the envelope.
+func (msg *rawEnvelopeMsg) BuildEnvelope() *rtapi.Envelope {
+	return proto.Clone(msg.env).(*rtapi.Envelope)
 }
 
-func (conn *Conn) notifyMatchPresenceEvent(msg *rtapi.MatchPresenceEvent) {
+// rawResponse is a response envelope of any message type.
+type rawResponse struct {
+	env *rtapi.Envelope
 }
 
-func (conn *Conn) notifyMatchmakerMatched(msg *rtapi.MatchmakerMatched) {
+// BuildEnvelope satisfies the EnvelopeBuilder interface.
+func (res *rawResponse) BuildEnvelope() *rtapi.Envelope {
+	return res.env
 }
 
-func (conn *Conn) notifyNotifications(msg *rtapi.Notifications) {
+// envelopeType returns the message type of the envelope, as named by the
+// envelope's message field (ie, "channel_join").
+func envelopeType(env *rtapi.Envelope) string {
+	msg := env.ProtoReflect()
+	if fd := msg.WhichOneof(msg.Descriptor().Oneofs().ByName("message")); fd != nil {
+		return string(fd.Name())
+	}
+	return ""
 }
 
-func (conn *Conn) notifyStatusPresenceEvent(msg *rtapi.StatusPresenceEvent) {
+// forget removes the pending request, returning its cid.
+func (conn *Conn) forget(m *req) string {
+	conn.rw.Lock()
+	defer conn.rw.Unlock()
+	if m.cid != "" && conn.l[m.cid] == m {
+		delete(conn.l, m.cid)
+	}
+	return m.cid
 }
 
-func (conn *Conn) notifyStreamData(msg *rtapi.StreamData) {
-}
+// Close closes the websocket connection.
+func (conn *Conn) Close() error {
+	conn.rw.RLock()
+	online := conn.appear && conn.online
+	conn.rw.RUnlock()
+	if online && conn.Status() == ConnConnected {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		if err := conn.AppearOffline(ctx); err != nil {
+			conn.logger.Log(LevelWarn, "unable to appear offline", "err", err)
+		}
+		cancel()
+	}
+	conn.closed.Store(true)
+	conn.setState(ConnDisconnecting)
+	if conn.cancel != nil {
+		defer conn.cancel()
+	}
+	conn.rw.RLock()
+	ws, wconn := conn.conn, conn.wconn
+	conn.rw.RUnlock()
+	if wconn != nil {
+		// the close handshake waits for the server's close frame, so the
+		// client's close frame is not held
+		_ = wconn.release()
+	}
+	if ws != nil {
+		return ws.Close(websocket.StatusGoingAway, "going away")
+	}
+	return nil
+}
+
+// CloseErr returns the reason the websocket connection was last closed, as a
+// *DisconnectReason, or nil when the websocket connection has not been
+// closed. The reason has the websocket close status code and reason sent by
+// the server, if any (see DisconnectReason.Unauthorized and
+// DisconnectReason.Temporary).
+func (conn *Conn) CloseErr() error {
+	if reason := conn.closeErr.Load(); reason != nil {
+		return reason
+	}
+	return nil
+}
+
+// Flush flushes outgoing messages held by write coalescing (see
+// WithConnWriteCoalescing).
+func (conn *Conn) Flush() error {
+	conn.rw.RLock()
+	c := conn.wconn
+	conn.rw.RUnlock()
+	if c == nil {
+		return nil
+	}
+	return c.Flush()
+}
+
+// Status returns the connection state.
+func (conn *Conn) Status() ConnState {
+	return ConnState(conn.state.Load())
+}
+
+// setState sets the connection state, notifying state change callbacks. A
+// closed connection's state is not changed.
+func (conn *Conn) setState(state ConnState) {
+	for {
+		prev := conn.state.Load()
+		if prev == int32(ConnClosed) || prev == int32(state) {
+			return
+		}
+		if conn.state.CompareAndSwap(prev, int32(state)) {
+			break
+		}
+	}
+	conn.stateHandlers.dispatch(state)
+}
+
+// track tracks the channels, matches, and parties joined, and the statuses
+// followed, after a successfully sent message.
+func (conn *Conn) track(msg, v EnvelopeBuilder) {
+	conn.rw.Lock()
+	defer conn.rw.Unlock()
+	switch m := msg.(type) {
+	case *ChannelJoinMsg:
+		if res, ok := v.(*ChannelMsg); ok && res.Id != "" {
+			conn.channels[res.Id] = m
+		}
+	case *ChannelLeaveMsg:
+		delete(conn.channels, m.ChannelId)
+	case *MatchCreateMsg:
+		if res, ok := v.(*MatchMsg); ok && res.MatchId != "" {
+			conn.matches[res.MatchId] = MatchJoin(res.MatchId)
+		}
+	case *MatchJoinMsg:
+		if res, ok := v.(*MatchMsg); ok && res.MatchId != "" {
+			conn.matches[res.MatchId] = MatchJoin(res.MatchId).WithMetadata(m.Metadata)
+		}
+	case *MatchLeaveMsg:
+		delete(conn.matches, m.MatchId)
+	case *PartyCreateMsg:
+		if res, ok := v.(*PartyMsg); ok && res.PartyId != "" {
+			conn.parties[res.PartyId] = PartyJoin(res.PartyId)
+		}
+	case *PartyJoinMsg:
+		conn.parties[m.PartyId] = m
+	case *PartyLeaveMsg:
+		delete(conn.parties, m.PartyId)
+	case *PartyCloseMsg:
+		delete(conn.parties, m.PartyId)
+	case *StatusFollowMsg:
+		for _, id := range m.UserIds {
+			conn.follows[id] = true
+		}
+		for _, username := range m.Usernames {
+			conn.followsu[username] = true
+		}
+		// track the online users followed by username by their user id, so
+		// that they are not refollowed after being unfollowed
+		if res, ok := v.(*StatusMsg); ok {
+			for _, p := range res.Presences {
+				if conn.followsu[p.Username] {
+					delete(conn.followsu, p.Username)
+					conn.follows[p.UserId] = true
+				}
+			}
+		}
+	case *StatusUnfollowMsg:
+		for _, id := range m.UserIds {
+			delete(conn.follows, id)
+		}
+	case *StatusUpdateMsg:
+		// the status is kept when appearing offline
+		if conn.online = m.Status != nil; conn.online {
+			conn.status = m.Status.GetValue()
+		}
+	}
+}
+
+// rejoinAll rejoins the tracked channels, matches, and parties, and refollows
+// the tracked statuses.
+func (conn *Conn) rejoinAll(ctx context.Context) {
+	conn.rw.RLock()
+	channels, matches, parties := maps.Values(conn.channels), maps.Values(conn.matches), maps.Values(conn.parties)
+	follows, followsu := maps.Keys(conn.follows), maps.Keys(conn.followsu)
+	online, status := conn.online, conn.status
+	conn.rw.RUnlock()
+	for _, msg := range channels {
+		if _, err := msg.Send(ctx, conn); err != nil {
+			conn.logger.Log(LevelError, "unable to rejoin channel", "target", msg.Target, "err", err)
+		}
+	}
+	for _, msg := range matches {
+		if _, err := msg.Send(ctx, conn); err != nil {
+			conn.logger.Log(LevelError, "unable to rejoin match", "match_id", msg.GetMatchId(), "err", err)
+		}
+	}
+	for _, msg := range parties {
+		if err := msg.Send(ctx, conn); err != nil {
+			conn.logger.Log(LevelError, "unable to rejoin party", "party_id", msg.PartyId, "err", err)
+		}
+	}
+	if len(follows) != 0 || len(followsu) != 0 {
+		if _, err := StatusFollow(follows...).WithUsernames(followsu...).Send(ctx, conn); err != nil {
+			conn.logger.Log(LevelError, "unable to refollow statuses", "err", err)
+		}
+	}
+	if online && status != "" {
+		if err := conn.StatusUpdate(ctx, status); err != nil {
+			conn.logger.Log(LevelError, "unable to restore status", "err", err)
+		}
+	}
+}
+
+// flushQueue sends the messages queued while reconnecting and rejoining, in
+// order, through the outgoing lanes. Messages sent while flushing are queued
+// and flushed after. The queue is kept when the websocket connection was
+// closed while rejoining, and flushed after the next rejoin.
+func (conn *Conn) flushQueue(ctx context.Context) {
+	for {
+		conn.qmu.Lock()
+		if conn.Status() != ConnConnected {
+			conn.qmu.Unlock()
+			return
+		}
+		queued := conn.queue
+		conn.queue, conn.rejoining = nil, len(queued) != 0
+		conn.qmu.Unlock()
+		if len(queued) == 0 {
+			return
+		}
+		for _, msg := range queued {
+			m := &req{
+				ctx:    ctx,
+				msg:    msg,
+				err:    make(chan error, 1),
+				queued: true,
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case conn.out[messagePriority(ctx, msg)] <- m:
+			}
+		}
+	}
+}
+
+// notifyConnect dispatches to the connect callbacks.
+func (conn *Conn) notifyConnect() {
+	conn.connectHandlers.dispatch(struct{}{})
+}
+
+// notifyDisconnect dispatches the reason to the disconnect callbacks.
+func (conn *Conn) notifyDisconnect(reason *DisconnectReason) {
+	conn.disconnectHandlers.dispatch(reason)
+}
+
+// notifyRawEnvelope dispatches the envelope to the raw envelope callbacks,
+// returning true when a callback handled the envelope.
+func (conn *Conn) notifyRawEnvelope(env *rtapi.Envelope) bool {
+	if conn.rawEnvelopeHandlers.len() == 0 {
+		return false
+	}
+	raw := &rawEnvelope{env: env}
+	conn.rawEnvelopeHandlers.dispatch(raw)
+	return raw.handled
+}
+
+// notifyError dispatches an error message to the error callbacks.
+func (conn *Conn) notifyError(env *rtapi.Envelope) {
+	notify(&conn.errorHandlers, new(ErrorMsg), env)
+}
+
+// notifyChannelMessage dispatches a channel message to the channel message
+// callbacks.
+func (conn *Conn) notifyChannelMessage(env *rtapi.Envelope) {
+	notify(&conn.channelMessageHandlers, new(ChannelMessageMsg), env)
+}
+
+// notifyChannelPresenceEvent dispatches a channel presence event to the
+// channel presence event callbacks.
+func (conn *Conn) notifyChannelPresenceEvent(env *rtapi.Envelope) {
+	notify(&conn.channelPresenceEventHandlers, new(ChannelPresenceEventMsg), env)
+}
+
+// notifyMatchData dispatches match data to the match data callbacks, and the
+// match data callbacks for the match id and op code.
+func (conn *Conn) notifyMatchData(env *rtapi.Envelope) {
+	msg := new(MatchDataMsg)
+	proto.Merge(msg.BuildEnvelope(), env)
+	conn.matchDataHandlers.dispatch(msg)
+	conn.matchDataMatchHandlers.dispatch(msg.MatchId, msg)
+	conn.matchDataOpCodeHandlers.dispatch(matchDataKey{msg.MatchId, OpType(msg.OpCode)}, msg)
+}
+
+// notifyMatchPresenceEvent dispatches a match presence event to the match
+// presence event callbacks.
+func (conn *Conn) notifyMatchPresenceEvent(env *rtapi.Envelope) {
+	notify(&conn.matchPresenceEventHandlers, new(MatchPresenceEventMsg), env)
+}
+
+// notifyMatchmakerMatched dispatches a matchmaker matched message to the
+// matchmaker matched callbacks.
+func (conn *Conn) notifyMatchmakerMatched(env *rtapi.Envelope) {
+	notify(&conn.matchmakerMatchedHandlers, new(MatchmakerMatchedMsg), env)
+}
+
+// notifyNotifications dispatches notifications to the notifications
+// callbacks.
+func (conn *Conn) notifyNotifications(env *rtapi.Envelope) {
+	notify(&conn.notificationsHandlers, new(NotificationsMsg), env)
+}
+
+// notifyParty dispatches a party message to the party callbacks.
+func (conn *Conn) notifyParty(env *rtapi.Envelope) {
+	notify(&conn.partyHandlers, new(PartyMsg), env)
+}
+
+// notifyPartyData dispatches party data to the party data callbacks.
+func (conn *Conn) notifyPartyData(env *rtapi.Envelope) {
+	notify(&conn.partyDataHandlers, new(PartyDataMsg), env)
+}
+
+// notifyPartyJoinRequest dispatches a party join request to the party join
+// request callbacks.
+func (conn *Conn) notifyPartyJoinRequest(env *rtapi.Envelope) {
+	notify(&conn.partyJoinRequestHandlers, new(PartyJoinRequestMsg), env)
+}
+
+// notifyPartyLeader dispatches a party leader message to the party leader
+// callbacks.
+func (conn *Conn) notifyPartyLeader(env *rtapi.Envelope) {
+	notify(&conn.partyLeaderHandlers, new(PartyLeaderMsg), env)
+}
+
+// notifyPartyMatchmakerTicket dispatches a party matchmaker ticket to the
+// party matchmaker ticket callbacks.
+func (conn *Conn) notifyPartyMatchmakerTicket(env *rtapi.Envelope) {
+	notify(&conn.partyMatchmakerTicketHandlers, new(PartyMatchmakerTicketMsg), env)
+}
+
+// notifyPartyPresenceEvent dispatches a party presence event to the party
+// presence event callbacks.
+func (conn *Conn) notifyPartyPresenceEvent(env *rtapi.Envelope) {
+	notify(&conn.partyPresenceEventHandlers, new(PartyPresenceEventMsg), env)
+}
+
+// notifyStatusPresenceEvent dispatches a status presence event to the status
+// presence event callbacks.
+func (conn *Conn) notifyStatusPresenceEvent(env *rtapi.Envelope) {
+	notify(&conn.statusPresenceEventHandlers, new(StatusPresenceEventMsg), env)
+}
+
+// notifyStreamData dispatches stream data to the stream data callbacks, and
+// the stream data callbacks for the stream.
+func (conn *Conn) notifyStreamData(env *rtapi.Envelope) {
+	msg := new(StreamDataMsg)
+	proto.Merge(msg.BuildEnvelope(), env)
+	conn.streamDataHandlers.dispatch(msg)
+	conn.streamDataStreamHandlers.dispatch(msg.StreamId(), msg)
+}
 
-func (conn *Conn) notifyStreamPresenceEvent(msg *rtapi.StreamPresenceEvent) {
+// notifyStreamPresenceEvent dispatches a stream presence event to the stream
+// presence event callbacks, and the stream presence event callbacks for the
+// stream.
+func (conn *Conn) notifyStreamPresenceEvent(env *rtapi.Envelope) {
+	msg := new(StreamPresenceEventMsg)
+	proto.Merge(msg.BuildEnvelope(), env)
+	conn.streamPresenceEventHandlers.dispatch(msg)
+	conn.streamPresenceStreamHandlers.dispatch(msg.StreamId(), msg)
 }
 
 // ChannelJoin sends a message to join a chat channel.
@@ -525,11 +1740,19 @@ func (conn *Conn) PartyCreateAsync(ctx context.Context, open bool, maxSize int,
 }
 
 // PartyDataSend sends a message to send input to a multiplayer party.
+//
+// The realtime protocol does not support reliable or targeted party data, so
+// reliable and presences are ignored. Party data is always sent reliably to
+// all party members.
 func (conn *Conn) PartyDataSend(ctx context.Context, partyId string, opCode OpType, data []byte, reliable bool, presences ...*UserPresenceMsg) error {
 	return PartyDataSend(partyId, opCode, data).Send(ctx, conn)
 }
 
 // PartyDataSendAsync sends a message to send input to a multiplayer party.
+//
+// The realtime protocol does not support reliable or targeted party data, so
+// reliable and presences are ignored. Party data is always sent reliably to
+// all party members.
 func (conn *Conn) PartyDataSendAsync(ctx context.Context, partyId string, opCode OpType, data []byte, reliable bool, presences []*UserPresenceMsg, f func(error)) {
 	PartyDataSend(partyId, opCode, data).Async(ctx, conn, f)
 }
@@ -616,12 +1839,12 @@ func (conn *Conn) PingAsync(ctx context.Context, f func(error)) {
 
 // Rpc sends a message to execute a remote procedure call.
 func (conn *Conn) Rpc(ctx context.Context, id string, payload, v interface{}) error {
-	return Rpc(id, payload, v).Send(ctx, conn)
+	return RpcMessage(id, payload, v).Send(ctx, conn)
 }
 
 // RpcAsync sends a message to execute a remote procedure call.
 func (conn *Conn) RpcAsync(ctx context.Context, id string, payload, v interface{}, f func(error)) {
-	Rpc(id, payload, v).SendAsync(ctx, conn, f)
+	RpcMessage(id, payload, v).Async(ctx, conn, f)
 }
 
 // StatusFollow sends a message to subscribe to user status updates.
@@ -658,56 +1881,560 @@ func (conn *Conn) StatusUpdateAsync(ctx context.Context, status string, f func(e
 		Async(ctx, conn, f)
 }
 
-// OnConnect adds a connect callback.
+// AppearOnline makes the user appear online to the user's followers, keeping
+// the last status set with StatusUpdate. The user stays online after the
+// websocket connection is reopened.
+func (conn *Conn) AppearOnline(ctx context.Context) error {
+	conn.rw.RLock()
+	status := conn.status
+	conn.rw.RUnlock()
+	return conn.StatusUpdate(ctx, status)
+}
+
+// AppearOffline makes the user appear offline to the user's followers.
+func (conn *Conn) AppearOffline(ctx context.Context) error {
+	return StatusUpdate().Send(ctx, conn)
+}
+
+// Online returns true when the user appears online (see AppearOnline).
+func (conn *Conn) Online() bool {
+	conn.rw.RLock()
+	defer conn.rw.RUnlock()
+	return conn.online
+}
+
+// OnRawEnvelope adds a callback called with every received envelope, before
+// it is dispatched. The envelope is reused after the callback returns, and
+// must be cloned (see proto.Clone) to be retained. When any callback returns
+// true, the envelope is treated as handled and is not dispatched further,
+// allowing handling of unknown or future message types and custom server
+// messages. Handling a response envelope (one with a cid) prevents the
+// pending request from completing. The callback is removed when the context
+// is closed.
+func (conn *Conn) OnRawEnvelope(ctx context.Context, f func(*rtapi.Envelope) bool) {
+	conn.rawEnvelopeHandlers.add(ctx, func(raw *rawEnvelope) {
+		if f(raw.env) {
+			raw.handled = true
+		}
+	})
+}
+
+// rawEnvelope is a received envelope passed to the raw envelope callbacks.
+type rawEnvelope struct {
+	env     *rtapi.Envelope
+	handled bool
+}
+
+// OnStateChange adds a callback called when the connection state changes. The
+// callback is removed when the context is closed.
+func (conn *Conn) OnStateChange(ctx context.Context, f func(ConnState)) {
+	conn.stateHandlers.add(ctx, f)
+}
+
+// StateChanges returns a channel receiving the connection's state
+// transitions. The channel is closed when the context is closed.
+func (conn *Conn) StateChanges(ctx context.Context, opts ...SubscribeOption) <-chan ConnState {
+	return subscribe(ctx, conn.stateHandlers.add, opts...)
+}
+
+// OnConnect adds a callback called when the websocket connection is
+// established. The callback is removed when the context is closed.
 func (conn *Conn) OnConnect(ctx context.Context, f func()) {
+	conn.connectHandlers.add(ctx, func(struct{}) {
+		f()
+	})
+}
+
+// OnMessageTooLarge adds a callback called when a received message exceeds
+// the read limit (see WithConnReadLimit), before the websocket connection is
+// closed. The callback is removed when the context is closed.
+func (conn *Conn) OnMessageTooLarge(ctx context.Context, f func(*MessageSizeError)) {
+	conn.oversizeHandlers.add(ctx, f)
+}
+
+// OnOrphanResponse adds a callback for responses that do not match a pending
+// request, such as responses received after the request timed out or its
+// context was closed. When no callback has been added, orphan responses are
+// logged as errors and discarded. The callback is removed when the context is
+// closed.
+func (conn *Conn) OnOrphanResponse(ctx context.Context, f func(*rtapi.Envelope)) {
+	conn.orphanHandlers.add(ctx, f)
+}
+
+// OnUnknown adds a fallback callback for received messages of an unknown type,
+// such as messages added by a newer server. When a callback has been added,
+// the unknown policy is not applied (see WithConnUnknownPolicy). The callback
+// is removed when the context is closed.
+func (conn *Conn) OnUnknown(ctx context.Context, f func(*rtapi.Envelope)) {
+	conn.unknownHandlers.add(ctx, f)
 }
 
-// OnDisconnect adds a disconnect callback.
-func (conn *Conn) OnDisconnect(ctx context.Context, f func()) {
+// OnDisconnect adds a callback called with the reason the websocket
+// connection was closed. The callback is removed when the context is closed.
+func (conn *Conn) OnDisconnect(ctx context.Context, f func(*DisconnectReason)) {
+	conn.disconnectHandlers.add(ctx, f)
 }
 
-// OnError adds an error callback.
+// OnError adds an error callback. The callback is removed when the context is
+// closed.
 func (conn *Conn) OnError(ctx context.Context, f func(*ErrorMsg)) {
+	conn.errorHandlers.add(ctx, f)
 }
 
-// OnChannelMessage adds a channel message callback.
+// OnChannelMessage adds a channel message callback. The callback is removed
+// when the context is closed.
 func (conn *Conn) OnChannelMessage(ctx context.Context, f func(*ChannelMessageMsg)) {
+	conn.channelMessageHandlers.add(ctx, f)
 }
 
-// OnChannelPresence adds a channel presence callback.
+// OnChannelPresenceEvent adds a channel presence callback. The callback is
+// removed when the context is closed.
 func (conn *Conn) OnChannelPresenceEvent(ctx context.Context, f func(*ChannelPresenceEventMsg)) {
+	conn.channelPresenceEventHandlers.add(ctx, f)
+}
+
+// OnMatchData adds a match data callback. The callback is removed when the
+// context is closed.
+func (conn *Conn) OnMatchData(ctx context.Context, f func(*MatchDataMsg)) {
+	conn.matchDataHandlers.add(ctx, f)
+}
+
+// OnMatchDataMatch adds a match data callback for a match. The callback is
+// removed when the context is closed.
+func (conn *Conn) OnMatchDataMatch(ctx context.Context, matchId string, f func(*MatchDataMsg)) {
+	conn.matchDataMatchHandlers.add(ctx, matchId, f)
+}
+
+// OnMatchDataOpCode adds a match data callback for an op code on a match. The
+// callback is removed when the context is closed.
+func (conn *Conn) OnMatchDataOpCode(ctx context.Context, matchId string, opCode OpType, f func(*MatchDataMsg)) {
+	conn.matchDataOpCodeHandlers.add(ctx, matchDataKey{matchId, opCode}, f)
 }
 
-// OnMatchPresence adds a match presence callback.
+// OnMatchPresenceEvent adds a match presence callback. The callback is removed
+// when the context is closed.
 func (conn *Conn) OnMatchPresenceEvent(ctx context.Context, f func(*MatchPresenceEventMsg)) {
+	conn.matchPresenceEventHandlers.add(ctx, f)
+}
+
+// OnMatchmakerMatched adds a matchmaker matched callback. The callback is
+// removed when the context is closed.
+func (conn *Conn) OnMatchmakerMatched(ctx context.Context, f func(*MatchmakerMatchedMsg)) {
+	conn.matchmakerMatchedHandlers.add(ctx, f)
 }
 
-// OnNotifications adds a notifications callback.
+// OnNotifications adds a notifications callback. The callback is removed when
+// the context is closed.
 func (conn *Conn) OnNotifications(ctx context.Context, f func(*NotificationsMsg)) {
+	conn.notificationsHandlers.add(ctx, f)
+}
+
+// OnParty adds a party callback. The callback is removed when the context is
+// closed.
+func (conn *Conn) OnParty(ctx context.Context, f func(*PartyMsg)) {
+	conn.partyHandlers.add(ctx, f)
+}
+
+// OnPartyData adds a party data callback. The callback is removed when the
+// context is closed.
+func (conn *Conn) OnPartyData(ctx context.Context, f func(*PartyDataMsg)) {
+	conn.partyDataHandlers.add(ctx, f)
+}
+
+// OnPartyJoinRequest adds a party join request callback. The callback is
+// removed when the context is closed.
+func (conn *Conn) OnPartyJoinRequest(ctx context.Context, f func(*PartyJoinRequestMsg)) {
+	conn.partyJoinRequestHandlers.add(ctx, f)
+}
+
+// OnPartyLeader adds a party leader callback. The callback is removed when the
+// context is closed.
+func (conn *Conn) OnPartyLeader(ctx context.Context, f func(*PartyLeaderMsg)) {
+	conn.partyLeaderHandlers.add(ctx, f)
+}
+
+// OnPartyMatchmakerTicket adds a party matchmaker ticket callback. The
+// callback is removed when the context is closed.
+func (conn *Conn) OnPartyMatchmakerTicket(ctx context.Context, f func(*PartyMatchmakerTicketMsg)) {
+	conn.partyMatchmakerTicketHandlers.add(ctx, f)
+}
+
+// OnPartyPresenceEvent adds a party presence callback. The callback is removed
+// when the context is closed.
+func (conn *Conn) OnPartyPresenceEvent(ctx context.Context, f func(*PartyPresenceEventMsg)) {
+	conn.partyPresenceEventHandlers.add(ctx, f)
 }
 
-// OnStatusPresence adds a status presence callback.
+// OnStatusPresenceEvent adds a status presence callback. The callback is
+// removed when the context is closed.
 func (conn *Conn) OnStatusPresenceEvent(ctx context.Context, f func(*StatusPresenceEventMsg)) {
+	conn.statusPresenceEventHandlers.add(ctx, f)
 }
 
-// OnStreamPresence adds a stream presence callback.
+// OnStreamPresenceEvent adds a stream presence callback. The callback is
+// removed when the context is closed.
 func (conn *Conn) OnStreamPresenceEvent(ctx context.Context, f func(*StreamPresenceEventMsg)) {
+	conn.streamPresenceEventHandlers.add(ctx, f)
 }
 
-// OnStreamData adds a stream data callback.
+// OnStreamData adds a stream data callback. The callback is removed when the
+// context is closed.
 func (conn *Conn) OnStreamData(ctx context.Context, f func(*StreamDataMsg)) {
+	conn.streamDataHandlers.add(ctx, f)
+}
+
+// OnStreamDataStream adds a stream data callback for a stream. The callback
+// is removed when the context is closed.
+func (conn *Conn) OnStreamDataStream(ctx context.Context, stream Stream, f func(*StreamDataMsg)) {
+	conn.streamDataStreamHandlers.add(ctx, stream, f)
+}
+
+// OnStreamPresenceEventStream adds a stream presence callback for a stream.
+// The callback is removed when the context is closed.
+func (conn *Conn) OnStreamPresenceEventStream(ctx context.Context, stream Stream, f func(*StreamPresenceEventMsg)) {
+	conn.streamPresenceStreamHandlers.add(ctx, stream, f)
+}
+
+// ErrorCh returns a channel receiving errors. The channel is closed when the
+// context is closed.
+func (conn *Conn) ErrorCh(ctx context.Context, opts ...SubscribeOption) <-chan *ErrorMsg {
+	return subscribe(ctx, conn.errorHandlers.add, opts...)
+}
+
+// ChannelMessageCh returns a channel receiving channel messages. The channel
+// is closed when the context is closed.
+func (conn *Conn) ChannelMessageCh(ctx context.Context, opts ...SubscribeOption) <-chan *ChannelMessageMsg {
+	return subscribe(ctx, conn.channelMessageHandlers.add, opts...)
+}
+
+// ChannelPresenceEventCh returns a channel receiving channel presence events.
+// The channel is closed when the context is closed.
+func (conn *Conn) ChannelPresenceEventCh(ctx context.Context, opts ...SubscribeOption) <-chan *ChannelPresenceEventMsg {
+	return subscribe(ctx, conn.channelPresenceEventHandlers.add, opts...)
+}
+
+// MatchDataCh returns a channel receiving match data for the match id, or for
+// all matches when the match id is empty. The channel is closed when the
+// context is closed.
+func (conn *Conn) MatchDataCh(ctx context.Context, matchId string, opts ...SubscribeOption) <-chan *MatchDataMsg {
+	if matchId == "" {
+		return subscribe(ctx, conn.matchDataHandlers.add, opts...)
+	}
+	return subscribe(ctx, func(ctx context.Context, f func(*MatchDataMsg)) {
+		conn.matchDataMatchHandlers.add(ctx, matchId, f)
+	}, opts...)
+}
+
+// MatchPresenceEventCh returns a channel receiving match presence events. The
+// channel is closed when the context is closed.
+func (conn *Conn) MatchPresenceEventCh(ctx context.Context, opts ...SubscribeOption) <-chan *MatchPresenceEventMsg {
+	return subscribe(ctx, conn.matchPresenceEventHandlers.add, opts...)
+}
+
+// MatchmakerMatchedCh returns a channel receiving matchmaker matched
+// messages. The channel is closed when the context is closed.
+func (conn *Conn) MatchmakerMatchedCh(ctx context.Context, opts ...SubscribeOption) <-chan *MatchmakerMatchedMsg {
+	return subscribe(ctx, conn.matchmakerMatchedHandlers.add, opts...)
+}
+
+// NotificationsCh returns a channel receiving notifications. The channel is
+// closed when the context is closed.
+func (conn *Conn) NotificationsCh(ctx context.Context, opts ...SubscribeOption) <-chan *NotificationsMsg {
+	return subscribe(ctx, conn.notificationsHandlers.add, opts...)
+}
+
+// PartyCh returns a channel receiving party messages. The channel is closed
+// when the context is closed.
+func (conn *Conn) PartyCh(ctx context.Context, opts ...SubscribeOption) <-chan *PartyMsg {
+	return subscribe(ctx, conn.partyHandlers.add, opts...)
+}
+
+// PartyDataCh returns a channel receiving party data. The channel is closed
+// when the context is closed.
+func (conn *Conn) PartyDataCh(ctx context.Context, opts ...SubscribeOption) <-chan *PartyDataMsg {
+	return subscribe(ctx, conn.partyDataHandlers.add, opts...)
+}
+
+// PartyJoinRequestCh returns a channel receiving party join requests. The
+// channel is closed when the context is closed.
+func (conn *Conn) PartyJoinRequestCh(ctx context.Context, opts ...SubscribeOption) <-chan *PartyJoinRequestMsg {
+	return subscribe(ctx, conn.partyJoinRequestHandlers.add, opts...)
+}
+
+// PartyLeaderCh returns a channel receiving party leader changes. The channel
+// is closed when the context is closed.
+func (conn *Conn) PartyLeaderCh(ctx context.Context, opts ...SubscribeOption) <-chan *PartyLeaderMsg {
+	return subscribe(ctx, conn.partyLeaderHandlers.add, opts...)
+}
+
+// PartyMatchmakerTicketCh returns a channel receiving party matchmaker
+// tickets. The channel is closed when the context is closed.
+func (conn *Conn) PartyMatchmakerTicketCh(ctx context.Context, opts ...SubscribeOption) <-chan *PartyMatchmakerTicketMsg {
+	return subscribe(ctx, conn.partyMatchmakerTicketHandlers.add, opts...)
+}
+
+// PartyPresenceEventCh returns a channel receiving party presence events. The
+// channel is closed when the context is closed.
+func (conn *Conn) PartyPresenceEventCh(ctx context.Context, opts ...SubscribeOption) <-chan *PartyPresenceEventMsg {
+	return subscribe(ctx, conn.partyPresenceEventHandlers.add, opts...)
+}
+
+// StatusPresenceEventCh returns a channel receiving status presence events.
+// The channel is closed when the context is closed.
+func (conn *Conn) StatusPresenceEventCh(ctx context.Context, opts ...SubscribeOption) <-chan *StatusPresenceEventMsg {
+	return subscribe(ctx, conn.statusPresenceEventHandlers.add, opts...)
+}
+
+// StreamDataCh returns a channel receiving stream data. The channel is closed
+// when the context is closed.
+func (conn *Conn) StreamDataCh(ctx context.Context, opts ...SubscribeOption) <-chan *StreamDataMsg {
+	return subscribe(ctx, conn.streamDataHandlers.add, opts...)
+}
+
+// StreamPresenceEventCh returns a channel receiving stream presence events.
+// The channel is closed when the context is closed.
+func (conn *Conn) StreamPresenceEventCh(ctx context.Context, opts ...SubscribeOption) <-chan *StreamPresenceEventMsg {
+	return subscribe(ctx, conn.streamPresenceEventHandlers.add, opts...)
 }
 
 // req wraps a request and results.
 type req struct {
-	msg EnvelopeBuilder
-	v   EnvelopeBuilder
-	err chan error
+	ctx   context.Context
+	msg   EnvelopeBuilder
+	v     EnvelopeBuilder
+	err   chan error
+	cid   string
+	size  int
+	seq   uint64
+	retry bool
+	// queued is a message queued while reconnecting, sent without a cid, as
+	// no response is awaited
+	queued bool
+}
+
+// callbacks is a goroutine-safe collection of callbacks, dispatched in the
+// order they were added.
+type callbacks[T any] struct {
+	id uint64
+	l  []callback[T]
+	rw sync.RWMutex
+}
+
+// callback is a registered callback.
+type callback[T any] struct {
+	id uint64
+	f  func(T)
+}
+
+// add adds a callback, removing it when the context is closed.
+func (cb *callbacks[T]) add(ctx context.Context, f func(T)) {
+	id := cb.push(f)
+	onDone(ctx, func() {
+		cb.remove(id)
+	})
+}
+
+// push adds a callback, returning its id.
+func (cb *callbacks[T]) push(f func(T)) uint64 {
+	cb.rw.Lock()
+	defer cb.rw.Unlock()
+	cb.id++
+	cb.l = append(cb.l, callback[T]{id: cb.id, f: f})
+	return cb.id
+}
+
+// remove removes the callback with the id, returning the number of remaining
+// callbacks.
+func (cb *callbacks[T]) remove(id uint64) int {
+	cb.rw.Lock()
+	defer cb.rw.Unlock()
+	l := make([]callback[T], 0, len(cb.l))
+	for _, c := range cb.l {
+		if c.id != id {
+			l = append(l, c)
+		}
+	}
+	cb.l = l
+	return len(l)
+}
+
+// len returns the number of callbacks.
+func (cb *callbacks[T]) len() int {
+	cb.rw.RLock()
+	defer cb.rw.RUnlock()
+	return len(cb.l)
+}
+
+// dispatch calls each callback with v.
+func (cb *callbacks[T]) dispatch(v T) {
+	cb.rw.RLock()
+	l := cb.l
+	cb.rw.RUnlock()
+	for _, c := range l {
+		c.f(v)
+	}
+}
+
+// keyedCallbacks is a goroutine-safe collection of callbacks keyed by K.
+type keyedCallbacks[K comparable, T any] struct {
+	m  map[K]*callbacks[T]
+	rw sync.RWMutex
+}
+
+// add adds a callback for the key, removing it when the context is closed.
+func (kc *keyedCallbacks[K, T]) add(ctx context.Context, key K, f func(T)) {
+	kc.rw.Lock()
+	if kc.m == nil {
+		kc.m = make(map[K]*callbacks[T])
+	}
+	cb, ok := kc.m[key]
+	if !ok {
+		cb = new(callbacks[T])
+		kc.m[key] = cb
+	}
+	id := cb.push(f)
+	kc.rw.Unlock()
+	onDone(ctx, func() {
+		kc.rw.Lock()
+		defer kc.rw.Unlock()
+		if cb.remove(id) == 0 && kc.m[key] == cb {
+			delete(kc.m, key)
+		}
+	})
+}
+
+// dispatch calls each callback for the key with v.
+func (kc *keyedCallbacks[K, T]) dispatch(key K, v T) {
+	kc.rw.RLock()
+	cb := kc.m[key]
+	kc.rw.RUnlock()
+	if cb != nil {
+		cb.dispatch(v)
+	}
+}
+
+// onDone calls f when the context is closed.
+func onDone(ctx context.Context, f func()) {
+	if ctx.Done() == nil {
+		return
+	}
+	go func() {
+		<-ctx.Done()
+		f()
+	}()
+}
+
+// subscribe adds a callback using add, sending received values to the
+// returned channel. The channel is closed when the context is closed.
+func subscribe[T any](ctx context.Context, add func(context.Context, func(T)), opts ...SubscribeOption) <-chan T {
+	o := subscribeOptions{buffer: 16}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	ch := make(chan T, o.buffer)
+	var mu sync.Mutex
+	var done bool
+	add(ctx, func(v T) {
+		mu.Lock()
+		defer mu.Unlock()
+		if done {
+			return
+		}
+		switch {
+		case o.drop == DropNone:
+			select {
+			case <-ctx.Done():
+			case ch <- v:
+			}
+			return
+		case o.drop == DropOldest && cap(ch) != 0:
+			for {
+				select {
+				case ch <- v:
+					return
+				default:
+				}
+				select {
+				case <-ch:
+				default:
+				}
+			}
+		}
+		select {
+		case ch <- v:
+		default:
+		}
+	})
+	onDone(ctx, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		done = true
+		close(ch)
+	})
+	return ch
+}
+
+// DropPolicy is the policy for values received by a subscription channel
+// when its buffer is full.
+type DropPolicy int
+
+// DropPolicy values.
+const (
+	// DropNewest drops the received value.
+	DropNewest DropPolicy = iota
+	// DropOldest drops the oldest buffered value.
+	DropOldest
+	// DropNone blocks dispatch until the value is received, or the
+	// subscription's context is closed.
+	DropNone
+)
+
+// subscribeOptions are subscription channel options.
+type subscribeOptions struct {
+	buffer int
+	drop   DropPolicy
+}
+
+// SubscribeOption is a subscription channel option.
+type SubscribeOption func(*subscribeOptions)
+
+// WithSubscribeBuffer is a subscription channel option to set the channel's
+// buffer size (default: 16).
+func WithSubscribeBuffer(buffer int) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.buffer = buffer
+	}
+}
+
+// WithSubscribeDropPolicy is a subscription channel option to set the policy
+// for values received when the channel's buffer is full (default:
+// DropNewest). Note that DropNone blocks the connection's dispatch of all
+// incoming messages until the value is received.
+func WithSubscribeDropPolicy(drop DropPolicy) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.drop = drop
+	}
+}
+
+// matchDataKey is the key for match data callbacks for a match id and op
+// code.
+type matchDataKey struct {
+	matchId string
+	opCode  OpType
+}
+
+// notify merges the envelope into msg and dispatches it to the callbacks.
+func notify[T EnvelopeBuilder](cb *callbacks[T], msg T, env *rtapi.Envelope) {
+	if cb.len() == 0 {
+		return
+	}
+	proto.Merge(msg.BuildEnvelope(), env)
+	cb.dispatch(msg)
 }
 
 // RealtimeError wraps a nakama realtime websocket error.
 type RealtimeError struct {
-	Code    rtapi.Error_Code
+	Code    ErrorCode
 	Message string
 	Context map[string]string
 }
@@ -716,7 +2443,7 @@ type RealtimeError struct {
 // message.
 func NewRealtimeError(err *rtapi.Error) error {
 	return &RealtimeError{
-		Code:    rtapi.Error_Code(err.Code),
+		Code:    ErrorCode(err.Code),
 		Message: err.Message,
 		Context: err.Context,
 	}
@@ -737,10 +2464,696 @@ func (err *RealtimeError) Error() string {
 	return fmt.Sprintf("realtime socket error %s (%d): %s%s", err.Code, err.Code, err.Message, extra)
 }
 
-// ConnOption is a nakama realtime websocket connection option.
-type ConnOption func(*Conn)
-
-// WithConnHandler is a nakama websocket connection option to set the Handler
+// Is satisfies the errors.Is interface, matching the error's code, such as
+// ErrMatchNotFound.
+func (err *RealtimeError) Is(target error) bool {
+	code, ok := target.(ErrorCode)
+	return ok && code == err.Code
+}
+
+// dispatchPool is a pool of workers dispatching notifications to callbacks.
+// Notifications for the same match, channel, party, or stream (or otherwise,
+// of the same type) are dispatched by the same worker, preserving their
+// order.
+type dispatchPool struct {
+	queues   []chan *rtapi.Envelope
+	overflow func(*rtapi.Envelope)
+}
+
+// start starts the pool's workers, stopping them when the context is closed.
+func (p *dispatchPool) start(ctx context.Context, conn *Conn) {
+	for _, q := range p.queues {
+		go func(q chan *rtapi.Envelope) {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case env := <-q:
+					if err := conn.recv(env); err != nil {
+						conn.logger.Log(LevelError, "unable to dispatch incoming message", "err", err)
+					}
+					putEnvelope(env)
+				}
+			}
+		}(q)
+	}
+}
+
+// push queues the notification to its worker, passing it to the overflow
+// callback when the worker's queue is full.
+func (p *dispatchPool) push(env *rtapi.Envelope) {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(dispatchKey(env)))
+	select {
+	case p.queues[h.Sum32()%uint32(len(p.queues))] <- env:
+	default:
+		if p.overflow != nil {
+			p.overflow(env)
+		}
+		putEnvelope(env)
+	}
+}
+
+// dispatchKey returns the ordering key for a notification.
+func dispatchKey(env *rtapi.Envelope) string {
+	switch v := env.Message.(type) {
+	case *rtapi.Envelope_ChannelMessage:
+		return v.ChannelMessage.ChannelId
+	case *rtapi.Envelope_ChannelPresenceEvent:
+		return v.ChannelPresenceEvent.ChannelId
+	case *rtapi.Envelope_MatchData:
+		return v.MatchData.MatchId
+	case *rtapi.Envelope_MatchPresenceEvent:
+		return v.MatchPresenceEvent.MatchId
+	case *rtapi.Envelope_Party:
+		return v.Party.PartyId
+	case *rtapi.Envelope_PartyData:
+		return v.PartyData.PartyId
+	case *rtapi.Envelope_PartyJoinRequest:
+		return v.PartyJoinRequest.PartyId
+	case *rtapi.Envelope_PartyLeader:
+		return v.PartyLeader.PartyId
+	case *rtapi.Envelope_PartyMatchmakerTicket:
+		return v.PartyMatchmakerTicket.PartyId
+	case *rtapi.Envelope_PartyPresenceEvent:
+		return v.PartyPresenceEvent.PartyId
+	case *rtapi.Envelope_StreamData:
+		return streamKey(v.StreamData.Stream)
+	case *rtapi.Envelope_StreamPresenceEvent:
+		return streamKey(v.StreamPresenceEvent.Stream)
+	}
+	return envelopeType(env)
+}
+
+// streamKey returns the key for a stream.
+func streamKey(stream *rtapi.Stream) string {
+	if stream == nil {
+		return ""
+	}
+	return strconv.Itoa(int(stream.Mode)) + "." + stream.Subject + "." + stream.Subcontext + "." + stream.Label
+}
+
+// coalescingConn is a net.Conn that coalesces writes, holding written bytes
+// until the window elapses or the size threshold is reached. Writes are
+// passed through until hold is set, once the websocket handshake completes.
+type coalescingConn struct {
+	net.Conn
+	window time.Duration
+	size   int
+	hold   atomic.Bool
+	buf    []byte
+	timer  *time.Timer
+	err    error
+	mu     sync.Mutex
+}
+
+// Write satisfies the net.Conn interface.
+func (c *coalescingConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return 0, c.err
+	}
+	if !c.hold.Load() {
+		return c.Conn.Write(p)
+	}
+	c.buf = append(c.buf, p...)
+	if c.size > 0 && len(c.buf) >= c.size {
+		if err := c.flush(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if c.timer == nil {
+		c.timer = time.AfterFunc(c.window, func() {
+			_ = c.Flush()
+		})
+	}
+	return len(p), nil
+}
+
+// Read satisfies the net.Conn interface. Flushes held writes before each
+// read, so that a request is sent before waiting for its response.
+func (c *coalescingConn) Read(p []byte) (int, error) {
+	if err := c.Flush(); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(p)
+}
+
+// Close satisfies the net.Conn interface.
+func (c *coalescingConn) Close() error {
+	_ = c.Flush()
+	return c.Conn.Close()
+}
+
+// Flush writes the held bytes to the underlying connection.
+func (c *coalescingConn) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flush()
+}
+
+// release flushes the held bytes, and passes through subsequent writes.
+func (c *coalescingConn) release() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hold.Store(false)
+	return c.flush()
+}
+
+// flush writes the held bytes. Must be called with the lock held.
+func (c *coalescingConn) flush() error {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	if c.err != nil || len(c.buf) == 0 {
+		return c.err
+	}
+	_, c.err = c.Conn.Write(c.buf)
+	c.buf = c.buf[:0]
+	return c.err
+}
+
+// inbox is a bounded buffer of received envelopes awaiting dispatch.
+type inbox struct {
+	mu    sync.Mutex
+	l     []*rtapi.Envelope
+	size  int
+	drop  DropPolicy
+	ready chan struct{}
+	space chan struct{}
+}
+
+// newInbox creates a new inbox.
+func newInbox(size int, drop DropPolicy) *inbox {
+	if size < 1 {
+		size = 1
+	}
+	return &inbox{
+		size:  size,
+		drop:  drop,
+		ready: make(chan struct{}, 1),
+		space: make(chan struct{}, 1),
+	}
+}
+
+// push adds the envelope to the inbox. When the inbox is full, notifications
+// are dropped according to the drop policy, otherwise push blocks until
+// there is space or the context is closed. Returns the dropped envelope, if
+// any. Responses are never dropped.
+func (b *inbox) push(ctx context.Context, env *rtapi.Envelope) (*rtapi.Envelope, error) {
+	for {
+		b.mu.Lock()
+		dropped, ok := b.reserve(env)
+		if ok {
+			b.l = append(b.l, env)
+		}
+		b.mu.Unlock()
+		switch {
+		case ok:
+			select {
+			case b.ready <- struct{}{}:
+			default:
+			}
+			return dropped, nil
+		case dropped != nil:
+			return dropped, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-b.space:
+		}
+	}
+}
+
+// reserve makes space for the envelope, applying the drop policy. Returns true
+// when the envelope can be added, and the dropped envelope, if any. Must be
+// called with the lock held.
+func (b *inbox) reserve(env *rtapi.Envelope) (*rtapi.Envelope, bool) {
+	switch {
+	case len(b.l) < b.size:
+		return nil, true
+	case env.Cid != "":
+		return nil, false
+	case b.drop == DropNewest:
+		return env, false
+	case b.drop == DropOldest:
+		i := slices.IndexFunc(b.l, func(e *rtapi.Envelope) bool { return e.Cid == "" })
+		if i == -1 {
+			return nil, false
+		}
+		dropped := b.l[i]
+		b.l = append(b.l[:i], b.l[i+1:]...)
+		return dropped, true
+	}
+	return nil, false
+}
+
+// pop removes and returns all buffered envelopes.
+func (b *inbox) pop() []*rtapi.Envelope {
+	b.mu.Lock()
+	l := b.l
+	b.l = nil
+	b.mu.Unlock()
+	select {
+	case b.space <- struct{}{}:
+	default:
+	}
+	return l
+}
+
+// Priority is the priority of an outgoing message. When the write path is
+// congested, messages with a higher priority are written first.
+type Priority int
+
+// Priority values.
+const (
+	// PriorityRealtime is the priority of latency sensitive messages. Match
+	// and party data are sent with PriorityRealtime by default.
+	PriorityRealtime Priority = iota
+	// PriorityNormal is the default priority.
+	PriorityNormal
+	// PriorityLow is the priority of bulk messages. Status updates are sent
+	// with PriorityLow by default.
+	PriorityLow
+
+	numPriorities = 3
+)
+
+// priorityKey is the context key for the priority of outgoing messages.
+type priorityKey struct{}
+
+// Prioritize returns a context that sends realtime messages sent with it with
+// the priority, overriding the message's default priority.
+func Prioritize(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// messagePriority returns the priority to send the message with.
+func messagePriority(ctx context.Context, msg EnvelopeBuilder) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok && PriorityRealtime <= p && p <= PriorityLow {
+		return p
+	}
+	switch msg.(type) {
+	case *MatchDataSendMsg, *PartyDataSendMsg:
+		return PriorityRealtime
+	case *StatusUpdateMsg:
+		return PriorityLow
+	}
+	return PriorityNormal
+}
+
+// ErrConnClosed is the error returned by Send when the connection is closed
+// before the response is received.
+var ErrConnClosed = errors.New("connection closed")
+
+// ErrQueueFull is the error returned by Send when the outgoing queue is full.
+var ErrQueueFull = errors.New("outgoing queue full")
+
+// enqueue adds the message to the outgoing queue when the connection is
+// reconnecting and the message does not require a response. Returns true
+// when the message was queued.
+func (conn *Conn) enqueue(msg EnvelopeBuilder) (bool, error) {
+	if conn.queueSize <= 0 || !queueable(msg.BuildEnvelope()) {
+		return false, nil
+	}
+	conn.qmu.Lock()
+	defer conn.qmu.Unlock()
+	if conn.Status() != ConnReconnecting && !conn.rejoining {
+		return false, nil
+	}
+	if len(conn.queue) >= conn.queueSize {
+		if conn.queueDrop != DropOldest {
+			return false, ErrQueueFull
+		}
+		conn.logger.Log(LevelWarn, "dropping queued message", "type", envelopeType(conn.queue[0].BuildEnvelope()))
+		conn.queue = conn.queue[1:]
+	}
+	conn.queue = append(conn.queue, msg)
+	return true, nil
+}
+
+// queueable returns true when the envelope can be buffered in the outgoing
+// queue: status updates, party data, and match data not marked reliable.
+func queueable(env *rtapi.Envelope) bool {
+	switch v := env.Message.(type) {
+	case *rtapi.Envelope_StatusUpdate, *rtapi.Envelope_PartyDataSend:
+		return true
+	case *rtapi.Envelope_MatchDataSend:
+		return !v.MatchDataSend.Reliable
+	}
+	return false
+}
+
+// RequestTimeoutError is a realtime request timeout error.
+type RequestTimeoutError struct {
+	Cid      string
+	Duration time.Duration
+}
+
+// Error satisfies the error interface.
+func (err *RequestTimeoutError) Error() string {
+	if err.Cid == "" {
+		return fmt.Sprintf("realtime request timed out after %s", err.Duration)
+	}
+	return fmt.Sprintf("realtime request %s timed out after %s", err.Cid, err.Duration)
+}
+
+// Timeout returns true. Satisfies the net.Error interface.
+func (err *RequestTimeoutError) Timeout() bool {
+	return true
+}
+
+// DisconnectCause is the cause of a websocket disconnect.
+type DisconnectCause int
+
+// DisconnectCause values.
+const (
+	// DisconnectCanceled is a disconnect caused by the connection being closed,
+	// or its context being canceled.
+	DisconnectCanceled DisconnectCause = iota
+	// DisconnectServerClose is a disconnect caused by the server closing the
+	// websocket.
+	DisconnectServerClose
+	// DisconnectPingTimeout is a disconnect caused by keepalive pings failing
+	// (see WithConnKeepalive).
+	DisconnectPingTimeout
+	// DisconnectNetworkError is a disconnect caused by a network error.
+	DisconnectNetworkError
+	// DisconnectTokenRefresh is a disconnect caused by the session token being
+	// refreshed (see WithConnTokenRefresh).
+	DisconnectTokenRefresh
+	// DisconnectMessageTooLarge is a disconnect caused by a received message
+	// exceeding the read limit (see WithConnReadLimit).
+	DisconnectMessageTooLarge
+	// DisconnectDisplaced is a disconnect caused by the server closing the
+	// websocket after the session connected from another socket, such as
+	// another device (see WithConnSingleSocket).
+	DisconnectDisplaced
+	// DisconnectUnknownMessage is a disconnect caused by a received message of
+	// an unknown type, with the UnknownError policy (see WithConnUnknownPolicy).
+	DisconnectUnknownMessage
+	// DisconnectMigrate is a disconnect caused by migrating the connection to
+	// another endpoint (see Migrate).
+	DisconnectMigrate
+)
+
+// String satisfies the fmt.Stringer interface.
+func (cause DisconnectCause) String() string {
+	switch cause {
+	case DisconnectCanceled:
+		return "canceled"
+	case DisconnectServerClose:
+		return "server close"
+	case DisconnectPingTimeout:
+		return "ping timeout"
+	case DisconnectNetworkError:
+		return "network error"
+	case DisconnectTokenRefresh:
+		return "token refresh"
+	case DisconnectMessageTooLarge:
+		return "message too large"
+	case DisconnectDisplaced:
+		return "displaced"
+	case DisconnectUnknownMessage:
+		return "unknown message"
+	case DisconnectMigrate:
+		return "migrate"
+	}
+	return fmt.Sprintf("DisconnectCause(%d)", int(cause))
+}
+
+// DisconnectReason is the reason a websocket connection was disconnected.
+// Pending requests are failed with the reason.
+type DisconnectReason struct {
+	Cause DisconnectCause
+	// Code is the websocket close status code sent by the server, when the
+	// cause is DisconnectServerClose or DisconnectDisplaced.
+	Code int
+	// Message is the websocket close reason sent by the server, if any.
+	Message string
+	Err     error
+}
+
+// Error satisfies the error interface.
+func (reason *DisconnectReason) Error() string {
+	s := "disconnected: " + reason.Cause.String()
+	switch {
+	case reason.Cause != DisconnectServerClose && reason.Cause != DisconnectDisplaced:
+	case reason.Message != "":
+		s += fmt.Sprintf(" (%d %q)", reason.Code, reason.Message)
+	default:
+		s += fmt.Sprintf(" (%d)", reason.Code)
+	}
+	if reason.Err != nil {
+		s += ": " + reason.Err.Error()
+	}
+	return s
+}
+
+// Unwrap returns the underlying error.
+func (reason *DisconnectReason) Unwrap() error {
+	return reason.Err
+}
+
+// Is returns true when target is ErrConnClosed.
+func (reason *DisconnectReason) Is(target error) bool {
+	return target == ErrConnClosed
+}
+
+// Temporary returns true when the disconnect is likely temporary, such as a
+// network error, or the server closing the websocket while restarting or
+// shutting down, and reconnecting should be retried.
+func (reason *DisconnectReason) Temporary() bool {
+	switch reason.Cause {
+	case DisconnectPingTimeout, DisconnectNetworkError, DisconnectTokenRefresh, DisconnectMigrate:
+		return true
+	case DisconnectServerClose:
+		switch websocket.StatusCode(reason.Code) {
+		case websocket.StatusGoingAway,
+			websocket.StatusAbnormalClosure,
+			websocket.StatusInternalError,
+			websocket.StatusServiceRestart,
+			websocket.StatusTryAgainLater,
+			websocket.StatusBadGateway:
+			return true
+		}
+	}
+	return false
+}
+
+// Unauthorized returns true when the server closed the websocket because the
+// session is no longer valid, such as when the session token expired or the
+// session was revoked, and the session should be refreshed or
+// reauthenticated before reconnecting. The server is expected to close the
+// websocket with the policy violation status code, or a close reason
+// mentioning an expired or invalid token.
+func (reason *DisconnectReason) Unauthorized() bool {
+	if reason.Cause != DisconnectServerClose {
+		return false
+	}
+	if websocket.StatusCode(reason.Code) == websocket.StatusPolicyViolation {
+		return true
+	}
+	msg := strings.ToLower(reason.Message)
+	return strings.Contains(msg, "expired") ||
+		strings.Contains(msg, "unauthorized") ||
+		strings.Contains(msg, "invalid token")
+}
+
+// displacedReason is the websocket close reason sent by nakama when closing
+// the session's other sockets.
+const displacedReason = "server-side session disconnect"
+
+// disconnectReason returns the disconnect reason for a websocket read error.
+func (conn *Conn) disconnectReason(err error) *DisconnectReason {
+	var cerr websocket.CloseError
+	switch {
+	case conn.closed.Load() || errors.Is(err, context.Canceled):
+		return &DisconnectReason{Cause: DisconnectCanceled, Err: err}
+	case conn.singleSocket && errors.As(err, &cerr) && cerr.Code == websocket.StatusNormalClosure && cerr.Reason == displacedReason:
+		return &DisconnectReason{Cause: DisconnectDisplaced, Code: int(cerr.Code), Message: cerr.Reason, Err: err}
+	case errors.As(err, &cerr):
+		return &DisconnectReason{Cause: DisconnectServerClose, Code: int(cerr.Code), Message: cerr.Reason, Err: err}
+	}
+	return &DisconnectReason{Cause: DisconnectNetworkError, Err: err}
+}
+
+// disconnect closes a websocket connection, recording the first reason.
+type disconnect struct {
+	cancel func()
+	reason *DisconnectReason
+	mu     sync.Mutex
+}
+
+// close records the reason, when none was recorded, and closes the websocket
+// connection.
+func (d *disconnect) close(reason *DisconnectReason) {
+	d.mu.Lock()
+	if d.reason == nil {
+		d.reason = reason
+	}
+	d.mu.Unlock()
+	d.cancel()
+}
+
+// get returns the recorded reason.
+func (d *disconnect) get() *DisconnectReason {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.reason
+}
+
+// writeAfter writes the messages waiting in the lanes with a higher priority
+// than the priority, and then writes the message.
+func (conn *Conn) writeAfter(ctx context.Context, ws *websocket.Conn, priority Priority, m *req) {
+	for p := PriorityRealtime; p < priority; p++ {
+	lane:
+		for i := cap(conn.out[p]); i >= 0; i-- {
+			select {
+			case h := <-conn.out[p]:
+				conn.write(ctx, ws, h)
+			default:
+				break lane
+			}
+		}
+	}
+	conn.write(ctx, ws, m)
+}
+
+// write writes the message, adding it to the pending requests when a
+// response is expected. Requests with a closed context are dropped.
+func (conn *Conn) write(ctx context.Context, ws *websocket.Conn, m *req) {
+	if m == nil {
+		return
+	}
+	cid := m.cid
+	if cid == "" && !m.queued {
+		cid, m.seq = conn.nextCid()
+	}
+	id, size, err := conn.send(ctx, m.ctx, ws, m.msg, cid)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+			conn.logger.Log(LevelError, "unable to send message", "type", envelopeType(m.msg.BuildEnvelope()), "err", err)
+		}
+		m.err <- fmt.Errorf("unable to send message: %w", err)
+		close(m.err)
+		return
+	}
+	if m.v == nil || id == "" {
+		close(m.err)
+		return
+	}
+	conn.rw.Lock()
+	m.cid, m.size = id, size
+	if m.ctx != nil && m.ctx.Err() != nil {
+		// Send returned while writing
+		conn.rw.Unlock()
+		close(m.err)
+		return
+	}
+	conn.l[id] = m
+	n := len(conn.l)
+	conn.rw.Unlock()
+	conn.metrics.PendingRequests(n)
+}
+
+// teardown fails the unsent and pending requests with ErrConnClosed, after
+// the run loop exits.
+func (conn *Conn) teardown() {
+	close(conn.done)
+	for _, out := range conn.out {
+	drain:
+		for {
+			select {
+			case m := <-out:
+				if m != nil {
+					m.err <- ErrConnClosed
+					close(m.err)
+				}
+			default:
+				break drain
+			}
+		}
+	}
+	conn.failPending(ErrConnClosed)
+}
+
+// failPending fails the pending requests with the error.
+func (conn *Conn) failPending(err error) {
+	conn.rw.Lock()
+	l := conn.l
+	conn.l = make(map[string]*req)
+	conn.rw.Unlock()
+	for _, m := range l {
+		m.err <- err
+		close(m.err)
+	}
+	if len(l) != 0 {
+		conn.metrics.PendingRequests(0)
+	}
+}
+
+// MessageSizeError is a realtime message size error, returned by Send when
+// an outgoing message exceeds the maximum message size (see
+// WithConnMaxMessageSize), or passed to OnMessageTooLarge callbacks when a
+// received message exceeds the read limit (see WithConnReadLimit).
+type MessageSizeError struct {
+	// Incoming is true for received messages.
+	Incoming bool
+	// Type is the message type of an outgoing message.
+	Type string
+	// Size is the size of an outgoing message, or the number of bytes read of
+	// a received message.
+	Size  int
+	Limit int
+}
+
+// Error satisfies the error interface.
+func (err *MessageSizeError) Error() string {
+	if err.Incoming {
+		return fmt.Sprintf("received realtime message exceeds the read limit of %d bytes", err.Limit)
+	}
+	return fmt.Sprintf("realtime message %s of %d bytes exceeds the maximum message size of %d bytes", err.Type, err.Size, err.Limit)
+}
+
+// UnknownPolicy is the policy for received messages of an unknown type, such
+// as messages added by a newer server.
+type UnknownPolicy int
+
+// UnknownPolicy values.
+const (
+	// UnknownLog logs unknown messages as errors, and discards them.
+	UnknownLog UnknownPolicy = iota
+	// UnknownIgnore discards unknown messages.
+	UnknownIgnore
+	// UnknownError closes the websocket connection, with an
+	// UnknownMessageError as the disconnect reason's error.
+	UnknownError
+)
+
+// UnknownMessageError is an unknown message error.
+type UnknownMessageError struct {
+	// Type is the message type, or empty when the message type is not known
+	// to this package's version of the realtime protocol.
+	Type string
+}
+
+// Error satisfies the error interface.
+func (err *UnknownMessageError) Error() string {
+	if err.Type == "" {
+		return "unknown realtime message"
+	}
+	return "unknown realtime message " + err.Type
+}
+
+// ConnOption is a nakama realtime websocket connection option.
+type ConnOption func(*Conn)
+
+// WithConnHandler is a nakama websocket connection option to set the Handler
 // used.
 func WithConnHandler(h Handler) ConnOption {
 	return func(conn *Conn) {
@@ -748,6 +3161,149 @@ func WithConnHandler(h Handler) ConnOption {
 	}
 }
 
+// WithConnLogger is a nakama websocket connection option to set the logger
+// used. Defaults to the Handler.
+func WithConnLogger(logger Logger) ConnOption {
+	return func(conn *Conn) {
+		conn.logger = logger
+	}
+}
+
+// WithConnMetrics is a nakama websocket connection option to set the metrics
+// used to measure realtime messages and requests.
+func WithConnMetrics(metrics Metrics) ConnOption {
+	return func(conn *Conn) {
+		conn.metrics = metrics
+	}
+}
+
+// WithConnReadBuffer is a nakama websocket connection option to set the
+// number of received messages buffered while awaiting dispatch. When the
+// buffer is full, the websocket reader applies the backpressure policy (see
+// WithConnBackpressure).
+func WithConnReadBuffer(n int) ConnOption {
+	return func(conn *Conn) {
+		conn.readBuf = n
+	}
+}
+
+// WithConnWriteBuffer is a nakama websocket connection option to set the
+// number of outgoing messages buffered, per priority (see Priority), while
+// awaiting a write. When the buffer is full, Send blocks until there is space,
+// the context is closed, or the request timeout elapses.
+func WithConnWriteBuffer(n int) ConnOption {
+	return func(conn *Conn) {
+		conn.writeBuf = n
+	}
+}
+
+// DefaultReadLimit is the default maximum size of received messages.
+const DefaultReadLimit = 32768
+
+// DefaultServerMaxMessageSize is the default maximum size of messages
+// accepted by the Nakama server (its socket.max_message_size_bytes config).
+const DefaultServerMaxMessageSize = 4096
+
+// WithConnReadLimit is a nakama websocket connection option to set the
+// maximum size of received messages (default DefaultReadLimit). When a
+// received message exceeds the limit, OnMessageTooLarge callbacks are called,
+// and the websocket connection is closed.
+func WithConnReadLimit(n int64) ConnOption {
+	return func(conn *Conn) {
+		conn.readLimit = n
+	}
+}
+
+// WithConnMaxMessageSize is a nakama websocket connection option to set the
+// maximum size of outgoing messages, such as DefaultServerMaxMessageSize.
+// Send returns a MessageSizeError for messages (such as match or party data)
+// exceeding the size, instead of sending a message the server would reject
+// by closing the websocket connection. The size is not checked by default.
+func WithConnMaxMessageSize(n int) ConnOption {
+	return func(conn *Conn) {
+		conn.maxSize = n
+	}
+}
+
+// WithConnPooledBufferLimit is a nakama websocket connection option to set
+// the capacity above which read buffers are released instead of being
+// returned to the pool, so that memory usage stays flat after receiving a
+// burst of large messages. Defaults to, and is capped at, 1 MiB.
+func WithConnPooledBufferLimit(n int) ConnOption {
+	return func(conn *Conn) {
+		conn.pooledLimit = n
+	}
+}
+
+// effectiveReadLimit returns the read limit of the websocket connection.
+func (conn *Conn) effectiveReadLimit() int64 {
+	if conn.readLimit != 0 {
+		return conn.readLimit
+	}
+	return DefaultReadLimit
+}
+
+// WithConnBackpressure is a nakama websocket connection option to set the
+// policy applied to received notifications when the read buffer is full.
+// DropNone (the default) blocks the websocket reader until the dispatcher
+// catches up, DropNewest discards the received notification, and DropOldest
+// discards the oldest buffered notification. Responses are never dropped,
+// and always block the reader when the buffer is full.
+func WithConnBackpressure(drop DropPolicy) ConnOption {
+	return func(conn *Conn) {
+		conn.pressure = drop
+	}
+}
+
+// WithConnWriteCoalescing is a nakama websocket connection option to coalesce
+// websocket writes, holding outgoing messages for up to window, or until size
+// bytes are held, and writing them to the underlying network connection at
+// once. Each message is still sent as its own websocket message, while
+// reducing the number of writes (and syscalls) for high frequency sends such
+// as match data. Held messages are also written when a message is received.
+// Use Flush to write held messages immediately. Errors writing held messages
+// are returned by the next send or Flush.
+func WithConnWriteCoalescing(window time.Duration, size int) ConnOption {
+	return func(conn *Conn) {
+		conn.coalesce, conn.coalesceN = window, size
+	}
+}
+
+// WithConnDispatchPool is a nakama websocket connection option to dispatch
+// notifications to callbacks using a pool of workers, so that slow callbacks
+// do not stall the connection. Notifications for the same match, channel,
+// party, or stream (or otherwise, of the same type) are dispatched in order by
+// the same worker. Each worker queues up to queue notifications, after which
+// further notifications are passed to the overflow callback (if any) and
+// dropped. The envelope passed to overflow is reused after it returns.
+// Responses are always dispatched by the connection.
+func WithConnDispatchPool(workers, queue int, overflow func(*rtapi.Envelope)) ConnOption {
+	return func(conn *Conn) {
+		if workers < 1 {
+			conn.pool = nil
+			return
+		}
+		p := &dispatchPool{overflow: overflow}
+		for i := 0; i < workers; i++ {
+			p.queues = append(p.queues, make(chan *rtapi.Envelope, queue))
+		}
+		conn.pool = p
+	}
+}
+
+// WithConnQueue is a nakama websocket connection option to buffer up to size
+// outgoing messages that do not require a response (status updates, party
+// data, and match data not marked reliable) while a persistent connection is
+// reconnecting. Queued messages are sent in order once reconnected, or, with
+// WithConnAutoRejoin, once the channels, matches, and parties are rejoined, and
+// Send returns immediately. When the queue is full, DropOldest discards the
+// oldest queued message, otherwise Send returns ErrQueueFull.
+func WithConnQueue(size int, drop DropPolicy) ConnOption {
+	return func(conn *Conn) {
+		conn.queueSize, conn.queueDrop = size, drop
+	}
+}
+
 // WithConnUrl is a nakama websocket connection option to set the websocket
 // URL.
 func WithConnUrl(urlstr string) ConnOption {
@@ -764,6 +3320,17 @@ func WithConnToken(token string) ConnOption {
 	}
 }
 
+// WithConnJSONOptions is a nakama websocket connection option to set the
+// protojson options used when the message encoding format is json (see
+// WithConnFormat), such as to emit unpopulated fields or use proto field
+// names for servers expecting them. Unknown fields are discarded when
+// unmarshaling by default, as newer servers may add fields to messages.
+func WithConnJSONOptions(marshal protojson.MarshalOptions, unmarshal protojson.UnmarshalOptions) ConnOption {
+	return func(conn *Conn) {
+		conn.jsonMarshal, conn.jsonDecode = marshal, unmarshal
+	}
+}
+
 // WithConnFormat is a nakama websocket connection option to set the message
 // encoding format (either "json" or "protobuf").
 func WithConnFormat(format string) ConnOption {
@@ -778,6 +3345,98 @@ func WithConnFormat(format string) ConnOption {
 	}
 }
 
+// WithConnRequestTimeout is a nakama websocket connection option to set the
+// timeout for a realtime request's response. Pending requests that time out
+// are removed, and a RequestTimeoutError is returned from Send.
+func WithConnRequestTimeout(timeout time.Duration) ConnOption {
+	return func(conn *Conn) {
+		conn.timeout = timeout
+	}
+}
+
+// WithConnKeepalive is a nakama websocket connection option to ping the
+// websocket connection at the interval, tracking the round-trip time (see
+// Conn.Latency). The websocket connection is dropped after the number of
+// consecutive failed pings, and reopened when the connection is persistent.
+func WithConnKeepalive(interval time.Duration, failures int) ConnOption {
+	return func(conn *Conn) {
+		conn.interval = interval
+		if conn.failures = failures; conn.failures < 1 {
+			conn.failures = 1
+		}
+	}
+}
+
+// WithConnPersist is a nakama websocket connection option to set whether or
+// not the websocket connection is reopened after being closed by the remote
+// end or a network error.
+func WithConnPersist(persist bool) ConnOption {
+	return func(conn *Conn) {
+		conn.persist = persist
+	}
+}
+
+// WithConnUnknownPolicy is a nakama websocket connection option to set the
+// policy for received messages of an unknown type (default: UnknownLog). The
+// policy is not applied when an OnUnknown callback has been added.
+func WithConnUnknownPolicy(policy UnknownPolicy) ConnOption {
+	return func(conn *Conn) {
+		conn.unknown = policy
+	}
+}
+
+// WithConnSingleSocket is a nakama websocket connection option to detect the
+// connection being displaced when the session connects from another socket,
+// such as another device, for servers configured with a single socket per
+// session (nakama's session.single_socket). A displaced connection is
+// disconnected with DisconnectDisplaced, and is not reopened when persistent,
+// so that two devices do not repeatedly displace each other.
+//
+// To intentionally run multiple sockets for a session (see ConnPool), the
+// server must allow multiple sockets per session. Each socket is a separate
+// presence, with its own session id.
+func WithConnSingleSocket(singleSocket bool) ConnOption {
+	return func(conn *Conn) {
+		conn.singleSocket = singleSocket
+	}
+}
+
+// WithConnBackoff is a nakama websocket connection option to set the minimum
+// and maximum backoff between reconnect attempts for a persistent connection.
+func WithConnBackoff(backoffMin, backoffMax time.Duration) ConnOption {
+	return func(conn *Conn) {
+		conn.backoffMin, conn.backoffMax = backoffMin, backoffMax
+	}
+}
+
+// WithConnAutoRejoin is a nakama websocket connection option to set whether or
+// not the joined channels, matches, and parties, and the followed statuses
+// are rejoined after the websocket connection is reopened. Implies
+// WithConnPersist(true) when true.
+func WithConnAutoRejoin(rejoin bool) ConnOption {
+	return func(conn *Conn) {
+		conn.rejoin = rejoin
+		if rejoin {
+			conn.persist = true
+		}
+	}
+}
+
+// WithConnTokenRefresh is a nakama websocket connection option to set whether
+// or not the websocket connection is reopened with the new session token when
+// the handler's session is refreshed. The session is refreshed before the
+// session token used to open the websocket connection expires (see
+// WithConnExpiryLead). Only applies when no token was set with WithConnToken.
+// Implies WithConnPersist(true) when true.
+func WithConnTokenRefresh(refresh bool) ConnOption {
+	return func(conn *Conn) {
+		conn.refresh = refresh
+		if refresh {
+			conn.persist = true
+		}
+	}
+}
+
 // WithConnQuery is a nakama websocket connection option to add an additional
 // key/value query param on the websocket URL.
 //
@@ -790,6 +3449,40 @@ func WithConnQuery(key, value string) ConnOption {
 	}
 }
 
+// WithConnDialHeaders is a nakama websocket connection option to set
+// additional http headers sent with the websocket handshake.
+func WithConnDialHeaders(header http.Header) ConnOption {
+	return func(conn *Conn) {
+		conn.header = header
+	}
+}
+
+// WithConnTLSConfig is a nakama websocket connection option to set the TLS
+// config used when dialing the websocket, such as for custom root CAs or
+// client certificates.
+func WithConnTLSConfig(tlsConfig *tls.Config) ConnOption {
+	return func(conn *Conn) {
+		conn.tlsConfig = tlsConfig
+	}
+}
+
+// WithConnProxy is a nakama websocket connection option to set the proxy func
+// used when dialing the websocket (see http.ProxyURL and
+// http.ProxyFromEnvironment).
+func WithConnProxy(proxy func(*http.Request) (*url.URL, error)) ConnOption {
+	return func(conn *Conn) {
+		conn.proxy = proxy
+	}
+}
+
+// WithConnSubprotocols is a nakama websocket connection option to set the
+// websocket subprotocols requested during the handshake.
+func WithConnSubprotocols(protocols ...string) ConnOption {
+	return func(conn *Conn) {
+		conn.protocols = protocols
+	}
+}
+
 // WithConnLang is a nakama websocket connection option to set the lang query
 // param on the websocket URL.
 func WithConnLang(lang string) ConnOption {
@@ -798,6 +3491,15 @@ func WithConnLang(lang string) ConnOption {
 	}
 }
 
+// WithConnAppearOnline is a nakama websocket connection option to set whether
+// or not the user automatically appears online when the websocket connection
+// is opened, and offline when the connection is closed (see AppearOnline).
+func WithConnAppearOnline(appear bool) ConnOption {
+	return func(conn *Conn) {
+		conn.appear, conn.online = appear, appear
+	}
+}
+
 // WithConnCreateStatus is a nakama websocket connection option to set the
 // status query param on the websocket URL.
 func WithConnCreateStatus(status bool) ConnOption {
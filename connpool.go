@@ -0,0 +1,166 @@
+package nakama
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// ErrConnPoolEmpty is the error returned when sending with an empty pool.
+var ErrConnPoolEmpty = errors.New("connection pool empty")
+
+// ConnPool is a pool of realtime connections, for a single session or
+// multiple sessions, that load-balances outgoing messages across the
+// connections, and aggregates the connections' incoming events. Useful for
+// bot farms and load generation. A pool of connections for a single session
+// requires the server to allow multiple sockets per session (see
+// WithConnSingleSocket).
+type ConnPool struct {
+	conns []*Conn
+	next  atomic.Uint64
+}
+
+// NewConnPool opens n realtime connections with the options, such as
+// WithConnHandler for a single session's client.
+func NewConnPool(ctx context.Context, n int, opts ...ConnOption) (*ConnPool, error) {
+	conns := make([]*Conn, 0, n)
+	for i := 0; i < n; i++ {
+		conn, err := NewConn(ctx, opts...)
+		if err != nil {
+			for _, c := range conns {
+				_ = c.Close()
+			}
+			return nil, fmt.Errorf("unable to open connection %d: %w", i, err)
+		}
+		conns = append(conns, conn)
+	}
+	return NewConnPoolOf(conns...), nil
+}
+
+// NewConnPoolOf creates a pool of the connections, such as connections for
+// multiple sessions.
+func NewConnPoolOf(conns ...*Conn) *ConnPool {
+	return &ConnPool{
+		conns: conns,
+	}
+}
+
+// Conns returns the pool's connections.
+func (p *ConnPool) Conns() []*Conn {
+	return append([]*Conn(nil), p.conns...)
+}
+
+// Len returns the number of connections in the pool.
+func (p *ConnPool) Len() int {
+	return len(p.conns)
+}
+
+// Next returns the next connection, round robin, skipping connections that
+// are not connected. When no connection is connected, the next connection is
+// returned regardless.
+func (p *ConnPool) Next() *Conn {
+	n := uint64(len(p.conns))
+	if n == 0 {
+		return nil
+	}
+	start := p.next.Add(1) - 1
+	for i := uint64(0); i < n; i++ {
+		if conn := p.conns[(start+i)%n]; conn.Status() == ConnConnected {
+			return conn
+		}
+	}
+	return p.conns[start%n]
+}
+
+// Each calls f with each connection, stopping at the first error. Useful to
+// join a match or channel on every connection.
+func (p *ConnPool) Each(ctx context.Context, f func(context.Context, *Conn) error) error {
+	for i, conn := range p.conns {
+		if err := f(ctx, conn); err != nil {
+			return fmt.Errorf("connection %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Send sends a message on the next connection.
+func (p *ConnPool) Send(ctx context.Context, msg, v EnvelopeBuilder) error {
+	conn := p.Next()
+	if conn == nil {
+		return ErrConnPoolEmpty
+	}
+	return conn.Send(ctx, msg, v)
+}
+
+// Rpc sends a rpc on the next connection.
+func (p *ConnPool) Rpc(ctx context.Context, id string, payload, v interface{}) error {
+	conn := p.Next()
+	if conn == nil {
+		return ErrConnPoolEmpty
+	}
+	return conn.Rpc(ctx, id, payload, v)
+}
+
+// MatchDataSend sends match data on the next connection. The match must be
+// joined on every connection in the pool (see Each).
+func (p *ConnPool) MatchDataSend(ctx context.Context, matchId string, opCode OpType, data []byte, reliable bool, presences ...*UserPresenceMsg) error {
+	conn := p.Next()
+	if conn == nil {
+		return ErrConnPoolEmpty
+	}
+	return conn.MatchDataSend(ctx, matchId, opCode, data, reliable, presences...)
+}
+
+// OnMatchData adds a callback for match data received by any connection.
+func (p *ConnPool) OnMatchData(ctx context.Context, f func(*Conn, *MatchDataMsg)) {
+	for _, conn := range p.conns {
+		conn := conn
+		conn.OnMatchData(ctx, func(msg *MatchDataMsg) {
+			f(conn, msg)
+		})
+	}
+}
+
+// OnChannelMessage adds a callback for channel messages received by any
+// connection.
+func (p *ConnPool) OnChannelMessage(ctx context.Context, f func(*Conn, *ChannelMessageMsg)) {
+	for _, conn := range p.conns {
+		conn := conn
+		conn.OnChannelMessage(ctx, func(msg *ChannelMessageMsg) {
+			f(conn, msg)
+		})
+	}
+}
+
+// OnNotifications adds a callback for notifications received by any
+// connection.
+func (p *ConnPool) OnNotifications(ctx context.Context, f func(*Conn, *NotificationsMsg)) {
+	for _, conn := range p.conns {
+		conn := conn
+		conn.OnNotifications(ctx, func(msg *NotificationsMsg) {
+			f(conn, msg)
+		})
+	}
+}
+
+// OnDisconnect adds a callback for any connection disconnecting.
+func (p *ConnPool) OnDisconnect(ctx context.Context, f func(*Conn, *DisconnectReason)) {
+	for _, conn := range p.conns {
+		conn := conn
+		conn.OnDisconnect(ctx, func(reason *DisconnectReason) {
+			f(conn, reason)
+		})
+	}
+}
+
+// Close closes the pool's connections, returning the first error.
+func (p *ConnPool) Close() error {
+	var err error
+	for _, conn := range p.conns {
+		if e := conn.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,404 @@
+// Package console provides a client for the Nakama Console API, for
+// administrative tooling such as listing and banning accounts, inspecting
+// storage, and viewing matches.
+package console
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ascii8/nakama-go"
+	nkapi "github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/rtapi"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Client is a nakama console client.
+type Client struct {
+	cl          *http.Client
+	url         string
+	username    string
+	password    string
+	expiryGrace time.Duration
+	token       string
+	expiry      time.Time
+	rw          sync.RWMutex
+	auth        sync.Mutex
+}
+
+// New creates a nakama console client.
+func New(opts ...Option) *Client {
+	cl := &Client{
+		cl:          http.DefaultClient,
+		url:         "http://127.0.0.1:7351",
+		expiryGrace: 5 * time.Second,
+	}
+	for _, o := range opts {
+		o(cl)
+	}
+	cl.url = strings.TrimSuffix(cl.url, "/")
+	return cl
+}
+
+// Authenticate authenticates with the console credentials. Requests
+// authenticate automatically when the console token is expired.
+func (cl *Client) Authenticate(ctx context.Context) error {
+	cl.auth.Lock()
+	defer cl.auth.Unlock()
+	req := map[string]string{
+		"username": cl.username,
+		"password": cl.password,
+	}
+	var res struct {
+		Token string `json:"token"`
+	}
+	if err := cl.do(ctx, "POST", "v2/console/authenticate", "", nil, req, &res); err != nil {
+		return fmt.Errorf("unable to authenticate: %w", err)
+	}
+	_, expiry, err := nakama.ParseTokenExpiry(res.Token, "console", cl.expiryGrace)
+	if err != nil {
+		return fmt.Errorf("unable to authenticate: %w", err)
+	}
+	cl.rw.Lock()
+	defer cl.rw.Unlock()
+	cl.token, cl.expiry = res.Token, expiry
+	return nil
+}
+
+// Token returns the console token, authenticating when the token is expired.
+func (cl *Client) Token(ctx context.Context) (string, error) {
+	cl.rw.RLock()
+	token, expiry := cl.token, cl.expiry
+	cl.rw.RUnlock()
+	if token != "" && time.Now().Before(expiry) {
+		return token, nil
+	}
+	if err := cl.Authenticate(ctx); err != nil {
+		return "", err
+	}
+	cl.rw.RLock()
+	defer cl.rw.RUnlock()
+	return cl.token, nil
+}
+
+// Do executes a http request with the console token. The response is decoded
+// into v with protojson when v is a proto.Message, and otherwise with
+// encoding/json.
+func (cl *Client) Do(ctx context.Context, method, typ string, query url.Values, msg, v interface{}) error {
+	token, err := cl.Token(ctx)
+	if err != nil {
+		return err
+	}
+	return cl.do(ctx, method, typ, token, query, msg, v)
+}
+
+// do executes a http request.
+func (cl *Client) do(ctx context.Context, method, typ, token string, query url.Values, msg, v interface{}) error {
+	urlstr := cl.url + "/" + typ
+	if len(query) != 0 {
+		urlstr += "?" + query.Encode()
+	}
+	var body io.Reader
+	if msg != nil {
+		buf, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(buf)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, urlstr, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := cl.cl.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nakama.NewClientErrorFromReader(res.StatusCode, res.Body)
+	}
+	if v == nil {
+		return nil
+	}
+	buf, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if m, ok := v.(proto.Message); ok {
+		return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(buf, m)
+	}
+	return json.Unmarshal(buf, v)
+}
+
+// AccountList is a page of accounts.
+type AccountList struct {
+	Users      []*nkapi.User
+	TotalCount int
+	NextCursor string
+}
+
+// Accounts lists the accounts matching the filter (a user id, username, or
+// social id), from the cursor.
+func (cl *Client) Accounts(ctx context.Context, filter, cursor string) (*AccountList, error) {
+	query := url.Values{}
+	if filter != "" {
+		query.Set("filter", filter)
+	}
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+	var res struct {
+		Users      []json.RawMessage `json:"users"`
+		TotalCount int               `json:"total_count"`
+		NextCursor string            `json:"next_cursor"`
+	}
+	if err := cl.Do(ctx, "GET", "v2/console/account", query, nil, &res); err != nil {
+		return nil, fmt.Errorf("unable to list accounts: %w", err)
+	}
+	users, err := unmarshalAll[nkapi.User](res.Users)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list accounts: %w", err)
+	}
+	return &AccountList{
+		Users:      users,
+		TotalCount: res.TotalCount,
+		NextCursor: res.NextCursor,
+	}, nil
+}
+
+// Account is a console account.
+type Account struct {
+	Account *nkapi.Account
+	// DisableTime is when the account was disabled, or the zero time.
+	DisableTime time.Time
+}
+
+// Account retrieves the account.
+func (cl *Client) Account(ctx context.Context, userId string) (*Account, error) {
+	var res struct {
+		Account     json.RawMessage `json:"account"`
+		DisableTime time.Time       `json:"disable_time"`
+	}
+	if err := cl.Do(ctx, "GET", "v2/console/account/"+url.PathEscape(userId), nil, nil, &res); err != nil {
+		return nil, fmt.Errorf("unable to retrieve account: %w", err)
+	}
+	account := new(nkapi.Account)
+	if err := unmarshal(res.Account, account); err != nil {
+		return nil, fmt.Errorf("unable to retrieve account: %w", err)
+	}
+	return &Account{
+		Account:     account,
+		DisableTime: res.DisableTime,
+	}, nil
+}
+
+// BanAccount bans the account.
+func (cl *Client) BanAccount(ctx context.Context, userId string) error {
+	if err := cl.Do(ctx, "POST", "v2/console/account/"+url.PathEscape(userId)+"/ban", nil, nil, nil); err != nil {
+		return fmt.Errorf("unable to ban account: %w", err)
+	}
+	return nil
+}
+
+// UnbanAccount unbans the account.
+func (cl *Client) UnbanAccount(ctx context.Context, userId string) error {
+	if err := cl.Do(ctx, "POST", "v2/console/account/"+url.PathEscape(userId)+"/unban", nil, nil, nil); err != nil {
+		return fmt.Errorf("unable to unban account: %w", err)
+	}
+	return nil
+}
+
+// DeleteAccount deletes the account, optionally recording the deletion.
+func (cl *Client) DeleteAccount(ctx context.Context, userId string, recordDeletion bool) error {
+	query := url.Values{
+		"record_deletion": []string{strconv.FormatBool(recordDeletion)},
+	}
+	if err := cl.Do(ctx, "DELETE", "v2/console/account/"+url.PathEscape(userId), query, nil, nil); err != nil {
+		return fmt.Errorf("unable to delete account: %w", err)
+	}
+	return nil
+}
+
+// StorageList is a page of storage objects. The objects' values are not
+// included.
+type StorageList struct {
+	Objects    []*nkapi.StorageObject
+	TotalCount int
+	NextCursor string
+}
+
+// Storage lists the storage objects, optionally filtered by collection, key,
+// and user id, from the cursor.
+func (cl *Client) Storage(ctx context.Context, collection, key, userId, cursor string) (*StorageList, error) {
+	query := url.Values{}
+	for k, v := range map[string]string{"collection": collection, "key": key, "user_id": userId, "cursor": cursor} {
+		if v != "" {
+			query.Set(k, v)
+		}
+	}
+	var res struct {
+		Objects    []json.RawMessage `json:"objects"`
+		TotalCount int               `json:"total_count"`
+		NextCursor string            `json:"next_cursor"`
+	}
+	if err := cl.Do(ctx, "GET", "v2/console/storage", query, nil, &res); err != nil {
+		return nil, fmt.Errorf("unable to list storage: %w", err)
+	}
+	objects, err := unmarshalAll[nkapi.StorageObject](res.Objects)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list storage: %w", err)
+	}
+	return &StorageList{
+		Objects:    objects,
+		TotalCount: res.TotalCount,
+		NextCursor: res.NextCursor,
+	}, nil
+}
+
+// StorageObject retrieves the storage object, including its value.
+func (cl *Client) StorageObject(ctx context.Context, collection, key, userId string) (*nkapi.StorageObject, error) {
+	typ := "v2/console/storage/" + url.PathEscape(collection) + "/" + url.PathEscape(key) + "/" + url.PathEscape(userId)
+	obj := new(nkapi.StorageObject)
+	if err := cl.Do(ctx, "GET", typ, nil, nil, obj); err != nil {
+		return nil, fmt.Errorf("unable to retrieve storage object: %w", err)
+	}
+	return obj, nil
+}
+
+// Match is a running match and the node running it.
+type Match struct {
+	Match *nkapi.Match
+	Node  string
+}
+
+// Matches lists the running matches, filtered by the query (such as "limit",
+// "authoritative", "label", or "match_id").
+func (cl *Client) Matches(ctx context.Context, query url.Values) ([]*Match, error) {
+	var res struct {
+		Matches []struct {
+			Match json.RawMessage `json:"api_match"`
+			Node  string          `json:"node"`
+		} `json:"matches"`
+	}
+	if err := cl.Do(ctx, "GET", "v2/console/match", query, nil, &res); err != nil {
+		return nil, fmt.Errorf("unable to list matches: %w", err)
+	}
+	matches := make([]*Match, len(res.Matches))
+	for i, m := range res.Matches {
+		match := new(nkapi.Match)
+		if err := unmarshal(m.Match, match); err != nil {
+			return nil, fmt.Errorf("unable to list matches: %w", err)
+		}
+		matches[i] = &Match{
+			Match: match,
+			Node:  m.Node,
+		}
+	}
+	return matches, nil
+}
+
+// MatchState is the state of an authoritative match.
+type MatchState struct {
+	Presences []*rtapi.UserPresence
+	Tick      int64
+	State     string
+}
+
+// MatchState retrieves the state of the authoritative match.
+func (cl *Client) MatchState(ctx context.Context, matchId string) (*MatchState, error) {
+	var res struct {
+		Presences []json.RawMessage `json:"presences"`
+		Tick      int64             `json:"tick,string"`
+		State     string            `json:"state"`
+	}
+	if err := cl.Do(ctx, "GET", "v2/console/match/"+url.PathEscape(matchId)+"/state", nil, nil, &res); err != nil {
+		return nil, fmt.Errorf("unable to retrieve match state: %w", err)
+	}
+	presences, err := unmarshalAll[rtapi.UserPresence](res.Presences)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve match state: %w", err)
+	}
+	return &MatchState{
+		Presences: presences,
+		Tick:      res.Tick,
+		State:     res.State,
+	}, nil
+}
+
+// unmarshal unmarshals the protojson encoded message.
+func unmarshal(buf []byte, msg proto.Message) error {
+	if len(buf) == 0 {
+		return nil
+	}
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(buf, msg)
+}
+
+// unmarshalAll unmarshals the protojson encoded messages.
+func unmarshalAll[T any, P interface {
+	*T
+	proto.Message
+}](bufs []json.RawMessage) ([]P, error) {
+	msgs := make([]P, len(bufs))
+	for i, buf := range bufs {
+		msgs[i] = P(new(T))
+		if err := unmarshal(buf, msgs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return msgs, nil
+}
+
+// Option is a nakama console client option.
+type Option func(*Client)
+
+// WithURL is a nakama console client option to set the console url. Defaults
+// to http://127.0.0.1:7351.
+func WithURL(urlstr string) Option {
+	return func(cl *Client) {
+		cl.url = urlstr
+	}
+}
+
+// WithCredentials is a nakama console client option to set the console
+// username and password.
+func WithCredentials(username, password string) Option {
+	return func(cl *Client) {
+		cl.username, cl.password = username, password
+	}
+}
+
+// WithHttpClient is a nakama console client option to set the http client
+// used.
+func WithHttpClient(httpClient *http.Client) Option {
+	return func(cl *Client) {
+		cl.cl = httpClient
+	}
+}
+
+// WithExpiryGrace is a nakama console client option to set the grace period
+// before the console token's expiry, after which the client authenticates
+// again.
+func WithExpiryGrace(expiryGrace time.Duration) Option {
+	return func(cl *Client) {
+		cl.expiryGrace = expiryGrace
+	}
+}
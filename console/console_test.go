@@ -0,0 +1,66 @@
+package console
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	token := newToken(time.Now().Add(time.Hour))
+	var banned string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/v2/console/authenticate" {
+			var v map[string]string
+			_ = json.NewDecoder(req.Body).Decode(&v)
+			if v["username"] != "admin" || v["password"] != "password" {
+				http.Error(w, `{"code":16,"message":"invalid credentials"}`, http.StatusUnauthorized)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{"token": token})
+			return
+		}
+		if req.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, `{"code":16,"message":"bad token"}`, http.StatusUnauthorized)
+			return
+		}
+		switch req.URL.Path {
+		case "/v2/console/account":
+			_, _ = w.Write([]byte(`{"users":[{"id":"u1","username":"bob","create_time":"2022-01-01T00:00:00Z"}],"total_count":1}`))
+		case "/v2/console/account/u1/ban":
+			banned = "u1"
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			http.Error(w, `{"code":5,"message":"not found"}`, http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	cl := New(
+		WithURL(srv.URL),
+		WithCredentials("admin", "password"),
+	)
+	switch res, err := cl.Accounts(ctx, "", ""); {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case len(res.Users) != 1 || res.Users[0].Username != "bob" || res.TotalCount != 1:
+		t.Errorf("expected bob, got: %+v", res)
+	}
+	if err := cl.BanAccount(ctx, "u1"); err != nil || banned != "u1" {
+		t.Errorf("expected u1 banned, got: %q %v", banned, err)
+	}
+	if _, err := cl.MatchState(ctx, "missing"); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+// newToken creates an unsigned jwt token with the expiry.
+func newToken(exp time.Time) string {
+	buf, _ := json.Marshal(map[string]interface{}{"exp": exp.Unix()})
+	return "e30." + base64.RawURLEncoding.EncodeToString(buf) + ".sig"
+}
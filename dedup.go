@@ -0,0 +1,73 @@
+package nakama
+
+import (
+	"context"
+	"sort"
+)
+
+// recentCids is the number of completed request cids remembered to detect
+// duplicate responses.
+const recentCids = 256
+
+// WithConnRetry is a nakama websocket connection option to resend pending
+// requests marked as idempotent (see Idempotent) after a persistent
+// connection reconnects, instead of failing them with the disconnect reason.
+// Resent requests keep their cid, and late duplicate responses to completed
+// requests are dropped, instead of being dispatched as orphan responses.
+func WithConnRetry(retry bool) ConnOption {
+	return func(conn *Conn) {
+		conn.retry = retry
+	}
+}
+
+// isIdempotentContext returns true when the context marks requests as idempotent.
+func isIdempotentContext(ctx context.Context) bool {
+	v, _ := ctx.Value(idempotentKey{}).(bool)
+	return v
+}
+
+// takeRetryable removes and returns the pending requests to resend after
+// reconnecting, in the order they were sent.
+func (conn *Conn) takeRetryable() []*req {
+	conn.rw.Lock()
+	var l []*req
+	for cid, m := range conn.l {
+		if m.retry {
+			l = append(l, m)
+			delete(conn.l, cid)
+		}
+	}
+	conn.rw.Unlock()
+	sort.Slice(l, func(i, j int) bool {
+		return l[i].seq < l[j].seq
+	})
+	return l
+}
+
+// complete remembers the cid of a completed request.
+func (conn *Conn) complete(cid string) {
+	if !conn.retry {
+		return
+	}
+	conn.rw.Lock()
+	defer conn.rw.Unlock()
+	if conn.recent == nil {
+		conn.recent = make(map[string]bool, recentCids)
+	}
+	if len(conn.recentl) == recentCids {
+		delete(conn.recent, conn.recentl[0])
+		conn.recentl = conn.recentl[1:]
+	}
+	conn.recent[cid] = true
+	conn.recentl = append(conn.recentl, cid)
+}
+
+// isDuplicate returns true when the cid is of a completed request.
+func (conn *Conn) isDuplicate(cid string) bool {
+	if !conn.retry {
+		return false
+	}
+	conn.rw.RLock()
+	defer conn.rw.RUnlock()
+	return conn.recent[cid]
+}
@@ -0,0 +1,212 @@
+package nakama
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+// endpointStagger is the delay before dialing the next endpoint while the
+// previous endpoints are still dialing, as per RFC 8305 (happy eyeballs).
+const endpointStagger = 250 * time.Millisecond
+
+// endpointProbeTimeout is the timeout of an endpoint latency probe.
+const endpointProbeTimeout = 2 * time.Second
+
+// Endpoint returns the url of the websocket endpoint last opened.
+func (conn *Conn) Endpoint() string {
+	conn.rw.RLock()
+	defer conn.rw.RUnlock()
+	return conn.endpoint
+}
+
+// Migrate closes the websocket connection and reopens it with the endpoint
+// url, such as to move to another regional edge. The endpoint does not need
+// to be one of the connection's endpoints (see WithConnEndpoints). Only
+// persistent connections can be migrated (see WithConnPersist). Connect
+// callbacks are called once the websocket connection is reopened.
+func (conn *Conn) Migrate(urlstr string) error {
+	if !conn.persist {
+		return fmt.Errorf("unable to migrate to %s: connection is not persistent", urlstr)
+	}
+	if conn.closed.Load() {
+		return ErrConnClosed
+	}
+	conn.rw.Lock()
+	conn.preferred = urlstr
+	d := conn.socket
+	conn.rw.Unlock()
+	conn.logger.Log(LevelInfo, "migrating", "endpoint", urlstr)
+	// when the run loop has not started the socket, the socket is closed
+	// once started
+	if d != nil {
+		d.close(&DisconnectReason{Cause: DisconnectMigrate})
+	}
+	return nil
+}
+
+// endpointURLs returns the endpoint urls to dial, in order, with the endpoint
+// url passed to Migrate first.
+func (conn *Conn) endpointURLs(ctx context.Context, urlstr string) []string {
+	urls := []string{urlstr}
+	if len(conn.endpoints) != 0 {
+		urls = append([]string(nil), conn.endpoints...)
+		if conn.probe {
+			urls = probeEndpoints(ctx, urls)
+		}
+	}
+	conn.rw.Lock()
+	preferred := conn.preferred
+	conn.preferred = ""
+	conn.rw.Unlock()
+	if preferred == "" {
+		return urls
+	}
+	l := []string{preferred}
+	for _, u := range urls {
+		if u != preferred {
+			l = append(l, u)
+		}
+	}
+	return l
+}
+
+// dialEndpoints dials the endpoint urls, starting the next dial when the
+// previous dial fails or has not completed after a short delay, returning
+// the first opened websocket connection. Dials are sequential when write
+// coalescing is enabled, as the coalescing conn is set when dialing.
+func (conn *Conn) dialEndpoints(ctx context.Context, urls []string, query string, opts *websocket.DialOptions) (*websocket.Conn, string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		ws     *websocket.Conn
+		urlstr string
+		err    error
+	}
+	ch := make(chan result, len(urls))
+	next, pending := 0, 0
+	start := func() {
+		urlstr := urls[next]
+		next, pending = next+1, pending+1
+		go func() {
+			ws, _, err := websocket.Dial(ctx, urlstr+"?"+query, opts)
+			ch <- result{ws, urlstr, err}
+		}()
+	}
+	start()
+	var first error
+	for pending != 0 {
+		var stagger <-chan time.Time
+		if next < len(urls) && conn.coalesce == 0 {
+			t := time.NewTimer(endpointStagger)
+			defer t.Stop()
+			stagger = t.C
+		}
+		select {
+		case <-stagger:
+			start()
+		case r := <-ch:
+			pending--
+			if r.err == nil {
+				// close the connections opened by the remaining dials
+				go func(n int) {
+					for i := 0; i < n; i++ {
+						if r := <-ch; r.ws != nil {
+							_ = r.ws.Close(websocket.StatusNormalClosure, "")
+						}
+					}
+				}(pending)
+				return r.ws, r.urlstr, nil
+			}
+			if first == nil {
+				first = fmt.Errorf("unable to open nakama websocket %s: %w", r.urlstr, r.err)
+			}
+			conn.logger.Log(LevelWarn, "unable to open endpoint", "endpoint", r.urlstr, "err", r.err)
+			if next < len(urls) {
+				start()
+			}
+		}
+	}
+	return nil, "", first
+}
+
+// probeEndpoints measures the tcp connect latency of the endpoint urls,
+// returning the urls ordered by latency, followed by the unreachable urls.
+func probeEndpoints(ctx context.Context, urls []string) []string {
+	ctx, cancel := context.WithTimeout(ctx, endpointProbeTimeout)
+	defer cancel()
+	latencies := make([]time.Duration, len(urls))
+	var wg sync.WaitGroup
+	for i, urlstr := range urls {
+		wg.Add(1)
+		go func(i int, urlstr string) {
+			defer wg.Done()
+			latencies[i] = probeEndpoint(ctx, urlstr)
+		}(i, urlstr)
+	}
+	wg.Wait()
+	idx := make([]int, len(urls))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		a, b := latencies[idx[i]], latencies[idx[j]]
+		return a >= 0 && (b < 0 || a < b)
+	})
+	l := make([]string, len(urls))
+	for i, j := range idx {
+		l[i] = urls[j]
+	}
+	return l
+}
+
+// probeEndpoint returns the tcp connect latency of the endpoint url, or -1
+// when the endpoint is unreachable.
+func probeEndpoint(ctx context.Context, urlstr string) time.Duration {
+	u, err := url.Parse(urlstr)
+	if err != nil {
+		return -1
+	}
+	host := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "wss" || u.Scheme == "https" {
+			port = "443"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+	start := time.Now()
+	nc, err := (&net.Dialer{}).DialContext(ctx, "tcp", host)
+	if err != nil {
+		return -1
+	}
+	d := time.Since(start)
+	_ = nc.Close()
+	return d
+}
+
+// WithConnEndpoints is a nakama websocket connection option to set the
+// websocket urls of multiple endpoints, such as regional edges, overriding
+// the url. Endpoints are dialed in order, dialing the next endpoint when the
+// previous endpoint fails or is slow to open, and using the first endpoint
+// opened (see Endpoint).
+func WithConnEndpoints(urls ...string) ConnOption {
+	return func(conn *Conn) {
+		conn.endpoints = append(conn.endpoints, urls...)
+	}
+}
+
+// WithConnEndpointProbe is a nakama websocket connection option to set
+// whether or not the endpoints' latencies are probed before dialing, dialing
+// the fastest endpoints first.
+func WithConnEndpointProbe(probe bool) ConnOption {
+	return func(conn *Conn) {
+		conn.probe = probe
+	}
+}
@@ -0,0 +1,38 @@
+package nakama
+
+import (
+	"github.com/heroiclabs/nakama-common/rtapi"
+	"google.golang.org/protobuf/proto"
+)
+
+// EnvelopeCodec is the interface for realtime envelope codecs, used when the
+// message encoding format is protobuf (see WithConnEnvelopeCodec).
+type EnvelopeCodec interface {
+	Marshal(env *rtapi.Envelope) ([]byte, error)
+	Unmarshal(buf []byte, env *rtapi.Envelope) error
+}
+
+// ProtoCodec encodes envelopes with the protobuf runtime.
+var ProtoCodec EnvelopeCodec = protoCodec{}
+
+// protoCodec is a protobuf runtime envelope codec.
+type protoCodec struct{}
+
+// Marshal satisfies the EnvelopeCodec interface.
+func (protoCodec) Marshal(env *rtapi.Envelope) ([]byte, error) {
+	return proto.Marshal(env)
+}
+
+// Unmarshal satisfies the EnvelopeCodec interface.
+func (protoCodec) Unmarshal(buf []byte, env *rtapi.Envelope) error {
+	return proto.Unmarshal(buf, env)
+}
+
+// WithConnEnvelopeCodec is a nakama websocket connection option to set the
+// envelope codec used when the message encoding format is protobuf, such as
+// one using vtprotobuf generated marshal methods (default: ProtoCodec).
+func WithConnEnvelopeCodec(codec EnvelopeCodec) ConnOption {
+	return func(conn *Conn) {
+		conn.codec = codec
+	}
+}
@@ -0,0 +1,104 @@
+package nakama
+
+import (
+	"context"
+	"time"
+)
+
+// expiryPoll is the interval at which the handler's session token is polled
+// while waiting for the session to be refreshed (see WithConnTokenRefresh).
+const expiryPoll = 1 * time.Second
+
+// SessionExpiry returns the expiry of the session token used to open the
+// websocket connection, or the zero time when the token has no expiry.
+func (conn *Conn) SessionExpiry() time.Time {
+	conn.rw.RLock()
+	defer conn.rw.RUnlock()
+	return conn.expiry
+}
+
+// OnSessionExpiring adds a callback called with the remaining time to live
+// when the session token used to open the websocket connection is about to
+// expire (see WithConnExpiryLead), such as to refresh the session and
+// reconnect. The callback is removed when the context is closed.
+func (conn *Conn) OnSessionExpiring(ctx context.Context, f func(ttl time.Duration)) {
+	conn.expiringHandlers.add(ctx, f)
+}
+
+// watchExpiry dispatches the session expiring callbacks when the session
+// token used to open the websocket connection is about to expire, and, when
+// token refresh is enabled, reopens the websocket connection with the
+// refreshed session token before the session token expires.
+func (conn *Conn) watchExpiry(ctx context.Context, d *disconnect) {
+	expiry := conn.SessionExpiry()
+	if expiry.IsZero() {
+		return
+	}
+	t := time.NewTimer(time.Until(expiry) - conn.expiryLead)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return
+	case <-t.C:
+	}
+	ttl := time.Until(expiry)
+	conn.logger.Log(LevelInfo, "session expiring", "ttl", ttl)
+	conn.expiringHandlers.dispatch(ttl)
+	if conn.refresh && conn.token == "" && conn.h != nil {
+		conn.reauth(ctx, d, expiry)
+	}
+}
+
+// reauth polls the handler for a refreshed session token, closing the
+// websocket connection so that it is reopened with the refreshed session
+// token, until the session token used to open the websocket connection
+// expires.
+func (conn *Conn) reauth(ctx context.Context, d *disconnect, expiry time.Time) {
+	for {
+		token, err := conn.h.Token(ctx)
+		switch {
+		case ctx.Err() != nil:
+			// closed, such as by the handler's token refresh callback
+			return
+		case err != nil:
+			conn.logger.Log(LevelWarn, "unable to refresh session", "err", err)
+		case tokenExpiry(token).After(expiry):
+			conn.logger.Log(LevelInfo, "session token refreshed, reconnecting")
+			d.close(&DisconnectReason{Cause: DisconnectTokenRefresh})
+			return
+		}
+		wait := time.Until(expiry)
+		if wait <= 0 {
+			conn.logger.Log(LevelWarn, "session expired before refresh")
+			return
+		}
+		if wait > expiryPoll {
+			wait = expiryPoll
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// tokenExpiry returns the expiry of a session token, or the zero time when the
+// token is not a jwt token or has no expiry.
+func tokenExpiry(token string) time.Time {
+	claims, err := parseToken(token, "session")
+	if err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
+
+// WithConnExpiryLead is a nakama websocket connection option to set how long
+// before the session token used to open the websocket connection expires the
+// session expiring callbacks are called (see OnSessionExpiring) and, with
+// token refresh, the session is refreshed (default: 30s).
+func WithConnExpiryLead(lead time.Duration) ConnOption {
+	return func(conn *Conn) {
+		conn.expiryLead = lead
+	}
+}
@@ -0,0 +1,521 @@
+package nakama
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	nkapi "github.com/heroiclabs/nakama-common/api"
+	"go.opentelemetry.io/otel"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// GrpcTransport is a http.RoundTripper that executes the client's http
+// requests against Nakama's gRPC API. Requests not part of the API (such as
+// the realtime websocket) are passed to the fallback transport.
+//
+// Use with the WithTransport option:
+//
+//	cl := nakama.New(
+//		nakama.WithServerKey("..."),
+//		nakama.WithTransport(nakama.NewGrpcTransport("127.0.0.1:7349")),
+//	)
+type GrpcTransport struct {
+	addr        string
+	tls         *tls.Config
+	dialOpts    []grpc.DialOption
+	fallback    http.RoundTripper
+	marshaler   *protojson.MarshalOptions
+	unmarshaler *protojson.UnmarshalOptions
+
+	once sync.Once
+	conn *grpc.ClientConn
+	err  error
+}
+
+// NewGrpcTransport creates a new gRPC transport for the Nakama gRPC address
+// (ie, 127.0.0.1:7349). The connection is established on first use.
+func NewGrpcTransport(addr string, opts ...GrpcOption) *GrpcTransport {
+	t := &GrpcTransport{
+		addr:     addr,
+		fallback: http.DefaultTransport,
+		marshaler: &protojson.MarshalOptions{
+			UseProtoNames:  true,
+			UseEnumNumbers: true,
+		},
+		unmarshaler: &protojson.UnmarshalOptions{
+			DiscardUnknown: true,
+		},
+	}
+	for _, o := range opts {
+		o(t)
+	}
+	return t
+}
+
+// RoundTrip satisfies the http.RoundTripper interface.
+func (t *GrpcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r, params := grpcMatch(req.Method, strings.TrimPrefix(req.URL.Path, "/"))
+	if r == nil {
+		return t.fallback.RoundTrip(req)
+	}
+	if req.Body != nil {
+		defer req.Body.Close()
+	}
+	conn, err := t.dial()
+	if err != nil {
+		return nil, err
+	}
+	// build request
+	in, err := t.buildRequest(req, r, params)
+	if err != nil {
+		return nil, err
+	}
+	var opts []grpc.CallOption
+	if auth := grpcAuthorization(req); auth != "" {
+		opts = append(opts, grpc.PerRPCCredentials(grpcCredentials(auth)))
+	}
+	// propagate trace context as metadata
+	ctx := req.Context()
+	for _, k := range otel.GetTextMapPropagator().Fields() {
+		if v := req.Header.Get(k); v != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, strings.ToLower(k), v)
+		}
+	}
+	// invoke
+	out := r.res()
+	if err := conn.Invoke(ctx, "/nakama.api.Nakama/"+r.name, in, out, opts...); err != nil {
+		s, ok := status.FromError(err)
+		if !ok || s.Code() == codes.Unavailable || s.Code() == codes.Canceled || s.Code() == codes.DeadlineExceeded {
+			return nil, err
+		}
+		buf, _ := json.Marshal(map[string]interface{}{
+			"code":    s.Code(),
+			"message": s.Message(),
+		})
+		return grpcResponse(req, grpcStatusCode(s.Code()), buf), nil
+	}
+	// encode response
+	if rpc, ok := out.(*nkapi.Rpc); ok {
+		return grpcResponse(req, http.StatusOK, []byte(rpc.Payload)), nil
+	}
+	buf, err := t.marshaler.Marshal(out)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal %s response: %w", r.name, err)
+	}
+	return grpcResponse(req, http.StatusOK, buf), nil
+}
+
+// Close closes the underlying gRPC connection.
+func (t *GrpcTransport) Close() error {
+	if t.conn != nil {
+		return t.conn.Close()
+	}
+	return nil
+}
+
+// dial dials the gRPC connection.
+func (t *GrpcTransport) dial() (*grpc.ClientConn, error) {
+	t.once.Do(func() {
+		creds := insecure.NewCredentials()
+		if t.tls != nil {
+			creds = credentials.NewTLS(t.tls)
+		}
+		opts := append([]grpc.DialOption{grpc.WithTransportCredentials(creds)}, t.dialOpts...)
+		if t.conn, t.err = grpc.Dial(t.addr, opts...); t.err != nil {
+			t.err = fmt.Errorf("unable to dial %s: %w", t.addr, t.err)
+		}
+	})
+	return t.conn, t.err
+}
+
+// buildRequest builds the gRPC request message for the http request, decoding
+// the body, path params and query values to the message's fields.
+func (t *GrpcTransport) buildRequest(req *http.Request, r *grpcRoute, params map[string]string) (proto.Message, error) {
+	in := r.req()
+	msg := in.ProtoReflect()
+	// body
+	if req.Body != nil && r.body != "" {
+		buf, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		if err := t.decodeBody(msg, r.body, buf); err != nil {
+			return nil, fmt.Errorf("unable to decode %s request: %w", r.name, err)
+		}
+	}
+	// query
+	for k, v := range req.URL.Query() {
+		if err := grpcSetField(msg, k, v); err != nil {
+			return nil, fmt.Errorf("invalid %s query param %q: %w", r.name, k, err)
+		}
+	}
+	// path params
+	for k, v := range params {
+		if err := grpcSetField(msg, k, []string{v}); err != nil {
+			return nil, fmt.Errorf("invalid %s path param %q: %w", r.name, k, err)
+		}
+	}
+	return in, nil
+}
+
+// decodeBody decodes buf to the field of msg, or to msg itself when field is
+// "*".
+func (t *GrpcTransport) decodeBody(msg protoreflect.Message, field string, buf []byte) error {
+	if len(bytes.TrimSpace(buf)) == 0 {
+		return nil
+	}
+	if field == "*" {
+		return t.unmarshaler.Unmarshal(buf, msg.Interface())
+	}
+	fd := msg.Descriptor().Fields().ByName(protoreflect.Name(field))
+	switch {
+	case fd == nil:
+		return fmt.Errorf("unknown body field %q", field)
+	case fd.Kind() == protoreflect.StringKind:
+		msg.Set(fd, protoreflect.ValueOfString(string(buf)))
+		return nil
+	case fd.Kind() == protoreflect.MessageKind:
+		return t.unmarshaler.Unmarshal(buf, msg.Mutable(fd).Message().Interface())
+	}
+	return fmt.Errorf("unsupported body field %q", field)
+}
+
+// GrpcOption is a gRPC transport option.
+type GrpcOption func(*GrpcTransport)
+
+// WithGrpcTLS is a gRPC transport option to set the TLS config used to
+// connect.
+func WithGrpcTLS(tls *tls.Config) GrpcOption {
+	return func(t *GrpcTransport) {
+		t.tls = tls
+	}
+}
+
+// WithGrpcDialOptions is a gRPC transport option to add additional dial
+// options.
+func WithGrpcDialOptions(opts ...grpc.DialOption) GrpcOption {
+	return func(t *GrpcTransport) {
+		t.dialOpts = append(t.dialOpts, opts...)
+	}
+}
+
+// WithGrpcFallback is a gRPC transport option to set the http transport used
+// for requests not part of the gRPC API.
+func WithGrpcFallback(fallback http.RoundTripper) GrpcOption {
+	return func(t *GrpcTransport) {
+		t.fallback = fallback
+	}
+}
+
+// grpcCredentials are per-RPC authorization credentials.
+type grpcCredentials string
+
+// GetRequestMetadata satisfies the credentials.PerRPCCredentials interface.
+func (c grpcCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": string(c)}, nil
+}
+
+// RequireTransportSecurity satisfies the credentials.PerRPCCredentials
+// interface.
+func (c grpcCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// grpcAuthorization returns the authorization for the request, either from
+// the Authorization header, or the url's user info.
+func grpcAuthorization(req *http.Request) string {
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		return auth
+	}
+	if req.URL.User != nil {
+		password, _ := req.URL.User.Password()
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(req.URL.User.Username()+":"+password))
+	}
+	return ""
+}
+
+// grpcResponse creates a http response for the request.
+func grpcResponse(req *http.Request, statusCode int, buf []byte) *http.Response {
+	return &http.Response{
+		Status:        strconv.Itoa(statusCode) + " " + http.StatusText(statusCode),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(buf)),
+		ContentLength: int64(len(buf)),
+		Request:       req,
+	}
+}
+
+// grpcStatusCode returns the http status code for a gRPC code, using the same
+// mapping as the Nakama http gateway.
+func grpcStatusCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// grpcSetField sets the named field (by proto or json name) on msg. Unknown
+// fields are ignored.
+func grpcSetField(msg protoreflect.Message, name string, values []string) error {
+	fields := msg.Descriptor().Fields()
+	fd := fields.ByName(protoreflect.Name(name))
+	if fd == nil {
+		fd = fields.ByJSONName(name)
+	}
+	if fd == nil || len(values) == 0 {
+		return nil
+	}
+	if fd.IsList() {
+		list := msg.Mutable(fd).List()
+		for _, s := range values {
+			v, err := grpcValue(msg, fd, s)
+			if err != nil {
+				return err
+			}
+			list.Append(v)
+		}
+		return nil
+	}
+	v, err := grpcValue(msg, fd, values[len(values)-1])
+	if err != nil {
+		return err
+	}
+	msg.Set(fd, v)
+	return nil
+}
+
+// grpcValue parses s as a value for the field. Message fields are only
+// supported for the wrapper types.
+func grpcValue(msg protoreflect.Message, fd protoreflect.FieldDescriptor, s string) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(s), nil
+	case protoreflect.BytesKind:
+		return protoreflect.ValueOfBytes([]byte(s)), nil
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(s)
+		return protoreflect.ValueOfBool(b), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		i, err := strconv.ParseInt(s, 10, 32)
+		return protoreflect.ValueOfInt32(int32(i)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		i, err := strconv.ParseInt(s, 10, 64)
+		return protoreflect.ValueOfInt64(i), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		i, err := strconv.ParseUint(s, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(i)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		i, err := strconv.ParseUint(s, 10, 64)
+		return protoreflect.ValueOfUint64(i), err
+	case protoreflect.EnumKind:
+		if v := fd.Enum().Values().ByName(protoreflect.Name(s)); v != nil {
+			return protoreflect.ValueOfEnum(v.Number()), nil
+		}
+		i, err := strconv.ParseInt(s, 10, 32)
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(i)), err
+	case protoreflect.MessageKind:
+		if fd.IsList() {
+			break
+		}
+		m := msg.NewField(fd).Message()
+		inner := m.Descriptor().Fields().ByName("value")
+		if inner == nil {
+			break
+		}
+		v, err := grpcValue(m, inner, s)
+		if err != nil {
+			return protoreflect.Value{}, err
+		}
+		m.Set(inner, v)
+		return protoreflect.ValueOfMessage(m), nil
+	}
+	return protoreflect.Value{}, fmt.Errorf("unsupported field type %s", fd.Kind())
+}
+
+// grpcRoute is a http to gRPC route.
+type grpcRoute struct {
+	method string
+	path   []string
+	name   string
+	body   string
+	req    func() proto.Message
+	res    func() proto.Message
+}
+
+// grpcMatch returns the route and path params for the http method and path.
+func grpcMatch(method, path string) (*grpcRoute, map[string]string) {
+	v := strings.Split(path, "/")
+outer:
+	for _, r := range grpcRoutes {
+		if r.method != method || len(r.path) != len(v) {
+			continue
+		}
+		params := make(map[string]string)
+		for i, s := range r.path {
+			switch {
+			case strings.HasPrefix(s, "{"):
+				params[strings.Trim(s, "{}")] = v[i]
+			case s != v[i]:
+				continue outer
+			}
+		}
+		return r, params
+	}
+	return nil, nil
+}
+
+// grpcRoutes are the http to gRPC routes.
+var grpcRoutes []*grpcRoute
+
+func init() {
+	empty := func() proto.Message { return new(emptypb.Empty) }
+	session := func() proto.Message { return new(nkapi.Session) }
+	add := func(method, path, name, body string, req, res func() proto.Message) {
+		grpcRoutes = append(grpcRoutes, &grpcRoute{
+			method: method,
+			path:   strings.Split(path, "/"),
+			name:   name,
+			body:   body,
+			req:    req,
+			res:    res,
+		})
+	}
+	// account
+	add("GET", "healthcheck", "Healthcheck", "", empty, empty)
+	add("GET", "v2/account", "GetAccount", "", empty, func() proto.Message { return new(nkapi.Account) })
+	add("PUT", "v2/account", "UpdateAccount", "*", func() proto.Message { return new(nkapi.UpdateAccountRequest) }, empty)
+	add("DELETE", "v2/account", "DeleteAccount", "", empty, empty)
+	add("POST", "v2/account/session/refresh", "SessionRefresh", "*", func() proto.Message { return new(nkapi.SessionRefreshRequest) }, session)
+	add("POST", "v2/session/logout", "SessionLogout", "*", func() proto.Message { return new(nkapi.SessionLogoutRequest) }, empty)
+	// authenticate
+	add("POST", "v2/account/authenticate/apple", "AuthenticateApple", "account", func() proto.Message { return new(nkapi.AuthenticateAppleRequest) }, session)
+	add("POST", "v2/account/authenticate/custom", "AuthenticateCustom", "account", func() proto.Message { return new(nkapi.AuthenticateCustomRequest) }, session)
+	add("POST", "v2/account/authenticate/device", "AuthenticateDevice", "account", func() proto.Message { return new(nkapi.AuthenticateDeviceRequest) }, session)
+	add("POST", "v2/account/authenticate/email", "AuthenticateEmail", "account", func() proto.Message { return new(nkapi.AuthenticateEmailRequest) }, session)
+	add("POST", "v2/account/authenticate/facebook", "AuthenticateFacebook", "account", func() proto.Message { return new(nkapi.AuthenticateFacebookRequest) }, session)
+	add("POST", "v2/account/authenticate/facebookinstantgame", "AuthenticateFacebookInstantGame", "account", func() proto.Message { return new(nkapi.AuthenticateFacebookInstantGameRequest) }, session)
+	add("POST", "v2/account/authenticate/gamecenter", "AuthenticateGameCenter", "account", func() proto.Message { return new(nkapi.AuthenticateGameCenterRequest) }, session)
+	add("POST", "v2/account/authenticate/google", "AuthenticateGoogle", "account", func() proto.Message { return new(nkapi.AuthenticateGoogleRequest) }, session)
+	add("POST", "v2/account/authenticate/steam", "AuthenticateSteam", "account", func() proto.Message { return new(nkapi.AuthenticateSteamRequest) }, session)
+	// link
+	add("POST", "v2/account/link/apple", "LinkApple", "*", func() proto.Message { return new(nkapi.AccountApple) }, empty)
+	add("POST", "v2/account/link/custom", "LinkCustom", "*", func() proto.Message { return new(nkapi.AccountCustom) }, empty)
+	add("POST", "v2/account/link/device", "LinkDevice", "*", func() proto.Message { return new(nkapi.AccountDevice) }, empty)
+	add("POST", "v2/account/link/email", "LinkEmail", "*", func() proto.Message { return new(nkapi.AccountEmail) }, empty)
+	add("POST", "v2/account/link/facebook", "LinkFacebook", "account", func() proto.Message { return new(nkapi.LinkFacebookRequest) }, empty)
+	add("POST", "v2/account/link/facebookinstantgame", "LinkFacebookInstantGame", "*", func() proto.Message { return new(nkapi.AccountFacebookInstantGame) }, empty)
+	add("POST", "v2/account/link/gamecenter", "LinkGameCenter", "*", func() proto.Message { return new(nkapi.AccountGameCenter) }, empty)
+	add("POST", "v2/account/link/google", "LinkGoogle", "*", func() proto.Message { return new(nkapi.AccountGoogle) }, empty)
+	add("POST", "v2/account/link/steam", "LinkSteam", "account", func() proto.Message { return new(nkapi.LinkSteamRequest) }, empty)
+	// unlink
+	add("POST", "v2/account/unlink/apple", "UnlinkApple", "*", func() proto.Message { return new(nkapi.AccountApple) }, empty)
+	add("POST", "v2/account/unlink/custom", "UnlinkCustom", "*", func() proto.Message { return new(nkapi.AccountCustom) }, empty)
+	add("POST", "v2/account/unlink/device", "UnlinkDevice", "*", func() proto.Message { return new(nkapi.AccountDevice) }, empty)
+	add("POST", "v2/account/unlink/email", "UnlinkEmail", "*", func() proto.Message { return new(nkapi.AccountEmail) }, empty)
+	add("POST", "v2/account/unlink/facebook", "UnlinkFacebook", "*", func() proto.Message { return new(nkapi.AccountFacebook) }, empty)
+	add("POST", "v2/account/unlink/facebookinstantgame", "UnlinkFacebookInstantGame", "*", func() proto.Message { return new(nkapi.AccountFacebookInstantGame) }, empty)
+	add("POST", "v2/account/unlink/gamecenter", "UnlinkGameCenter", "*", func() proto.Message { return new(nkapi.AccountGameCenter) }, empty)
+	add("POST", "v2/account/unlink/google", "UnlinkGoogle", "*", func() proto.Message { return new(nkapi.AccountGoogle) }, empty)
+	add("POST", "v2/account/unlink/steam", "UnlinkSteam", "*", func() proto.Message { return new(nkapi.AccountSteam) }, empty)
+	// channel
+	add("GET", "v2/channel/{channel_id}", "ListChannelMessages", "", func() proto.Message { return new(nkapi.ListChannelMessagesRequest) }, func() proto.Message { return new(nkapi.ChannelMessageList) })
+	// event
+	add("POST", "v2/event", "Event", "*", func() proto.Message { return new(nkapi.Event) }, empty)
+	// friend
+	add("GET", "v2/friend", "ListFriends", "", func() proto.Message { return new(nkapi.ListFriendsRequest) }, func() proto.Message { return new(nkapi.FriendList) })
+	add("POST", "v2/friend", "AddFriends", "", func() proto.Message { return new(nkapi.AddFriendsRequest) }, empty)
+	add("DELETE", "v2/friend", "DeleteFriends", "", func() proto.Message { return new(nkapi.DeleteFriendsRequest) }, empty)
+	add("POST", "v2/friend/block", "BlockFriends", "", func() proto.Message { return new(nkapi.BlockFriendsRequest) }, empty)
+	add("POST", "v2/friend/facebook", "ImportFacebookFriends", "account", func() proto.Message { return new(nkapi.ImportFacebookFriendsRequest) }, empty)
+	add("POST", "v2/friend/steam", "ImportSteamFriends", "account", func() proto.Message { return new(nkapi.ImportSteamFriendsRequest) }, empty)
+	// group
+	add("GET", "v2/group", "ListGroups", "", func() proto.Message { return new(nkapi.ListGroupsRequest) }, func() proto.Message { return new(nkapi.GroupList) })
+	add("POST", "v2/group", "CreateGroup", "*", func() proto.Message { return new(nkapi.CreateGroupRequest) }, func() proto.Message { return new(nkapi.Group) })
+	add("PUT", "v2/group/{group_id}", "UpdateGroup", "*", func() proto.Message { return new(nkapi.UpdateGroupRequest) }, empty)
+	add("DELETE", "v2/group/{group_id}", "DeleteGroup", "", func() proto.Message { return new(nkapi.DeleteGroupRequest) }, empty)
+	add("POST", "v2/group/{group_id}/add", "AddGroupUsers", "", func() proto.Message { return new(nkapi.AddGroupUsersRequest) }, empty)
+	add("POST", "v2/group/{group_id}/ban", "BanGroupUsers", "", func() proto.Message { return new(nkapi.BanGroupUsersRequest) }, empty)
+	add("POST", "v2/group/{group_id}/demote", "DemoteGroupUsers", "", func() proto.Message { return new(nkapi.DemoteGroupUsersRequest) }, empty)
+	add("POST", "v2/group/{group_id}/join", "JoinGroup", "", func() proto.Message { return new(nkapi.JoinGroupRequest) }, empty)
+	add("POST", "v2/group/{group_id}/kick", "KickGroupUsers", "", func() proto.Message { return new(nkapi.KickGroupUsersRequest) }, empty)
+	add("POST", "v2/group/{group_id}/leave", "LeaveGroup", "", func() proto.Message { return new(nkapi.LeaveGroupRequest) }, empty)
+	add("POST", "v2/group/{group_id}/promote", "PromoteGroupUsers", "", func() proto.Message { return new(nkapi.PromoteGroupUsersRequest) }, empty)
+	add("GET", "v2/group/{group_id}/user", "ListGroupUsers", "", func() proto.Message { return new(nkapi.ListGroupUsersRequest) }, func() proto.Message { return new(nkapi.GroupUserList) })
+	// iap
+	add("POST", "v2/iap/purchase/apple", "ValidatePurchaseApple", "*", func() proto.Message { return new(nkapi.ValidatePurchaseAppleRequest) }, func() proto.Message { return new(nkapi.ValidatePurchaseResponse) })
+	add("POST", "v2/iap/purchase/google", "ValidatePurchaseGoogle", "*", func() proto.Message { return new(nkapi.ValidatePurchaseGoogleRequest) }, func() proto.Message { return new(nkapi.ValidatePurchaseResponse) })
+	add("POST", "v2/iap/purchase/huawei", "ValidatePurchaseHuawei", "*", func() proto.Message { return new(nkapi.ValidatePurchaseHuaweiRequest) }, func() proto.Message { return new(nkapi.ValidatePurchaseResponse) })
+	add("POST", "v2/iap/subscription", "ListSubscriptions", "*", func() proto.Message { return new(nkapi.ListSubscriptionsRequest) }, func() proto.Message { return new(nkapi.SubscriptionList) })
+	add("POST", "v2/iap/subscription/apple", "ValidateSubscriptionApple", "*", func() proto.Message { return new(nkapi.ValidateSubscriptionAppleRequest) }, func() proto.Message { return new(nkapi.ValidateSubscriptionResponse) })
+	add("POST", "v2/iap/subscription/google", "ValidateSubscriptionGoogle", "*", func() proto.Message { return new(nkapi.ValidateSubscriptionGoogleRequest) }, func() proto.Message { return new(nkapi.ValidateSubscriptionResponse) })
+	add("GET", "v2/iap/subscription/{product_id}", "GetSubscription", "", func() proto.Message { return new(nkapi.GetSubscriptionRequest) }, func() proto.Message { return new(nkapi.ValidatedSubscription) })
+	// leaderboard
+	add("GET", "v2/leaderboard/{leaderboard_id}", "ListLeaderboardRecords", "", func() proto.Message { return new(nkapi.ListLeaderboardRecordsRequest) }, func() proto.Message { return new(nkapi.LeaderboardRecordList) })
+	add("POST", "v2/leaderboard/{leaderboard_id}", "WriteLeaderboardRecord", "record", func() proto.Message { return new(nkapi.WriteLeaderboardRecordRequest) }, func() proto.Message { return new(nkapi.LeaderboardRecord) })
+	add("DELETE", "v2/leaderboard/{leaderboard_id}", "DeleteLeaderboardRecord", "", func() proto.Message { return new(nkapi.DeleteLeaderboardRecordRequest) }, empty)
+	add("GET", "v2/leaderboard/{leaderboard_id}/owner/{owner_id}", "ListLeaderboardRecordsAroundOwner", "", func() proto.Message { return new(nkapi.ListLeaderboardRecordsAroundOwnerRequest) }, func() proto.Message { return new(nkapi.LeaderboardRecordList) })
+	// match
+	add("GET", "v2/match", "ListMatches", "", func() proto.Message { return new(nkapi.ListMatchesRequest) }, func() proto.Message { return new(nkapi.MatchList) })
+	// notification
+	add("GET", "v2/notification", "ListNotifications", "", func() proto.Message { return new(nkapi.ListNotificationsRequest) }, func() proto.Message { return new(nkapi.NotificationList) })
+	add("DELETE", "v2/notification", "DeleteNotifications", "", func() proto.Message { return new(nkapi.DeleteNotificationsRequest) }, empty)
+	// rpc
+	add("POST", "v2/rpc/{id}", "RpcFunc", "payload", func() proto.Message { return new(nkapi.Rpc) }, func() proto.Message { return new(nkapi.Rpc) })
+	// storage
+	add("POST", "v2/storage", "ReadStorageObjects", "*", func() proto.Message { return new(nkapi.ReadStorageObjectsRequest) }, func() proto.Message { return new(nkapi.StorageObjects) })
+	add("PUT", "v2/storage", "WriteStorageObjects", "*", func() proto.Message { return new(nkapi.WriteStorageObjectsRequest) }, func() proto.Message { return new(nkapi.StorageObjectAcks) })
+	add("PUT", "v2/storage/delete", "DeleteStorageObjects", "*", func() proto.Message { return new(nkapi.DeleteStorageObjectsRequest) }, empty)
+	add("GET", "v2/storage/{collection}", "ListStorageObjects", "", func() proto.Message { return new(nkapi.ListStorageObjectsRequest) }, func() proto.Message { return new(nkapi.StorageObjectList) })
+	// tournament
+	add("GET", "v2/tournament", "ListTournaments", "", func() proto.Message { return new(nkapi.ListTournamentsRequest) }, func() proto.Message { return new(nkapi.TournamentList) })
+	add("GET", "v2/tournament/{tournament_id}", "ListTournamentRecords", "", func() proto.Message { return new(nkapi.ListTournamentRecordsRequest) }, func() proto.Message { return new(nkapi.TournamentRecordList) })
+	add("POST", "v2/tournament/{tournament_id}", "WriteTournamentRecord", "record", func() proto.Message { return new(nkapi.WriteTournamentRecordRequest) }, func() proto.Message { return new(nkapi.LeaderboardRecord) })
+	add("POST", "v2/tournament/{tournament_id}/join", "JoinTournament", "", func() proto.Message { return new(nkapi.JoinTournamentRequest) }, empty)
+	add("GET", "v2/tournament/{tournament_id}/owner/{owner_id}", "ListTournamentRecordsAroundOwner", "", func() proto.Message { return new(nkapi.ListTournamentRecordsAroundOwnerRequest) }, func() proto.Message { return new(nkapi.TournamentRecordList) })
+	// user
+	add("GET", "v2/user", "GetUsers", "", func() proto.Message { return new(nkapi.GetUsersRequest) }, func() proto.Message { return new(nkapi.Users) })
+	add("GET", "v2/user/{user_id}/group", "ListUserGroups", "", func() proto.Message { return new(nkapi.ListUserGroupsRequest) }, func() proto.Message { return new(nkapi.UserGroupList) })
+}
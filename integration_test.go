@@ -0,0 +1,263 @@
+//go:build integration
+
+package nakama
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/ascii8/nktest"
+	"github.com/google/uuid"
+	"github.com/heroiclabs/nakama-common/rtapi"
+)
+
+// The integration tests run end to end flows against the nakama and postgres
+// containers started by TestMain. Run with:
+//
+//	go test -tags integration -run Integration
+//
+// The containers are torn down by TestMain after the tests complete, and each
+// test closes its connections on cleanup.
+
+func TestIntegrationAuth(t *testing.T) {
+	ctx, cancel, nk := nktest.WithCancel(context.Background(), t)
+	defer cancel()
+	store := NewFileSessionStore(filepath.Join(t.TempDir(), "session.json"))
+	cl1 := newClient(ctx, t, nk, WithSessionStore(store))
+	createAccount(ctx, t, cl1)
+	userId := cl1.SessionUserId()
+	if err := cl1.SessionRefresh(ctx); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	// restore the session in a new client
+	cl2 := newClient(ctx, t, nk, WithSessionStore(store))
+	if id := cl2.SessionUserId(); id != userId {
+		t.Fatalf("expected %s, got: %s", userId, id)
+	}
+	if token := cl2.SessionToken(); token != cl1.SessionToken() {
+		t.Errorf("expected restored token to match refreshed token")
+	}
+	res, err := cl2.Account(ctx)
+	switch {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case res.User.Id != userId:
+		t.Errorf("expected %s, got: %s", userId, res.User.Id)
+	}
+	if err := cl2.SessionLogout(ctx); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	switch session, err := store.Load(); {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case session != nil:
+		t.Errorf("expected session store to be cleared after logout")
+	}
+}
+
+func TestIntegrationChat(t *testing.T) {
+	ctx, cancel, nk := nktest.WithCancel(context.Background(), t)
+	defer cancel()
+	target := "room_" + uuid.New().String()
+	_, conn1 := newIntegrationConn(ctx, t, nk)
+	cl2, conn2 := newIntegrationConn(ctx, t, nk)
+	ch1, err := conn1.ChannelJoinHandle(ctx, target, ChannelJoinRoom, true, false)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	events := conn1.ChannelPresenceEventCh(ctx)
+	ch2, err := conn2.ChannelJoinHandle(ctx, target, ChannelJoinRoom, true, false)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if ev := recvIntegration(ctx, t, events); len(ev.Joins) != 1 || ev.Joins[0].UserId != cl2.SessionUserId() {
+		t.Errorf("expected join for %s, got: %+v", cl2.SessionUserId(), ev.Joins)
+	}
+	msgs := ch2.Messages()
+	ack, err := ch1.SendMessage(ctx, `{"msg":"hello"}`)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	msg := recvIntegration(ctx, t, msgs)
+	switch {
+	case msg.MessageId != ack.MessageId:
+		t.Errorf("expected %s, got: %s", ack.MessageId, msg.MessageId)
+	case msg.Content != `{"msg":"hello"}`:
+		t.Errorf("expected %q, got: %q", `{"msg":"hello"}`, msg.Content)
+	}
+	if _, err := ch1.UpdateMessage(ctx, ack.MessageId, `{"msg":"bye"}`); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if msg := recvIntegration(ctx, t, msgs); msg.Content != `{"msg":"bye"}` {
+		t.Errorf("expected %q, got: %q", `{"msg":"bye"}`, msg.Content)
+	}
+	if err := ch2.Leave(ctx); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if ev := recvIntegration(ctx, t, events); len(ev.Leaves) != 1 || ev.Leaves[0].UserId != cl2.SessionUserId() {
+		t.Errorf("expected leave for %s, got: %+v", cl2.SessionUserId(), ev.Leaves)
+	}
+	if err := ch1.Leave(ctx); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+}
+
+func TestIntegrationGroupChat(t *testing.T) {
+	ctx, cancel, nk := nktest.WithCancel(context.Background(), t)
+	defer cancel()
+	cl1, conn1 := newIntegrationConn(ctx, t, nk)
+	cl2, conn2 := newIntegrationConn(ctx, t, nk)
+	group, err := cl1.CreateGroup(ctx, CreateGroup().WithName("group_"+uuid.New().String()).WithOpen(true))
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	ch, err := conn1.GroupChannelHandle(ctx, cl1, group.Id, true, false)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if ch.Channel().GroupId != group.Id {
+		t.Errorf("expected group id %s, got: %s", group.Id, ch.Channel().GroupId)
+	}
+	// not a member
+	if _, err := conn2.GroupChannelHandle(ctx, cl2, group.Id, true, false); !errors.Is(err, ErrNotGroupMember) {
+		t.Errorf("expected not a group member error, got: %v", err)
+	}
+}
+
+func TestIntegrationDirectMessage(t *testing.T) {
+	ctx, cancel, nk := nktest.WithCancel(context.Background(), t)
+	defer cancel()
+	cl1, conn1 := newIntegrationConn(ctx, t, nk)
+	cl2, _ := newIntegrationConn(ctx, t, nk)
+	account, err := cl2.Account(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	for _, user := range []string{account.User.Id, account.User.Username} {
+		ch, err := conn1.DirectMessage(ctx, cl1, user)
+		switch {
+		case err != nil:
+			t.Fatalf("expected no error, got: %v", err)
+		case ch.Channel().UserIdTwo != account.User.Id && ch.Channel().UserIdOne != account.User.Id:
+			t.Errorf("expected direct message channel with %s, got: %+v", account.User.Id, ch.Channel())
+		}
+		if err := ch.Leave(ctx); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+}
+
+func TestIntegrationMatch(t *testing.T) {
+	ctx, cancel, nk := nktest.WithCancel(context.Background(), t)
+	defer cancel()
+	_, conn1 := newIntegrationConn(ctx, t, nk)
+	cl2, conn2 := newIntegrationConn(ctx, t, nk)
+	m1, err := conn1.MatchCreateHandle(ctx, "match_"+uuid.New().String())
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	events := conn1.MatchPresenceEventCh(ctx)
+	m2, err := conn2.MatchJoinHandle(ctx, m1.Id(), nil)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if ev := recvIntegration(ctx, t, events); len(ev.Joins) != 1 || ev.Joins[0].UserId != cl2.SessionUserId() {
+		t.Errorf("expected join for %s, got: %+v", cl2.SessionUserId(), ev.Joins)
+	}
+	if n := len(m1.Presences()); n != 1 {
+		t.Errorf("expected 1 presence, got: %d", n)
+	}
+	data := make(chan *MatchDataMsg, 1)
+	m2.OnOpCode(5, func(msg *MatchDataMsg) {
+		data <- msg
+	})
+	if err := m1.SendData(ctx, 5, []byte("ping"), true); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if msg := recvIntegration(ctx, t, data); string(msg.Data) != "ping" {
+		t.Errorf("expected %q, got: %q", "ping", string(msg.Data))
+	}
+	if err := m2.Leave(ctx); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if ev := recvIntegration(ctx, t, events); len(ev.Leaves) != 1 || ev.Leaves[0].UserId != cl2.SessionUserId() {
+		t.Errorf("expected leave for %s, got: %+v", cl2.SessionUserId(), ev.Leaves)
+	}
+	if err := m1.Leave(ctx); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+}
+
+func TestIntegrationParty(t *testing.T) {
+	ctx, cancel, nk := nktest.WithCancel(context.Background(), t)
+	defer cancel()
+	cl1, conn1 := newIntegrationConn(ctx, t, nk)
+	cl2, conn2 := newIntegrationConn(ctx, t, nk)
+	p1, err := conn1.PartyCreateHandle(ctx, true, 4)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if leader := p1.Leader(); leader == nil || leader.UserId != cl1.SessionUserId() {
+		t.Fatalf("expected leader %s, got: %+v", cl1.SessionUserId(), leader)
+	}
+	joins := make(chan string, 1)
+	p1.OnMemberJoin(func(presence *rtapi.UserPresence) {
+		joins <- presence.UserId
+	})
+	parties := conn2.PartyCh(ctx)
+	if err := conn2.PartyJoin(ctx, p1.Id()); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	p2 := conn2.PartyHandle(ctx, recvIntegration(ctx, t, parties))
+	if id := recvIntegration(ctx, t, joins); id != cl2.SessionUserId() {
+		t.Errorf("expected %s, got: %s", cl2.SessionUserId(), id)
+	}
+	data := make(chan *PartyDataMsg, 1)
+	p2.OnData(func(msg *PartyDataMsg) {
+		data <- msg
+	})
+	if err := p1.DataSend(ctx, 7, []byte("hello")); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if msg := recvIntegration(ctx, t, data); string(msg.Data) != "hello" {
+		t.Errorf("expected %q, got: %q", "hello", string(msg.Data))
+	}
+	if err := p2.Leave(ctx); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if err := p1.Close(ctx); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+}
+
+// newIntegrationConn creates a client with a new account and an open realtime
+// connection, closing the connection when the test completes.
+func newIntegrationConn(ctx context.Context, t *testing.T, nk *nktest.Runner, opts ...ConnOption) (*Client, *Conn) {
+	cl := newClient(ctx, t, nk)
+	conn := createAccountAndConn(ctx, t, cl, opts...)
+	t.Cleanup(func() {
+		if err := conn.Close(); err != nil {
+			t.Logf("unable to close conn: %v", err)
+		}
+	})
+	return cl, conn
+}
+
+// recvIntegration receives a value from the channel, failing the test when
+// the context is closed first.
+func recvIntegration[T any](ctx context.Context, t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected no error, got: %v", ctx.Err())
+	case v, ok := <-ch:
+		if !ok {
+			t.Fatalf("expected channel to be open")
+		}
+		return v
+	}
+	var v T
+	return v
+}
@@ -0,0 +1,182 @@
+package nakama
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	nkapi "github.com/heroiclabs/nakama-common/api"
+)
+
+// LeaderboardChangeType is a leaderboard change type.
+type LeaderboardChangeType int
+
+// LeaderboardChangeType values.
+const (
+	// LeaderboardEntryNew is a record new to the view.
+	LeaderboardEntryNew LeaderboardChangeType = iota
+	// LeaderboardEntryRemoved is a record no longer in the view.
+	LeaderboardEntryRemoved
+	// LeaderboardRankUp is a record moving to a better (lower) rank.
+	LeaderboardRankUp
+	// LeaderboardRankDown is a record moving to a worse (higher) rank.
+	LeaderboardRankDown
+	// LeaderboardScoreChanged is a record with a changed score or subscore,
+	// and an unchanged rank.
+	LeaderboardScoreChanged
+)
+
+// String satisfies the fmt.Stringer interface.
+func (typ LeaderboardChangeType) String() string {
+	switch typ {
+	case LeaderboardEntryNew:
+		return "EntryNew"
+	case LeaderboardEntryRemoved:
+		return "EntryRemoved"
+	case LeaderboardRankUp:
+		return "RankUp"
+	case LeaderboardRankDown:
+		return "RankDown"
+	case LeaderboardScoreChanged:
+		return "ScoreChanged"
+	}
+	return "LeaderboardChangeType(" + strconv.Itoa(int(typ)) + ")"
+}
+
+// LeaderboardChange is a change to a record in a leaderboard view.
+type LeaderboardChange struct {
+	Type LeaderboardChangeType
+	// Record is the current record, or the last record for removed records.
+	Record *nkapi.LeaderboardRecord
+	// Prev is the previous record, or nil for new records.
+	Prev *nkapi.LeaderboardRecord
+}
+
+// LeaderboardView is a live view of the leaderboard records around an owner,
+// periodically refreshed, that emits the changes between refreshes.
+type LeaderboardView struct {
+	cl      *Client
+	req     *LeaderboardRecordsAroundOwnerRequest
+	ctx     context.Context
+	cancel  func()
+	records []*nkapi.LeaderboardRecord
+	loaded  bool
+	rw      sync.RWMutex
+	refresh sync.Mutex
+
+	changeHandlers callbacks[*LeaderboardChange]
+}
+
+// LeaderboardView creates a live view of the leaderboard records around the
+// request's owner, refreshed at the interval until the context is closed or
+// the view is closed. The first refresh loads the records without emitting
+// changes. When the interval is 0, the view is only refreshed by calling
+// Refresh.
+func (cl *Client) LeaderboardView(ctx context.Context, req *LeaderboardRecordsAroundOwnerRequest, interval time.Duration) *LeaderboardView {
+	ctx, cancel := context.WithCancel(ctx)
+	v := &LeaderboardView{
+		cl:     cl,
+		req:    req,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	if interval != 0 {
+		go v.run(interval)
+	}
+	return v
+}
+
+// run refreshes the view at the interval.
+func (v *LeaderboardView) run(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if _, err := v.Refresh(v.ctx); err != nil && v.ctx.Err() == nil {
+			v.cl.logger.Log(LevelError, "unable to refresh leaderboard view", "leaderboard_id", v.req.LeaderboardId, "err", err)
+		}
+		select {
+		case <-v.ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Refresh retrieves the records, dispatching and returning the changes since
+// the last refresh.
+func (v *LeaderboardView) Refresh(ctx context.Context) ([]*LeaderboardChange, error) {
+	v.refresh.Lock()
+	defer v.refresh.Unlock()
+	res, err := v.req.Do(ctx, v.cl)
+	if err != nil {
+		return nil, err
+	}
+	v.rw.Lock()
+	prev, loaded := v.records, v.loaded
+	v.records, v.loaded = res.Records, true
+	v.rw.Unlock()
+	if !loaded {
+		return nil, nil
+	}
+	changes := diffLeaderboardRecords(prev, res.Records)
+	for _, change := range changes {
+		v.changeHandlers.dispatch(change)
+	}
+	return changes, nil
+}
+
+// diffLeaderboardRecords returns the changes from the previous to the next
+// records, matched by owner id, in the order of the next records, followed
+// by the removed records.
+func diffLeaderboardRecords(prev, next []*nkapi.LeaderboardRecord) []*LeaderboardChange {
+	m := make(map[string]*nkapi.LeaderboardRecord, len(prev))
+	for _, r := range prev {
+		m[r.OwnerId] = r
+	}
+	var changes []*LeaderboardChange
+	for _, r := range next {
+		p, ok := m[r.OwnerId]
+		delete(m, r.OwnerId)
+		switch {
+		case !ok:
+			changes = append(changes, &LeaderboardChange{Type: LeaderboardEntryNew, Record: r})
+		case r.Rank < p.Rank:
+			changes = append(changes, &LeaderboardChange{Type: LeaderboardRankUp, Record: r, Prev: p})
+		case r.Rank > p.Rank:
+			changes = append(changes, &LeaderboardChange{Type: LeaderboardRankDown, Record: r, Prev: p})
+		case r.Score != p.Score || r.Subscore != p.Subscore:
+			changes = append(changes, &LeaderboardChange{Type: LeaderboardScoreChanged, Record: r, Prev: p})
+		}
+	}
+	for _, p := range prev {
+		if _, ok := m[p.OwnerId]; ok {
+			changes = append(changes, &LeaderboardChange{Type: LeaderboardEntryRemoved, Record: p, Prev: p})
+		}
+	}
+	return changes
+}
+
+// Records returns the records from the last refresh, ordered by rank.
+func (v *LeaderboardView) Records() []*nkapi.LeaderboardRecord {
+	v.rw.RLock()
+	defer v.rw.RUnlock()
+	return append([]*nkapi.LeaderboardRecord(nil), v.records...)
+}
+
+// OnChange adds a callback for changes to the view's records. The callback is
+// removed when the view is closed.
+func (v *LeaderboardView) OnChange(f func(*LeaderboardChange)) {
+	v.changeHandlers.add(v.ctx, f)
+}
+
+// Changes returns a channel receiving changes to the view's records. The
+// channel is closed when the view is closed.
+func (v *LeaderboardView) Changes(opts ...SubscribeOption) <-chan *LeaderboardChange {
+	return subscribe(v.ctx, v.changeHandlers.add, opts...)
+}
+
+// Close stops refreshing the view, removing its callbacks.
+func (v *LeaderboardView) Close() {
+	v.cancel()
+}
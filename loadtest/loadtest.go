@@ -0,0 +1,404 @@
+// Package loadtest provides a load testing harness for nakama deployments,
+// running scripted scenarios on simulated clients, and reporting the latency
+// and error statistics of each operation.
+package loadtest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ascii8/nakama-go"
+	"github.com/google/uuid"
+)
+
+// Scenario is a scripted scenario run by a simulated client.
+type Scenario func(context.Context, *Client) error
+
+// Client is a simulated client.
+type Client struct {
+	// Index is the client's index, from 0.
+	Index int
+	// Client is the client's nakama client.
+	Client *nakama.Client
+	// Conn is the client's realtime connection.
+	Conn *nakama.Conn
+	// MatchId is the id of the match last joined with JoinMatch.
+	MatchId string
+	// ChannelId is the id of the channel last joined with JoinChannel.
+	ChannelId string
+
+	stats *stats
+}
+
+// Do runs f as the named operation, recording its latency and error.
+func (c *Client) Do(ctx context.Context, name string, f func(context.Context) error) error {
+	start := time.Now()
+	err := f(ctx)
+	c.stats.record(name, time.Since(start), err)
+	return err
+}
+
+// Runner runs a scenario on simulated clients.
+type Runner struct {
+	scenario   Scenario
+	clients    int
+	rampUp     time.Duration
+	duration   time.Duration
+	clientOpts []nakama.Option
+	connOpts   []nakama.ConnOption
+	auth       func(context.Context, int, *nakama.Client) error
+}
+
+// New creates a runner for the scenario. By default, a single client is
+// authenticated with a random device id, and runs the scenario once.
+func New(scenario Scenario, opts ...Option) *Runner {
+	r := &Runner{
+		scenario: scenario,
+		clients:  1,
+		auth: func(ctx context.Context, i int, cl *nakama.Client) error {
+			return cl.AuthenticateDevice(ctx, fmt.Sprintf("loadtest-%d-%s", i, uuid.NewString()), true, "")
+		},
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	return r
+}
+
+// Run starts the clients, runs the scenario on each client, and returns the
+// report once every client has finished, or the context is closed.
+func (r *Runner) Run(ctx context.Context) (*Report, error) {
+	if r.duration != 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, r.duration)
+		defer cancel()
+	}
+	s := newStats()
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < r.clients; i++ {
+		if i != 0 && r.rampUp != 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(r.rampUp / time.Duration(r.clients)):
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r.runClient(ctx, i, s)
+		}(i)
+	}
+	wg.Wait()
+	return s.report(r.clients, time.Since(start)), nil
+}
+
+// runClient authenticates and connects the client, and runs the scenario,
+// repeating it until the context is closed when the runner has a duration.
+func (r *Runner) runClient(ctx context.Context, i int, s *stats) {
+	c := &Client{
+		Index:  i,
+		Client: nakama.New(r.clientOpts...),
+		stats:  s,
+	}
+	if err := c.Do(ctx, "auth", func(ctx context.Context) error {
+		return r.auth(ctx, i, c.Client)
+	}); err != nil {
+		return
+	}
+	if err := c.Do(ctx, "connect", func(ctx context.Context) error {
+		var err error
+		c.Conn, err = c.Client.NewConn(ctx, r.connOpts...)
+		return err
+	}); err != nil {
+		return
+	}
+	defer c.Conn.Close()
+	for {
+		if err := r.scenario(ctx, c); err != nil && ctx.Err() == nil {
+			s.record("scenario", 0, err)
+		}
+		if r.duration == 0 || ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// Option is a runner option.
+type Option func(*Runner)
+
+// WithClients is a runner option to set the number of simulated clients.
+func WithClients(clients int) Option {
+	return func(r *Runner) {
+		r.clients = clients
+	}
+}
+
+// WithRampUp is a runner option to set the duration over which the clients
+// are started.
+func WithRampUp(rampUp time.Duration) Option {
+	return func(r *Runner) {
+		r.rampUp = rampUp
+	}
+}
+
+// WithDuration is a runner option to set the duration of the run. Clients
+// repeat the scenario until the duration has elapsed.
+func WithDuration(duration time.Duration) Option {
+	return func(r *Runner) {
+		r.duration = duration
+	}
+}
+
+// WithClientOptions is a runner option to set the nakama client options, such
+// as nakama.WithURL and nakama.WithServerKey.
+func WithClientOptions(opts ...nakama.Option) Option {
+	return func(r *Runner) {
+		r.clientOpts = append(r.clientOpts, opts...)
+	}
+}
+
+// WithConnOptions is a runner option to set the realtime connection options.
+func WithConnOptions(opts ...nakama.ConnOption) Option {
+	return func(r *Runner) {
+		r.connOpts = append(r.connOpts, opts...)
+	}
+}
+
+// WithAuth is a runner option to set the func used to authenticate each
+// client.
+func WithAuth(auth func(ctx context.Context, i int, cl *nakama.Client) error) Option {
+	return func(r *Runner) {
+		r.auth = auth
+	}
+}
+
+// Sequence returns a scenario running the scenarios in order, stopping at the
+// first error.
+func Sequence(scenarios ...Scenario) Scenario {
+	return func(ctx context.Context, c *Client) error {
+		for _, scenario := range scenarios {
+			if err := scenario(ctx, c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// JoinMatch returns a scenario joining the match, as the "match_join"
+// operation.
+func JoinMatch(matchId string) Scenario {
+	return func(ctx context.Context, c *Client) error {
+		return c.Do(ctx, "match_join", func(ctx context.Context) error {
+			msg, err := c.Conn.MatchJoin(ctx, matchId, nil)
+			if err != nil {
+				return err
+			}
+			c.MatchId = msg.MatchId
+			return nil
+		})
+	}
+}
+
+// SendData returns a scenario sending the data to the client's joined match
+// at the rate (per second) for the duration, as the "match_data_send"
+// operation.
+func SendData(opCode nakama.OpType, data []byte, rate float64, d time.Duration) Scenario {
+	return func(ctx context.Context, c *Client) error {
+		return every(ctx, rate, d, func() error {
+			return c.Do(ctx, "match_data_send", func(ctx context.Context) error {
+				return c.Conn.MatchDataSend(ctx, c.MatchId, opCode, data, true)
+			})
+		})
+	}
+}
+
+// JoinChannel returns a scenario joining the chat room, as the "channel_join"
+// operation.
+func JoinChannel(room string) Scenario {
+	return func(ctx context.Context, c *Client) error {
+		return c.Do(ctx, "channel_join", func(ctx context.Context) error {
+			msg, err := c.Conn.ChannelJoin(ctx, room, nakama.ChannelJoinRoom, false, false)
+			if err != nil {
+				return err
+			}
+			c.ChannelId = msg.Id
+			return nil
+		})
+	}
+}
+
+// Chat returns a scenario sending the message (json content) to the client's
+// joined channel at the rate (per second) for the duration, as the
+// "channel_message_send" operation.
+func Chat(content string, rate float64, d time.Duration) Scenario {
+	return func(ctx context.Context, c *Client) error {
+		return every(ctx, rate, d, func() error {
+			return c.Do(ctx, "channel_message_send", func(ctx context.Context) error {
+				_, err := c.Conn.ChannelMessageSend(ctx, c.ChannelId, content)
+				return err
+			})
+		})
+	}
+}
+
+// every calls f at the rate (per second) for the duration, stopping at the
+// first error.
+func every(ctx context.Context, rate float64, d time.Duration, f func() error) error {
+	t := time.NewTicker(time.Duration(float64(time.Second) / rate))
+	defer t.Stop()
+	end := time.NewTimer(d)
+	defer end.Stop()
+	for {
+		if err := f(); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-end.C:
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// stats collects operation statistics.
+type stats struct {
+	ops map[string]*opStats
+	mu  sync.Mutex
+}
+
+// opStats are the collected statistics of an operation.
+type opStats struct {
+	latencies []time.Duration
+	errors    int
+	lastErr   error
+}
+
+// newStats creates operation statistics.
+func newStats() *stats {
+	return &stats{
+		ops: make(map[string]*opStats),
+	}
+}
+
+// record records an operation's latency and error.
+func (s *stats) record(name string, d time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	op, ok := s.ops[name]
+	if !ok {
+		op = new(opStats)
+		s.ops[name] = op
+	}
+	if err != nil {
+		op.errors, op.lastErr = op.errors+1, err
+		return
+	}
+	op.latencies = append(op.latencies, d)
+}
+
+// report builds the report.
+func (s *stats) report(clients int, d time.Duration) *Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := &Report{
+		Clients:  clients,
+		Duration: d,
+	}
+	for name, op := range s.ops {
+		l := append([]time.Duration(nil), op.latencies...)
+		sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+		res := &OpReport{
+			Name:    name,
+			Count:   len(l) + op.errors,
+			Errors:  op.errors,
+			LastErr: op.lastErr,
+		}
+		if len(l) != 0 {
+			var sum time.Duration
+			for _, v := range l {
+				sum += v
+			}
+			res.Min, res.Max, res.Mean = l[0], l[len(l)-1], sum/time.Duration(len(l))
+			res.P50, res.P90, res.P99 = percentile(l, 50), percentile(l, 90), percentile(l, 99)
+		}
+		report.Ops = append(report.Ops, res)
+	}
+	sort.Slice(report.Ops, func(i, j int) bool { return report.Ops[i].Name < report.Ops[j].Name })
+	return report
+}
+
+// percentile returns the percentile of the sorted latencies.
+func percentile(l []time.Duration, p int) time.Duration {
+	return l[(len(l)-1)*p/100]
+}
+
+// Report is a load test report.
+type Report struct {
+	// Clients is the number of simulated clients.
+	Clients int
+	// Duration is the duration of the run.
+	Duration time.Duration
+	// Ops are the operations' statistics, ordered by name.
+	Ops []*OpReport
+}
+
+// Op returns the named operation's statistics.
+func (report *Report) Op(name string) (*OpReport, bool) {
+	for _, op := range report.Ops {
+		if op.Name == name {
+			return op, true
+		}
+	}
+	return nil, false
+}
+
+// WriteTo writes the report as a table to w.
+func (report *Report) WriteTo(w io.Writer) (int64, error) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "clients: %d, duration: %s\n", report.Clients, report.Duration.Round(time.Millisecond))
+	tw := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "OP\tCOUNT\tERRORS\tRATE\tMIN\tMEAN\tP50\tP90\tP99\tMAX")
+	for _, op := range report.Ops {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f/s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			op.Name, op.Count, op.Errors, float64(op.Count)/report.Duration.Seconds(),
+			op.Min, op.Mean, op.P50, op.P90, op.P99, op.Max,
+		)
+	}
+	_ = tw.Flush()
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+// String satisfies the fmt.Stringer interface.
+func (report *Report) String() string {
+	var sb strings.Builder
+	_, _ = report.WriteTo(&sb)
+	return sb.String()
+}
+
+// OpReport are an operation's statistics.
+type OpReport struct {
+	Name    string
+	Count   int
+	Errors  int
+	LastErr error
+	Min     time.Duration
+	Mean    time.Duration
+	P50     time.Duration
+	P90     time.Duration
+	P99     time.Duration
+	Max     time.Duration
+}
@@ -0,0 +1,50 @@
+package loadtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ascii8/nakama-go"
+	"github.com/ascii8/nakama-go/nakamatest"
+	"github.com/heroiclabs/nakama-common/rtapi"
+)
+
+func TestRunner(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := nakamatest.NewServer(nakamatest.WithLogger(t.Logf))
+	defer srv.Close()
+	srv.Respond("match_join", &rtapi.Envelope{
+		Message: &rtapi.Envelope_Match{
+			Match: &rtapi.Match{MatchId: "match"},
+		},
+	})
+	srv.Respond("match_data_send", &rtapi.Envelope{})
+	r := New(
+		Sequence(
+			JoinMatch("match"),
+			SendData(1, []byte("data"), 100, 100*time.Millisecond),
+		),
+		WithClients(3),
+		WithRampUp(30*time.Millisecond),
+		WithAuth(func(context.Context, int, *nakama.Client) error {
+			return nil
+		}),
+		WithConnOptions(
+			nakama.WithConnUrl(srv.URL()),
+			nakama.WithConnToken("token"),
+		),
+	)
+	report, err := r.Run(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	t.Logf("report:\n%s", report)
+	if op, ok := report.Op("match_join"); !ok || op.Count != 3 || op.Errors != 0 {
+		t.Errorf("expected 3 match joins, got: %+v", op)
+	}
+	if op, ok := report.Op("match_data_send"); !ok || op.Count < 3 || op.Errors != 0 {
+		t.Errorf("expected match data sends, got: %+v", op)
+	}
+}
@@ -0,0 +1,132 @@
+package nakama
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Level is a log level.
+type Level int
+
+// Level values.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String satisfies the fmt.Stringer interface.
+func (level Level) String() string {
+	switch level {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("Level(%d)", int(level))
+}
+
+// Logger is the interface for structured loggers. The key/value pairs are
+// alternating keys (strings) and values, as with log/slog.
+type Logger interface {
+	Log(level Level, msg string, keyvals ...interface{})
+}
+
+// LoggerFunc wraps a func as a Logger.
+type LoggerFunc func(Level, string, ...interface{})
+
+// Log satisfies the Logger interface.
+func (f LoggerFunc) Log(level Level, msg string, keyvals ...interface{}) {
+	f(level, msg, keyvals...)
+}
+
+// NopLogger is a logger that discards all messages.
+var NopLogger Logger = LoggerFunc(func(Level, string, ...interface{}) {})
+
+// NewLogfLogger creates a logger that formats messages at or above the
+// minimum level as "LEVEL msg key=value ...", writing them with f (such as
+// log.Printf or testing.T.Logf).
+func NewLogfLogger(f func(string, ...interface{}), min Level) Logger {
+	return LoggerFunc(func(level Level, msg string, keyvals ...interface{}) {
+		if level < min {
+			return
+		}
+		var sb strings.Builder
+		sb.WriteString(level.String())
+		sb.WriteString(" ")
+		sb.WriteString(msg)
+		for i := 0; i < len(keyvals); i += 2 {
+			var v interface{} = "MISSING"
+			if i+1 < len(keyvals) {
+				v = keyvals[i+1]
+			}
+			fmt.Fprintf(&sb, " %v=%v", keyvals[i], v)
+		}
+		f("%s", sb.String())
+	})
+}
+
+// ZapSugaredLogger is the interface for a go.uber.org/zap SugaredLogger.
+type ZapSugaredLogger interface {
+	Debugw(string, ...interface{})
+	Infow(string, ...interface{})
+	Warnw(string, ...interface{})
+	Errorw(string, ...interface{})
+}
+
+// NewZapLogger creates a logger for a go.uber.org/zap SugaredLogger (ie,
+// zap.L().Sugar()).
+func NewZapLogger(l ZapSugaredLogger) Logger {
+	return LoggerFunc(func(level Level, msg string, keyvals ...interface{}) {
+		switch level {
+		case LevelDebug:
+			l.Debugw(msg, keyvals...)
+		case LevelInfo:
+			l.Infow(msg, keyvals...)
+		case LevelWarn:
+			l.Warnw(msg, keyvals...)
+		default:
+			l.Errorw(msg, keyvals...)
+		}
+	})
+}
+
+// LogrusEntry is the interface for a github.com/sirupsen/logrus logger or
+// entry.
+type LogrusEntry interface {
+	Debug(...interface{})
+	Info(...interface{})
+	Warn(...interface{})
+	Error(...interface{})
+}
+
+// NewLogrusLogger creates a logger for a github.com/sirupsen/logrus logger,
+// using withFields to add the key/value pairs as fields:
+//
+//	nakama.NewLogrusLogger(func(fields map[string]interface{}) nakama.LogrusEntry {
+//		return l.WithFields(fields)
+//	})
+func NewLogrusLogger(withFields func(map[string]interface{}) LogrusEntry) Logger {
+	return LoggerFunc(func(level Level, msg string, keyvals ...interface{}) {
+		fields := make(map[string]interface{}, len(keyvals)/2)
+		for i := 0; i+1 < len(keyvals); i += 2 {
+			fields[fmt.Sprint(keyvals[i])] = keyvals[i+1]
+		}
+		entry := withFields(fields)
+		switch level {
+		case LevelDebug:
+			entry.Debug(msg)
+		case LevelInfo:
+			entry.Info(msg)
+		case LevelWarn:
+			entry.Warn(msg)
+		default:
+			entry.Error(msg)
+		}
+	})
+}
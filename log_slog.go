@@ -0,0 +1,26 @@
+//go:build go1.21
+
+package nakama
+
+import (
+	"context"
+	"log/slog"
+)
+
+// NewSlogLogger creates a logger for a log/slog logger.
+func NewSlogLogger(l *slog.Logger) Logger {
+	return LoggerFunc(func(level Level, msg string, keyvals ...interface{}) {
+		var lvl slog.Level
+		switch level {
+		case LevelDebug:
+			lvl = slog.LevelDebug
+		case LevelInfo:
+			lvl = slog.LevelInfo
+		case LevelWarn:
+			lvl = slog.LevelWarn
+		default:
+			lvl = slog.LevelError
+		}
+		l.Log(context.Background(), lvl, msg, keyvals...)
+	})
+}
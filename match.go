@@ -0,0 +1,252 @@
+package nakama
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/rtapi"
+)
+
+// MatchHandle is a handle to a joined multiplayer match, tracking the match's
+// presences and scoping data and presence callbacks to the match.
+type MatchHandle struct {
+	conn      *Conn
+	match     *MatchMsg
+	ctx       context.Context
+	cancel    func()
+	presences *PresenceSet
+}
+
+// MatchHandle creates a handle for a joined match, such as the response to
+// MatchJoinToken. The handle's callbacks are removed when the context is
+// closed, or the match is left.
+func (conn *Conn) MatchHandle(ctx context.Context, match *MatchMsg) *MatchHandle {
+	ctx, cancel := context.WithCancel(ctx)
+	h := &MatchHandle{
+		conn:      conn,
+		match:     match,
+		ctx:       ctx,
+		cancel:    cancel,
+		presences: NewPresenceSet(match.Presences...),
+	}
+	conn.OnMatchPresenceEvent(ctx, h.update)
+	return h
+}
+
+// MatchCreateHandle sends a message to create a multiplayer match, returning
+// a handle to the match.
+func (conn *Conn) MatchCreateHandle(ctx context.Context, name string) (*MatchHandle, error) {
+	match, err := conn.MatchCreate(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return conn.MatchHandle(context.Background(), match), nil
+}
+
+// MatchJoinHandle sends a message to join a match, returning a handle to the
+// match.
+func (conn *Conn) MatchJoinHandle(ctx context.Context, matchId string, metadata map[string]string) (*MatchHandle, error) {
+	match, err := conn.MatchJoin(ctx, matchId, metadata)
+	if err != nil {
+		return nil, err
+	}
+	return conn.MatchHandle(context.Background(), match), nil
+}
+
+// MatchmakerMatch adds the user to the matchmaker pool, waits for the ticket
+// to be matched, and joins the matched match (by match id or token),
+// returning a handle to the match. When the context is closed before the
+// ticket is matched, the ticket is removed from the pool.
+func (conn *Conn) MatchmakerMatch(ctx context.Context, msg *MatchmakerAddMsg) (*MatchHandle, error) {
+	sctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	matched := conn.MatchmakerMatchedCh(sctx, WithSubscribeDropPolicy(DropNone))
+	ticket, err := msg.Send(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			rctx, rcancel := context.WithTimeout(context.Background(), matchmakerRemoveTimeout)
+			defer rcancel()
+			if err := conn.MatchmakerRemove(rctx, ticket.Ticket); err != nil {
+				conn.logger.Log(LevelWarn, "unable to remove matchmaker ticket", "ticket", ticket.Ticket, "err", err)
+			}
+			return nil, ctx.Err()
+		case m := <-matched:
+			if m.Ticket != ticket.Ticket {
+				continue
+			}
+			if matchId := m.GetMatchId(); matchId != "" {
+				return conn.MatchJoinHandle(ctx, matchId, nil)
+			}
+			match, err := conn.MatchJoinToken(ctx, m.GetToken(), nil)
+			if err != nil {
+				return nil, err
+			}
+			return conn.MatchHandle(context.Background(), match), nil
+		}
+	}
+}
+
+// MatchSelector selects the match to join from listed matches (see
+// MatchJoinByQuery). Returns nil when none of the matches are suitable.
+type MatchSelector func(matches []*Match) *Match
+
+// MatchLeastFull is a match selector that selects the match with the fewest
+// players.
+func MatchLeastFull(matches []*Match) *Match {
+	var m *Match
+	for _, match := range matches {
+		if m == nil || match.Size < m.Size {
+			m = match
+		}
+	}
+	return m
+}
+
+// MatchRandom is a match selector that selects a random match.
+func MatchRandom(matches []*Match) *Match {
+	if len(matches) == 0 {
+		return nil
+	}
+	return matches[rand.Intn(len(matches))]
+}
+
+// MatchJoinByQuery lists the authoritative matches matching the label query
+// and size (see MatchesRequest.WithQuery), selects a match with the
+// connection's match selector (see WithConnMatchSelector), and joins it,
+// returning a handle to the match. When the selected match cannot be joined,
+// such as when it filled up or ended after being listed, the next selected
+// match is joined. The connection's handler must be a client. Returns an
+// error wrapping ErrNotFound when no match could be joined.
+func (conn *Conn) MatchJoinByQuery(ctx context.Context, query string, minSize, maxSize int) (*MatchHandle, error) {
+	cl, err := conn.client()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list matches: %w", err)
+	}
+	res, err := Matches().
+		WithAuthoritative(true).
+		WithQuery(query).
+		WithMinSize(minSize).
+		WithMaxSize(maxSize).
+		Do(ctx, cl)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list matches: %w", err)
+	}
+	selector := conn.selector
+	if selector == nil {
+		selector = MatchLeastFull
+	}
+	matches := res.Matches
+	for len(matches) != 0 {
+		m := selector(matches)
+		if m == nil {
+			break
+		}
+		h, err := conn.MatchJoinHandle(ctx, m.MatchId, nil)
+		switch {
+		case err == nil:
+			return h, nil
+		case ctx.Err() != nil:
+			return nil, err
+		}
+		conn.logger.Log(LevelWarn, "unable to join match", "match_id", m.MatchId, "err", err)
+		// remove the match without modifying the response's matches
+		l := make([]*Match, 0, len(matches)-1)
+		for _, match := range matches {
+			if match != m {
+				l = append(l, match)
+			}
+		}
+		matches = l
+	}
+	return nil, fmt.Errorf("unable to join match for query %q: %w", query, ErrNotFound)
+}
+
+// WithConnMatchSelector is a nakama websocket connection option to set the
+// match selector used by MatchJoinByQuery (default: MatchLeastFull).
+func WithConnMatchSelector(selector MatchSelector) ConnOption {
+	return func(conn *Conn) {
+		conn.selector = selector
+	}
+}
+
+// matchmakerRemoveTimeout is the timeout for removing a matchmaker ticket
+// after the context passed to MatchmakerMatch is closed.
+const matchmakerRemoveTimeout = 5 * time.Second
+
+// update updates the match's presences from a presence event.
+func (h *MatchHandle) update(msg *MatchPresenceEventMsg) {
+	if msg.MatchId == h.match.MatchId {
+		h.presences.Apply(msg)
+	}
+}
+
+// Id returns the match id.
+func (h *MatchHandle) Id() string {
+	return h.match.MatchId
+}
+
+// Match returns the match message the handle was created with.
+func (h *MatchHandle) Match() *MatchMsg {
+	return h.match
+}
+
+// Self returns the user's presence in the match.
+func (h *MatchHandle) Self() *rtapi.UserPresence {
+	return h.match.Self
+}
+
+// Presences returns the match's current presences.
+func (h *MatchHandle) Presences() []*rtapi.UserPresence {
+	return h.presences.Presences()
+}
+
+// Roster returns the set of the match's current presences.
+func (h *MatchHandle) Roster() *PresenceSet {
+	return h.presences
+}
+
+// SendData sends data to the match. When presences are provided, the data is
+// only sent to those presences.
+func (h *MatchHandle) SendData(ctx context.Context, opCode OpType, data []byte, reliable bool, presences ...*UserPresenceMsg) error {
+	return h.conn.MatchDataSend(ctx, h.match.MatchId, opCode, data, reliable, presences...)
+}
+
+// OnData adds a callback for data received from the match. The callback is
+// removed when the match is left.
+func (h *MatchHandle) OnData(f func(*MatchDataMsg)) {
+	h.conn.OnMatchDataMatch(h.ctx, h.match.MatchId, f)
+}
+
+// OnOpCode adds a callback for data with the op code received from the match.
+// The callback is removed when the match is left.
+func (h *MatchHandle) OnOpCode(opCode OpType, f func(*MatchDataMsg)) {
+	h.conn.OnMatchDataOpCode(h.ctx, h.match.MatchId, opCode, f)
+}
+
+// OnPresenceEvent adds a callback for the match's presence events. The
+// callback is removed when the match is left.
+func (h *MatchHandle) OnPresenceEvent(f func(*MatchPresenceEventMsg)) {
+	id := h.match.MatchId
+	h.conn.OnMatchPresenceEvent(h.ctx, func(msg *MatchPresenceEventMsg) {
+		if msg.MatchId == id {
+			f(msg)
+		}
+	})
+}
+
+// Done returns a channel that is closed when the match is left.
+func (h *MatchHandle) Done() <-chan struct{} {
+	return h.ctx.Done()
+}
+
+// Leave sends a message to leave the match, removing the handle's callbacks.
+func (h *MatchHandle) Leave(ctx context.Context) error {
+	defer h.cancel()
+	return h.conn.MatchLeave(ctx, h.match.MatchId)
+}
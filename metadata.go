@@ -0,0 +1,121 @@
+package nakama
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// metadataKey is the context key for request metadata.
+type metadataKey struct{}
+
+// WithMetadata returns a context carrying the key/value metadata (such as a
+// trace id or client version), in addition to any metadata already carried
+// by the context. The metadata is added to outgoing requests by the client
+// or connection's MetadataInjector.
+func WithMetadata(ctx context.Context, md map[string]string) context.Context {
+	m := make(map[string]string)
+	for k, v := range MetadataFrom(ctx) {
+		m[k] = v
+	}
+	for k, v := range md {
+		m[k] = v
+	}
+	return context.WithValue(ctx, metadataKey{}, m)
+}
+
+// MetadataFrom returns the metadata carried by the context.
+func MetadataFrom(ctx context.Context) map[string]string {
+	md, _ := ctx.Value(metadataKey{}).(map[string]string)
+	return md
+}
+
+// MetadataInjector injects context metadata into outgoing requests.
+type MetadataInjector interface {
+	// InjectHeader injects the metadata into a http request's headers.
+	InjectHeader(md map[string]string, header http.Header)
+	// InjectPayload injects the metadata into a realtime rpc's encoded
+	// payload, returning the new payload.
+	InjectPayload(md map[string]string, payload []byte) ([]byte, error)
+}
+
+// NewMetadataInjector creates a metadata injector that adds each key as a
+// http header with the prefix, and adds the metadata to realtime rpc json
+// object payloads as the field. Payloads that are not json objects are sent
+// as is. When the field is empty, payloads are not modified.
+//
+// Nakama passes http request headers to runtime rpcs, but realtime rpcs only
+// have a payload.
+func NewMetadataInjector(prefix, field string) MetadataInjector {
+	return &metadataInjector{
+		prefix: prefix,
+		field:  field,
+	}
+}
+
+// DefaultMetadataInjector is the metadata injector used by WithMetadataInjector
+// and WithConnMetadataInjector when passed nil.
+var DefaultMetadataInjector = NewMetadataInjector("X-Nakama-Metadata-", "_metadata")
+
+// metadataInjector is the metadata injector created by NewMetadataInjector.
+type metadataInjector struct {
+	prefix string
+	field  string
+}
+
+// InjectHeader satisfies the MetadataInjector interface.
+func (inj *metadataInjector) InjectHeader(md map[string]string, header http.Header) {
+	for k, v := range md {
+		header.Set(inj.prefix+k, v)
+	}
+}
+
+// InjectPayload satisfies the MetadataInjector interface.
+func (inj *metadataInjector) InjectPayload(md map[string]string, payload []byte) ([]byte, error) {
+	if inj.field == "" {
+		return payload, nil
+	}
+	obj := make(map[string]json.RawMessage)
+	if len(bytes.TrimSpace(payload)) != 0 {
+		if err := json.Unmarshal(payload, &obj); err != nil || obj == nil {
+			return payload, nil
+		}
+	}
+	buf, err := json.Marshal(md)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode metadata: %w", err)
+	}
+	obj[inj.field] = buf
+	if payload, err = json.Marshal(obj); err != nil {
+		return nil, fmt.Errorf("unable to encode payload: %w", err)
+	}
+	return payload, nil
+}
+
+// WithMetadataInjector is a nakama client option to set the metadata
+// injector used to add context metadata (see WithMetadata) to the headers of
+// http requests. When the injector is nil, DefaultMetadataInjector is used.
+func WithMetadataInjector(injector MetadataInjector) Option {
+	return func(cl *Client) {
+		if injector == nil {
+			injector = DefaultMetadataInjector
+		}
+		cl.metadata = injector
+	}
+}
+
+// WithConnMetadataInjector is a nakama websocket connection option to set
+// the metadata injector used to add context metadata (see WithMetadata) to
+// the payloads of realtime rpcs. Protobuf encoded payloads (see
+// RpcRequest.WithProto) are not modified. When the injector is nil,
+// DefaultMetadataInjector is used.
+func WithConnMetadataInjector(injector MetadataInjector) ConnOption {
+	return func(conn *Conn) {
+		if injector == nil {
+			injector = DefaultMetadataInjector
+		}
+		conn.metadata = injector
+	}
+}
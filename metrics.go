@@ -0,0 +1,198 @@
+package nakama
+
+import (
+	"expvar"
+	"strconv"
+	"time"
+)
+
+// Metrics is the interface for collecting client and realtime connection
+// metrics. Implementations must be safe for concurrent use.
+type Metrics interface {
+	// MessageSent is called after a realtime message is written to the
+	// websocket, with the message type and size in bytes.
+	MessageSent(typ string, size int)
+	// MessageReceived is called after a realtime message is read from the
+	// websocket, with the message type and size in bytes.
+	MessageReceived(typ string, size int)
+	// PendingRequests is called with the number of realtime requests awaiting
+	// a response, whenever it changes.
+	PendingRequests(n int)
+	// Reconnected is called after the websocket is reopened.
+	Reconnected()
+	// RealtimeRequest is called after a realtime request completes, with the
+	// message type, duration, and error (if any).
+	RealtimeRequest(typ string, d time.Duration, err error)
+	// HttpRequest is called after a http request completes, with the
+	// operation name (ie, "GetAccount"), status code (0 when there was no
+	// response), request and response sizes in bytes (-1 when unknown),
+	// duration, and error (if any).
+	HttpRequest(name string, statusCode, reqSize, resSize int, d time.Duration, err error)
+}
+
+// nopMetrics is a metrics implementation that discards all metrics.
+type nopMetrics struct{}
+
+func (nopMetrics) MessageSent(string, int)                                 {}
+func (nopMetrics) MessageReceived(string, int)                             {}
+func (nopMetrics) PendingRequests(int)                                     {}
+func (nopMetrics) Reconnected()                                            {}
+func (nopMetrics) RealtimeRequest(string, time.Duration, error)            {}
+func (nopMetrics) HttpRequest(string, int, int, int, time.Duration, error) {}
+
+// NopMetrics is a metrics implementation that discards all metrics.
+var NopMetrics Metrics = nopMetrics{}
+
+// DefaultLatencyBuckets are the default latency histogram bucket upper
+// bounds.
+var DefaultLatencyBuckets = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// ExpvarMetrics is a metrics implementation publishing the collected metrics
+// as an expvar.Map.
+type ExpvarMetrics struct {
+	m *expvar.Map
+
+	messagesSent     *expvar.Map
+	messagesReceived *expvar.Map
+	bytesSent        *expvar.Int
+	bytesReceived    *expvar.Int
+	pendingRequests  *expvar.Int
+	reconnects       *expvar.Int
+	realtimeErrors   *expvar.Map
+	realtimeLatency  *histogram
+	httpRequests     *expvar.Map
+	httpErrors       *expvar.Map
+	httpBytesSent    *expvar.Int
+	httpBytesRecv    *expvar.Int
+	httpLatency      *histogram
+}
+
+// NewExpvarMetrics creates and publishes expvar metrics with the name. As
+// with expvar.Publish, panics if the name is already in use.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	m := &ExpvarMetrics{
+		m:                expvar.NewMap(name),
+		messagesSent:     new(expvar.Map).Init(),
+		messagesReceived: new(expvar.Map).Init(),
+		bytesSent:        new(expvar.Int),
+		bytesReceived:    new(expvar.Int),
+		pendingRequests:  new(expvar.Int),
+		reconnects:       new(expvar.Int),
+		realtimeErrors:   new(expvar.Map).Init(),
+		realtimeLatency:  newHistogram(DefaultLatencyBuckets),
+		httpRequests:     new(expvar.Map).Init(),
+		httpErrors:       new(expvar.Map).Init(),
+		httpBytesSent:    new(expvar.Int),
+		httpBytesRecv:    new(expvar.Int),
+		httpLatency:      newHistogram(DefaultLatencyBuckets),
+	}
+	m.m.Set("messages_sent", m.messagesSent)
+	m.m.Set("messages_received", m.messagesReceived)
+	m.m.Set("bytes_sent", m.bytesSent)
+	m.m.Set("bytes_received", m.bytesReceived)
+	m.m.Set("pending_requests", m.pendingRequests)
+	m.m.Set("reconnects", m.reconnects)
+	m.m.Set("realtime_errors", m.realtimeErrors)
+	m.m.Set("realtime_latency", m.realtimeLatency.m)
+	m.m.Set("http_requests", m.httpRequests)
+	m.m.Set("http_errors", m.httpErrors)
+	m.m.Set("http_bytes_sent", m.httpBytesSent)
+	m.m.Set("http_bytes_received", m.httpBytesRecv)
+	m.m.Set("http_latency", m.httpLatency.m)
+	return m
+}
+
+// MessageSent satisfies the Metrics interface.
+func (m *ExpvarMetrics) MessageSent(typ string, size int) {
+	m.messagesSent.Add(typ, 1)
+	m.bytesSent.Add(int64(size))
+}
+
+// MessageReceived satisfies the Metrics interface.
+func (m *ExpvarMetrics) MessageReceived(typ string, size int) {
+	m.messagesReceived.Add(typ, 1)
+	m.bytesReceived.Add(int64(size))
+}
+
+// PendingRequests satisfies the Metrics interface.
+func (m *ExpvarMetrics) PendingRequests(n int) {
+	m.pendingRequests.Set(int64(n))
+}
+
+// Reconnected satisfies the Metrics interface.
+func (m *ExpvarMetrics) Reconnected() {
+	m.reconnects.Add(1)
+}
+
+// RealtimeRequest satisfies the Metrics interface.
+func (m *ExpvarMetrics) RealtimeRequest(typ string, d time.Duration, err error) {
+	if err != nil {
+		m.realtimeErrors.Add(typ, 1)
+	}
+	m.realtimeLatency.observe(d)
+}
+
+// HttpRequest satisfies the Metrics interface.
+func (m *ExpvarMetrics) HttpRequest(name string, statusCode, reqSize, resSize int, d time.Duration, err error) {
+	m.httpRequests.Add(name, 1)
+	if err != nil {
+		m.httpErrors.Add(name, 1)
+	}
+	if reqSize > 0 {
+		m.httpBytesSent.Add(int64(reqSize))
+	}
+	if resSize > 0 {
+		m.httpBytesRecv.Add(int64(resSize))
+	}
+	m.httpLatency.observe(d)
+}
+
+// histogram is a cumulative latency histogram backed by an expvar.Map.
+type histogram struct {
+	m       *expvar.Map
+	bounds  []time.Duration
+	buckets []*expvar.Int
+	count   *expvar.Int
+	sum     *expvar.Float
+}
+
+// newHistogram creates a histogram with the bucket upper bounds.
+func newHistogram(bounds []time.Duration) *histogram {
+	h := &histogram{
+		m:      new(expvar.Map).Init(),
+		bounds: bounds,
+		count:  new(expvar.Int),
+		sum:    new(expvar.Float),
+	}
+	for _, b := range bounds {
+		v := new(expvar.Int)
+		h.buckets = append(h.buckets, v)
+		h.m.Set("le_"+strconv.FormatFloat(b.Seconds(), 'f', -1, 64), v)
+	}
+	h.m.Set("count", h.count)
+	h.m.Set("sum", h.sum)
+	return h
+}
+
+// observe records the duration.
+func (h *histogram) observe(d time.Duration) {
+	for i, b := range h.bounds {
+		if d <= b {
+			h.buckets[i].Add(1)
+		}
+	}
+	h.count.Add(1)
+	h.sum.Add(d.Seconds())
+}
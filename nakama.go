@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
@@ -14,30 +15,27 @@ import (
 
 	nkapi "github.com/heroiclabs/nakama-common/api"
 	rtapi "github.com/heroiclabs/nakama-common/rtapi"
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/timestamppb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
-/*
-
 // StoreProviderType is the store provider type.
-type StoreProviderType = nkapi.StoreProvider_Type
+type StoreProviderType = nkapi.StoreProvider
 
 // StoreProviderType values.
 const (
-	// Apple App Store
+	// Apple App Store.
 	StoreProviderApple StoreProviderType = nkapi.StoreProvider_APPLE_APP_STORE
-	// Google Play Store
+	// Google Play Store.
 	StoreProviderGoogle StoreProviderType = nkapi.StoreProvider_GOOGLE_PLAY_STORE
-	// Huawei App Gallery
+	// Huawei App Gallery.
 	StoreProviderHuawei StoreProviderType = nkapi.StoreProvider_HUAWEI_APP_GALLERY
 )
-*/
 
-/*
 // StoreEnvironmentType is the store environment type.
-type StoreEnvironmentType = nkapi.StoreEnvironment_Type
+type StoreEnvironmentType = nkapi.StoreEnvironment
 
 // StoreEnvironmentType values.
 const (
@@ -48,7 +46,6 @@ const (
 	// Production environment.
 	StoreEnvironmentProduction StoreEnvironmentType = nkapi.StoreEnvironment_PRODUCTION
 )
-*/
 
 // OpType is the operator type.
 type OpType = nkapi.Operator
@@ -97,6 +94,76 @@ const (
 	GroupUserJoinRequest = nkapi.GroupUserList_GroupUser_JOIN_REQUEST
 )
 
+// StorageReadPermission is the storage object read permission type.
+type StorageReadPermission int32
+
+// StorageReadPermission values.
+const (
+	// The object is only readable by server runtime code.
+	StorageNoRead StorageReadPermission = 0
+	// The object is readable by the owner.
+	StorageOwnerRead StorageReadPermission = 1
+	// The object is readable by any user.
+	StoragePublicRead StorageReadPermission = 2
+)
+
+// StorageWritePermission is the storage object write permission type.
+type StorageWritePermission int32
+
+// StorageWritePermission values.
+const (
+	// The object is only writable by server runtime code.
+	StorageNoWrite StorageWritePermission = 0
+	// The object is writable by the owner.
+	StorageOwnerWrite StorageWritePermission = 1
+)
+
+// Pager pages through the responses of a cursor based list request. The
+// requests' Pager methods page with a copy of the request, leaving the
+// request unmodified.
+type Pager[T any] struct {
+	f      func(context.Context, string) (T, string, error)
+	cursor string
+	page   T
+	err    error
+	done   bool
+}
+
+// NewPager creates a pager starting at the cursor, calling f with the cursor
+// to retrieve each page and its next cursor.
+func NewPager[T any](cursor string, f func(context.Context, string) (T, string, error)) *Pager[T] {
+	return &Pager[T]{
+		f:      f,
+		cursor: cursor,
+	}
+}
+
+// Next retrieves the next page, returning false when there are no more pages
+// or an error was encountered.
+func (p *Pager[T]) Next(ctx context.Context) bool {
+	if p.done {
+		return false
+	}
+	p.page, p.cursor, p.err = p.f(ctx, p.cursor)
+	p.done = p.err != nil || p.cursor == ""
+	return p.err == nil
+}
+
+// Page returns the current page.
+func (p *Pager[T]) Page() T {
+	return p.page
+}
+
+// Cursor returns the cursor for the next page.
+func (p *Pager[T]) Cursor() string {
+	return p.cursor
+}
+
+// Err returns the error encountered retrieving a page, if any.
+func (p *Pager[T]) Err() error {
+	return p.err
+}
+
 // HealthcheckRequest is a healthcheck request.
 type HealthcheckRequest struct{}
 
@@ -202,9 +269,40 @@ func (req *UpdateAccountRequest) Async(ctx context.Context, cl *Client, f func(e
 	}()
 }
 
+// DeleteAccountRequest is a request to delete the user's account.
+type DeleteAccountRequest struct{}
+
+// DeleteAccount creates a request to delete the user's account.
+func DeleteAccount() *DeleteAccountRequest {
+	return &DeleteAccountRequest{}
+}
+
+// Do executes the request against the context and client.
+func (req *DeleteAccountRequest) Do(ctx context.Context, cl *Client) error {
+	return cl.Do(ctx, "DELETE", "v2/account", true, nil, nil, nil)
+}
+
+// Async executes the request against the context and client.
+func (req *DeleteAccountRequest) Async(ctx context.Context, cl *Client, f func(error)) {
+	go func() {
+		f(req.Do(ctx, cl))
+	}()
+}
+
 // SessionResponse is the authenticate response.
 type SessionResponse = nkapi.Session
 
+// Authenticator is the interface for authenticate requests.
+//
+// Satisfied by AuthenticateAppleRequest, AuthenticateCustomRequest,
+// AuthenticateDeviceRequest, AuthenticateEmailRequest,
+// AuthenticateFacebookRequest, AuthenticateFacebookInstantGameRequest,
+// AuthenticateGameCenterRequest, AuthenticateGoogleRequest and
+// AuthenticateSteamRequest.
+type Authenticator interface {
+	Do(context.Context, *Client) (*SessionResponse, error)
+}
+
 // AuthenticateAppleRequest is a request to authenticate a user with an Apple
 // token.
 type AuthenticateAppleRequest struct {
@@ -1566,6 +1664,21 @@ func (req *ChannelMessagesRequest) Async(ctx context.Context, cl *Client, f func
 	}()
 }
 
+// Pager returns a pager for the request's pages of messages, starting at the
+// request's cursor. Pages continue in the request's direction (see
+// WithForward).
+func (req *ChannelMessagesRequest) Pager(cl *Client) *Pager[*ChannelMessagesResponse] {
+	r := new(ChannelMessagesRequest)
+	proto.Merge(&r.ListChannelMessagesRequest, &req.ListChannelMessagesRequest)
+	return NewPager(req.Cursor, func(ctx context.Context, cursor string) (*ChannelMessagesResponse, string, error) {
+		res, err := r.WithCursor(cursor).Do(ctx, cl)
+		if err != nil {
+			return nil, "", err
+		}
+		return res, res.NextCursor, nil
+	})
+}
+
 // ChannelMessagesResponse is the ListChannelMessages response.
 type ChannelMessagesResponse = nkapi.ChannelMessageList
 
@@ -1671,6 +1784,20 @@ func (req *FriendsRequest) Async(ctx context.Context, cl *Client, f func(*Friend
 	}()
 }
 
+// Pager returns a pager for the request's pages of friends, starting at the
+// request's cursor.
+func (req *FriendsRequest) Pager(cl *Client) *Pager[*FriendsResponse] {
+	r := new(FriendsRequest)
+	proto.Merge(&r.ListFriendsRequest, &req.ListFriendsRequest)
+	return NewPager(req.Cursor, func(ctx context.Context, cursor string) (*FriendsResponse, string, error) {
+		res, err := r.WithCursor(cursor).Do(ctx, cl)
+		if err != nil {
+			return nil, "", err
+		}
+		return res, res.Cursor, nil
+	})
+}
+
 // FriendsResponse is the ListFriends response.
 type FriendsResponse = nkapi.FriendList
 
@@ -1696,7 +1823,14 @@ func (req *DeleteFriendsRequest) WithUsernames(usernames ...string) *DeleteFrien
 
 // Do executes the request against the context and client.
 func (req *DeleteFriendsRequest) Do(ctx context.Context, cl *Client) error {
-	return cl.Do(ctx, "DELETE", "v2/friend", true, nil, req, nil)
+	query := url.Values{}
+	if len(req.Ids) != 0 {
+		query["ids"] = req.Ids
+	}
+	if len(req.Usernames) != 0 {
+		query["usernames"] = req.Usernames
+	}
+	return cl.Do(ctx, "DELETE", "v2/friend", true, query, nil, nil)
 }
 
 // Async executes the request against the context and client.
@@ -1728,7 +1862,14 @@ func (req *AddFriendsRequest) WithUsernames(usernames ...string) *AddFriendsRequ
 
 // Do executes the request against the context and client.
 func (req *AddFriendsRequest) Do(ctx context.Context, cl *Client) error {
-	return cl.Do(ctx, "POST", "v2/friend", true, nil, req, nil)
+	query := url.Values{}
+	if len(req.Ids) != 0 {
+		query["ids"] = req.Ids
+	}
+	if len(req.Usernames) != 0 {
+		query["usernames"] = req.Usernames
+	}
+	return cl.Do(ctx, "POST", "v2/friend", true, query, nil, nil)
 }
 
 // Async executes the request against the context and client.
@@ -1760,7 +1901,14 @@ func (req *BlockFriendsRequest) WithUsernames(usernames ...string) *BlockFriends
 
 // Do executes the request against the context and client.
 func (req *BlockFriendsRequest) Do(ctx context.Context, cl *Client) error {
-	return cl.Do(ctx, "POST", "v2/friend/block", true, nil, req, nil)
+	query := url.Values{}
+	if len(req.Ids) != 0 {
+		query["ids"] = req.Ids
+	}
+	if len(req.Usernames) != 0 {
+		query["usernames"] = req.Usernames
+	}
+	return cl.Do(ctx, "POST", "v2/friend/block", true, query, nil, nil)
 }
 
 // Async executes the request against the context and client.
@@ -1939,6 +2087,20 @@ func (req *GroupsRequest) Async(ctx context.Context, cl *Client, f func(*GroupsR
 	}()
 }
 
+// Pager returns a pager for the request's pages of groups, starting at the
+// request's cursor.
+func (req *GroupsRequest) Pager(cl *Client) *Pager[*GroupsResponse] {
+	r := new(GroupsRequest)
+	proto.Merge(&r.ListGroupsRequest, &req.ListGroupsRequest)
+	return NewPager(req.Cursor, func(ctx context.Context, cursor string) (*GroupsResponse, string, error) {
+		res, err := r.WithCursor(cursor).Do(ctx, cl)
+		if err != nil {
+			return nil, "", err
+		}
+		return res, res.Cursor, nil
+	})
+}
+
 // GroupsResponse is the ListGroups response.
 type GroupsResponse = nkapi.GroupList
 
@@ -2108,7 +2270,11 @@ func AddGroupUsers(groupId string, userIds ...string) *AddGroupUsersRequest {
 
 // Do executes the request against the context and client.
 func (req *AddGroupUsersRequest) Do(ctx context.Context, cl *Client) error {
-	return cl.Do(ctx, "POST", "v2/group/"+req.GroupId+"/add", true, nil, req, nil)
+	query := url.Values{}
+	if len(req.UserIds) != 0 {
+		query["userIds"] = req.UserIds
+	}
+	return cl.Do(ctx, "POST", "v2/group/"+req.GroupId+"/add", true, query, nil, nil)
 }
 
 // Async executes the request against the context and client.
@@ -2135,7 +2301,11 @@ func BanGroupUsers(groupId string, userIds ...string) *BanGroupUsersRequest {
 
 // Do executes the request against the context and client.
 func (req *BanGroupUsersRequest) Do(ctx context.Context, cl *Client) error {
-	return cl.Do(ctx, "POST", "v2/group/"+req.GroupId+"/ban", true, nil, req, nil)
+	query := url.Values{}
+	if len(req.UserIds) != 0 {
+		query["userIds"] = req.UserIds
+	}
+	return cl.Do(ctx, "POST", "v2/group/"+req.GroupId+"/ban", true, query, nil, nil)
 }
 
 // Async executes the request against the context and client.
@@ -2162,7 +2332,11 @@ func DemoteGroupUsers(groupId string, userIds ...string) *DemoteGroupUsersReques
 
 // Do executes the request against the context and client.
 func (req *DemoteGroupUsersRequest) Do(ctx context.Context, cl *Client) error {
-	return cl.Do(ctx, "POST", "v2/group/"+req.GroupId+"/demote", true, nil, req, nil)
+	query := url.Values{}
+	if len(req.UserIds) != 0 {
+		query["userIds"] = req.UserIds
+	}
+	return cl.Do(ctx, "POST", "v2/group/"+req.GroupId+"/demote", true, query, nil, nil)
 }
 
 // Async executes the request against the context and client.
@@ -2217,7 +2391,11 @@ func KickGroupUsers(groupId string, userIds ...string) *KickGroupUsersRequest {
 
 // Do executes the request against the context and client.
 func (req *KickGroupUsersRequest) Do(ctx context.Context, cl *Client) error {
-	return cl.Do(ctx, "POST", "v2/group/"+req.GroupId+"/kick", true, nil, req, nil)
+	query := url.Values{}
+	if len(req.UserIds) != 0 {
+		query["userIds"] = req.UserIds
+	}
+	return cl.Do(ctx, "POST", "v2/group/"+req.GroupId+"/kick", true, query, nil, nil)
 }
 
 // Async executes the request against the context and client.
@@ -2272,7 +2450,11 @@ func PromoteGroupUsers(groupId string, userIds ...string) *PromoteGroupUsersRequ
 
 // Do executes the request against the context and client.
 func (req *PromoteGroupUsersRequest) Do(ctx context.Context, cl *Client) error {
-	return cl.Do(ctx, "POST", "v2/group/"+req.GroupId+"/promote", true, nil, req, nil)
+	query := url.Values{}
+	if len(req.UserIds) != 0 {
+		query["userIds"] = req.UserIds
+	}
+	return cl.Do(ctx, "POST", "v2/group/"+req.GroupId+"/promote", true, query, nil, nil)
 }
 
 // Async executes the request against the context and client.
@@ -2341,6 +2523,20 @@ func (req *GroupUsersRequest) Async(ctx context.Context, cl *Client, f func(*Gro
 	}()
 }
 
+// Pager returns a pager for the request's pages of group users, starting at the
+// request's cursor.
+func (req *GroupUsersRequest) Pager(cl *Client) *Pager[*GroupUsersResponse] {
+	r := new(GroupUsersRequest)
+	proto.Merge(&r.ListGroupUsersRequest, &req.ListGroupUsersRequest)
+	return NewPager(req.Cursor, func(ctx context.Context, cursor string) (*GroupUsersResponse, string, error) {
+		res, err := r.WithCursor(cursor).Do(ctx, cl)
+		if err != nil {
+			return nil, "", err
+		}
+		return res, res.Cursor, nil
+	})
+}
+
 // GroupUsersResponse is the ListGroupUsers response.
 type GroupUsersResponse = nkapi.GroupUserList
 
@@ -2456,16 +2652,43 @@ func (req *ValidatePurchaseHuaweiRequest) Async(ctx context.Context, cl *Client,
 	}()
 }
 
-/*
+// GoogleReceipt is a Google Play purchase receipt, as returned by the Play
+// Billing library.
+type GoogleReceipt struct {
+	OrderId       string `json:"orderId,omitempty"`
+	PackageName   string `json:"packageName,omitempty"`
+	ProductId     string `json:"productId,omitempty"`
+	PurchaseTime  int64  `json:"purchaseTime,omitempty"`
+	PurchaseState int    `json:"purchaseState"`
+	PurchaseToken string `json:"purchaseToken,omitempty"`
+	Acknowledged  bool   `json:"acknowledged,omitempty"`
+}
+
+// String satisfies the fmt.Stringer interface, returning the receipt as
+// encoded JSON suitable for the purchase and subscription validation requests.
+func (r GoogleReceipt) String() string {
+	buf, _ := json.Marshal(r)
+	return string(buf)
+}
+
+// HuaweiReceipt is a Huawei App Gallery purchase receipt, consisting of the
+// in-app purchase data and its signature.
+type HuaweiReceipt struct {
+	PurchaseData string `json:"purchaseData"`
+	Signature    string `json:"signature"`
+}
+
 // SubscriptionsRequest is a request to retrieve subscriptions.
 type SubscriptionsRequest struct {
-	nkapi.SubscriptionsRequest
+	nkapi.ListSubscriptionsRequest
 }
 
 // Subscriptions creates a request to retrieve subscriptions.
-func Subscriptions(groupId string) *SubscriptionsRequest {
+func Subscriptions() *SubscriptionsRequest {
 	return &SubscriptionsRequest{
-		Limit: wrapperspb.Int32(100),
+		ListSubscriptionsRequest: nkapi.ListSubscriptionsRequest{
+			Limit: wrapperspb.Int32(100),
+		},
 	}
 }
 
@@ -2483,15 +2706,8 @@ func (req *SubscriptionsRequest) WithCursor(cursor string) *SubscriptionsRequest
 
 // Do executes the request against the context and client.
 func (req *SubscriptionsRequest) Do(ctx context.Context, cl *Client) (*SubscriptionsResponse, error) {
-	query := url.Values{}
-	if req.Limit != nil {
-		query.Set("limit", strconv.FormatInt(int64(req.Limit.Value), 10))
-	}
-	if req.Cursor != "" {
-		query.Set("cursor", req.Cursor)
-	}
 	res := new(SubscriptionsResponse)
-	if err := cl.Do(ctx, "GET", "v2/iap/subscription", true, nil, req, res); err != nil {
+	if err := cl.Do(ctx, "POST", "v2/iap/subscription", true, nil, req, res); err != nil {
 		return nil, err
 	}
 	return res, nil
@@ -2504,29 +2720,73 @@ func (req *SubscriptionsRequest) Async(ctx context.Context, cl *Client, f func(*
 	}()
 }
 
+// Pager returns a pager for the request's pages of subscriptions, starting at
+// the request's cursor.
+func (req *SubscriptionsRequest) Pager(cl *Client) *Pager[*SubscriptionsResponse] {
+	r := new(SubscriptionsRequest)
+	proto.Merge(&r.ListSubscriptionsRequest, &req.ListSubscriptionsRequest)
+	return NewPager(req.Cursor, func(ctx context.Context, cursor string) (*SubscriptionsResponse, string, error) {
+		res, err := r.WithCursor(cursor).Do(ctx, cl)
+		if err != nil {
+			return nil, "", err
+		}
+		return res, res.Cursor, nil
+	})
+}
+
 // SubscriptionsResponse is the Subscriptions response.
 type SubscriptionsResponse = nkapi.SubscriptionList
 
-// ValidateSubscriptionResponse is the ValidateSubscriptionApple response.
+// SubscriptionRequest is a request to retrieve a subscription.
+type SubscriptionRequest struct {
+	nkapi.GetSubscriptionRequest
+}
+
+// Subscription creates a request to retrieve a subscription.
+func Subscription(productId string) *SubscriptionRequest {
+	return &SubscriptionRequest{
+		GetSubscriptionRequest: nkapi.GetSubscriptionRequest{
+			ProductId: productId,
+		},
+	}
+}
+
+// Do executes the request against the context and client.
+func (req *SubscriptionRequest) Do(ctx context.Context, cl *Client) (*SubscriptionResponse, error) {
+	res := new(SubscriptionResponse)
+	if err := cl.Do(ctx, "GET", "v2/iap/subscription/"+url.PathEscape(req.ProductId), true, nil, nil, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Async executes the request against the context and client.
+func (req *SubscriptionRequest) Async(ctx context.Context, cl *Client, f func(*SubscriptionResponse, error)) {
+	go func() {
+		f(req.Do(ctx, cl))
+	}()
+}
+
+// SubscriptionResponse is the Subscription response.
+type SubscriptionResponse = nkapi.ValidatedSubscription
+
+// ValidateSubscriptionResponse is the validate subscription response.
 type ValidateSubscriptionResponse = nkapi.ValidateSubscriptionResponse
 
-// ValidateSubscriptionAppleRequest is a request to validate Apple subscriptions.
+// ValidateSubscriptionAppleRequest is a request to validate a Apple subscription.
 type ValidateSubscriptionAppleRequest struct {
 	nkapi.ValidateSubscriptionAppleRequest
 }
 
-// ValidateSubscriptionApple creates a request to validate Apple subscriptions.
-func ValidateSubscriptionApple() *ValidateSubscriptionAppleRequest {
+// ValidateSubscriptionApple creates a request to validate a Apple subscription.
+func ValidateSubscriptionApple(receipt string) *ValidateSubscriptionAppleRequest {
 	return &ValidateSubscriptionAppleRequest{
+		ValidateSubscriptionAppleRequest: nkapi.ValidateSubscriptionAppleRequest{
+			Receipt: receipt,
+		},
 	}
 }
 
-// WithReceipt sets the receipt on the request.
-func (req *ValidateSubscriptionAppleRequest) WithReceipt(receipt string) *ValidateSubscriptionAppleRequest {
-	req.Receipt = receipt
-	return req
-}
-
 // WithPersist sets the persist on the request.
 func (req *ValidateSubscriptionAppleRequest) WithPersist(persist bool) *ValidateSubscriptionAppleRequest {
 	req.Persist = wrapperspb.Bool(persist)
@@ -2555,17 +2815,14 @@ type ValidateSubscriptionGoogleRequest struct {
 }
 
 // ValidateSubscriptionGoogle creates a request to validate a Google subscription.
-func ValidateSubscriptionGoogle() *ValidateSubscriptionGoogleRequest {
+func ValidateSubscriptionGoogle(receipt string) *ValidateSubscriptionGoogleRequest {
 	return &ValidateSubscriptionGoogleRequest{
+		ValidateSubscriptionGoogleRequest: nkapi.ValidateSubscriptionGoogleRequest{
+			Receipt: receipt,
+		},
 	}
 }
 
-// WithReceipt sets the receipt on the request.
-func (req *ValidateSubscriptionGoogleRequest) WithReceipt(receipt string) *ValidateSubscriptionGoogleRequest {
-	req.Receipt = receipt
-	return req
-}
-
 // WithPersist sets the persist on the request.
 func (req *ValidateSubscriptionGoogleRequest) WithPersist(persist bool) *ValidateSubscriptionGoogleRequest {
 	req.Persist = wrapperspb.Bool(persist)
@@ -2587,50 +2844,6 @@ func (req *ValidateSubscriptionGoogleRequest) Async(ctx context.Context, cl *Cli
 		f(req.Do(ctx, cl))
 	}()
 }
-*/
-
-/*
-// SubscriptionRequest is a request to retrieve a subscription.
-type SubscriptionRequest struct {
-	nkapi.GetSubscriptionRequest
-}
-
-// Subscription creates a request to retrieve a subscription.
-ex/ WriteLeaderboardRecord writes a leaderboard record.
-func (cl *Client) WriteLeaderboardRecord(ctx context.Context, req *WriteLeaderboardRecordRequest) (*WriteLeaderboardRecordResponse, error) {
-	return req.Do(ctx, cl)
-}
-
-// WriteLeaderboardRecordAsync writes a leaderboard record.
-func (cl *Client) WriteLeaderboardRecordAsync(ctx context.Context, req *WriteLeaderboardRecordRequest, f func(*WriteLeaderboardRecordResponse, error)) {
-	req.Async(ctx, cl, f)
-}
-func Subscription(productId string) *SubscriptionRequest {
-	return &SubscriptionRequest{
-		ProductId: productId,
-	}
-}
-
-// Do executes the request against the context and client.
-func (req *SubscriptionRequest) Do(ctx context.Context, cl *Client) (*SubscriptionResponse, error) {
-	res := new(SubscriptionResponse)
-	if err := cl.Do(ctx, "GET", "v2/iap/subscription/"+req.ProductId, nil, nil, res); err != nil {
-		return nil, err
-	}
-	return res, nil
-}
-
-// Async executes the request against the context and client.
-func (req *SubscriptionRequest) Async(ctx context.Context, cl *Client, f func(*SubscriptionResponse, error)) {
-	go func() {
-		f(req.Do(ctx, cl))
-	}()
-}
-
-// SubscriptionResponse is a Subscription response.
-type SubscriptionResponse = nkapi.ValidatedSubscription
-
-*/
 
 // LeaderboardRecordsRequest is a request to retrieve the leaderboard records.
 type LeaderboardRecordsRequest struct {
@@ -2674,8 +2887,8 @@ func (req *LeaderboardRecordsRequest) WithExpiry(expiry int) *LeaderboardRecords
 // Do executes the request against the context and client.
 func (req *LeaderboardRecordsRequest) Do(ctx context.Context, cl *Client) (*LeaderboardRecordsResponse, error) {
 	query := url.Values{}
-	if req.OwnerIds != nil {
-		query.Set("ownerIds", strings.Join(req.OwnerIds, ","))
+	if len(req.OwnerIds) != 0 {
+		query["ownerIds"] = req.OwnerIds
 	}
 	if req.Limit != nil {
 		query.Set("limit", strconv.FormatInt(int64(req.Limit.Value), 10))
@@ -2700,6 +2913,20 @@ func (req *LeaderboardRecordsRequest) Async(ctx context.Context, cl *Client, f f
 	}()
 }
 
+// Pager returns a pager for the request's pages of records, starting at the
+// request's cursor.
+func (req *LeaderboardRecordsRequest) Pager(cl *Client) *Pager[*LeaderboardRecordsResponse] {
+	r := new(LeaderboardRecordsRequest)
+	proto.Merge(&r.ListLeaderboardRecordsRequest, &req.ListLeaderboardRecordsRequest)
+	return NewPager(req.Cursor, func(ctx context.Context, cursor string) (*LeaderboardRecordsResponse, string, error) {
+		res, err := r.WithCursor(cursor).Do(ctx, cl)
+		if err != nil {
+			return nil, "", err
+		}
+		return res, res.NextCursor, nil
+	})
+}
+
 // LeaderboardRecordsResponse is the ListLeaderboardRecords response.
 type LeaderboardRecordsResponse = nkapi.LeaderboardRecordList
 
@@ -2787,6 +3014,95 @@ func (req *WriteLeaderboardRecordRequest) Async(ctx context.Context, cl *Client,
 // WriteLeaderboardRecordResponse is the WriteLeaderboardRecord response.
 type WriteLeaderboardRecordResponse = nkapi.LeaderboardRecord
 
+// RecordWrite is a leaderboard or tournament record write, with typed score,
+// subscore and metadata, and an optional operator override.
+type RecordWrite struct {
+	id       string
+	score    int64
+	subscore int64
+	operator OpType
+	metadata string
+	err      error
+}
+
+// LeaderboardRecordWrite creates a record write for the leaderboard or
+// tournament, with the score.
+func LeaderboardRecordWrite(id string, score int64) *RecordWrite {
+	return &RecordWrite{
+		id:    id,
+		score: score,
+	}
+}
+
+// WithSubscore sets the subscore on the record write.
+func (w *RecordWrite) WithSubscore(subscore int64) *RecordWrite {
+	w.subscore = subscore
+	return w
+}
+
+// WithOperator overrides the leaderboard's operator (OpBest, OpSet,
+// OpIncrement, or OpDecrement) for the record write.
+func (w *RecordWrite) WithOperator(operator OpType) *RecordWrite {
+	w.operator = operator
+	return w
+}
+
+// WithMetadata sets the metadata on the record write. The metadata is encoded
+// as json, except for a string, []byte, or json.RawMessage, which are used as
+// is.
+func (w *RecordWrite) WithMetadata(metadata interface{}) *RecordWrite {
+	switch v := metadata.(type) {
+	case string:
+		w.metadata = v
+	case []byte:
+		w.metadata = string(v)
+	case json.RawMessage:
+		w.metadata = string(v)
+	default:
+		buf, err := json.Marshal(v)
+		if err != nil {
+			w.err = fmt.Errorf("unable to encode record metadata: %w", err)
+			return w
+		}
+		w.metadata = string(buf)
+	}
+	return w
+}
+
+// Leaderboard returns the request to write the record to the leaderboard.
+func (w *RecordWrite) Leaderboard() *WriteLeaderboardRecordRequest {
+	return WriteLeaderboardRecord(w.id).
+		WithScore(w.score).
+		WithSubscore(w.subscore).
+		WithOperator(w.operator).
+		WithMetadata(w.metadata)
+}
+
+// Tournament returns the request to write the record to the tournament.
+func (w *RecordWrite) Tournament() *WriteTournamentRecordRequest {
+	return WriteTournamentRecord(w.id).
+		WithScore(w.score).
+		WithSubscore(w.subscore).
+		WithOperator(w.operator).
+		WithMetadata(w.metadata)
+}
+
+// Do writes the record to the leaderboard.
+func (w *RecordWrite) Do(ctx context.Context, cl *Client) (*WriteLeaderboardRecordResponse, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	return w.Leaderboard().Do(ctx, cl)
+}
+
+// DoTournament writes the record to the tournament.
+func (w *RecordWrite) DoTournament(ctx context.Context, cl *Client) (*WriteTournamentRecordResponse, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	return w.Tournament().Do(ctx, cl)
+}
+
 // LeaderboardRecordsAroundOwnerRequest is a request to retrieve leaderboard
 // records around owner.
 type LeaderboardRecordsAroundOwnerRequest struct {
@@ -2817,6 +3133,12 @@ func (req *LeaderboardRecordsAroundOwnerRequest) WithExpiry(expiry int) *Leaderb
 	return req
 }
 
+// WithCursor sets the cursor on the request.
+func (req *LeaderboardRecordsAroundOwnerRequest) WithCursor(cursor string) *LeaderboardRecordsAroundOwnerRequest {
+	req.Cursor = cursor
+	return req
+}
+
 // Do executes the request against the context and client.
 func (req *LeaderboardRecordsAroundOwnerRequest) Do(ctx context.Context, cl *Client) (*LeaderboardRecordsAroundOwnerResponse, error) {
 	query := url.Values{}
@@ -2826,11 +3148,9 @@ func (req *LeaderboardRecordsAroundOwnerRequest) Do(ctx context.Context, cl *Cli
 	if req.Expiry != nil {
 		query.Set("expiry", strconv.FormatInt(int64(req.Expiry.Value), 10))
 	}
-	/*
-		if req.Cursor != "" {
-			query.Set("cursor", req.Cursor)
-		}
-	*/
+	if req.Cursor != "" {
+		query.Set("cursor", req.Cursor)
+	}
 	res := new(LeaderboardRecordsAroundOwnerResponse)
 	if err := cl.Do(ctx, "GET", "v2/leaderboard/"+req.LeaderboardId+"/owner/"+req.OwnerId, true, query, nil, res); err != nil {
 		return nil, err
@@ -2845,6 +3165,20 @@ func (req *LeaderboardRecordsAroundOwnerRequest) Async(ctx context.Context, cl *
 	}()
 }
 
+// Pager returns a pager for the request's pages of records, starting at the
+// request's cursor.
+func (req *LeaderboardRecordsAroundOwnerRequest) Pager(cl *Client) *Pager[*LeaderboardRecordsAroundOwnerResponse] {
+	r := new(LeaderboardRecordsAroundOwnerRequest)
+	proto.Merge(&r.ListLeaderboardRecordsAroundOwnerRequest, &req.ListLeaderboardRecordsAroundOwnerRequest)
+	return NewPager(req.Cursor, func(ctx context.Context, cursor string) (*LeaderboardRecordsAroundOwnerResponse, string, error) {
+		res, err := r.WithCursor(cursor).Do(ctx, cl)
+		if err != nil {
+			return nil, "", err
+		}
+		return res, res.NextCursor, nil
+	})
+}
+
 // LeaderboardRecordsAroundOwnerResponse is the ListLeaderboardRecordsAroundOwner response.
 type LeaderboardRecordsAroundOwnerResponse = nkapi.LeaderboardRecordList
 
@@ -2933,9 +3267,79 @@ func (req *MatchesRequest) Async(ctx context.Context, cl *Client, f func(*Matche
 	}()
 }
 
+// Iter returns an iterator over the matches returned by the request. The
+// iterator repeats the request when the returned matches have been exhausted,
+// yielding only matches not previously seen, and stops when a request returns
+// no new matches.
+func (req *MatchesRequest) Iter(cl *Client) *MatchIterator {
+	return &MatchIterator{
+		f: func(ctx context.Context) ([]*Match, error) {
+			res, err := req.Do(ctx, cl)
+			if err != nil {
+				return nil, err
+			}
+			return res.Matches, nil
+		},
+		seen: make(map[string]bool),
+	}
+}
+
 // MatchesResponse is the ListMatches response.
 type MatchesResponse = nkapi.MatchList
 
+// Match is a realtime match.
+type Match = nkapi.Match
+
+// MatchIterator is an iterator over listed matches.
+type MatchIterator struct {
+	f       func(context.Context) ([]*Match, error)
+	seen    map[string]bool
+	matches []*Match
+	match   *Match
+	err     error
+	done    bool
+}
+
+// Next advances to the next match, returning false when there are no more
+// matches or an error was encountered.
+func (it *MatchIterator) Next(ctx context.Context) bool {
+	for !it.done {
+		for len(it.matches) != 0 {
+			m := it.matches[0]
+			it.matches = it.matches[1:]
+			if it.seen[m.MatchId] {
+				continue
+			}
+			it.seen[m.MatchId], it.match = true, m
+			return true
+		}
+		var matches []*Match
+		if matches, it.err = it.f(ctx); it.err != nil {
+			it.done = true
+			break
+		}
+		n := 0
+		for _, m := range matches {
+			if !it.seen[m.MatchId] {
+				n++
+			}
+		}
+		it.matches, it.done = matches, n == 0
+	}
+	it.match = nil
+	return false
+}
+
+// Match returns the current match.
+func (it *MatchIterator) Match() *Match {
+	return it.match
+}
+
+// Err returns the error encountered retrieving matches, if any.
+func (it *MatchIterator) Err() error {
+	return it.err
+}
+
 // NotificationsRequest is a request to retrieve notifications.
 type NotificationsRequest struct {
 	nkapi.ListNotificationsRequest
@@ -2972,7 +3376,7 @@ func (req *NotificationsRequest) Do(ctx context.Context, cl *Client) (*Notificat
 		query.Set("cacheableCursor", req.CacheableCursor)
 	}
 	res := new(NotificationsResponse)
-	if err := cl.Do(ctx, "GET", "v2/notifications", true, query, nil, res); err != nil {
+	if err := cl.Do(ctx, "GET", "v2/notification", true, query, nil, res); err != nil {
 		return nil, err
 	}
 	return res, nil
@@ -2988,6 +3392,9 @@ func (req *NotificationsRequest) Async(ctx context.Context, cl *Client, f func(*
 // NotificationsResponse is the ListNotifications response.
 type NotificationsResponse = nkapi.NotificationList
 
+// Notification is a notification.
+type Notification = nkapi.Notification
+
 // DeleteNotificationsRequest is a request to delete notifications.
 type DeleteNotificationsRequest struct {
 	nkapi.DeleteNotificationsRequest
@@ -3004,7 +3411,11 @@ func DeleteNotifications(ids ...string) *DeleteNotificationsRequest {
 
 // Do executes the request against the context and client.
 func (req *DeleteNotificationsRequest) Do(ctx context.Context, cl *Client) error {
-	return cl.Do(ctx, "DELETE", "v2/notification", true, nil, req, nil)
+	query := url.Values{}
+	if len(req.Ids) != 0 {
+		query["ids"] = req.Ids
+	}
+	return cl.Do(ctx, "DELETE", "v2/notification", true, query, nil, nil)
 }
 
 // Async executes the request against the context and client.
@@ -3021,11 +3432,15 @@ type RpcRequest struct {
 	v       interface{}
 	httpKey string
 	proto   bool
+	codec   RpcCodec
 	buf     []byte
 	mutex   sync.Mutex
 }
 
-// Rpc creates a request to execute a remote procedure call.
+// Rpc creates a request to execute a remote procedure call. The payload is
+// json encoded, unless it is a string or []byte (sent as is), or the request
+// is a realtime protobuf request. Similarly, the response is json decoded to
+// v, unless v is a *string or *[]byte.
 func Rpc(id string, payload, v interface{}) *RpcRequest {
 	return &RpcRequest{
 		id:      id,
@@ -3058,14 +3473,44 @@ func (req *RpcRequest) WithProto(proto bool) *RpcRequest {
 	return req
 }
 
+// WithCodec sets the codec used to encode the payload and decode the
+// response, overriding the default encoding rules (see Rpc).
+func (req *RpcRequest) WithCodec(codec RpcCodec) *RpcRequest {
+	req.codec = codec
+	return req
+}
+
 // Do executes the request against the context and client.
 func (req *RpcRequest) Do(ctx context.Context, cl *Client) error {
+	if req.codec != nil {
+		return req.doCodec(ctx, cl)
+	}
+	httpKey := req.httpKey
+	if httpKey == "" && (cl.serverMode || cl.SessionToken() == "") {
+		httpKey = cl.httpKey
+	}
 	query := url.Values{}
 	query.Set("unwrap", "true")
-	if req.httpKey != "" {
-		query.Set("http_key", req.httpKey)
+	if httpKey != "" {
+		query.Set("http_key", httpKey)
 	}
-	return cl.Do(ctx, "POST", "v2/rpc/"+req.id, req.httpKey == "", query, req.payload, req.v)
+	return cl.Do(ctx, "POST", "v2/rpc/"+req.id, httpKey == "", query, req.payload, req.v)
+}
+
+// doCodec executes the request against the context and client, using the
+// request's codec.
+func (req *RpcRequest) doCodec(ctx context.Context, cl *Client) error {
+	if err := req.marshal(); err != nil {
+		return err
+	}
+	var buf []byte
+	if err := Rpc(req.id, req.buf, &buf).WithHttpKey(req.httpKey).Do(ctx, cl); err != nil {
+		return err
+	}
+	if len(buf) == 0 || req.v == nil {
+		return nil
+	}
+	return req.codec.Unmarshal(buf, req.v)
 }
 
 // Async executes the request against the context and client.
@@ -3077,23 +3522,93 @@ func (req *RpcRequest) Async(ctx context.Context, cl *Client, f func(error)) {
 
 // Send sends the message to the connection.
 func (req *RpcRequest) Send(ctx context.Context, conn *Conn) error {
-	if err := req.marshal(); err != nil {
+	return req.Msg().Send(ctx, conn)
+}
+
+// SendAsync sends the message to the connection.
+//
+// Deprecated: use RpcMsg.Async.
+func (req *RpcRequest) SendAsync(ctx context.Context, conn *Conn, f func(error)) {
+	req.Msg().Async(ctx, conn, f)
+}
+
+// Msg returns the realtime message for the request.
+func (req *RpcRequest) Msg() *RpcMsg {
+	return &RpcMsg{req: req}
+}
+
+// RpcMsg is a realtime message to execute a remote procedure call.
+type RpcMsg struct {
+	req *RpcRequest
+}
+
+// RpcMessage creates a realtime message to execute a remote procedure call.
+// See Rpc for the encoding rules.
+func RpcMessage(id string, payload, v interface{}) *RpcMsg {
+	return Rpc(id, payload, v).Msg()
+}
+
+// BuildEnvelope satisfies the EnvelopeBuilder interface.
+func (msg *RpcMsg) BuildEnvelope() *rtapi.Envelope {
+	return msg.req.BuildEnvelope()
+}
+
+// WithProto sets the Protobuf encoding toggle for the message.
+func (msg *RpcMsg) WithProto(proto bool) *RpcMsg {
+	msg.req.proto = proto
+	return msg
+}
+
+// WithCodec sets the codec used to encode the payload and decode the
+// response, overriding the default encoding rules (see Rpc).
+func (msg *RpcMsg) WithCodec(codec RpcCodec) *RpcMsg {
+	msg.req.codec = codec
+	return msg
+}
+
+// Send sends the message to the connection.
+func (msg *RpcMsg) Send(ctx context.Context, conn *Conn) error {
+	if err := msg.req.marshal(); err != nil {
 		return err
 	}
-	res := new(rpcMsg)
-	if err := conn.Send(ctx, req, res); err != nil {
+	res := new(rpcResponseMsg)
+	if err := conn.Send(ctx, msg.req, res); err != nil {
 		return err
 	}
-	return req.unmarshal(res)
+	return msg.req.unmarshal(res)
 }
 
-// SendAsync sends the message to the connection.
-func (req *RpcRequest) SendAsync(ctx context.Context, conn *Conn, f func(error)) {
+// Async sends the message to the connection.
+func (msg *RpcMsg) Async(ctx context.Context, conn *Conn, f func(error)) {
 	go func() {
-		f(req.Send(ctx, conn))
+		f(msg.Send(ctx, conn))
 	}()
 }
 
+// inject returns the message with the context's metadata and span context
+// injected in the payload by the connection's metadata injector (see
+// WithConnMetadataInjector and WithConnTracerProvider).
+func (req *RpcRequest) inject(ctx context.Context, conn *Conn) (EnvelopeBuilder, error) {
+	if conn.metadata == nil || req.proto {
+		return req, nil
+	}
+	md := MetadataFrom(ctx)
+	if conn.tracer != nil {
+		md = traceMetadata(ctx, md)
+	}
+	if len(md) == 0 {
+		return req, nil
+	}
+	if err := req.marshal(); err != nil {
+		return nil, err
+	}
+	buf, err := conn.metadata.InjectPayload(md, req.buf)
+	if err != nil {
+		return nil, err
+	}
+	return &RpcRequest{id: req.id, buf: buf}, nil
+}
+
 // marshal marshals the request.
 func (req *RpcRequest) marshal() error {
 	req.mutex.Lock()
@@ -3101,6 +3616,15 @@ func (req *RpcRequest) marshal() error {
 	if req.buf != nil {
 		return nil
 	}
+	// codec encode
+	if req.codec != nil {
+		buf, err := req.codec.Marshal(req.payload)
+		if err != nil {
+			return err
+		}
+		req.buf = buf
+		return nil
+	}
 	// protobuf encode
 	if req.proto {
 		msg, ok := req.payload.(proto.Message)
@@ -3114,6 +3638,15 @@ func (req *RpcRequest) marshal() error {
 		req.buf = buf
 		return nil
 	}
+	// raw
+	switch v := req.payload.(type) {
+	case string:
+		req.buf = []byte(v)
+		return nil
+	case []byte:
+		req.buf = v
+		return nil
+	}
 	// json encode
 	buf := new(bytes.Buffer)
 	enc := json.NewEncoder(buf)
@@ -3125,10 +3658,17 @@ func (req *RpcRequest) marshal() error {
 }
 
 // unmarshal unmarshals the response.
-func (req *RpcRequest) unmarshal(msg *rpcMsg) error {
+func (req *RpcRequest) unmarshal(msg *rpcResponseMsg) error {
 	if msg.Payload == "" {
 		return nil
 	}
+	// codec decode
+	if req.codec != nil {
+		if req.v == nil {
+			return nil
+		}
+		return req.codec.Unmarshal([]byte(msg.Payload), req.v)
+	}
 	// protobuf decode
 	if req.proto {
 		v, ok := req.v.(proto.Message)
@@ -3137,12 +3677,161 @@ func (req *RpcRequest) unmarshal(msg *rpcMsg) error {
 		}
 		return proto.Unmarshal([]byte(msg.Payload), v)
 	}
+	// raw
+	switch v := req.v.(type) {
+	case *string:
+		*v = msg.Payload
+		return nil
+	case *[]byte:
+		*v = []byte(msg.Payload)
+		return nil
+	}
 	// json decode
 	dec := json.NewDecoder(strings.NewReader(msg.Payload))
 	dec.DisallowUnknownFields()
 	return dec.Decode(req.v)
 }
 
+// RpcCall executes a remote procedure call against the client, encoding req
+// and decoding the response as Resp. See Rpc for the encoding rules.
+func RpcCall[Req, Resp any](ctx context.Context, cl *Client, id string, req Req) (Resp, error) {
+	res, v := rpcResponse[Resp]()
+	if err := Rpc(id, req, v).Do(ctx, cl); err != nil {
+		var zero Resp
+		return zero, err
+	}
+	return *res, nil
+}
+
+// RpcSend sends a remote procedure call message to the connection, encoding
+// req and decoding the response as Resp. See Rpc for the encoding rules.
+//
+// Deprecated: use ConnRpc.
+func RpcSend[Req, Resp any](ctx context.Context, conn *Conn, id string, req Req) (Resp, error) {
+	return ConnRpc[Req, Resp](ctx, conn, id, req)
+}
+
+// ConnRpc sends a remote procedure call message to the connection, encoding
+// req and decoding the response as Resp. See Rpc for the encoding rules.
+func ConnRpc[Req, Resp any](ctx context.Context, conn *Conn, id string, req Req) (Resp, error) {
+	res, v := rpcResponse[Resp]()
+	if err := RpcMessage(id, req, v).Send(ctx, conn); err != nil {
+		var zero Resp
+		return zero, err
+	}
+	return *res, nil
+}
+
+// ConnRpcCodec sends a remote procedure call message to the connection,
+// encoding req and decoding the response as Resp with the codec.
+func ConnRpcCodec[Req, Resp any](ctx context.Context, conn *Conn, codec RpcCodec, id string, req Req) (Resp, error) {
+	res, v := rpcResponse[Resp]()
+	if err := RpcMessage(id, req, v).WithCodec(codec).Send(ctx, conn); err != nil {
+		var zero Resp
+		return zero, err
+	}
+	return *res, nil
+}
+
+// ConnRpcAsync sends a remote procedure call message to the connection,
+// encoding req and decoding the response as Resp. See Rpc for the encoding
+// rules.
+func ConnRpcAsync[Req, Resp any](ctx context.Context, conn *Conn, id string, req Req, f func(Resp, error)) {
+	go func() {
+		f(ConnRpc[Req, Resp](ctx, conn, id, req))
+	}()
+}
+
+// rpcResponse returns a new Resp and the value to decode the response to.
+// When Resp is a pointer type (such as a proto.Message), the pointed to value
+// is allocated and decoded to directly.
+func rpcResponse[Resp any]() (*Resp, interface{}) {
+	res := new(Resp)
+	if typ := reflect.TypeOf(res).Elem(); typ.Kind() == reflect.Pointer {
+		*res = reflect.New(typ.Elem()).Interface().(Resp)
+		return res, *res
+	}
+	return res, res
+}
+
+// RpcCodec is the interface for remote procedure call payload codecs.
+type RpcCodec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(buf []byte, v interface{}) error
+}
+
+// RpcCodec values.
+var (
+	// JsonCodec encodes payloads with encoding/json.
+	JsonCodec RpcCodec = jsonCodec{}
+	// ProtojsonCodec encodes proto.Message payloads with protojson.
+	ProtojsonCodec RpcCodec = protojsonCodec{}
+	// RawCodec sends string or []byte payloads as is, decoding responses to
+	// a *string or *[]byte.
+	RawCodec RpcCodec = rawCodec{}
+)
+
+// jsonCodec is a encoding/json rpc codec.
+type jsonCodec struct{}
+
+// Marshal satisfies the RpcCodec interface.
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal satisfies the RpcCodec interface.
+func (jsonCodec) Unmarshal(buf []byte, v interface{}) error {
+	return json.Unmarshal(buf, v)
+}
+
+// protojsonCodec is a protojson rpc codec.
+type protojsonCodec struct{}
+
+// Marshal satisfies the RpcCodec interface.
+func (protojsonCodec) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("payload type %T is not a proto.Message", v)
+	}
+	return protojson.Marshal(msg)
+}
+
+// Unmarshal satisfies the RpcCodec interface.
+func (protojsonCodec) Unmarshal(buf []byte, v interface{}) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("response type %T is not a proto.Message", v)
+	}
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(buf, msg)
+}
+
+// rawCodec is a raw string rpc codec.
+type rawCodec struct{}
+
+// Marshal satisfies the RpcCodec interface.
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	switch z := v.(type) {
+	case string:
+		return []byte(z), nil
+	case []byte:
+		return z, nil
+	}
+	return nil, fmt.Errorf("payload type %T is not a string or []byte", v)
+}
+
+// Unmarshal satisfies the RpcCodec interface.
+func (rawCodec) Unmarshal(buf []byte, v interface{}) error {
+	switch z := v.(type) {
+	case *string:
+		*z = string(buf)
+		return nil
+	case *[]byte:
+		*z = buf
+		return nil
+	}
+	return fmt.Errorf("response type %T is not a *string or *[]byte", v)
+}
+
 // SessionLogoutRequest is a request to logout of the session.
 type SessionLogoutRequest struct {
 	nkapi.SessionLogoutRequest
@@ -3341,6 +4030,123 @@ func (req *StorageObjectsRequest) Async(ctx context.Context, cl *Client, f func(
 // StorageObjectsResponse is the ListStorageObjects response.
 type StorageObjectsResponse = nkapi.StorageObjectList
 
+// StorageValue is a storage object with a json decoded value.
+type StorageValue[T any] struct {
+	Collection      string
+	Key             string
+	UserId          string
+	Version         string
+	PermissionRead  StorageReadPermission
+	PermissionWrite StorageWritePermission
+	CreateTime      time.Time
+	UpdateTime      time.Time
+	Value           T
+}
+
+// NewStorageValue decodes the storage object's json value.
+func NewStorageValue[T any](obj *nkapi.StorageObject) (*StorageValue[T], error) {
+	v := &StorageValue[T]{
+		Collection:      obj.Collection,
+		Key:             obj.Key,
+		UserId:          obj.UserId,
+		Version:         obj.Version,
+		PermissionRead:  StorageReadPermission(obj.PermissionRead),
+		PermissionWrite: StorageWritePermission(obj.PermissionWrite),
+		CreateTime:      timeOf(obj.CreateTime),
+		UpdateTime:      timeOf(obj.UpdateTime),
+	}
+	if err := json.Unmarshal([]byte(obj.Value), &v.Value); err != nil {
+		return nil, fmt.Errorf("unable to decode storage object %s/%s: %w", obj.Collection, obj.Key, err)
+	}
+	return v, nil
+}
+
+// ReadStorageValue reads the storage object for the collection and key owned
+// by the user id, decoding its json value. When the user id is empty, the
+// object owned by the session user is read. Returns nil when the object does
+// not exist.
+func ReadStorageValue[T any](ctx context.Context, cl *Client, collection, key, userId string) (*StorageValue[T], error) {
+	if userId == "" {
+		userId = cl.SessionUserId()
+	}
+	res, err := ReadStorageObjects().WithObjectId(collection, key, userId).Do(ctx, cl)
+	switch {
+	case err != nil:
+		return nil, err
+	case len(res.Objects) == 0:
+		return nil, nil
+	}
+	return NewStorageValue[T](res.Objects[0])
+}
+
+// WriteStorageValue writes v as the json value of the session user's storage
+// object for the collection and key, returning the object's new version.
+func WriteStorageValue[T any](ctx context.Context, cl *Client, collection, key string, v T, opts ...StorageOption) (string, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("unable to encode storage object %s/%s: %w", collection, key, err)
+	}
+	obj := &WriteStorageObject{
+		Collection: collection,
+		Key:        key,
+		Value:      string(buf),
+	}
+	for _, o := range opts {
+		o(obj)
+	}
+	res, err := WriteStorageObjects().WithObject(obj).Do(ctx, cl)
+	switch {
+	case err != nil:
+		return "", err
+	case len(res.Acks) == 0:
+		return "", fmt.Errorf("unable to write storage object %s/%s: no ack", collection, key)
+	}
+	return res.Acks[0].Version, nil
+}
+
+// ListStorageValues lists the storage objects in the collection owned by the
+// user id, decoding their json values. Returns the cursor for the next page.
+func ListStorageValues[T any](ctx context.Context, cl *Client, collection, userId string, limit int, cursor string) ([]*StorageValue[T], string, error) {
+	res, err := StorageObjects(collection).
+		WithUserId(userId).
+		WithLimit(limit).
+		WithCursor(cursor).
+		Do(ctx, cl)
+	if err != nil {
+		return nil, "", err
+	}
+	values := make([]*StorageValue[T], 0, len(res.Objects))
+	for _, obj := range res.Objects {
+		v, err := NewStorageValue[T](obj)
+		if err != nil {
+			return nil, "", err
+		}
+		values = append(values, v)
+	}
+	return values, res.Cursor, nil
+}
+
+// StorageOption is a storage object write option.
+type StorageOption func(*WriteStorageObject)
+
+// WithStorageVersion is a storage object write option to set the version for
+// optimistic concurrency control. The write fails when the object's version
+// does not match. Use "*" to only write when the object does not exist.
+func WithStorageVersion(version string) StorageOption {
+	return func(obj *WriteStorageObject) {
+		obj.Version = version
+	}
+}
+
+// WithStoragePermissions is a storage object write option to set the read and
+// write permissions.
+func WithStoragePermissions(read StorageReadPermission, write StorageWritePermission) StorageOption {
+	return func(obj *WriteStorageObject) {
+		obj.PermissionRead = wrapperspb.Int32(int32(read))
+		obj.PermissionWrite = wrapperspb.Int32(int32(write))
+	}
+}
+
 // TournamentsRequest is a request to retrieve tournaments.
 type TournamentsRequest struct {
 	nkapi.ListTournamentsRequest
@@ -3385,6 +4191,11 @@ func (req *TournamentsRequest) WithEndTime(endTime uint32) *TournamentsRequest {
 	return req
 }
 
+// WithTimeRange sets the startTime and endTime on the request.
+func (req *TournamentsRequest) WithTimeRange(startTime, endTime time.Time) *TournamentsRequest {
+	return req.WithStartTime(uint32(startTime.Unix())).WithEndTime(uint32(endTime.Unix()))
+}
+
 // WithCursor sets the cursor on the request.
 func (req *TournamentsRequest) WithCursor(cursor string) *TournamentsRequest {
 	req.Cursor = cursor
@@ -3426,6 +4237,20 @@ func (req *TournamentsRequest) Async(ctx context.Context, cl *Client, f func(*To
 	}()
 }
 
+// Pager returns a pager for the request's pages of tournaments, starting at the
+// request's cursor.
+func (req *TournamentsRequest) Pager(cl *Client) *Pager[*TournamentsResponse] {
+	r := new(TournamentsRequest)
+	proto.Merge(&r.ListTournamentsRequest, &req.ListTournamentsRequest)
+	return NewPager(req.Cursor, func(ctx context.Context, cursor string) (*TournamentsResponse, string, error) {
+		res, err := r.WithCursor(cursor).Do(ctx, cl)
+		if err != nil {
+			return nil, "", err
+		}
+		return res, res.Cursor, nil
+	})
+}
+
 // TournamentsResponse is the ListTournaments response.
 type TournamentsResponse = nkapi.TournamentList
 
@@ -3471,8 +4296,8 @@ func (req *TournamentRecordsRequest) WithCursor(cursor string) *TournamentRecord
 // Do executes the request against the context and client.
 func (req *TournamentRecordsRequest) Do(ctx context.Context, cl *Client) (*TournamentRecordsResponse, error) {
 	query := url.Values{}
-	if req.OwnerIds != nil {
-		query.Set("ownerIds", strings.Join(req.OwnerIds, ","))
+	if len(req.OwnerIds) != 0 {
+		query["ownerIds"] = req.OwnerIds
 	}
 	if req.Limit != nil {
 		query.Set("limit", strconv.FormatInt(int64(req.Limit.Value), 10))
@@ -3497,6 +4322,20 @@ func (req *TournamentRecordsRequest) Async(ctx context.Context, cl *Client, f fu
 	}()
 }
 
+// Pager returns a pager for the request's pages of records, starting at the
+// request's cursor.
+func (req *TournamentRecordsRequest) Pager(cl *Client) *Pager[*TournamentRecordsResponse] {
+	r := new(TournamentRecordsRequest)
+	proto.Merge(&r.ListTournamentRecordsRequest, &req.ListTournamentRecordsRequest)
+	return NewPager(req.Cursor, func(ctx context.Context, cursor string) (*TournamentRecordsResponse, string, error) {
+		res, err := r.WithCursor(cursor).Do(ctx, cl)
+		if err != nil {
+			return nil, "", err
+		}
+		return res, res.NextCursor, nil
+	})
+}
+
 // TournamentRecordsResponse is the ListTournamentRecords response.
 type TournamentRecordsResponse = nkapi.TournamentRecordList
 
@@ -3614,6 +4453,12 @@ func (req *TournamentRecordsAroundOwnerRequest) WithExpiry(expiry int) *Tourname
 	return req
 }
 
+// WithCursor sets the cursor on the request.
+func (req *TournamentRecordsAroundOwnerRequest) WithCursor(cursor string) *TournamentRecordsAroundOwnerRequest {
+	req.Cursor = cursor
+	return req
+}
+
 // Do executes the request against the context and client.
 func (req *TournamentRecordsAroundOwnerRequest) Do(ctx context.Context, cl *Client) (*TournamentRecordsAroundOwnerResponse, error) {
 	query := url.Values{}
@@ -3623,11 +4468,9 @@ func (req *TournamentRecordsAroundOwnerRequest) Do(ctx context.Context, cl *Clie
 	if req.Expiry != nil {
 		query.Set("expiry", strconv.FormatInt(int64(req.Expiry.Value), 10))
 	}
-	/*
-		if req.Cursor != "" {
-			query.Set("cursor", req.Cursor)
-		}
-	*/
+	if req.Cursor != "" {
+		query.Set("cursor", req.Cursor)
+	}
 	res := new(TournamentRecordsAroundOwnerResponse)
 	if err := cl.Do(ctx, "GET", "v2/tournament/"+req.TournamentId+"/owner/"+req.OwnerId, true, query, nil, res); err != nil {
 		return nil, err
@@ -3642,6 +4485,20 @@ func (req *TournamentRecordsAroundOwnerRequest) Async(ctx context.Context, cl *C
 	}()
 }
 
+// Pager returns a pager for the request's pages of records, starting at the
+// request's cursor.
+func (req *TournamentRecordsAroundOwnerRequest) Pager(cl *Client) *Pager[*TournamentRecordsAroundOwnerResponse] {
+	r := new(TournamentRecordsAroundOwnerRequest)
+	proto.Merge(&r.ListTournamentRecordsAroundOwnerRequest, &req.ListTournamentRecordsAroundOwnerRequest)
+	return NewPager(req.Cursor, func(ctx context.Context, cursor string) (*TournamentRecordsAroundOwnerResponse, string, error) {
+		res, err := r.WithCursor(cursor).Do(ctx, cl)
+		if err != nil {
+			return nil, "", err
+		}
+		return res, res.NextCursor, nil
+	})
+}
+
 // TournamentRecordsAroundOwnerResponse is the ListTournamentRecordsAroundOwner response.
 type TournamentRecordsAroundOwnerResponse = nkapi.TournamentRecordList
 
@@ -3675,13 +4532,13 @@ func (req *UsersRequest) WithFacebookIds(facebookIds ...string) *UsersRequest {
 func (req *UsersRequest) Do(ctx context.Context, cl *Client) (*UsersResponse, error) {
 	query := url.Values{}
 	if len(req.Ids) != 0 {
-		query.Set("ids", strings.Join(req.Ids, ","))
+		query["ids"] = req.Ids
 	}
 	if len(req.Usernames) != 0 {
-		query.Set("usernames", strings.Join(req.Usernames, ","))
+		query["usernames"] = req.Usernames
 	}
 	if len(req.FacebookIds) != 0 {
-		query.Set("facebookIds", strings.Join(req.FacebookIds, ","))
+		query["facebookIds"] = req.FacebookIds
 	}
 	res := new(UsersResponse)
 	if err := cl.Do(ctx, "GET", "v2/user", true, query, nil, res); err != nil {
@@ -3758,5 +4615,19 @@ func (req *UserGroupsRequest) Async(ctx context.Context, cl *Client, f func(*Use
 	}()
 }
 
+// Pager returns a pager for the request's pages of user groups, starting at the
+// request's cursor.
+func (req *UserGroupsRequest) Pager(cl *Client) *Pager[*UserGroupsResponse] {
+	r := new(UserGroupsRequest)
+	proto.Merge(&r.ListUserGroupsRequest, &req.ListUserGroupsRequest)
+	return NewPager(req.Cursor, func(ctx context.Context, cursor string) (*UserGroupsResponse, string, error) {
+		res, err := r.WithCursor(cursor).Do(ctx, cl)
+		if err != nil {
+			return nil, "", err
+		}
+		return res, res.Cursor, nil
+	})
+}
+
 // UserGroupsResponse is the ListUserGroups response.
 type UserGroupsResponse = nkapi.UserGroupList
@@ -2,7 +2,17 @@ package nakama
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -10,6 +20,13 @@ import (
 	"github.com/google/uuid"
 	nkapi "github.com/heroiclabs/nakama-common/api"
 	"golang.org/x/exp/slices"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 // TestMain handles setting up and tearing down the postgres and nakama
@@ -56,6 +73,42 @@ func TestRpc(t *testing.T) {
 	}
 }
 
+func TestRpcCall(t *testing.T) {
+	ctx, cancel, nk := nktest.WithCancel(context.Background(), t)
+	defer cancel()
+	const amount int64 = 1000
+	cl := newClient(ctx, t, nk, WithHttpKey(nk.Name()))
+	res, err := RpcCall[rewards, rewards](ctx, cl, "dailyRewards", rewards{Rewards: amount})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if res.Rewards != 2*amount {
+		t.Errorf("expected %d, got: %d", 2*amount, res.Rewards)
+	}
+	raw, err := RpcCall[string, string](ctx, cl, "dailyRewards", `{"rewards":1000}`)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if exp := `{"rewards":2000}`; strings.TrimSpace(raw) != exp {
+		t.Errorf("expected %q, got: %q", exp, raw)
+	}
+}
+
+func TestServerMode(t *testing.T) {
+	ctx, cancel, nk := nktest.WithCancel(context.Background(), t)
+	defer cancel()
+	const amount int64 = 1000
+	cl := newClient(ctx, t, nk, WithServerMode(nk.Name()))
+	createAccount(ctx, t, cl)
+	res, err := RpcCall[rewards, rewards](ctx, cl, "dailyRewards", rewards{Rewards: amount})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if res.Rewards != 2*amount {
+		t.Errorf("expected %d, got: %d", 2*amount, res.Rewards)
+	}
+}
+
 func TestRpcProtoEncodeDecode(t *testing.T) {
 	ctx, cancel, nk := nktest.WithCancel(context.Background(), t)
 	defer cancel()
@@ -117,15 +170,845 @@ func TestPing(t *testing.T) {
 	}
 }
 
+func TestConnState(t *testing.T) {
+	ctx, cancel, nk := nktest.WithCancel(context.Background(), t)
+	defer cancel()
+	cl := newClient(ctx, t, nk, WithServerKey(nk.ServerKey()))
+	conn := createAccountAndConn(ctx, t, cl)
+	if state := conn.Status(); state != ConnConnected {
+		t.Fatalf("expected %s, got: %s", ConnConnected, state)
+	}
+	ch := conn.StateChanges(ctx)
+	if err := conn.Close(); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	for _, exp := range []ConnState{ConnDisconnecting, ConnClosed} {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("expected no error, got: %v", ctx.Err())
+		case state := <-ch:
+			if state != exp {
+				t.Errorf("expected %s, got: %s", exp, state)
+			}
+		}
+	}
+}
+
 func TestRpcRealtime(t *testing.T) {
 }
 
 func TestChannels(t *testing.T) {
+	ctx, cancel, nk := nktest.WithCancel(context.Background(), t)
+	defer cancel()
+	const target = "my_room"
+	cl1 := newClient(ctx, t, nk, WithServerKey(nk.ServerKey()))
+	conn1 := createAccountAndConn(ctx, t, cl1)
+	defer conn1.Close()
+	cl2 := newClient(ctx, t, nk, WithServerKey(nk.ServerKey()))
+	conn2 := createAccountAndConn(ctx, t, cl2)
+	defer conn2.Close()
+	msgc := make(chan *ChannelMessageMsg, 1)
+	conn2.OnChannelMessage(ctx, func(msg *ChannelMessageMsg) {
+		msgc <- msg
+	})
+	ch1, err := conn1.ChannelJoin(ctx, target, ChannelJoinRoom, true, false)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if _, err := conn2.ChannelJoin(ctx, target, ChannelJoinRoom, true, false); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if _, err := conn1.ChannelMessageSend(ctx, ch1.Id, `{"msg":"hello"}`); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected no error, got: %v", ctx.Err())
+	case msg := <-msgc:
+		t.Logf("msg: %+v", msg)
+		if msg.ChannelId != ch1.Id {
+			t.Errorf("expected %s, got: %s", ch1.Id, msg.ChannelId)
+		}
+		if msg.Content != `{"msg":"hello"}` {
+			t.Errorf("expected %q, got: %q", `{"msg":"hello"}`, msg.Content)
+		}
+	}
+}
+
+func TestMatchData(t *testing.T) {
+	ctx, cancel, nk := nktest.WithCancel(context.Background(), t)
+	defer cancel()
+	cl1 := newClient(ctx, t, nk, WithServerKey(nk.ServerKey()))
+	conn1 := createAccountAndConn(ctx, t, cl1)
+	defer conn1.Close()
+	cl2 := newClient(ctx, t, nk, WithServerKey(nk.ServerKey()))
+	conn2 := createAccountAndConn(ctx, t, cl2)
+	defer conn2.Close()
+	match, err := conn1.MatchCreate(ctx, "")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if _, err := conn2.MatchJoin(ctx, match.MatchId, nil); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	all := make(chan *MatchDataMsg, 2)
+	conn2.OnMatchData(ctx, func(msg *MatchDataMsg) {
+		all <- msg
+	})
+	opCode := make(chan *MatchDataMsg, 2)
+	conn2.OnMatchDataOpCode(ctx, match.MatchId, 2, func(msg *MatchDataMsg) {
+		opCode <- msg
+	})
+	other := make(chan *MatchDataMsg, 2)
+	conn2.OnMatchDataMatch(ctx, "other", func(msg *MatchDataMsg) {
+		other <- msg
+	})
+	for i, data := range []string{"a", "b"} {
+		if err := conn1.MatchDataSend(ctx, match.MatchId, OpType(i+1), []byte(data), true); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+	for _, data := range []string{"a", "b"} {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("expected match data %q, got: %v", data, ctx.Err())
+		case msg := <-all:
+			if string(msg.Data) != data {
+				t.Errorf("expected %q, got: %q", data, msg.Data)
+			}
+		}
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected match data for op code 2, got: %v", ctx.Err())
+	case msg := <-opCode:
+		if msg.OpCode != 2 || string(msg.Data) != "b" {
+			t.Errorf("expected op code 2 data %q, got: %d %q", "b", msg.OpCode, msg.Data)
+		}
+	}
+	select {
+	case msg := <-other:
+		t.Errorf("expected no match data for another match, got: %v", msg)
+	default:
+	}
+}
+
+func TestParty(t *testing.T) {
+	ctx, cancel, nk := nktest.WithCancel(context.Background(), t)
+	defer cancel()
+	cl1 := newClient(ctx, t, nk, WithServerKey(nk.ServerKey()))
+	conn1 := createAccountAndConn(ctx, t, cl1)
+	defer conn1.Close()
+	cl2 := newClient(ctx, t, nk, WithServerKey(nk.ServerKey()))
+	conn2 := createAccountAndConn(ctx, t, cl2)
+	defer conn2.Close()
+	presence := make(chan *PartyPresenceEventMsg, 1)
+	conn1.OnPartyPresenceEvent(ctx, func(msg *PartyPresenceEventMsg) {
+		presence <- msg
+	})
+	party := make(chan *PartyMsg, 1)
+	conn2.OnParty(ctx, func(msg *PartyMsg) {
+		party <- msg
+	})
+	data := make(chan *PartyDataMsg, 1)
+	conn2.OnPartyData(ctx, func(msg *PartyDataMsg) {
+		data <- msg
+	})
+	p, err := conn1.PartyCreate(ctx, true, 2)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if err := conn2.PartyJoin(ctx, p.PartyId); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected party, got: %v", ctx.Err())
+	case msg := <-party:
+		if msg.PartyId != p.PartyId {
+			t.Errorf("expected party %s, got: %s", p.PartyId, msg.PartyId)
+		}
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected party presence event, got: %v", ctx.Err())
+	case msg := <-presence:
+		if msg.PartyId != p.PartyId || len(msg.Joins) == 0 {
+			t.Errorf("expected party %s join, got: %v", p.PartyId, msg)
+		}
+	}
+	if err := conn1.PartyDataSend(ctx, p.PartyId, 1, []byte("a"), true); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected party data, got: %v", ctx.Err())
+	case msg := <-data:
+		if msg.PartyId != p.PartyId || string(msg.Data) != "a" {
+			t.Errorf("expected party %s data %q, got: %s %q", p.PartyId, "a", msg.PartyId, msg.Data)
+		}
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
 	ctx, cancel, nk := nktest.WithCancel(context.Background(), t)
 	defer cancel()
 	cl := newClient(ctx, t, nk, WithServerKey(nk.ServerKey()))
-	conn := createAccountAndConn(ctx, t, cl)
+	conn := createAccountAndConn(ctx, t, cl, WithConnRequestTimeout(100*time.Millisecond))
 	defer conn.Close()
+	var res string
+	err := conn.Rpc(ctx, "sleep", "1s", &res)
+	var timeoutErr *RequestTimeoutError
+	switch {
+	case !errors.As(err, &timeoutErr):
+		t.Fatalf("expected request timeout error, got: %v", err)
+	case !timeoutErr.Timeout():
+		t.Errorf("expected timeout, got: %v", timeoutErr)
+	}
+	if err := conn.Rpc(ctx, "sleep", "1ms", &res); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if res != "1ms" {
+		t.Errorf("expected %q, got: %q", "1ms", res)
+	}
+}
+
+func TestKeepalive(t *testing.T) {
+	ctx, cancel, nk := nktest.WithCancel(context.Background(), t)
+	defer cancel()
+	cl := newClient(ctx, t, nk, WithServerKey(nk.ServerKey()))
+	conn := createAccountAndConn(ctx, t, cl, WithConnKeepalive(50*time.Millisecond, 3))
+	defer conn.Close()
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected no error, got: %v", ctx.Err())
+	case <-time.After(500 * time.Millisecond):
+	}
+	srtt, rtt := conn.Latency()
+	if srtt <= 0 || rtt <= 0 {
+		t.Fatalf("expected latency, got: %v %v", srtt, rtt)
+	}
+	t.Logf("latency: %v %v", srtt, rtt)
+	if err := conn.Ping(ctx); err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+}
+
+func TestSubscribeDropPolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		drop DropPolicy
+		exp  string
+	}{
+		{"newest", DropNewest, "ab"},
+		{"oldest", DropOldest, "bc"},
+		{"none", DropNone, "abc"},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel, nk := nktest.WithCancel(context.Background(), t)
+			defer cancel()
+			cl1 := newClient(ctx, t, nk, WithServerKey(nk.ServerKey()))
+			conn1 := createAccountAndConn(ctx, t, cl1)
+			defer conn1.Close()
+			cl2 := newClient(ctx, t, nk, WithServerKey(nk.ServerKey()))
+			conn2 := createAccountAndConn(ctx, t, cl2)
+			defer conn2.Close()
+			match, err := conn1.MatchCreate(ctx, "")
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if _, err := conn2.MatchJoin(ctx, match.MatchId, nil); err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			sctx, scancel := context.WithCancel(ctx)
+			defer scancel()
+			ch := conn2.MatchDataCh(sctx, match.MatchId,
+				WithSubscribeBuffer(2),
+				WithSubscribeDropPolicy(test.drop),
+			)
+			// callbacks are dispatched in order, so the subscription has
+			// handled the match data once the callback has
+			dispatched := make(chan struct{}, 3)
+			conn2.OnMatchData(ctx, func(*MatchDataMsg) {
+				dispatched <- struct{}{}
+			})
+			for _, data := range []string{"a", "b", "c"} {
+				if err := conn1.MatchDataSend(ctx, match.MatchId, 1, []byte(data), true); err != nil {
+					t.Fatalf("expected no error, got: %v", err)
+				}
+			}
+			// dispatch is blocked on the full channel with DropNone
+			if test.drop != DropNone {
+				for i := 0; i < 3; i++ {
+					select {
+					case <-ctx.Done():
+						t.Fatalf("expected match data dispatched, got: %v", ctx.Err())
+					case <-dispatched:
+					}
+				}
+			}
+			var got string
+			for len(got) < len(test.exp) {
+				select {
+				case <-ctx.Done():
+					t.Fatalf("expected match data, got: %q", got)
+				case msg := <-ch:
+					got += string(msg.Data)
+				}
+			}
+			if got != test.exp {
+				t.Errorf("expected %q, got: %q", test.exp, got)
+			}
+			// closed with the subscription's context
+			scancel()
+			for msg := range ch {
+				t.Errorf("expected no more match data, got: %q", msg.Data)
+			}
+		})
+	}
+}
+
+func TestSessionRefresher(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	refreshed := newToken(time.Now().Add(time.Hour))
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v2/account/session/refresh" {
+			http.NotFound(w, req)
+			return
+		}
+		if calls.Add(1) == 1 {
+			// the first refresh fails, and is retried after a backoff
+			http.Error(w, `{"message":"unavailable"}`, http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"token":"` + refreshed + `","refresh_token":"` + refreshed + `"}`))
+	}))
+	defer srv.Close()
+	cl := New(WithURL(srv.URL), WithExpiryGrace(500*time.Millisecond))
+	token := newToken(time.Now().Add(2 * time.Second))
+	if err := cl.SessionStart(&SessionResponse{Token: token, RefreshToken: refreshed}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	cl.StartSessionRefresher(ctx)
+	for cl.Session().Token != refreshed {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("expected session refreshed, got: %v", ctx.Err())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	// not refreshed again until the refreshed token nears expiry
+	time.Sleep(100 * time.Millisecond)
+	if n := calls.Load(); n != 2 {
+		t.Errorf("expected 2 refresh requests, got: %d", n)
+	}
+}
+
+func TestStorageValue(t *testing.T) {
+	ctx, cancel, nk := nktest.WithCancel(context.Background(), t)
+	defer cancel()
+	cl := newClient(ctx, t, nk)
+	createAccount(ctx, t, cl)
+	version, err := WriteStorageValue(ctx, cl, "my_collection", "my_key", rewards{Rewards: 15}, WithStoragePermissions(StorageOwnerRead, StorageOwnerWrite))
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	v, err := ReadStorageValue[rewards](ctx, cl, "my_collection", "my_key", "")
+	switch {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case v == nil:
+		t.Fatalf("expected non-nil value")
+	case v.Version != version:
+		t.Errorf("expected %q, got: %q", version, v.Version)
+	case v.Value.Rewards != 15:
+		t.Errorf("expected 15, got: %d", v.Value.Rewards)
+	}
+	if _, err := WriteStorageValue(ctx, cl, "my_collection", "my_key", rewards{Rewards: 25}, WithStorageVersion("*")); err == nil {
+		t.Errorf("expected error writing existing object with version *")
+	}
+}
+
+func TestPager(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var cursors []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		cursor := req.URL.Query().Get("cursor")
+		cursors = append(cursors, cursor)
+		next := ""
+		if cursor == "" {
+			next = "page-2"
+		}
+		_, _ = w.Write([]byte(`{"records":[{"owner_id":"` + cursor + `"}],"next_cursor":"` + next + `"}`))
+	}))
+	defer srv.Close()
+	cl := New(WithURL(srv.URL))
+	token := newToken(time.Now().Add(time.Hour))
+	if err := cl.SessionStart(&SessionResponse{Token: token, RefreshToken: token}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	req := LeaderboardRecords("board")
+	p := req.Pager(cl)
+	var pages int
+	for p.Next(ctx) {
+		pages++
+	}
+	switch {
+	case p.Err() != nil:
+		t.Fatalf("expected no error, got: %v", p.Err())
+	case pages != 2 || len(cursors) != 2 || cursors[1] != "page-2":
+		t.Errorf("expected 2 pages, got: %d %v", pages, cursors)
+	case req.Cursor != "":
+		t.Errorf("expected request not modified, got cursor: %q", req.Cursor)
+	}
+}
+
+func TestRecordWrite(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v2/leaderboard/board" {
+			http.NotFound(w, req)
+			return
+		}
+		_ = json.NewDecoder(req.Body).Decode(&body)
+		_, _ = w.Write([]byte(`{"leaderboard_id":"board","score":"10"}`))
+	}))
+	defer srv.Close()
+	cl := New(WithURL(srv.URL))
+	token := newToken(time.Now().Add(time.Hour))
+	if err := cl.SessionStart(&SessionResponse{Token: token, RefreshToken: token}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	res, err := LeaderboardRecordWrite("board", 10).
+		WithSubscore(2).
+		WithMetadata(map[string]int{"level": 3}).
+		Do(ctx, cl)
+	switch {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case res.Score != 10:
+		t.Errorf("expected score 10, got: %d", res.Score)
+	}
+	if got := fmt.Sprintf("%v %v %v", body["score"], body["subscore"], body["metadata"]); got != `10 2 {"level":3}` {
+		t.Errorf("expected record write, got: %q", got)
+	}
+	if _, err := LeaderboardRecordWrite("board", 1).WithMetadata(func() {}).Do(ctx, cl); err == nil {
+		t.Errorf("expected metadata encoding error")
+	}
+}
+
+func TestAccount(t *testing.T) {
+	ctx, cancel, nk := nktest.WithCancel(context.Background(), t)
+	defer cancel()
+	cl := newClient(ctx, t, nk)
+	createAccount(ctx, t, cl)
+	if err := cl.UpdateAccount(ctx, UpdateAccount().WithDisplayName("my name").WithTimezone("UTC")); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	res, err := cl.Account(ctx)
+	switch {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case res.User.DisplayName != "my name":
+		t.Errorf("expected %q, got: %q", "my name", res.User.DisplayName)
+	}
+	users, err := cl.Users(ctx, cl.SessionUserId())
+	switch {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case len(users.Users) != 1:
+		t.Errorf("expected 1 user, got: %d", len(users.Users))
+	}
+}
+
+func TestLinkUnlink(t *testing.T) {
+	ctx, cancel, nk := nktest.WithCancel(context.Background(), t)
+	defer cancel()
+	cl := newClient(ctx, t, nk)
+	createAccount(ctx, t, cl)
+	customId := uuid.New().String()
+	if err := cl.LinkCustom(ctx, customId); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	res, err := cl.Account(ctx)
+	switch {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case res.CustomId != customId:
+		t.Errorf("expected %q, got: %q", customId, res.CustomId)
+	}
+	if err := cl.UnlinkCustom(ctx, customId); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	res, err = cl.Account(ctx)
+	switch {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case res.CustomId != "":
+		t.Errorf("expected empty custom id, got: %q", res.CustomId)
+	}
+}
+
+func TestFriends(t *testing.T) {
+	ctx, cancel, nk := nktest.WithCancel(context.Background(), t)
+	defer cancel()
+	cl1 := newClient(ctx, t, nk)
+	createAccount(ctx, t, cl1)
+	cl2 := newClient(ctx, t, nk)
+	createAccount(ctx, t, cl2)
+	if err := cl1.AddFriends(ctx, cl2.SessionUserId()); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	res, err := cl2.Friends(ctx, Friends().WithState(FriendInviteReceived))
+	switch {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case len(res.Friends) != 1:
+		t.Fatalf("expected 1 friend, got: %d", len(res.Friends))
+	case res.Friends[0].User.Id != cl1.SessionUserId():
+		t.Errorf("expected %s, got: %s", cl1.SessionUserId(), res.Friends[0].User.Id)
+	}
+	if err := cl2.DeleteFriends(ctx, cl1.SessionUserId()); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+}
+
+func TestGroups(t *testing.T) {
+	ctx, cancel, nk := nktest.WithCancel(context.Background(), t)
+	defer cancel()
+	cl1 := newClient(ctx, t, nk)
+	createAccount(ctx, t, cl1)
+	cl2 := newClient(ctx, t, nk)
+	createAccount(ctx, t, cl2)
+	group, err := cl1.CreateGroup(ctx, CreateGroup().WithName("group_"+uuid.New().String()).WithOpen(true).WithMaxCount(10))
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if err := cl2.JoinGroup(ctx, group.Id); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	var count int
+	pager := GroupUsers(group.Id).WithLimit(1).Pager(cl1)
+	for pager.Next(ctx) {
+		count += len(pager.Page().GroupUsers)
+	}
+	if err := pager.Err(); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 group users, got: %d", count)
+	}
+	if err := cl2.LeaveGroup(ctx, group.Id); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if err := cl1.DeleteGroup(ctx, group.Id); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+}
+
+func TestHttpRetry(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// statuses are the response statuses, in order, after which 200 is
+	// returned
+	var statuses []int
+	var retryAfter string
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		buf, _ := io.ReadAll(req.Body)
+		bodies = append(bodies, string(buf))
+		if len(statuses) == 0 {
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		status := statuses[0]
+		statuses = statuses[1:]
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"code":14,"message":"unavailable"}`))
+	}))
+	defer srv.Close()
+	exec := func(ctx context.Context, method string, opts ...Option) error {
+		cl := New(append([]Option{
+			WithURL(srv.URL),
+			WithRetries(2),
+			WithRetryBackoff(ConstantBackoff(time.Millisecond)),
+		}, opts...)...)
+		req, err := http.NewRequestWithContext(ctx, method, srv.URL, strings.NewReader("body"))
+		if err != nil {
+			return err
+		}
+		res, err := cl.Exec(req)
+		if err != nil {
+			return err
+		}
+		return res.Body.Close()
+	}
+	tests := []struct {
+		name       string
+		method     string
+		ctx        context.Context
+		opts       []Option
+		statuses   []int
+		retryAfter string
+		wait       time.Duration
+		attempts   int
+		status     int
+	}{
+		{"unavailable", "GET", ctx, nil, []int{503}, "", 0, 2, 0},
+		{"retry after seconds", "GET", ctx, nil, []int{429}, "1", time.Second, 2, 0},
+		{"retry after date", "GET", ctx, nil, []int{429}, "date", 500 * time.Millisecond, 2, 0},
+		{"attempts", "PUT", ctx, nil, []int{503, 503, 503}, "", 0, 3, 503},
+		{"not retryable", "GET", ctx, nil, []int{400}, "", 0, 1, 400},
+		{"non-idempotent", "POST", ctx, nil, []int{503}, "", 0, 1, 503},
+		{"idempotent context", "POST", Idempotent(ctx), nil, []int{503}, "", 0, 2, 0},
+		{"retry non-idempotent", "POST", ctx, []Option{WithRetryNonIdempotent(true)}, []int{503}, "", 0, 2, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			statuses, retryAfter, bodies = test.statuses, test.retryAfter, nil
+			if retryAfter == "date" {
+				retryAfter = time.Now().Add(2 * time.Second).UTC().Format(http.TimeFormat)
+			}
+			start := time.Now()
+			err := exec(test.ctx, test.method, test.opts...)
+			var cerr *ClientError
+			switch {
+			case test.status == 0 && err != nil:
+				t.Fatalf("expected no error, got: %v", err)
+			case test.status != 0 && (!errors.As(err, &cerr) || cerr.StatusCode != test.status):
+				t.Fatalf("expected status %d, got: %v", test.status, err)
+			case len(bodies) != test.attempts:
+				t.Errorf("expected %d attempts, got: %d", test.attempts, len(bodies))
+			case time.Since(start) < test.wait:
+				t.Errorf("expected retry after %v, took: %v", test.wait, time.Since(start))
+			}
+			// the body is resent on each attempt
+			for i, body := range bodies {
+				if body != "body" {
+					t.Errorf("expected body on attempt %d, got: %q", i+1, body)
+				}
+			}
+		})
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff(100*time.Millisecond, time.Second)
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{10, time.Second},
+	}
+	for _, test := range tests {
+		for i := 0; i < 10; i++ {
+			// jitter of up to half the delay
+			if d := backoff(test.attempt); d < test.max/2 || d > test.max {
+				t.Errorf("attempt %d: expected backoff between %v and %v, got: %v", test.attempt, test.max/2, test.max, d)
+			}
+		}
+	}
+}
+
+func TestGrpcTransport(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// stub nakama.api.Nakama service, recording the requests
+	type call struct {
+		method string
+		auth   string
+		req    proto.Message
+	}
+	var mu sync.Mutex
+	var calls []call
+	accountCode := codes.NotFound
+	requests := map[string]func() proto.Message{
+		"AuthenticateDevice":     func() proto.Message { return new(nkapi.AuthenticateDeviceRequest) },
+		"WriteLeaderboardRecord": func() proto.Message { return new(nkapi.WriteLeaderboardRecordRequest) },
+		"ListLeaderboardRecords": func() proto.Message { return new(nkapi.ListLeaderboardRecordsRequest) },
+		"ListFriends":            func() proto.Message { return new(nkapi.ListFriendsRequest) },
+		"RpcFunc":                func() proto.Message { return new(nkapi.Rpc) },
+		"GetAccount":             func() proto.Message { return new(emptypb.Empty) },
+	}
+	responses := map[string]proto.Message{
+		"AuthenticateDevice":     &nkapi.Session{Token: "token", RefreshToken: "refresh"},
+		"WriteLeaderboardRecord": &nkapi.LeaderboardRecord{LeaderboardId: "board", Score: 10},
+		"ListLeaderboardRecords": &nkapi.LeaderboardRecordList{NextCursor: "next"},
+		"ListFriends":            &nkapi.FriendList{Cursor: "next"},
+		"RpcFunc":                &nkapi.Rpc{Payload: `{"b":2}`},
+	}
+	gs := grpc.NewServer(grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+		full, _ := grpc.MethodFromServerStream(stream)
+		method := strings.TrimPrefix(full, "/nakama.api.Nakama/")
+		f, ok := requests[method]
+		if !ok {
+			return status.Errorf(codes.Unimplemented, "unknown method %s", full)
+		}
+		req := f()
+		if err := stream.RecvMsg(req); err != nil {
+			return err
+		}
+		var auth string
+		if md, ok := metadata.FromIncomingContext(stream.Context()); ok && len(md.Get("authorization")) != 0 {
+			auth = md.Get("authorization")[0]
+		}
+		mu.Lock()
+		calls = append(calls, call{method, auth, req})
+		mu.Unlock()
+		res, ok := responses[method]
+		if !ok {
+			return status.Error(accountCode, "account error")
+		}
+		return stream.SendMsg(res)
+	}))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	go func() {
+		_ = gs.Serve(l)
+	}()
+	defer gs.Stop()
+	transport := NewGrpcTransport(l.Addr().String())
+	defer transport.Close()
+	cl := New(
+		WithURL("http://127.0.0.1:7350"),
+		WithServerKey("key"),
+		WithTransport(transport),
+	)
+	// body decoded to the request's account field, with query params
+	session, err := AuthenticateDevice("device").WithCreate(true).WithUsername("bob").Do(ctx, cl)
+	switch {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case session.Token != "token" || session.RefreshToken != "refresh":
+		t.Errorf("expected session, got: %v", session)
+	}
+	token := newToken(time.Now().Add(time.Hour))
+	if err := cl.SessionStart(&SessionResponse{Token: token, RefreshToken: token}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	// body decoded to the request's record field, with a path param and an
+	// enum
+	record, err := WriteLeaderboardRecord("board").WithScore(10).WithOperator(OpIncrement).Do(ctx, cl)
+	if err != nil || record.Score != 10 {
+		t.Fatalf("expected record, got: %v %v", record, err)
+	}
+	// lists, wrapper types and a path param from query params
+	records, err := LeaderboardRecords("board").WithOwnerIds("a", "b").WithLimit(5).WithCursor("cursor").WithExpiry(7).Do(ctx, cl)
+	if err != nil || records.NextCursor != "next" {
+		t.Fatalf("expected records, got: %v %v", records, err)
+	}
+	friends, err := Friends().WithState(FriendInviteSent).Do(ctx, cl)
+	if err != nil || friends.Cursor != "next" {
+		t.Fatalf("expected friends, got: %v %v", friends, err)
+	}
+	// body decoded to the request's payload field, returned unwrapped
+	var res map[string]int
+	if err := cl.Rpc(ctx, "echo", map[string]int{"a": 1}, &res); err != nil || res["b"] != 2 {
+		t.Fatalf("expected rpc response, got: %v %v", res, err)
+	}
+	// status mapped to the http status code
+	var cerr *ClientError
+	if _, err := Account().Do(ctx, cl); !errors.As(err, &cerr) || cerr.StatusCode != http.StatusNotFound || cerr.Code != codes.NotFound {
+		t.Errorf("expected not found error, got: %v", err)
+	}
+	expected := []call{
+		{"AuthenticateDevice", "Basic a2V5Og==", &nkapi.AuthenticateDeviceRequest{
+			Account:  &nkapi.AccountDevice{Id: "device"},
+			Create:   wrapperspb.Bool(true),
+			Username: "bob",
+		}},
+		{"WriteLeaderboardRecord", "Bearer " + token, &nkapi.WriteLeaderboardRecordRequest{
+			LeaderboardId: "board",
+			Record:        &nkapi.WriteLeaderboardRecordRequest_LeaderboardRecordWrite{Score: 10, Operator: OpIncrement},
+		}},
+		{"ListLeaderboardRecords", "Bearer " + token, &nkapi.ListLeaderboardRecordsRequest{
+			LeaderboardId: "board",
+			OwnerIds:      []string{"a", "b"},
+			Limit:         wrapperspb.Int32(5),
+			Cursor:        "cursor",
+			Expiry:        wrapperspb.Int64(7),
+		}},
+		{"ListFriends", "Bearer " + token, &nkapi.ListFriendsRequest{
+			Limit: wrapperspb.Int32(100),
+			State: wrapperspb.Int32(int32(FriendInviteSent)),
+		}},
+		// the payload is the json encoded body, as sent over http
+		{"RpcFunc", "Bearer " + token, &nkapi.Rpc{Id: "echo", Payload: "{\"a\":1}\n"}},
+		{"GetAccount", "Bearer " + token, &emptypb.Empty{}},
+	}
+	mu.Lock()
+	if len(calls) != len(expected) {
+		t.Fatalf("expected %d calls, got: %d", len(expected), len(calls))
+	}
+	for i, c := range calls {
+		switch exp := expected[i]; {
+		case c.method != exp.method:
+			t.Errorf("call %d: expected method %s, got: %s", i, exp.method, c.method)
+		case c.auth != exp.auth:
+			t.Errorf("call %d: expected authorization %q, got: %q", i, exp.auth, c.auth)
+		case !proto.Equal(c.req, exp.req):
+			t.Errorf("call %d: expected %s request %v, got: %v", i, exp.method, exp.req, c.req)
+		}
+	}
+	mu.Unlock()
+	// status codes, mapped as the nakama http gateway
+	statuses := []struct {
+		code       codes.Code
+		statusCode int
+	}{
+		{codes.InvalidArgument, http.StatusBadRequest},
+		{codes.FailedPrecondition, http.StatusBadRequest},
+		{codes.Unauthenticated, http.StatusUnauthorized},
+		{codes.PermissionDenied, http.StatusForbidden},
+		{codes.AlreadyExists, http.StatusConflict},
+		{codes.ResourceExhausted, http.StatusTooManyRequests},
+		{codes.Unimplemented, http.StatusNotImplemented},
+		{codes.Internal, http.StatusInternalServerError},
+	}
+	for _, test := range statuses {
+		mu.Lock()
+		accountCode = test.code
+		mu.Unlock()
+		_, err := Account().Do(ctx, cl)
+		if !errors.As(err, &cerr) || cerr.StatusCode != test.statusCode || cerr.Code != test.code {
+			t.Errorf("expected %s mapped to status %d, got: %v", test.code, test.statusCode, err)
+		}
+	}
+	// requests not part of the api are passed to the fallback transport
+	var fallback string
+	transport = NewGrpcTransport(l.Addr().String(), WithGrpcFallback(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		fallback = req.URL.Path
+		return nil, errors.New("fallback")
+	})))
+	defer transport.Close()
+	req, _ := http.NewRequestWithContext(ctx, "GET", "http://127.0.0.1:7350/ws", nil)
+	if _, err := transport.RoundTrip(req); err == nil || fallback != "/ws" {
+		t.Errorf("expected fallback transport, got: %q %v", fallback, err)
+	}
+}
+
+// roundTripFunc is a http.RoundTripper func.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
 }
 
 func newClient(ctx context.Context, t *testing.T, nk *nktest.Runner, opts ...Option) *Client {
@@ -183,3 +1066,8 @@ func createAccountAndConn(ctx context.Context, t *testing.T, cl *Client, opts ..
 type rewards struct {
 	Rewards int64 `json:"rewards,omitempty"`
 }
+
+func newToken(exp time.Time) string {
+	buf, _ := json.Marshal(map[string]interface{}{"exp": exp.Unix()})
+	return "e30." + base64.RawURLEncoding.EncodeToString(buf) + ".sig"
+}
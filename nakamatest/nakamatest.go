@@ -0,0 +1,351 @@
+// Package nakamatest provides a mock nakama realtime websocket server for
+// testing applications using nakama.Conn without a live nakama instance.
+package nakamatest
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/rtapi"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"nhooyr.io/websocket"
+)
+
+// HandlerFunc handles a received message, returning the response to send to
+// the session. The response's cid is set to the received message's cid. When
+// the response is nil, no response is sent.
+type HandlerFunc func(*Session, *rtapi.Envelope) (*rtapi.Envelope, error)
+
+// Server is a mock nakama realtime websocket server.
+type Server struct {
+	srv      *httptest.Server
+	listener net.Listener
+	tls      bool
+	token    func(string) error
+	logf     func(string, ...interface{})
+	handlers map[string]HandlerFunc
+	sessions map[*Session]bool
+	received []*rtapi.Envelope
+	rw       sync.RWMutex
+}
+
+// NewServer creates and starts a new mock nakama realtime websocket server.
+// By default, pings are responded to with a pong, and all other messages are
+// responded to with an unrecognized payload error.
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		handlers: make(map[string]HandlerFunc),
+		sessions: make(map[*Session]bool),
+	}
+	s.Handle("ping", func(*Session, *rtapi.Envelope) (*rtapi.Envelope, error) {
+		return &rtapi.Envelope{
+			Message: &rtapi.Envelope_Pong{
+				Pong: &rtapi.Pong{},
+			},
+		}, nil
+	})
+	for _, o := range opts {
+		o(s)
+	}
+	s.srv = httptest.NewUnstartedServer(http.HandlerFunc(s.serve))
+	if s.listener != nil {
+		s.srv.Listener.Close()
+		s.srv.Listener = s.listener
+	}
+	if s.tls {
+		s.srv.StartTLS()
+	} else {
+		s.srv.Start()
+	}
+	return s
+}
+
+// URL returns the websocket url of the server, suitable for use with
+// nakama.WithConnUrl.
+func (s *Server) URL() string {
+	return "ws" + strings.TrimPrefix(s.srv.URL, "http") + "/ws"
+}
+
+// Certificate returns the server's self-signed certificate when served with
+// WithTLS, or nil.
+func (s *Server) Certificate() *x509.Certificate {
+	return s.srv.Certificate()
+}
+
+// Close closes all sessions and the server.
+func (s *Server) Close() {
+	for _, sess := range s.Sessions() {
+		sess.Close()
+	}
+	s.srv.Close()
+}
+
+// Handle sets the handler for the message type, named by the envelope's
+// message field (ie, "channel_join", "match_data_send", "rpc").
+func (s *Server) Handle(typ string, f HandlerFunc) {
+	s.rw.Lock()
+	defer s.rw.Unlock()
+	s.handlers[typ] = f
+}
+
+// Respond sets a scripted response for the message type. See Handle.
+func (s *Server) Respond(typ string, res *rtapi.Envelope) {
+	s.Handle(typ, func(*Session, *rtapi.Envelope) (*rtapi.Envelope, error) {
+		return proto.Clone(res).(*rtapi.Envelope), nil
+	})
+}
+
+// Notify sends the message to all connected sessions.
+func (s *Server) Notify(ctx context.Context, env *rtapi.Envelope) error {
+	for _, sess := range s.Sessions() {
+		if err := sess.Send(ctx, env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sessions returns the connected sessions.
+func (s *Server) Sessions() []*Session {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	var sessions []*Session
+	for sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	return sessions
+}
+
+// Received returns the messages received by the server, in the order
+// received.
+func (s *Server) Received() []*rtapi.Envelope {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	return append([]*rtapi.Envelope(nil), s.received...)
+}
+
+// serve serves a websocket session.
+func (s *Server) serve(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	if s.token != nil {
+		if err := s.token(query.Get("token")); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+	ws, err := websocket.Accept(w, req, nil)
+	if err != nil {
+		s.Logf("unable to accept websocket: %v", err)
+		return
+	}
+	sess := &Session{
+		Token:  query.Get("token"),
+		Status: query.Get("status") == "true",
+		Header: req.Header,
+		binary: query.Get("format") == "protobuf",
+		ws:     ws,
+	}
+	s.rw.Lock()
+	s.sessions[sess] = true
+	s.rw.Unlock()
+	defer func() {
+		s.rw.Lock()
+		delete(s.sessions, sess)
+		s.rw.Unlock()
+		sess.Close()
+	}()
+	ctx := req.Context()
+	for {
+		_, buf, err := ws.Read(ctx)
+		if err != nil {
+			if websocket.CloseStatus(err) == -1 && !errors.Is(err, context.Canceled) {
+				s.Logf("unable to read: %v", err)
+			}
+			return
+		}
+		env, err := sess.unmarshal(buf)
+		if err != nil {
+			s.Logf("unable to unmarshal: %v", err)
+			return
+		}
+		if err := s.dispatch(ctx, sess, env); err != nil {
+			s.Logf("unable to dispatch: %v", err)
+			return
+		}
+	}
+}
+
+// dispatch dispatches a received message to its handler, sending the
+// response.
+func (s *Server) dispatch(ctx context.Context, sess *Session, env *rtapi.Envelope) error {
+	typ := Type(env)
+	s.rw.Lock()
+	s.received = append(s.received, env)
+	f := s.handlers[typ]
+	s.rw.Unlock()
+	var res *rtapi.Envelope
+	if f != nil {
+		var err error
+		if res, err = f(sess, env); err != nil {
+			res = NewError(rtapi.Error_RUNTIME_EXCEPTION, err.Error())
+		}
+	} else {
+		res = NewError(rtapi.Error_UNRECOGNIZED_PAYLOAD, fmt.Sprintf("unhandled message type %q", typ))
+	}
+	if res == nil || env.Cid == "" {
+		return nil
+	}
+	res.Cid = env.Cid
+	return sess.Send(ctx, res)
+}
+
+// Logf logs to the server's logger.
+func (s *Server) Logf(str string, v ...interface{}) {
+	if s.logf != nil {
+		s.logf(str, v...)
+	}
+}
+
+// Session is a connected websocket session.
+type Session struct {
+	// Token is the token query param sent by the client.
+	Token string
+	// Status is true when the status query param was sent as true, making the
+	// user appear online.
+	Status bool
+	// Header is the websocket handshake request's headers.
+	Header http.Header
+	binary bool
+	ws     *websocket.Conn
+	mu     sync.Mutex
+}
+
+// Send sends the message to the session.
+func (sess *Session) Send(ctx context.Context, env *rtapi.Envelope) error {
+	buf, err := sess.marshal(env)
+	if err != nil {
+		return err
+	}
+	typ := websocket.MessageBinary
+	if !sess.binary {
+		typ = websocket.MessageText
+	}
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.ws.Write(ctx, typ, buf)
+}
+
+// SendRaw sends the raw message to the session, such as a json message with
+// fields unknown to the client.
+func (sess *Session) SendRaw(ctx context.Context, buf []byte) error {
+	typ := websocket.MessageBinary
+	if !sess.binary {
+		typ = websocket.MessageText
+	}
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.ws.Write(ctx, typ, buf)
+}
+
+// Close closes the session's websocket connection.
+func (sess *Session) Close() error {
+	return sess.ws.Close(websocket.StatusNormalClosure, "")
+}
+
+// CloseReason closes the session's websocket connection with the reason, such
+// as "server-side session disconnect", sent by nakama when the session
+// connects from another socket.
+func (sess *Session) CloseReason(reason string) error {
+	return sess.ws.Close(websocket.StatusNormalClosure, reason)
+}
+
+// CloseStatus closes the session's websocket connection with the status code
+// and reason, such as 1001 (going away) when the server is shutting down.
+func (sess *Session) CloseStatus(code int, reason string) error {
+	return sess.ws.Close(websocket.StatusCode(code), reason)
+}
+
+// marshal marshals the message using the session's format.
+func (sess *Session) marshal(env *rtapi.Envelope) ([]byte, error) {
+	if sess.binary {
+		return proto.Marshal(env)
+	}
+	return protojson.Marshal(env)
+}
+
+// unmarshal unmarshals the message using the session's format.
+func (sess *Session) unmarshal(buf []byte) (*rtapi.Envelope, error) {
+	f := proto.Unmarshal
+	if !sess.binary {
+		f = protojson.Unmarshal
+	}
+	env := new(rtapi.Envelope)
+	if err := f(buf, env); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// Type returns the message type of the envelope, as named by the envelope's
+// message field (ie, "channel_join").
+func Type(env *rtapi.Envelope) string {
+	msg := env.ProtoReflect()
+	if fd := msg.WhichOneof(msg.Descriptor().Oneofs().ByName("message")); fd != nil {
+		return string(fd.Name())
+	}
+	return ""
+}
+
+// NewError creates an error message.
+func NewError(code rtapi.Error_Code, message string) *rtapi.Envelope {
+	return &rtapi.Envelope{
+		Message: &rtapi.Envelope_Error{
+			Error: &rtapi.Error{
+				Code:    int32(code),
+				Message: message,
+			},
+		},
+	}
+}
+
+// Option is a mock server option.
+type Option func(*Server)
+
+// WithTokenCheck is a mock server option to set a func to check the token
+// query param of connecting clients.
+func WithTokenCheck(f func(string) error) Option {
+	return func(s *Server) {
+		s.token = f
+	}
+}
+
+// WithListener is a mock server option to set the listener the server is
+// served on, such as an in-memory listener for benchmarks.
+func WithListener(l net.Listener) Option {
+	return func(s *Server) {
+		s.listener = l
+	}
+}
+
+// WithTLS is a mock server option to serve over TLS using a self-signed
+// certificate (see Server.Certificate).
+func WithTLS() Option {
+	return func(s *Server) {
+		s.tls = true
+	}
+}
+
+// WithLogger is a mock server option to set a logger.
+func WithLogger(f func(string, ...interface{})) Option {
+	return func(s *Server) {
+		s.logf = f
+	}
+}
@@ -0,0 +1,4035 @@
+package nakamatest
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ascii8/nakama-go"
+	nkapi "github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/rtapi"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestServer(t *testing.T) {
+	for _, format := range []string{"protobuf", "json"} {
+		t.Run(format, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			srv := NewServer(WithLogger(t.Logf))
+			defer srv.Close()
+			srv.Respond("channel_join", &rtapi.Envelope{
+				Message: &rtapi.Envelope_Channel{
+					Channel: &rtapi.Channel{
+						Id:       "2...my-room",
+						RoomName: "my-room",
+					},
+				},
+			})
+			conn, err := nakama.NewConn(
+				ctx,
+				nakama.WithConnHandler(nakama.New(nakama.WithLogger(t.Logf))),
+				nakama.WithConnUrl(srv.URL()),
+				nakama.WithConnToken("token"),
+				nakama.WithConnFormat(format),
+			)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			// the run loop logs the disconnect after close returns, so wait
+			// for it to exit before the test's logger is done
+			closed := make(chan struct{})
+			conn.OnStateChange(ctx, func(state nakama.ConnState) {
+				if state == nakama.ConnClosed {
+					close(closed)
+				}
+			})
+			defer func() {
+				_ = conn.Close()
+				select {
+				case <-ctx.Done():
+				case <-closed:
+				}
+			}()
+			// ping
+			if err := conn.Ping(ctx); err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			// scripted response
+			ch, err := conn.ChannelJoin(ctx, "my-room", nakama.ChannelJoinRoom, false, false)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if ch.Id != "2...my-room" {
+				t.Errorf("expected channel id %q, got: %q", "2...my-room", ch.Id)
+			}
+			// unhandled
+			if _, err := conn.MatchCreate(ctx, "match"); !errors.Is(err, nakama.ErrUnrecognizedPayload) {
+				t.Errorf("expected unrecognized payload error, got: %v", err)
+			}
+			// injected notification
+			notifications := conn.NotificationsCh(ctx)
+			if err := srv.Notify(ctx, &rtapi.Envelope{
+				Message: &rtapi.Envelope_Notifications{
+					Notifications: &rtapi.Notifications{
+						Notifications: []*nkapi.Notification{{Id: "n1", Subject: "hello"}},
+					},
+				},
+			}); err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				t.Fatalf("expected notification: %v", ctx.Err())
+			case msg := <-notifications:
+				if n := msg.Notifications.Notifications; len(n) != 1 || n[0].Subject != "hello" {
+					t.Errorf("expected notification subject %q, got: %v", "hello", n)
+				}
+			}
+			if n := len(srv.Received()); n != 3 {
+				t.Errorf("expected 3 received messages, got: %d", n)
+			}
+		})
+	}
+}
+
+func TestMatchHandle(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	self := &rtapi.UserPresence{UserId: "self", SessionId: "s0"}
+	srv.Respond("match_join", &rtapi.Envelope{
+		Message: &rtapi.Envelope_Match{
+			Match: &rtapi.Match{
+				MatchId:   "m1",
+				Self:      self,
+				Presences: []*rtapi.UserPresence{{UserId: "u1", SessionId: "s1"}},
+			},
+		},
+	})
+	srv.Respond("match_leave", &rtapi.Envelope{})
+	conn := newTestConn(t, srv)
+	h, err := conn.MatchJoinHandle(ctx, "m1", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if h.Id() != "m1" || h.Self().GetSessionId() != "s0" || len(h.Presences()) != 1 {
+		t.Fatalf("expected match m1 with 1 presence, got: %s %v %v", h.Id(), h.Self(), h.Presences())
+	}
+	var events int
+	h.OnPresenceEvent(func(*nakama.MatchPresenceEventMsg) {
+		events++
+	})
+	var data []string
+	h.OnData(func(msg *nakama.MatchDataMsg) {
+		data = append(data, string(msg.Data))
+	})
+	notify := func(envs ...*rtapi.Envelope) {
+		t.Helper()
+		for _, env := range envs {
+			if err := srv.Notify(ctx, env); err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+		}
+		// the ping response is received after the notifications
+		if err := conn.Ping(ctx); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+	presenceEvent := func(matchId string, joins, leaves []*rtapi.UserPresence) *rtapi.Envelope {
+		return &rtapi.Envelope{
+			Message: &rtapi.Envelope_MatchPresenceEvent{
+				MatchPresenceEvent: &rtapi.MatchPresenceEvent{MatchId: matchId, Joins: joins, Leaves: leaves},
+			},
+		}
+	}
+	matchData := func(matchId, data string) *rtapi.Envelope {
+		return &rtapi.Envelope{
+			Message: &rtapi.Envelope_MatchData{
+				MatchData: &rtapi.MatchData{MatchId: matchId, Data: []byte(data)},
+			},
+		}
+	}
+	notify(
+		presenceEvent("m1", []*rtapi.UserPresence{{UserId: "u2", SessionId: "s2"}}, []*rtapi.UserPresence{{UserId: "u1", SessionId: "s1"}}),
+		// another match's events are ignored
+		presenceEvent("m2", []*rtapi.UserPresence{{UserId: "u3", SessionId: "s3"}}, nil),
+		matchData("m1", "a"),
+		matchData("m2", "b"),
+	)
+	switch presences := h.Presences(); {
+	case len(presences) != 1 || presences[0].GetSessionId() != "s2":
+		t.Errorf("expected presence s2, got: %v", presences)
+	case events != 1:
+		t.Errorf("expected 1 presence event, got: %d", events)
+	case len(data) != 1 || data[0] != "a":
+		t.Errorf("expected match data a, got: %v", data)
+	}
+	if err := h.Leave(ctx); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	select {
+	case <-h.Done():
+	default:
+		t.Fatalf("expected handle done after leaving")
+	}
+	// callbacks are removed after leaving, once the handle's context closed
+	time.Sleep(50 * time.Millisecond)
+	notify(
+		presenceEvent("m1", []*rtapi.UserPresence{{UserId: "u4", SessionId: "s4"}}, nil),
+		matchData("m1", "c"),
+	)
+	if events != 1 || len(data) != 1 {
+		t.Errorf("expected no callbacks after leaving, got: %d %v", events, data)
+	}
+}
+
+func TestChannelHandle(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	srv.Respond("channel_join", &rtapi.Envelope{
+		Message: &rtapi.Envelope_Channel{
+			Channel: &rtapi.Channel{
+				Id:        "c1",
+				Self:      &rtapi.UserPresence{UserId: "self", SessionId: "s0"},
+				Presences: []*rtapi.UserPresence{{UserId: "u1", SessionId: "s1"}},
+			},
+		},
+	})
+	srv.Handle("channel_message_send", func(_ *Session, env *rtapi.Envelope) (*rtapi.Envelope, error) {
+		return &rtapi.Envelope{
+			Message: &rtapi.Envelope_ChannelMessageAck{
+				ChannelMessageAck: &rtapi.ChannelMessageAck{ChannelId: env.GetChannelMessageSend().GetChannelId(), MessageId: "m1"},
+			},
+		}, nil
+	})
+	srv.Respond("channel_leave", &rtapi.Envelope{})
+	conn := newTestConn(t, srv)
+	h, err := conn.ChannelJoinHandle(ctx, "room", nakama.ChannelJoinRoom, false, false)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if ack, err := h.SendMessage(ctx, `{}`); err != nil || ack.ChannelId != "c1" {
+		t.Fatalf("expected message sent to c1, got: %v %v", ack, err)
+	}
+	messages := h.Messages()
+	for _, env := range []*rtapi.Envelope{
+		{Message: &rtapi.Envelope_ChannelPresenceEvent{ChannelPresenceEvent: &rtapi.ChannelPresenceEvent{
+			ChannelId: "c1",
+			Joins:     []*rtapi.UserPresence{{UserId: "u2", SessionId: "s2"}},
+			Leaves:    []*rtapi.UserPresence{{UserId: "u1", SessionId: "s1"}},
+		}}},
+		{Message: &rtapi.Envelope_ChannelPresenceEvent{ChannelPresenceEvent: &rtapi.ChannelPresenceEvent{
+			ChannelId: "c2",
+			Joins:     []*rtapi.UserPresence{{UserId: "u3", SessionId: "s3"}},
+		}}},
+		{Message: &rtapi.Envelope_ChannelMessage{ChannelMessage: &nkapi.ChannelMessage{ChannelId: "c2", MessageId: "other"}}},
+		{Message: &rtapi.Envelope_ChannelMessage{ChannelMessage: &nkapi.ChannelMessage{ChannelId: "c1", MessageId: "m1"}}},
+	} {
+		if err := srv.Notify(ctx, env); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected channel message")
+	case msg := <-messages:
+		if msg.MessageId != "m1" {
+			t.Errorf("expected message m1, got: %v", msg)
+		}
+	}
+	if presences := h.Presences(); len(presences) != 1 || presences[0].GetSessionId() != "s2" {
+		t.Errorf("expected presence s2, got: %v", presences)
+	}
+	if err := h.Leave(ctx); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected messages closed after leaving")
+	case _, ok := <-messages:
+		if ok {
+			t.Errorf("expected messages closed after leaving")
+		}
+	}
+}
+
+func TestPartyHandle(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	srv.Respond("party_accept", &rtapi.Envelope{})
+	conn := newTestConn(t, srv)
+	self := &rtapi.UserPresence{UserId: "self", SessionId: "s0"}
+	h := conn.PartyHandle(ctx, &nakama.PartyMsg{
+		Party: rtapi.Party{PartyId: "p1", Self: self, Leader: self, Presences: []*rtapi.UserPresence{self}},
+	})
+	var leaders, joins, requests []string
+	h.OnLeaderChange(func(p *rtapi.UserPresence) {
+		leaders = append(leaders, p.UserId)
+	})
+	h.OnMemberJoin(func(p *rtapi.UserPresence) {
+		joins = append(joins, p.UserId)
+	})
+	h.OnJoinRequest(func(p *rtapi.UserPresence) {
+		requests = append(requests, p.UserId)
+	})
+	u1 := &rtapi.UserPresence{UserId: "u1", SessionId: "s1"}
+	u2 := &rtapi.UserPresence{UserId: "u2", SessionId: "s2"}
+	waitSession(ctx, t, srv)
+	for _, env := range []*rtapi.Envelope{
+		{Message: &rtapi.Envelope_PartyJoinRequest{PartyJoinRequest: &rtapi.PartyJoinRequest{PartyId: "p1", Presences: []*rtapi.UserPresence{u1, u2}}}},
+		// joining removes the pending join request
+		{Message: &rtapi.Envelope_PartyPresenceEvent{PartyPresenceEvent: &rtapi.PartyPresenceEvent{PartyId: "p1", Joins: []*rtapi.UserPresence{u1}}}},
+		{Message: &rtapi.Envelope_PartyLeader{PartyLeader: &rtapi.PartyLeader{PartyId: "p1", Presence: u1}}},
+		// another party's leader change is ignored
+		{Message: &rtapi.Envelope_PartyLeader{PartyLeader: &rtapi.PartyLeader{PartyId: "p2", Presence: u2}}},
+	} {
+		if err := srv.Notify(ctx, env); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+	// the ping response is received after the party messages
+	if err := conn.Ping(ctx); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	switch {
+	case h.Leader().GetUserId() != "u1":
+		t.Errorf("expected leader u1, got: %v", h.Leader())
+	case fmt.Sprint(leaders, joins, requests) != "[u1] [u1] [u1 u2]":
+		t.Errorf("expected leader, join and request callbacks, got: %v %v %v", leaders, joins, requests)
+	case len(h.Presences()) != 2:
+		t.Errorf("expected members self and u1, got: %v", h.Presences())
+	case len(h.JoinRequests()) != 1 || h.JoinRequests()[0].UserId != "u2":
+		t.Errorf("expected join request u2, got: %v", h.JoinRequests())
+	}
+	if err := h.Accept(ctx, &nakama.UserPresenceMsg{UserPresence: rtapi.UserPresence{UserId: "u2", SessionId: "s2"}}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if l := h.JoinRequests(); len(l) != 0 {
+		t.Errorf("expected no join requests after accepting, got: %v", l)
+	}
+}
+
+func TestMatchmakerMatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	var tickets int
+	matched := make(chan bool, 1)
+	srv.Handle("matchmaker_add", func(sess *Session, _ *rtapi.Envelope) (*rtapi.Envelope, error) {
+		tickets++
+		ticket := "t" + strconv.Itoa(tickets)
+		if <-matched {
+			go func() {
+				for _, ticket := range []string{"other", ticket} {
+					_ = sess.Send(ctx, &rtapi.Envelope{
+						Message: &rtapi.Envelope_MatchmakerMatched{
+							MatchmakerMatched: &rtapi.MatchmakerMatched{
+								Ticket: ticket,
+								Id:     &rtapi.MatchmakerMatched_MatchId{MatchId: "match-" + ticket},
+							},
+						},
+					})
+				}
+			}()
+		}
+		return &rtapi.Envelope{
+			Message: &rtapi.Envelope_MatchmakerTicket{
+				MatchmakerTicket: &rtapi.MatchmakerTicket{Ticket: ticket},
+			},
+		}, nil
+	})
+	removed := make(chan string, 1)
+	srv.Handle("matchmaker_remove", func(_ *Session, env *rtapi.Envelope) (*rtapi.Envelope, error) {
+		removed <- env.GetMatchmakerRemove().GetTicket()
+		return &rtapi.Envelope{}, nil
+	})
+	srv.Handle("match_join", func(_ *Session, env *rtapi.Envelope) (*rtapi.Envelope, error) {
+		return &rtapi.Envelope{
+			Message: &rtapi.Envelope_Match{
+				Match: &rtapi.Match{MatchId: env.GetMatchJoin().GetMatchId()},
+			},
+		}, nil
+	})
+	conn := newTestConn(t, srv)
+	// matched, ignoring other tickets
+	matched <- true
+	h, err := conn.MatchmakerMatch(ctx, nakama.MatchmakerAdd("*", 2, 2))
+	switch {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case h.Id() != "match-t1":
+		t.Errorf("expected match-t1, got: %s", h.Id())
+	}
+	// the ticket is removed when the context is closed before matching
+	matched <- false
+	mctx, mcancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer mcancel()
+	if _, err := conn.MatchmakerMatch(mctx, nakama.MatchmakerAdd("*", 2, 2)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got: %v", err)
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected ticket removed")
+	case ticket := <-removed:
+		if ticket != "t2" {
+			t.Errorf("expected ticket t2 removed, got: %s", ticket)
+		}
+	}
+}
+
+func TestWireTrace(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	text, ndjson := new(bytes.Buffer), new(bytes.Buffer)
+	for _, opt := range []nakama.ConnOption{nakama.WithConnTrace(text), nakama.WithConnTraceJSON(ndjson)} {
+		conn := newTestConn(t, srv, opt)
+		if err := conn.Ping(ctx); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		conn.Close()
+	}
+	lines := strings.Split(strings.TrimSpace(text.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], " -> ping cid=") || !strings.Contains(lines[1], " <- pong cid=") || !strings.Contains(lines[1], " elapsed=") {
+		t.Errorf("expected ping and pong lines, got: %q", lines)
+	}
+	dec := json.NewDecoder(ndjson)
+	var records []nakama.TraceRecord
+	for dec.More() {
+		var r nakama.TraceRecord
+		if err := dec.Decode(&r); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		records = append(records, r)
+	}
+	if len(records) != 2 || records[0].Type != "ping" || records[1].Cid != records[0].Cid || records[1].Elapsed == 0 {
+		t.Errorf("expected ping and pong records, got: %v", records)
+	}
+}
+
+func TestCaptureReplay(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	buf := new(bytes.Buffer)
+	conn := newTestConn(t, srv, nakama.WithConnCapture(buf))
+	if err := conn.Ping(ctx); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	data := conn.MatchDataCh(ctx, "match")
+	for i := 0; i < 3; i++ {
+		if err := srv.Notify(ctx, &rtapi.Envelope{
+			Message: &rtapi.Envelope_MatchData{
+				MatchData: &rtapi.MatchData{MatchId: "match", OpCode: int64(i)},
+			},
+		}); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		<-data
+	}
+	// replay
+	replay := nakama.NewReplayConn()
+	var opCodes []int64
+	replay.OnMatchData(ctx, func(msg *nakama.MatchDataMsg) {
+		opCodes = append(opCodes, msg.OpCode)
+	})
+	if err := replay.Replay(ctx, buf, false); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(opCodes) != 3 || opCodes[0] != 0 || opCodes[2] != 2 {
+		t.Errorf("expected op codes [0 1 2], got: %v", opCodes)
+	}
+}
+
+func TestDisconnectReason(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	// close the session without responding
+	srv.Handle("rpc", func(sess *Session, _ *rtapi.Envelope) (*rtapi.Envelope, error) {
+		go sess.Close()
+		return nil, nil
+	})
+	conn := newTestConn(t, srv)
+	reasons := make(chan *nakama.DisconnectReason, 1)
+	conn.OnDisconnect(ctx, func(reason *nakama.DisconnectReason) {
+		reasons <- reason
+	})
+	var reason *nakama.DisconnectReason
+	switch err := conn.Rpc(ctx, "rpc", "", nil); {
+	case !errors.As(err, &reason):
+		t.Fatalf("expected disconnect reason, got: %v", err)
+	case reason.Cause != nakama.DisconnectServerClose:
+		t.Errorf("expected cause %s, got: %s", nakama.DisconnectServerClose, reason.Cause)
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected disconnect: %v", ctx.Err())
+	case r := <-reasons:
+		if r != reason {
+			t.Errorf("expected pending request to fail with %v, got: %v", r, reason)
+		}
+	}
+	// not persistent, so requests fail after the disconnect
+	if err := conn.Ping(ctx); !errors.Is(err, nakama.ErrConnClosed) {
+		t.Errorf("expected connection closed error, got: %v", err)
+	}
+}
+
+func TestCloseErr(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	tests := []struct {
+		code         int
+		message      string
+		unauthorized bool
+		temporary    bool
+	}{
+		{1008, "session token expired", true, false},
+		{1001, "server shutdown", false, true},
+	}
+	for _, test := range tests {
+		conn := newTestConn(t, srv, nakama.WithConnToken(test.message))
+		if err := conn.CloseErr(); err != nil {
+			t.Errorf("expected no close error, got: %v", err)
+		}
+		reasons := make(chan *nakama.DisconnectReason, 1)
+		conn.OnDisconnect(ctx, func(reason *nakama.DisconnectReason) {
+			reasons <- reason
+		})
+		// wait for the session by token, as sessions of closed connections
+		// may still be registered
+		var sess *Session
+		for sess == nil {
+			for _, s := range srv.Sessions() {
+				if s.Token == test.message {
+					sess = s
+				}
+			}
+			select {
+			case <-ctx.Done():
+				t.Fatalf("expected session")
+			case <-time.After(time.Millisecond):
+			}
+		}
+		if err := sess.CloseStatus(test.code, test.message); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		var reason *nakama.DisconnectReason
+		select {
+		case <-ctx.Done():
+			t.Fatalf("expected disconnect")
+		case reason = <-reasons:
+		}
+		switch {
+		case reason.Cause != nakama.DisconnectServerClose || reason.Code != test.code || reason.Message != test.message:
+			t.Errorf("expected server close %d %q, got: %v", test.code, test.message, reason)
+		case reason.Unauthorized() != test.unauthorized || reason.Temporary() != test.temporary:
+			t.Errorf("expected unauthorized %t temporary %t, got: %v", test.unauthorized, test.temporary, reason)
+		case conn.CloseErr() != error(reason):
+			t.Errorf("expected close error %v, got: %v", reason, conn.CloseErr())
+		}
+	}
+}
+
+func TestSessionExpiring(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	refreshed := newToken(time.Now().Add(time.Hour))
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v2/account/session/refresh" {
+			http.NotFound(w, req)
+			return
+		}
+		_, _ = w.Write([]byte(`{"token":"` + refreshed + `","refresh_token":"` + refreshed + `"}`))
+	}))
+	defer api.Close()
+	cl := nakama.New(nakama.WithURL(api.URL), nakama.WithExpiryGrace(time.Second))
+	token := newToken(time.Now().Add(3 * time.Second))
+	if err := cl.SessionStart(&nakama.SessionResponse{Token: token, RefreshToken: refreshed}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	conn, err := cl.NewConn(
+		ctx,
+		nakama.WithConnUrl(srv.URL()),
+		nakama.WithConnTokenRefresh(true),
+		nakama.WithConnExpiryLead(2*time.Second),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	defer conn.Close()
+	if exp := conn.SessionExpiry(); exp.IsZero() || time.Until(exp) > 3*time.Second {
+		t.Errorf("expected session expiry, got: %v", exp)
+	}
+	ttls := make(chan time.Duration, 1)
+	conn.OnSessionExpiring(ctx, func(ttl time.Duration) {
+		ttls <- ttl
+	})
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected session expiring")
+	case ttl := <-ttls:
+		if ttl <= 0 || ttl > 2*time.Second {
+			t.Errorf("expected ttl of at most 2s, got: %v", ttl)
+		}
+	}
+	// wait for the connection reopened with the refreshed token
+	for {
+		var reopened bool
+		for _, s := range srv.Sessions() {
+			reopened = reopened || s.Token == refreshed
+		}
+		if reopened && conn.Status() == nakama.ConnConnected {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("expected connection reopened with refreshed token")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if exp := conn.SessionExpiry(); time.Until(exp) < time.Minute {
+		t.Errorf("expected refreshed session expiry, got: %v", exp)
+	}
+}
+
+func TestDisplaced(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	conn := newTestConn(t, srv,
+		nakama.WithConnPersist(true),
+		nakama.WithConnSingleSocket(true),
+	)
+	reasons := make(chan *nakama.DisconnectReason, 1)
+	conn.OnDisconnect(ctx, func(reason *nakama.DisconnectReason) {
+		reasons <- reason
+	})
+	waitSession(ctx, t, srv)
+	for _, sess := range srv.Sessions() {
+		_ = sess.CloseReason("server-side session disconnect")
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected disconnect: %v", ctx.Err())
+	case reason := <-reasons:
+		if reason.Cause != nakama.DisconnectDisplaced {
+			t.Errorf("expected cause %s, got: %s", nakama.DisconnectDisplaced, reason.Cause)
+		}
+	}
+	// displaced connections are not reopened
+	states := conn.StateChanges(ctx)
+	for state := conn.Status(); state != nakama.ConnClosed; {
+		var ok bool
+		switch state, ok = <-states; {
+		case !ok:
+			t.Fatalf("expected closed, got: %v", ctx.Err())
+		case state == nakama.ConnReconnecting:
+			t.Fatalf("expected no reconnect")
+		}
+	}
+}
+
+func TestRejoin(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	srv.Respond("channel_join", &rtapi.Envelope{
+		Message: &rtapi.Envelope_Channel{Channel: &rtapi.Channel{Id: "channel"}},
+	})
+	srv.Respond("match_join", &rtapi.Envelope{
+		Message: &rtapi.Envelope_Match{Match: &rtapi.Match{MatchId: "match"}},
+	})
+	srv.Respond("status_follow", &rtapi.Envelope{
+		Message: &rtapi.Envelope_Status{Status: &rtapi.Status{
+			Presences: []*rtapi.UserPresence{{UserId: "bob-id", Username: "bob"}},
+		}},
+	})
+	srv.Respond("status_unfollow", &rtapi.Envelope{})
+	conn := newTestConn(t, srv,
+		nakama.WithConnAutoRejoin(true),
+		nakama.WithConnBackoff(10*time.Millisecond, 10*time.Millisecond),
+	)
+	if _, err := conn.ChannelJoin(ctx, "room", nakama.ChannelJoinRoom, false, false); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if _, err := conn.MatchJoin(ctx, "match", nil); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if _, err := nakama.StatusFollow("alice-id").WithUsernames("bob").Send(ctx, conn); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	// bob was followed by username
+	if err := conn.StatusUnfollow(ctx, "bob-id"); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	sent := len(srv.Received())
+	waitSession(ctx, t, srv)
+	for _, sess := range srv.Sessions() {
+		_ = sess.Close()
+	}
+	// wait for the rejoin after the reconnect
+	for {
+		var channel, match bool
+		var follow *rtapi.StatusFollow
+		for _, env := range srv.Received()[sent:] {
+			switch Type(env) {
+			case "channel_join":
+				channel = env.GetChannelJoin().GetTarget() == "room"
+			case "match_join":
+				match = env.GetMatchJoin().GetMatchId() == "match"
+			case "status_follow":
+				follow = env.GetStatusFollow()
+			}
+		}
+		if channel && match && follow != nil {
+			if len(follow.UserIds) != 1 || follow.UserIds[0] != "alice-id" || len(follow.Usernames) != 0 {
+				t.Errorf("expected only alice refollowed, got: %v", follow)
+			}
+			return
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("expected channel, match and statuses rejoined, got: %v", srv.Received()[sent:])
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestQueueRejoin(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	srv.Respond("match_join", &rtapi.Envelope{
+		Message: &rtapi.Envelope_Match{Match: &rtapi.Match{MatchId: "match"}},
+	})
+	conn := newTestConn(t, srv,
+		nakama.WithConnAutoRejoin(true),
+		nakama.WithConnQueue(10, nakama.DropOldest),
+		nakama.WithConnBackoff(50*time.Millisecond, 50*time.Millisecond),
+	)
+	if _, err := conn.MatchJoin(ctx, "match", nil); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	states := conn.StateChanges(ctx)
+	waitSession(ctx, t, srv)
+	for _, sess := range srv.Sessions() {
+		_ = sess.Close()
+	}
+	for state := range states {
+		if state == nakama.ConnReconnecting {
+			break
+		}
+	}
+	// queued while reconnecting
+	if err := conn.MatchDataSend(ctx, "match", 1, []byte("data"), false); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	for {
+		var types []string
+		for _, env := range srv.Received()[1:] {
+			types = append(types, Type(env))
+			if env.GetMatchDataSend() != nil && env.Cid != "" {
+				t.Errorf("expected queued message sent without a cid")
+			}
+		}
+		if len(types) == 2 {
+			if types[0] != "match_join" || types[1] != "match_data_send" {
+				t.Errorf("expected match rejoined before queued match data, got: %v", types)
+			}
+			return
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("expected match rejoin and match data, got: %v", types)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	var calls int
+	srv.Handle("rpc", func(sess *Session, env *rtapi.Envelope) (*rtapi.Envelope, error) {
+		if calls++; calls == 1 {
+			// close the session without responding
+			go sess.Close()
+			return nil, nil
+		}
+		// respond twice
+		if err := sess.Send(ctx, env); err != nil {
+			return nil, err
+		}
+		return env, nil
+	})
+	conn := newTestConn(t, srv,
+		nakama.WithConnPersist(true),
+		nakama.WithConnBackoff(10*time.Millisecond, 10*time.Millisecond),
+		nakama.WithConnRetry(true),
+	)
+	orphans := make(chan *rtapi.Envelope, 1)
+	conn.OnOrphanResponse(ctx, func(env *rtapi.Envelope) {
+		orphans <- env
+	})
+	var res string
+	if err := conn.Rpc(nakama.Idempotent(ctx), "echo", "hello", &res); err != nil || res != "hello" {
+		t.Fatalf("expected hello, got: %q %v", res, err)
+	}
+	received := srv.Received()
+	if len(received) != 2 || received[0].Cid != received[1].Cid {
+		t.Errorf("expected request resent with the same cid, got: %v", received)
+	}
+	// the duplicate response is dropped
+	if err := conn.Ping(ctx); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	select {
+	case env := <-orphans:
+		t.Errorf("expected no orphan response, got: %v", env)
+	default:
+	}
+}
+
+func TestRetryOrder(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	const n = 5
+	var calls int
+	srv.Handle("rpc", func(sess *Session, env *rtapi.Envelope) (*rtapi.Envelope, error) {
+		if calls++; calls <= n {
+			if calls == n {
+				// close the session without responding
+				go sess.Close()
+			}
+			return nil, nil
+		}
+		return env, nil
+	})
+	conn := newTestConn(t, srv,
+		nakama.WithConnPersist(true),
+		nakama.WithConnBackoff(10*time.Millisecond, 10*time.Millisecond),
+		nakama.WithConnRetry(true),
+	)
+	errc := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			var res string
+			errc <- conn.Rpc(nakama.Idempotent(ctx), "echo", strconv.Itoa(i), &res)
+		}(i)
+	}
+	for i := 0; i < n; i++ {
+		if err := <-errc; err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+	received := srv.Received()
+	if len(received) != 2*n {
+		t.Fatalf("expected %d requests, got: %d", 2*n, len(received))
+	}
+	for i := 0; i < n; i++ {
+		if received[i].Cid != received[n+i].Cid {
+			t.Errorf("expected requests resent in send order, got: %v", received)
+			break
+		}
+	}
+}
+
+func TestSendEnvelope(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	srv.Handle("rpc", func(_ *Session, env *rtapi.Envelope) (*rtapi.Envelope, error) {
+		return env, nil
+	})
+	conn := newTestConn(t, srv)
+	env := &rtapi.Envelope{
+		Message: &rtapi.Envelope_Rpc{
+			Rpc: &nkapi.Rpc{Id: "echo", Payload: "hello"},
+		},
+	}
+	res, err := conn.SendEnvelope(ctx, env)
+	switch {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case res.GetRpc().GetPayload() != "hello" || res.Cid == "":
+		t.Errorf("expected rpc response, got: %v", res)
+	case env.Cid != "":
+		t.Errorf("expected envelope not modified, got cid: %q", env.Cid)
+	}
+}
+
+func TestSendCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	srv.Handle("rpc", func(_ *Session, env *rtapi.Envelope) (*rtapi.Envelope, error) {
+		return env, nil
+	})
+	conn := newTestConn(t, srv, nakama.WithConnRateLimit(2, 1))
+	var res string
+	if err := conn.Rpc(ctx, "echo", "first", &res); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	// cancelled while waiting for the rate limit, and never written
+	cctx, ccancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer ccancel()
+	if err := conn.Rpc(cctx, "echo", "second", &res); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got: %v", err)
+	}
+	if err := conn.Rpc(ctx, "echo", "third", &res); err != nil || res != "third" {
+		t.Fatalf("expected third, got: %q %v", res, err)
+	}
+	for _, env := range srv.Received() {
+		if strings.Contains(env.GetRpc().GetPayload(), "second") {
+			t.Errorf("expected cancelled request not written")
+		}
+	}
+}
+
+func TestAppearOnline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	srv.Respond("status_update", &rtapi.Envelope{})
+	conn := newTestConn(t, srv, nakama.WithConnAppearOnline(true))
+	waitSession(ctx, t, srv)
+	if !srv.Sessions()[0].Status || !conn.Online() {
+		t.Errorf("expected online on connect")
+	}
+	if err := conn.StatusUpdate(ctx, "busy"); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if err := conn.AppearOffline(ctx); err != nil || conn.Online() {
+		t.Fatalf("expected offline, got: %v", err)
+	}
+	if err := conn.AppearOnline(ctx); err != nil || !conn.Online() {
+		t.Fatalf("expected online, got: %v", err)
+	}
+	if err := conn.Close(); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	var statuses []*wrapperspb.StringValue
+	for _, env := range srv.Received() {
+		if msg := env.GetStatusUpdate(); msg != nil {
+			statuses = append(statuses, msg.Status)
+		}
+	}
+	switch {
+	case len(statuses) != 4:
+		t.Fatalf("expected 4 status updates, got: %v", statuses)
+	case statuses[2].GetValue() != "busy":
+		t.Errorf("expected status kept when appearing online, got: %v", statuses[2])
+	case statuses[1] != nil || statuses[3] != nil:
+		t.Errorf("expected offline status updates, got: %v", statuses)
+	}
+}
+
+func TestTickets(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	var n int
+	srv.Handle("matchmaker_add", func(*Session, *rtapi.Envelope) (*rtapi.Envelope, error) {
+		n++
+		return &rtapi.Envelope{
+			Message: &rtapi.Envelope_MatchmakerTicket{
+				MatchmakerTicket: &rtapi.MatchmakerTicket{Ticket: "t" + strconv.Itoa(n)},
+			},
+		}, nil
+	})
+	srv.Respond("matchmaker_remove", &rtapi.Envelope{})
+	conn := newTestConn(t, srv, nakama.WithConnTicketTimeout(300*time.Millisecond))
+	events := make(chan *nakama.TicketEvent, 4)
+	conn.OnTicket(ctx, func(ev *nakama.TicketEvent) {
+		events <- ev
+	})
+	next := func(typ nakama.TicketEventType, ticket string) {
+		t.Helper()
+		select {
+		case <-ctx.Done():
+			t.Fatalf("expected %s event", typ)
+		case ev := <-events:
+			if ev.Type != typ || ev.Ticket.Ticket != ticket {
+				t.Fatalf("expected %s event for %s, got: %s %s", typ, ticket, ev.Type, ev.Ticket.Ticket)
+			}
+		}
+	}
+	// resolved
+	if _, err := conn.MatchmakerAdd(ctx, nakama.MatchmakerAdd("*", 2, 2)); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if tickets := conn.ActiveTickets(); len(tickets) != 1 || tickets[0].Query != "*" || tickets[0].MaxCount != 2 {
+		t.Fatalf("expected active ticket, got: %v", tickets)
+	}
+	if err := srv.Notify(ctx, &rtapi.Envelope{
+		Message: &rtapi.Envelope_MatchmakerMatched{
+			MatchmakerMatched: &rtapi.MatchmakerMatched{Ticket: "t1"},
+		},
+	}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	next(nakama.TicketResolved, "t1")
+	// removed when the context is closed
+	sctx, scancel := context.WithCancel(ctx)
+	if _, err := conn.MatchmakerAddScoped(sctx, nakama.MatchmakerAdd("*", 2, 2)); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	scancel()
+	next(nakama.TicketRemoved, "t2")
+	// timeout
+	if _, err := conn.MatchmakerAdd(ctx, nakama.MatchmakerAdd("*", 2, 2)); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	next(nakama.TicketTimeout, "t3")
+	// invalidated when the websocket is closed
+	if _, err := conn.MatchmakerAdd(ctx, nakama.MatchmakerAdd("*", 2, 2)); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	_ = srv.Sessions()[0].Close()
+	next(nakama.TicketInvalidated, "t4")
+	if tickets := conn.ActiveTickets(); len(tickets) != 0 {
+		t.Errorf("expected no active tickets, got: %v", tickets)
+	}
+	var removed []string
+	for _, env := range srv.Received() {
+		if msg := env.GetMatchmakerRemove(); msg != nil {
+			removed = append(removed, msg.Ticket)
+		}
+	}
+	if len(removed) != 2 || removed[0] != "t2" || removed[1] != "t3" {
+		t.Errorf("expected t2 and t3 removed, got: %v", removed)
+	}
+}
+
+func TestScoped(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	srv.Respond("channel_join", &rtapi.Envelope{
+		Message: &rtapi.Envelope_Channel{Channel: &rtapi.Channel{Id: "channel"}},
+	})
+	srv.Handle("match_join", func(_ *Session, env *rtapi.Envelope) (*rtapi.Envelope, error) {
+		return &rtapi.Envelope{
+			Message: &rtapi.Envelope_Match{Match: &rtapi.Match{MatchId: env.GetMatchJoin().GetMatchId()}},
+		}, nil
+	})
+	srv.Respond("status_follow", &rtapi.Envelope{
+		Message: &rtapi.Envelope_Status{Status: &rtapi.Status{}},
+	})
+	for _, typ := range []string{"channel_leave", "match_leave", "status_unfollow"} {
+		srv.Respond(typ, &rtapi.Envelope{})
+	}
+	conn := newTestConn(t, srv)
+	sctx, scancel := context.WithCancel(ctx)
+	if _, err := conn.ChannelJoinScoped(sctx, "room", nakama.ChannelJoinRoom, false, false); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	for _, id := range []string{"m1", "m2"} {
+		if _, err := conn.MatchJoinScoped(sctx, id, nil); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+	if _, err := conn.StatusFollowScoped(sctx, "u1", "u2"); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	// left before the context is closed
+	if err := conn.MatchLeave(ctx, "m1"); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	scancel()
+	var left []string
+	for len(left) < 4 {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("expected cleanup, got: %v", left)
+		case <-time.After(10 * time.Millisecond):
+		}
+		left = nil
+		for _, env := range srv.Received() {
+			switch {
+			case env.GetChannelLeave() != nil:
+				left = append(left, env.GetChannelLeave().ChannelId)
+			case env.GetMatchLeave() != nil:
+				left = append(left, env.GetMatchLeave().MatchId)
+			case env.GetStatusUnfollow() != nil:
+				left = append(left, strings.Join(env.GetStatusUnfollow().UserIds, ","))
+			}
+		}
+	}
+	sort.Strings(left)
+	if exp := []string{"channel", "m1", "m2", "u1,u2"}; strings.Join(left, " ") != strings.Join(exp, " ") {
+		t.Errorf("expected %v left, got: %v", exp, left)
+	}
+}
+
+func TestConnStats(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	srv.Handle("rpc", func(_ *Session, env *rtapi.Envelope) (*rtapi.Envelope, error) {
+		if env.GetRpc().GetId() == "fail" {
+			return &rtapi.Envelope{
+				Message: &rtapi.Envelope_Error{
+					Error: &rtapi.Error{Code: int32(rtapi.Error_RUNTIME_FUNCTION_EXCEPTION), Message: "fail"},
+				},
+			}, nil
+		}
+		return env, nil
+	})
+	conn := newTestConn(t, srv)
+	var res string
+	if err := conn.Rpc(ctx, "echo", "hello", &res); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if err := conn.Rpc(ctx, "fail", "", &res); err == nil {
+		t.Fatalf("expected error")
+	}
+	stats := conn.Stats()
+	switch {
+	case stats.State != nakama.ConnConnected:
+		t.Errorf("expected connected, got: %s", stats.State)
+	case stats.MessagesSent["rpc"] != 2 || stats.MessagesReceived["rpc"] != 1 || stats.MessagesReceived["error"] != 1:
+		t.Errorf("expected message counts, got: %v %v", stats.MessagesSent, stats.MessagesReceived)
+	case stats.BytesSent == 0 || stats.BytesReceived == 0:
+		t.Errorf("expected byte counts, got: %d %d", stats.BytesSent, stats.BytesReceived)
+	case stats.PendingRequests != 0 || stats.Reconnects != 0:
+		t.Errorf("expected no pending requests or reconnects, got: %d %d", stats.PendingRequests, stats.Reconnects)
+	case stats.LastError == nil || stats.Uptime == 0:
+		t.Errorf("expected last error and uptime, got: %v %s", stats.LastError, stats.Uptime)
+	}
+}
+
+func TestUnknown(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	unknown := &rtapi.Envelope{
+		Message: &rtapi.Envelope_Rpc{Rpc: &nkapi.Rpc{Id: "unexpected"}},
+	}
+	notify := func(token string) {
+		for {
+			for _, sess := range srv.Sessions() {
+				if sess.Token == token {
+					if err := sess.Send(ctx, unknown); err != nil {
+						t.Fatalf("expected no error, got: %v", err)
+					}
+					return
+				}
+			}
+			select {
+			case <-ctx.Done():
+				t.Fatalf("expected session")
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+	// fallback callback
+	conn := newTestConn(t, srv, nakama.WithConnToken("fallback"))
+	received := make(chan *rtapi.Envelope, 1)
+	conn.OnUnknown(ctx, func(env *rtapi.Envelope) {
+		received <- env
+	})
+	notify("fallback")
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected unknown message")
+	case env := <-received:
+		if env.GetRpc().GetId() != "unexpected" {
+			t.Errorf("expected unknown rpc, got: %v", env)
+		}
+	}
+	// error policy
+	conn = newTestConn(t, srv,
+		nakama.WithConnToken("error"),
+		nakama.WithConnUnknownPolicy(nakama.UnknownError),
+	)
+	disconnected := make(chan *nakama.DisconnectReason, 1)
+	conn.OnDisconnect(ctx, func(reason *nakama.DisconnectReason) {
+		disconnected <- reason
+	})
+	notify("error")
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected disconnect")
+	case reason := <-disconnected:
+		var uerr *nakama.UnknownMessageError
+		if reason.Cause != nakama.DisconnectUnknownMessage || !errors.As(reason, &uerr) || uerr.Type != "rpc" {
+			t.Errorf("expected unknown message disconnect, got: %v", reason)
+		}
+	}
+}
+
+func TestJSONOptions(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	conn := newTestConn(t, srv,
+		nakama.WithConnFormat("json"),
+		nakama.WithConnUnknownPolicy(nakama.UnknownError),
+	)
+	notifications := make(chan *nakama.NotificationsMsg, 1)
+	conn.OnNotifications(ctx, func(msg *nakama.NotificationsMsg) {
+		notifications <- msg
+	})
+	events := make(chan *nakama.StatusPresenceEventMsg, 1)
+	conn.OnStatusPresenceEvent(ctx, func(msg *nakama.StatusPresenceEventMsg) {
+		events <- msg
+	})
+	disconnected := make(chan *nakama.DisconnectReason, 1)
+	conn.OnDisconnect(ctx, func(reason *nakama.DisconnectReason) {
+		disconnected <- reason
+	})
+	waitSession(ctx, t, srv)
+	sess := srv.Sessions()[0]
+	// unknown fields are discarded
+	for _, msg := range []string{
+		`{"notifications":{"notifications":[{"id":"n1","added_field":1}]}}`,
+		`{"status_presence_event":{"joins":[{"user_id":"u1","added_field":true}]},"added_field":{}}`,
+	} {
+		if err := sess.SendRaw(ctx, []byte(msg)); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected notifications")
+	case msg := <-notifications:
+		if n := msg.GetNotifications(); len(n) != 1 || n[0].Id != "n1" {
+			t.Errorf("expected notification n1, got: %v", n)
+		}
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected status presence event")
+	case msg := <-events:
+		if len(msg.Joins) != 1 || msg.Joins[0].UserId != "u1" {
+			t.Errorf("expected join u1, got: %v", msg.Joins)
+		}
+	}
+	// messages of an unknown type are unknown
+	if err := sess.SendRaw(ctx, []byte(`{"added_message":{}}`)); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected disconnect")
+	case reason := <-disconnected:
+		var uerr *nakama.UnknownMessageError
+		if !errors.As(reason, &uerr) || uerr.Type != "added_message" {
+			t.Errorf("expected unknown message disconnect, got: %v", reason)
+		}
+	}
+}
+
+func TestEnvelopeCodec(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	codec := &countingCodec{EnvelopeCodec: nakama.ProtoCodec}
+	conn := newTestConn(t, srv, nakama.WithConnEnvelopeCodec(codec))
+	if err := conn.Ping(ctx); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if codec.marshaled.Load() != 1 || codec.unmarshaled.Load() != 1 {
+		t.Errorf("expected codec used, got: %d %d", codec.marshaled.Load(), codec.unmarshaled.Load())
+	}
+}
+
+// countingCodec counts the envelopes encoded by the codec.
+type countingCodec struct {
+	nakama.EnvelopeCodec
+	marshaled   atomic.Int32
+	unmarshaled atomic.Int32
+}
+
+func (c *countingCodec) Marshal(env *rtapi.Envelope) ([]byte, error) {
+	c.marshaled.Add(1)
+	return c.EnvelopeCodec.Marshal(env)
+}
+
+func (c *countingCodec) Unmarshal(buf []byte, env *rtapi.Envelope) error {
+	c.unmarshaled.Add(1)
+	return c.EnvelopeCodec.Unmarshal(buf, env)
+}
+
+func TestUserCache(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var requested [][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v2/rpc/" + nakama.SearchUsersRpc:
+			_, _ = w.Write([]byte(`{"user_ids":["b","c"]}`))
+		case "/v2/user":
+			ids := req.URL.Query()["ids"]
+			requested = append(requested, ids)
+			var users []string
+			for _, id := range ids {
+				users = append(users, `{"id":"`+id+`","username":"user-`+id+`","display_name":"`+strings.ToUpper(id)+`"}`)
+			}
+			_, _ = w.Write([]byte(`{"users":[` + strings.Join(users, ",") + `]}`))
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer srv.Close()
+	cl := nakama.New(nakama.WithURL(srv.URL))
+	token := newToken(time.Now().Add(time.Hour))
+	if err := cl.SessionStart(&nakama.SessionResponse{Token: token, RefreshToken: token}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	cache := nakama.NewUserCache(cl, 2)
+	var invalidated []string
+	cache.OnInvalidate(ctx, func(id string) {
+		invalidated = append(invalidated, id)
+	})
+	names, err := cache.DisplayNames(ctx, "a", "b")
+	if err != nil || names["a"] != "A" || names["b"] != "B" {
+		t.Fatalf("expected display names, got: %v %v", names, err)
+	}
+	users, err := cache.Search(ctx, "query", 10)
+	switch {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case len(users) != 2 || users[0].Id != "b" || users[1].Id != "c":
+		t.Errorf("expected users b and c, got: %v", users)
+	case len(requested) != 2 || len(requested[1]) != 1 || requested[1][0] != "c":
+		t.Errorf("expected only c requested, got: %v", requested)
+	case len(invalidated) != 1 || invalidated[0] != "a" || cache.Len() != 2:
+		t.Errorf("expected a evicted, got: %v", invalidated)
+	}
+	cache.Invalidate("b")
+	if _, err := cache.User(ctx, "b"); err != nil || len(requested) != 3 {
+		t.Errorf("expected b requested after invalidation, got: %v %v", requested, err)
+	}
+}
+
+func TestRecordWrite(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	bodies := make(map[string]map[string]interface{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var v map[string]interface{}
+		_ = json.NewDecoder(req.Body).Decode(&v)
+		bodies[req.URL.Path] = v
+		_, _ = w.Write([]byte(`{"leaderboard_id":"board","score":"10"}`))
+	}))
+	defer srv.Close()
+	cl := nakama.New(nakama.WithURL(srv.URL))
+	token := newToken(time.Now().Add(time.Hour))
+	if err := cl.SessionStart(&nakama.SessionResponse{Token: token, RefreshToken: token}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	w := nakama.LeaderboardRecordWrite("board", 10).
+		WithSubscore(2).
+		WithOperator(nakama.OpIncrement).
+		WithMetadata(map[string]int{"level": 3})
+	if _, err := w.Do(ctx, cl); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if _, err := w.DoTournament(ctx, cl); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	for _, path := range []string{"/v2/leaderboard/board", "/v2/tournament/board"} {
+		body := bodies[path]
+		if got := fmt.Sprintf("%v %v %v %v", body["score"], body["subscore"], body["operator"], body["metadata"]); got != `10 2 3 {"level":3}` {
+			t.Errorf("expected record write for %s, got: %q", path, got)
+		}
+	}
+	if _, err := nakama.LeaderboardRecordWrite("board", 1).WithMetadata(func() {}).Do(ctx, cl); err == nil {
+		t.Errorf("expected metadata encoding error")
+	}
+}
+
+func TestStorageValue(t *testing.T) {
+	v, err := nakama.NewStorageValue[map[string]int](&nkapi.StorageObject{
+		Collection: "collection",
+		Key:        "key",
+		Value:      `{"level":3}`,
+	})
+	switch {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case v.Value["level"] != 3:
+		t.Errorf("expected decoded value, got: %v", v.Value)
+	case !v.CreateTime.IsZero() || !v.UpdateTime.IsZero():
+		t.Errorf("expected zero times, got: %v %v", v.CreateTime, v.UpdateTime)
+	}
+}
+
+func TestStorageUpdate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	value, version, writes := 1, 1, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case "POST":
+			_, _ = fmt.Fprintf(w, `{"objects":[{"collection":"counters","key":"clicks","value":"%d","version":"%d"}]}`, value, version)
+		case "PUT":
+			var v struct {
+				Objects []struct {
+					Value   string `json:"value"`
+					Version string `json:"version"`
+				} `json:"objects"`
+			}
+			_ = json.NewDecoder(req.Body).Decode(&v)
+			if writes++; writes == 1 {
+				// concurrent modification
+				value, version = value+10, version+1
+			}
+			if v.Objects[0].Version != strconv.Itoa(version) {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"code":3,"message":"Storage write rejected - version check failed."}`))
+				return
+			}
+			value, _ = strconv.Atoi(v.Objects[0].Value)
+			version++
+			_, _ = fmt.Fprintf(w, `{"acks":[{"collection":"counters","key":"clicks","version":"%d"}]}`, version)
+		}
+	}))
+	defer srv.Close()
+	cl := nakama.New(nakama.WithURL(srv.URL))
+	token := newToken(time.Now().Add(time.Hour))
+	if err := cl.SessionStart(&nakama.SessionResponse{Token: token, RefreshToken: token}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	conflicts := 0
+	incr := func(old int) (int, error) {
+		return old + 1, nil
+	}
+	v, err := nakama.StorageUpdate(ctx, cl, "counters", "clicks", incr,
+		nakama.WithUpdateBackoff(nakama.ConstantBackoff(time.Millisecond)),
+		nakama.WithUpdateConflict(func(int, error) { conflicts++ }),
+	)
+	switch {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case v != 12 || value != 12 || conflicts != 1:
+		t.Errorf("expected 12 after 1 conflict, got: %d %d %d", v, value, conflicts)
+	}
+	writes = 0
+	if _, err := nakama.StorageUpdate(ctx, cl, "counters", "clicks", incr, nakama.WithUpdateAttempts(1)); !errors.Is(err, nakama.ErrStorageConflict) {
+		t.Errorf("expected ErrStorageConflict, got: %v", err)
+	}
+}
+
+func TestLoggers(t *testing.T) {
+	// debug messages are not logged with WithLogger
+	var lines []string
+	cl := nakama.New(nakama.WithLogger(func(s string, v ...interface{}) {
+		lines = append(lines, fmt.Sprintf(s, v...))
+	}))
+	cl.Log(nakama.LevelDebug, "send", "type", "ping")
+	cl.Log(nakama.LevelWarn, "retrying", "attempt", 1)
+	if len(lines) != 1 || lines[0] != "WARN retrying attempt=1" {
+		t.Errorf("expected only the warning logged, got: %q", lines)
+	}
+	// logrus fields
+	entry := new(logrusEntry)
+	logger := nakama.NewLogrusLogger(func(fields map[string]interface{}) nakama.LogrusEntry {
+		entry.fields = fields
+		return entry
+	})
+	logger.Log(nakama.LevelError, "unable to send", "cid", "1", "err", "closed")
+	if entry.level != "error" || entry.msg != "unable to send" || entry.fields["cid"] != "1" || entry.fields["err"] != "closed" {
+		t.Errorf("expected error with fields, got: %+v", entry)
+	}
+}
+
+// logrusEntry is a logrus entry recording the last message.
+type logrusEntry struct {
+	fields     map[string]interface{}
+	level, msg string
+}
+
+func (e *logrusEntry) Debug(v ...interface{}) { e.level, e.msg = "debug", fmt.Sprint(v...) }
+func (e *logrusEntry) Info(v ...interface{})  { e.level, e.msg = "info", fmt.Sprint(v...) }
+func (e *logrusEntry) Warn(v ...interface{})  { e.level, e.msg = "warn", fmt.Sprint(v...) }
+func (e *logrusEntry) Error(v ...interface{}) { e.level, e.msg = "error", fmt.Sprint(v...) }
+
+func TestServerURL(t *testing.T) {
+	tests := []struct {
+		opts []nakama.Option
+		exp  string
+	}{
+		{nil, "ws://127.0.0.1:7350/ws"},
+		{[]nakama.Option{nakama.WithSSL(true)}, "wss://127.0.0.1:7350/ws"},
+		{[]nakama.Option{nakama.WithServer("example.com", 0, true, "")}, "wss://example.com/ws"},
+		{[]nakama.Option{nakama.WithServer("example.com", 8443, true, "nakama/")}, "wss://example.com:8443/nakama/ws"},
+		{[]nakama.Option{nakama.WithServer("::1", 7350, false, "/edge"), nakama.WithSSL(true)}, "wss://[::1]:7350/edge/ws"},
+	}
+	for i, test := range tests {
+		urlstr, err := nakama.New(test.opts...).SocketURL()
+		switch {
+		case err != nil:
+			t.Errorf("test %d expected no error, got: %v", i, err)
+		case urlstr != test.exp:
+			t.Errorf("test %d expected %q, got: %q", i, test.exp, urlstr)
+		}
+	}
+}
+
+func TestEndpoints(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	down := NewServer(WithLogger(t.Logf))
+	down.Close()
+	srv1, srv2 := NewServer(WithLogger(t.Logf)), NewServer(WithLogger(t.Logf))
+	defer srv1.Close()
+	defer srv2.Close()
+	for _, probe := range []bool{false, true} {
+		conn, err := nakama.NewConn(
+			ctx,
+			nakama.WithConnToken("token"),
+			nakama.WithConnEndpoints(down.URL(), srv1.URL()),
+			nakama.WithConnEndpointProbe(probe),
+			nakama.WithConnPersist(true),
+		)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		defer conn.Close()
+		if endpoint := conn.Endpoint(); endpoint != srv1.URL() {
+			t.Fatalf("expected endpoint %s, got: %s", srv1.URL(), endpoint)
+		}
+		connected := make(chan struct{}, 1)
+		conn.OnConnect(ctx, func() {
+			connected <- struct{}{}
+		})
+		if err := conn.Migrate(srv2.URL()); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("expected reconnect")
+		case <-connected:
+		}
+		if endpoint := conn.Endpoint(); endpoint != srv2.URL() {
+			t.Errorf("expected endpoint %s, got: %s", srv2.URL(), endpoint)
+		}
+		if err := conn.Ping(ctx); err != nil {
+			t.Errorf("expected no error, got: %v", err)
+		}
+	}
+}
+
+func TestMatchJoinByQuery(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var query url.Values
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v2/match" {
+			http.NotFound(w, req)
+			return
+		}
+		query = req.URL.Query()
+		_, _ = w.Write([]byte(`{"matches":[{"match_id":"a","size":3},{"match_id":"b","size":1},{"match_id":"c","size":2}]}`))
+	}))
+	defer api.Close()
+	srv := newTestServer(t)
+	srv.Handle("match_join", func(_ *Session, env *rtapi.Envelope) (*rtapi.Envelope, error) {
+		id := env.GetMatchJoin().GetMatchId()
+		if id == "b" {
+			return nil, fmt.Errorf("match full")
+		}
+		return &rtapi.Envelope{
+			Message: &rtapi.Envelope_Match{
+				Match: &rtapi.Match{MatchId: id, Authoritative: true},
+			},
+		}, nil
+	})
+	cl := nakama.New(nakama.WithURL(api.URL))
+	token := newToken(time.Now().Add(time.Hour))
+	if err := cl.SessionStart(&nakama.SessionResponse{Token: token, RefreshToken: token}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	conn, err := cl.NewConn(ctx, nakama.WithConnUrl(srv.URL()))
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	defer conn.Close()
+	h, err := conn.MatchJoinByQuery(ctx, "+label.mode:ranked", 1, 4)
+	switch {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case h.Id() != "c":
+		t.Errorf("expected least full joinable match c, got: %s", h.Id())
+	case query.Get("query") != "+label.mode:ranked" || query.Get("authoritative") != "true" ||
+		query.Get("minSize") != "1" || query.Get("maxSize") != "4":
+		t.Errorf("expected query parameters, got: %v", query)
+	}
+	conn, err = cl.NewConn(
+		ctx,
+		nakama.WithConnUrl(srv.URL()),
+		nakama.WithConnMatchSelector(func([]*nakama.Match) *nakama.Match {
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.MatchJoinByQuery(ctx, "", 0, 4); !errors.Is(err, nakama.ErrNotFound) {
+		t.Errorf("expected not found error, got: %v", err)
+	}
+}
+
+func TestPartyInvite(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	deleted := make(chan []string, 1)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "DELETE" || req.URL.Path != "/v2/notification" {
+			http.NotFound(w, req)
+			return
+		}
+		deleted <- req.URL.Query()["ids"]
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer api.Close()
+	srv := newTestServer(t)
+	srv.Handle("rpc", func(sess *Session, env *rtapi.Envelope) (*rtapi.Envelope, error) {
+		if id := env.GetRpc().GetId(); id != nakama.PartyInviteRpc {
+			return nil, fmt.Errorf("unexpected rpc %s", id)
+		}
+		// notify the inviting session, as there is a single user
+		go func() {
+			_ = sess.Send(ctx, &rtapi.Envelope{
+				Message: &rtapi.Envelope_Notifications{
+					Notifications: &rtapi.Notifications{
+						Notifications: []*nkapi.Notification{
+							{Id: "other", Code: 1, Content: `{}`},
+							{Id: "n1", Code: nakama.PartyInviteCode, Content: env.GetRpc().GetPayload(), SenderId: "sender", Persistent: true},
+						},
+					},
+				},
+			})
+		}()
+		return &rtapi.Envelope{
+			Message: &rtapi.Envelope_Rpc{
+				Rpc: &nkapi.Rpc{Id: nakama.PartyInviteRpc},
+			},
+		}, nil
+	})
+	srv.Respond("party_join", &rtapi.Envelope{})
+	cl := nakama.New(nakama.WithURL(api.URL))
+	token := newToken(time.Now().Add(time.Hour))
+	if err := cl.SessionStart(&nakama.SessionResponse{Token: token, RefreshToken: token}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	conn, err := cl.NewConn(ctx, nakama.WithConnUrl(srv.URL()))
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	defer conn.Close()
+	invites := make(chan *nakama.PartyInvite, 2)
+	conn.OnPartyInvite(ctx, func(inv *nakama.PartyInvite) {
+		invites <- inv
+	})
+	party := conn.PartyHandle(ctx, &nakama.PartyMsg{Party: rtapi.Party{PartyId: "party"}})
+	if err := party.Invite(ctx, "user"); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	var inv *nakama.PartyInvite
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected invite")
+	case inv = <-invites:
+	}
+	if inv.PartyId != "party" || inv.SenderId != "sender" || inv.Notification.Id != "n1" {
+		t.Errorf("expected invite to party from sender, got: %+v", inv)
+	}
+	if err := inv.Accept(ctx); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if ids := <-deleted; len(ids) != 1 || ids[0] != "n1" {
+		t.Errorf("expected notification n1 deleted, got: %v", ids)
+	}
+	var joined []string
+	for _, env := range srv.Received() {
+		if Type(env) == "party_join" {
+			joined = append(joined, env.GetPartyJoin().GetPartyId())
+		}
+	}
+	if len(joined) != 1 || joined[0] != "party" {
+		t.Errorf("expected party joined, got: %v", joined)
+	}
+	if len(invites) != 0 {
+		t.Errorf("expected a single invite")
+	}
+}
+
+func TestMessageSize(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	conn := newTestConn(t, srv,
+		nakama.WithConnReadLimit(1024),
+		nakama.WithConnMaxMessageSize(nakama.DefaultServerMaxMessageSize),
+	)
+	// outgoing
+	var serr *nakama.MessageSizeError
+	switch err := conn.MatchDataSend(ctx, "match", 1, make([]byte, 8192), true); {
+	case !errors.As(err, &serr):
+		t.Fatalf("expected message size error, got: %v", err)
+	case serr.Incoming || serr.Type != "match_data_send":
+		t.Errorf("expected outgoing match_data_send, got: %+v", serr)
+	}
+	// incoming
+	oversize := make(chan *nakama.MessageSizeError, 1)
+	conn.OnMessageTooLarge(ctx, func(err *nakama.MessageSizeError) {
+		oversize <- err
+	})
+	if err := srv.Notify(ctx, &rtapi.Envelope{
+		Message: &rtapi.Envelope_MatchData{
+			MatchData: &rtapi.MatchData{MatchId: "match", Data: make([]byte, 2048)},
+		},
+	}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected message size error: %v", ctx.Err())
+	case err := <-oversize:
+		if !err.Incoming || err.Limit != 1024 {
+			t.Errorf("expected incoming with limit 1024, got: %+v", err)
+		}
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	// echo the payload
+	srv.Handle("rpc", func(_ *Session, env *rtapi.Envelope) (*rtapi.Envelope, error) {
+		return env, nil
+	})
+	conn := newTestConn(t, srv, nakama.WithConnMetadataInjector(nil))
+	ctx = nakama.WithMetadata(ctx, map[string]string{"trace_id": "abc"})
+	var res struct {
+		Name     string            `json:"name"`
+		Metadata map[string]string `json:"_metadata"`
+	}
+	switch err := conn.Rpc(ctx, "echo", map[string]string{"name": "bob"}, &res); {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case res.Name != "bob" || res.Metadata["trace_id"] != "abc":
+		t.Errorf("expected payload with metadata, got: %+v", res)
+	}
+	// non-object payloads are sent as is
+	var s string
+	switch err := conn.Rpc(ctx, "echo", "plain", &s); {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case s != "plain":
+		t.Errorf("expected %q, got: %q", "plain", s)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	srv.Respond("match_data_send", &rtapi.Envelope{})
+	conn := newTestConn(t, srv,
+		nakama.WithConnRateLimit(10, 2),
+		nakama.WithConnMatchDataRateLimit(2, 2),
+	)
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := conn.Ping(ctx); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+	// the burst of 2 is sent immediately, and the remaining 2 at 10/s
+	if d := time.Since(start); d < 150*time.Millisecond {
+		t.Errorf("expected pings to be rate limited, took: %v", d)
+	}
+	// match data has a separate budget
+	start = time.Now()
+	for i := 0; i < 2; i++ {
+		if err := conn.MatchDataSend(ctx, "match", 1, nil, true); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+	if d := time.Since(start); d > 90*time.Millisecond {
+		t.Errorf("expected match data burst to not be rate limited, took: %v", d)
+	}
+	// match data waiting for the rate limit does not delay other requests
+	sent := make(chan error, 1)
+	go func() {
+		sent <- conn.MatchDataSend(ctx, "match", 1, nil, true)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	start = time.Now()
+	if err := conn.Ping(ctx); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if d := time.Since(start); d > 300*time.Millisecond {
+		t.Errorf("expected ping to not wait for match data, took: %v", d)
+	}
+	if err := <-sent; err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+}
+
+func TestOpCodes(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	srv.Respond("match_data_send", &rtapi.Envelope{})
+	type move struct {
+		X, Y int
+	}
+	opCodes := nakama.NewOpCodeRegistry()
+	nakama.RegisterOpCodeCodec[move](opCodes, 1, nakama.JsonCodec)
+	conn := newTestConn(t, srv, nakama.WithConnOpCodes(opCodes))
+	h := conn.MatchHandle(ctx, &nakama.MatchMsg{Match: rtapi.Match{MatchId: "match"}})
+	// outgoing
+	if err := h.SendTyped(ctx, 1, move{1, 2}, true); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	received := srv.Received()
+	if data := received[len(received)-1].GetMatchDataSend().GetData(); string(data) != `{"X":1,"Y":2}` {
+		t.Errorf("expected encoded move, got: %q", string(data))
+	}
+	if err := h.SendTyped(ctx, 1, "move", true); err == nil {
+		t.Errorf("expected error for wrong type")
+	}
+	if err := h.SendTyped(ctx, 2, move{}, true); err == nil {
+		t.Errorf("expected error for unregistered op code")
+	}
+	// incoming
+	moves := make(chan move, 1)
+	nakama.OnMatchDataDecode(h, 1, func(m move, _ *nakama.MatchDataMsg) {
+		moves <- m
+	})
+	if err := srv.Notify(ctx, &rtapi.Envelope{
+		Message: &rtapi.Envelope_MatchData{
+			MatchData: &rtapi.MatchData{MatchId: "match", OpCode: 1, Data: []byte(`{"X":3,"Y":4}`)},
+		},
+	}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected move: %v", ctx.Err())
+	case m := <-moves:
+		if m != (move{3, 4}) {
+			t.Errorf("expected {3 4}, got: %v", m)
+		}
+	}
+}
+
+func TestStateSync(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	// echo match data back to the sender
+	srv.Handle("match_data_send", func(sess *Session, env *rtapi.Envelope) (*rtapi.Envelope, error) {
+		msg := env.GetMatchDataSend()
+		err := sess.Send(ctx, &rtapi.Envelope{
+			Message: &rtapi.Envelope_MatchData{
+				MatchData: &rtapi.MatchData{MatchId: msg.MatchId, OpCode: msg.OpCode, Data: msg.Data},
+			},
+		})
+		return &rtapi.Envelope{}, err
+	})
+	conn := newTestConn(t, srv)
+	type state struct {
+		Tick   int
+		Health []int
+	}
+	h := conn.MatchHandle(ctx, &nakama.MatchMsg{Match: rtapi.Match{MatchId: "match"}})
+	ss := nakama.NewStateSync[state](h, 10, 11, nakama.WithStateSyncInterval(time.Hour))
+	states := make(chan state, 2)
+	ss.OnState(func(s *nakama.SyncedState[state]) {
+		states <- s.State
+	})
+	for _, s := range []state{{1, []int{100, 100, 100}}, {2, []int{100, 90, 100}}} {
+		if err := ss.Send(ctx, s); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("expected state: %v", ctx.Err())
+		case got := <-states:
+			if got.Tick != s.Tick || got.Health[1] != s.Health[1] {
+				t.Errorf("expected %v, got: %v", s, got)
+			}
+		}
+	}
+	var ops []int64
+	for _, env := range srv.Received() {
+		if msg := env.GetMatchDataSend(); msg != nil {
+			ops = append(ops, msg.OpCode)
+		}
+	}
+	if len(ops) != 2 || ops[0] != 10 || ops[1] != 11 {
+		t.Errorf("expected a snapshot and a delta, got op codes: %v", ops)
+	}
+}
+
+func TestRelaySequencer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	srv.Respond("match_data_send", &rtapi.Envelope{})
+	conn := newTestConn(t, srv)
+	self := &rtapi.UserPresence{UserId: "u1", SessionId: "s1"}
+	peer := &rtapi.UserPresence{UserId: "u2", SessionId: "s2"}
+	h := conn.MatchHandle(ctx, &nakama.MatchMsg{Match: rtapi.Match{MatchId: "match", Self: self}})
+	r := nakama.NewRelaySequencer(h)
+	if seq, err := r.SendData(ctx, 1, []byte("a"), false); err != nil || seq != 1 {
+		t.Fatalf("expected seq 1, got: %d %v", seq, err)
+	}
+	received := make(chan *nakama.RelayedData, 8)
+	r.OnData(func(data *nakama.RelayedData) {
+		received <- data
+	})
+	gaps := make(chan *nakama.SequenceGap, 1)
+	r.OnGap(func(gap *nakama.SequenceGap) {
+		gaps <- gap
+	})
+	// echo, peer 1, duplicate, peer 4
+	for _, m := range []struct {
+		presence *rtapi.UserPresence
+		seq      byte
+	}{{self, 1}, {peer, 1}, {peer, 1}, {peer, 4}} {
+		if err := srv.Notify(ctx, &rtapi.Envelope{
+			Message: &rtapi.Envelope_MatchData{
+				MatchData: &rtapi.MatchData{MatchId: "match", Presence: m.presence, OpCode: 1, Data: []byte{0, 0, 0, m.seq, 'x'}},
+			},
+		}); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+	for _, exp := range []uint32{1, 4} {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("expected data: %v", ctx.Err())
+		case data := <-received:
+			if data.Seq != exp || data.Presence.SessionId != "s2" || string(data.Payload) != "x" {
+				t.Errorf("expected seq %d from s2, got: %d from %s", exp, data.Seq, data.Presence.SessionId)
+			}
+		}
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected gap: %v", ctx.Err())
+	case gap := <-gaps:
+		if gap.Expected != 2 || gap.Received != 4 || gap.Missed() != 2 {
+			t.Errorf("expected gap of 2 after 1, got: %+v", gap)
+		}
+	}
+	if n := len(received); n != 0 {
+		t.Errorf("expected echo and duplicate to be dropped, got %d more", n)
+	}
+}
+
+func TestPresenceSet(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	conn := newTestConn(t, srv)
+	p1 := &rtapi.UserPresence{UserId: "u1", SessionId: "s1"}
+	p2 := &rtapi.UserPresence{UserId: "u2", SessionId: "s2"}
+	h := conn.MatchHandle(ctx, &nakama.MatchMsg{Match: rtapi.Match{MatchId: "match", Presences: []*rtapi.UserPresence{p1}}})
+	changes := h.Roster().Changes(ctx)
+	// a presence both joining and leaving is removed
+	if err := srv.Notify(ctx, &rtapi.Envelope{
+		Message: &rtapi.Envelope_MatchPresenceEvent{
+			MatchPresenceEvent: &rtapi.MatchPresenceEvent{MatchId: "match", Joins: []*rtapi.UserPresence{p1, p2}, Leaves: []*rtapi.UserPresence{p1}},
+		},
+	}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected change: %v", ctx.Err())
+	case change := <-changes:
+		if len(change.Joins) != 1 || change.Joins[0].SessionId != "s2" || len(change.Leaves) != 1 || change.Leaves[0].SessionId != "s1" {
+			t.Errorf("expected s2 join and s1 leave, got: %+v", change)
+		}
+	}
+	if l := h.Presences(); len(l) != 1 || l[0].SessionId != "s2" {
+		t.Errorf("expected presences [s2], got: %v", l)
+	}
+	if !h.Roster().Contains("s2") || len(h.Roster().User("u2")) != 1 {
+		t.Errorf("expected roster to contain s2")
+	}
+}
+
+func TestCidGenerator(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	conn := newTestConn(t, srv, nakama.WithConnCidGenerator(nakama.EpochCid))
+	for i := 0; i < 2; i++ {
+		if err := conn.Ping(ctx); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+	received := srv.Received()
+	if len(received) != 2 || received[0].Cid != "1.1" || received[1].Cid != "1.2" {
+		t.Errorf("expected cids [1.1 1.2], got: %v", received)
+	}
+	if epoch, n := conn.CidCounter(); epoch != 1 || n != 2 {
+		t.Errorf("expected epoch 1 and counter 2, got: %d %d", epoch, n)
+	}
+}
+
+func TestOrphanResponse(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	// respond after the request has timed out
+	srv.Handle("rpc", func(*Session, *rtapi.Envelope) (*rtapi.Envelope, error) {
+		time.Sleep(200 * time.Millisecond)
+		return &rtapi.Envelope{
+			Message: &rtapi.Envelope_Rpc{Rpc: &nkapi.Rpc{Id: "slow", Payload: "late"}},
+		}, nil
+	})
+	conn := newTestConn(t, srv)
+	orphans := make(chan *rtapi.Envelope, 1)
+	conn.OnOrphanResponse(ctx, func(env *rtapi.Envelope) {
+		orphans <- env
+	})
+	rctx, rcancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer rcancel()
+	if err := conn.Rpc(rctx, "slow", "", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got: %v", err)
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected orphan response: %v", ctx.Err())
+	case env := <-orphans:
+		if env.Cid == "" || env.GetRpc().GetPayload() != "late" {
+			t.Errorf("expected late rpc response, got: %v", env)
+		}
+	}
+}
+
+func TestOnlineStatus(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	srv.Respond("status_follow", &rtapi.Envelope{
+		Message: &rtapi.Envelope_Status{
+			Status: &rtapi.Status{Presences: []*rtapi.UserPresence{{UserId: "u1", SessionId: "s1"}}},
+		},
+	})
+	srv.Respond("status_unfollow", &rtapi.Envelope{})
+	conn := newTestConn(t, srv)
+	online, err := conn.OnlineStatus(ctx, "u1", "u2")
+	switch {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case !online["u1"] || online["u2"] || len(online) != 2:
+		t.Errorf("expected u1 online and u2 offline, got: %v", online)
+	}
+	received := srv.Received()
+	if n := len(received); n != 2 || received[1].GetStatusUnfollow() == nil {
+		t.Errorf("expected follow and unfollow, got: %v", received)
+	}
+}
+
+func TestStatusTracker(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	online := map[string]*rtapi.UserPresence{
+		"u1": {UserId: "u1", SessionId: "s1", Status: wrapperspb.String("hi")},
+		"u4": {UserId: "u4", SessionId: "s4"},
+	}
+	srv.Handle("status_follow", func(_ *Session, env *rtapi.Envelope) (*rtapi.Envelope, error) {
+		status := new(rtapi.Status)
+		for _, id := range env.GetStatusFollow().GetUserIds() {
+			if p, ok := online[id]; ok {
+				status.Presences = append(status.Presences, p)
+			}
+		}
+		return &rtapi.Envelope{Message: &rtapi.Envelope_Status{Status: status}}, nil
+	})
+	srv.Respond("status_unfollow", &rtapi.Envelope{})
+	conn := newTestConn(t, srv,
+		nakama.WithConnPersist(true),
+		nakama.WithConnBackoff(10*time.Millisecond, 10*time.Millisecond),
+	)
+	tracker := conn.StatusTracker(ctx)
+	defer tracker.Close()
+	var mu sync.Mutex
+	var changes []string
+	tracker.OnChange(func(msg *nakama.StatusPresenceEventMsg) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, p := range msg.Leaves {
+			changes = append(changes, "-"+p.UserId)
+		}
+		for _, p := range msg.Joins {
+			changes = append(changes, "+"+p.UserId)
+		}
+	})
+	// follow
+	if err := tracker.Follow(ctx, "u1", "u2"); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	switch status, ok := tracker.Status("u1"); {
+	case !tracker.Online("u1") || tracker.Online("u2"):
+		t.Errorf("expected u1 online and u2 offline")
+	case status != "hi" || !ok:
+		t.Errorf("expected u1 status hi, got: %q %t", status, ok)
+	}
+	// presence events for followed users
+	for _, ev := range []*rtapi.StatusPresenceEvent{
+		{Joins: []*rtapi.UserPresence{{UserId: "u2", SessionId: "s2", Status: wrapperspb.String("away")}}},
+		// not followed
+		{Joins: []*rtapi.UserPresence{{UserId: "u3", SessionId: "s3"}}},
+		// status update
+		{
+			Leaves: []*rtapi.UserPresence{{UserId: "u1", SessionId: "s1"}},
+			Joins:  []*rtapi.UserPresence{{UserId: "u1", SessionId: "s1", Status: wrapperspb.String("busy")}},
+		},
+	} {
+		if err := srv.Notify(ctx, &rtapi.Envelope{Message: &rtapi.Envelope_StatusPresenceEvent{StatusPresenceEvent: ev}}); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+	// the ping response is received after the presence events
+	if err := conn.Ping(ctx); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	status1, _ := tracker.Status("u1")
+	status2, _ := tracker.Status("u2")
+	switch {
+	case status1 != "busy" || status2 != "away":
+		t.Errorf("expected u1 busy and u2 away, got: %q %q", status1, status2)
+	case tracker.Online("u3") || len(tracker.Presences()) != 2:
+		t.Errorf("expected only followed presences, got: %v", tracker.Presences())
+	}
+	// unfollow
+	if err := tracker.Unfollow(ctx, "u2"); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if followed := tracker.Followed(); tracker.Online("u2") || fmt.Sprint(followed) != "[u1]" {
+		t.Errorf("expected only u1 followed, got: %v", followed)
+	}
+	// online status uses an ephemeral follow for users not followed
+	sent := len(srv.Received())
+	switch m, err := tracker.OnlineStatus(ctx, "u1", "u4", "u5"); {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case fmt.Sprint(m) != "map[u1:true u4:true u5:false]":
+		t.Errorf("expected u1 and u4 online, got: %v", m)
+	}
+	received := srv.Received()[sent:]
+	if len(received) != 2 || fmt.Sprint(received[0].GetStatusFollow().GetUserIds()) != "[u4 u5]" || received[1].GetStatusUnfollow() == nil {
+		t.Errorf("expected ephemeral follow and unfollow of u4 and u5, got: %v", received)
+	}
+	// reconnect
+	sent = len(srv.Received())
+	for _, sess := range srv.Sessions() {
+		_ = sess.Close()
+	}
+	for {
+		var refollowed bool
+		for _, env := range srv.Received()[sent:] {
+			refollowed = refollowed || fmt.Sprint(env.GetStatusFollow().GetUserIds()) == "[u1]"
+		}
+		mu.Lock()
+		n := len(changes)
+		mu.Unlock()
+		if refollowed && tracker.Online("u1") && n == 6 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("expected u1 refollowed, got: %v", srv.Received()[sent:])
+		case <-time.After(time.Millisecond):
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if s := fmt.Sprint(changes); s != "[+u1 +u2 -u1 +u1 -u1 +u1]" {
+		t.Errorf("expected changes, got: %s", s)
+	}
+}
+
+func TestWireHooks(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	srv.Handle("rpc", func(_ *Session, env *rtapi.Envelope) (*rtapi.Envelope, error) {
+		return env, nil
+	})
+	var mu sync.Mutex
+	var sent, received []string
+	conn := newTestConn(t, srv,
+		nakama.WithConnBeforeSend(func(typ string, buf []byte) ([]byte, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			sent = append(sent, typ)
+			return buf, nil
+		}),
+		nakama.WithConnAfterReceive(func(typ string, buf []byte) ([]byte, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			received = append(received, typ)
+			// rewrite the echoed payload
+			return bytes.Replace(buf, []byte("bob"), []byte("eve"), 1), nil
+		}),
+	)
+	var res map[string]string
+	switch err := conn.Rpc(ctx, "echo", map[string]string{"name": "bob"}, &res); {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case res["name"] != "eve":
+		t.Errorf("expected rewritten payload, got: %v", res)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sent) != 1 || sent[0] != "rpc" || len(received) != 1 || received[0] != "rpc" {
+		t.Errorf("expected rpc sent and received, got: %v %v", sent, received)
+	}
+}
+
+func TestConnPool(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	srv.Handle("rpc", func(_ *Session, env *rtapi.Envelope) (*rtapi.Envelope, error) {
+		return env, nil
+	})
+	p, err := nakama.NewConnPool(
+		ctx,
+		3,
+		nakama.WithConnUrl(srv.URL()),
+		nakama.WithConnToken("token"),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	defer p.Close()
+	used := make(map[*nakama.Conn]bool)
+	for i := 0; i < p.Len(); i++ {
+		used[p.Next()] = true
+	}
+	if len(used) != 3 {
+		t.Errorf("expected 3 distinct connections, got: %d", len(used))
+	}
+	for i := 0; i < 6; i++ {
+		var s string
+		if err := p.Rpc(ctx, "echo", "hello", &s); err != nil || s != "hello" {
+			t.Fatalf("expected hello, got: %q %v", s, err)
+		}
+	}
+	if n := len(srv.Received()); n != 6 {
+		t.Errorf("expected 6 received, got: %d", n)
+	}
+}
+
+func TestBot(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	srv.Respond("match_data_send", &rtapi.Envelope{})
+	started, replied := make(chan struct{}), make(chan struct{})
+	bot := nakama.NewBot(
+		nakama.New(),
+		nakama.WithBotConnOptions(
+			nakama.WithConnUrl(srv.URL()),
+			nakama.WithConnToken("token"),
+		),
+		nakama.WithBotBehavior(&nakama.Behavior{
+			OnStart: func(context.Context, *nakama.Bot) error {
+				close(started)
+				return nil
+			},
+			// reply to match data with the same data
+			OnMatchData: func(ctx context.Context, b *nakama.Bot, msg *nakama.MatchDataMsg) error {
+				defer close(replied)
+				return b.Conn().MatchDataSend(ctx, msg.MatchId, nakama.OpType(msg.OpCode), msg.Data, true)
+			},
+		}),
+	)
+	bctx, bcancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- bot.Run(bctx)
+	}()
+	<-started
+	waitSession(ctx, t, srv)
+	if err := srv.Notify(ctx, &rtapi.Envelope{
+		Message: &rtapi.Envelope_MatchData{
+			MatchData: &rtapi.MatchData{MatchId: "match", OpCode: 1, Data: []byte("ping")},
+		},
+	}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected reply, got: %v", ctx.Err())
+	case <-replied:
+	}
+	bcancel()
+	if err := <-done; err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+	received := srv.Received()
+	if n := len(received); n != 1 || string(received[0].GetMatchDataSend().GetData()) != "ping" {
+		t.Errorf("expected match data reply, got: %v", received)
+	}
+}
+
+func TestJSONNotifications(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	conn := newTestConn(t, srv,
+		nakama.WithConnFormat("json"),
+		nakama.WithConnReadLimit(1<<20),
+	)
+	const count = 500
+	received := make(chan *nakama.NotificationsMsg, 1)
+	conn.OnNotifications(ctx, func(msg *nakama.NotificationsMsg) {
+		received <- msg
+	})
+	notifications := make([]*nkapi.Notification, count)
+	for i := range notifications {
+		notifications[i] = &nkapi.Notification{Id: strconv.Itoa(i), Subject: "subject", Content: `{"n":1}`, Code: 1}
+	}
+	waitSession(ctx, t, srv)
+	if err := srv.Notify(ctx, &rtapi.Envelope{
+		Message: &rtapi.Envelope_Notifications{
+			Notifications: &rtapi.Notifications{Notifications: notifications},
+		},
+	}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected notifications, got: %v", ctx.Err())
+	case msg := <-received:
+		if n := len(msg.Notifications.Notifications); n != count || msg.Notifications.Notifications[count-1].Id != strconv.Itoa(count-1) {
+			t.Errorf("expected %d notifications, got: %d", count, n)
+		}
+	}
+	// responses still decode after the stream
+	srv.Handle("rpc", func(_ *Session, env *rtapi.Envelope) (*rtapi.Envelope, error) {
+		return env, nil
+	})
+	var res string
+	if err := conn.Rpc(ctx, "echo", "hello", &res); err != nil || res != "hello" {
+		t.Errorf("expected hello, got: %q %v", res, err)
+	}
+}
+
+func TestConnRpc(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	// echo the payload
+	srv.Handle("rpc", func(_ *Session, env *rtapi.Envelope) (*rtapi.Envelope, error) {
+		return env, nil
+	})
+	conn := newTestConn(t, srv)
+	type user struct {
+		Name string `json:"name"`
+	}
+	// json
+	switch res, err := nakama.ConnRpc[user, user](ctx, conn, "echo", user{Name: "bob"}); {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case res.Name != "bob":
+		t.Errorf("expected bob, got: %+v", res)
+	}
+	// pointer responses are allocated
+	switch res, err := nakama.ConnRpc[*user, *user](ctx, conn, "echo", &user{Name: "alice"}); {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case res == nil || res.Name != "alice":
+		t.Errorf("expected alice, got: %+v", res)
+	}
+	// async
+	errc := make(chan error, 1)
+	nakama.ConnRpcAsync(ctx, conn, "echo", "hello", func(res string, err error) {
+		if err == nil && res != "hello" {
+			err = fmt.Errorf("expected hello, got: %q", res)
+		}
+		errc <- err
+	})
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected response, got: %v", ctx.Err())
+	case err := <-errc:
+		if err != nil {
+			t.Errorf("expected no error, got: %v", err)
+		}
+	}
+	// json codec
+	switch res, err := nakama.ConnRpcCodec[user, map[string]string](ctx, conn, nakama.JsonCodec, "echo", user{Name: "carol"}); {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case res["name"] != "carol":
+		t.Errorf("expected carol, got: %v", res)
+	}
+	// protojson codec
+	switch res, err := nakama.ConnRpcCodec[*nkapi.AccountDevice, *nkapi.AccountDevice](ctx, conn, nakama.ProtojsonCodec, "echo", &nkapi.AccountDevice{Id: "device"}); {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case res.GetId() != "device":
+		t.Errorf("expected device, got: %v", res)
+	}
+	if _, err := nakama.ConnRpcCodec[user, user](ctx, conn, nakama.ProtojsonCodec, "echo", user{}); err == nil {
+		t.Errorf("expected error for a non proto.Message payload")
+	}
+	// raw codec
+	switch res, err := nakama.ConnRpcCodec[string, []byte](ctx, conn, nakama.RawCodec, "echo", `{"raw":true}`); {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case string(res) != `{"raw":true}`:
+		t.Errorf("expected raw payload, got: %q", res)
+	}
+	if _, err := nakama.ConnRpcCodec[int, string](ctx, conn, nakama.RawCodec, "echo", 1); err == nil {
+		t.Errorf("expected error for a non string payload")
+	}
+	// realtime message
+	var s string
+	if err := nakama.RpcMessage("echo", "plain", &s).Send(ctx, conn); err != nil || s != "plain" {
+		t.Errorf("expected plain, got: %q %v", s, err)
+	}
+}
+
+func TestWriteCoalescing(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	// match data is not responded to, so that reads do not flush
+	srv.Handle("match_data_send", func(*Session, *rtapi.Envelope) (*rtapi.Envelope, error) {
+		return nil, nil
+	})
+	var writes atomic.Int32
+	cl := nakama.New(nakama.WithHttpClient(&http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				nc, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+				if err != nil {
+					return nil, err
+				}
+				return &countingConn{Conn: nc, writes: &writes}, nil
+			},
+		},
+	}))
+	conn, err := cl.NewConn(
+		ctx,
+		nakama.WithConnUrl(srv.URL()),
+		nakama.WithConnToken("token"),
+		nakama.WithConnWriteCoalescing(time.Hour, 0),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	defer conn.Close()
+	waitSession(ctx, t, srv)
+	const count = 5
+	var sent int
+	send := func() {
+		for i := 0; i < count; i++ {
+			conn.MatchDataSendAsync(ctx, "match", 1, []byte(strconv.Itoa(sent)), true, nil, func(error) {})
+			// wait for the message to be written, to keep the send order
+			for sent++; conn.Stats().MessagesSent["match_data_send"] != sent; {
+				select {
+				case <-ctx.Done():
+					t.Fatalf("expected message %d to be sent, got: %v", sent, ctx.Err())
+				case <-time.After(time.Millisecond):
+				}
+			}
+		}
+	}
+	// wait waits for the server to receive the sent messages, checking each
+	// message is received separately
+	wait := func() {
+		t.Helper()
+		for {
+			var received []*rtapi.Envelope
+			for _, env := range srv.Received() {
+				if env.GetMatchDataSend() != nil {
+					received = append(received, env)
+				}
+			}
+			if len(received) == sent {
+				for i, env := range received {
+					if s := string(env.GetMatchDataSend().GetData()); s != strconv.Itoa(i) {
+						t.Errorf("expected message %d, got: %q", i, s)
+					}
+				}
+				return
+			}
+			select {
+			case <-ctx.Done():
+				t.Fatalf("expected %d messages, got: %d", sent, len(received))
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}
+	// flush writes the held messages at once
+	before := writes.Load()
+	send()
+	if err := conn.Flush(); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	// a read may have flushed the first message
+	if n := writes.Load() - before; n < 1 || n > 2 {
+		t.Errorf("expected fewer writes than messages, got: %d", n)
+	}
+	wait()
+	// a read flushes the held messages
+	before = writes.Load()
+	send()
+	if n := writes.Load() - before; n != 0 {
+		t.Errorf("expected held writes, got: %d", n)
+	}
+	if err := srv.Notify(ctx, &rtapi.Envelope{
+		Message: &rtapi.Envelope_StatusPresenceEvent{StatusPresenceEvent: &rtapi.StatusPresenceEvent{}},
+	}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	wait()
+	if n := writes.Load() - before; n != 1 {
+		t.Errorf("expected 1 write, got: %d", n)
+	}
+}
+
+// countingConn is a net.Conn counting writes.
+type countingConn struct {
+	net.Conn
+	writes *atomic.Int32
+}
+
+// Write satisfies the net.Conn interface.
+func (c *countingConn) Write(p []byte) (int, error) {
+	c.writes.Add(1)
+	return c.Conn.Write(p)
+}
+
+func TestTracing(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	propagator := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(propagator)
+	// http requests propagate the span context in the headers
+	headers := make(chan string, 1)
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		headers <- req.Header.Get("traceparent")
+		_, _ = w.Write([]byte(`"ok"`))
+	}))
+	defer hs.Close()
+	tp := new(recordingTracerProvider)
+	cl := nakama.New(nakama.WithURL(hs.URL), nakama.WithHttpKey("httpkey"), nakama.WithTracerProvider(tp))
+	var res string
+	if err := cl.Rpc(ctx, "echo", "hello", &res); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	spans := tp.Spans()
+	switch header := <-headers; {
+	case len(spans) != 1 || !strings.HasPrefix(spans[0].name, "nakama "):
+		t.Fatalf("expected 1 http span, got: %v", spans)
+	case !strings.Contains(header, spans[0].sc.SpanID().String()):
+		t.Errorf("expected traceparent with span id %s, got: %q", spans[0].sc.SpanID(), header)
+	}
+	// realtime requests
+	srv := newTestServer(t)
+	srv.Handle("rpc", func(_ *Session, env *rtapi.Envelope) (*rtapi.Envelope, error) {
+		if env.GetRpc().GetId() == "fail" {
+			return nil, errors.New("fail")
+		}
+		return env, nil
+	})
+	tp = new(recordingTracerProvider)
+	conn := newTestConn(t, srv, nakama.WithConnTracerProvider(tp), nakama.WithConnMetadataInjector(nil))
+	if err := conn.Ping(ctx); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	var md struct {
+		Metadata map[string]string `json:"_metadata"`
+	}
+	if err := conn.Rpc(ctx, "echo", map[string]string{}, &md); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if err := conn.Rpc(ctx, "fail", "", nil); err == nil {
+		t.Fatalf("expected error")
+	}
+	spans = tp.Spans()
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 realtime spans, got: %v", spans)
+	}
+	for i, typ := range []string{"ping", "rpc", "rpc"} {
+		switch span := spans[i]; {
+		case span.name != "nakama.realtime "+typ || span.attrs["nakama.message_type"] != typ:
+			t.Errorf("expected %s span, got: %s %v", typ, span.name, span.attrs)
+		case span.attrs["nakama.cid"] == "" || !span.ended:
+			t.Errorf("expected ended span with cid, got: %v", span.attrs)
+		case span.err != (i == 2):
+			t.Errorf("expected span %d error %t", i, i == 2)
+		}
+	}
+	// realtime rpcs propagate the span context in the payload metadata
+	if s := md.Metadata["traceparent"]; !strings.Contains(s, spans[1].sc.SpanID().String()) {
+		t.Errorf("expected traceparent with span id %s, got: %q", spans[1].sc.SpanID(), s)
+	}
+}
+
+// recordingTracerProvider is a trace.TracerProvider and trace.Tracer
+// recording started spans.
+type recordingTracerProvider struct {
+	mu    sync.Mutex
+	spans []*recordingSpan
+}
+
+// Tracer satisfies the trace.TracerProvider interface.
+func (tp *recordingTracerProvider) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return tp
+}
+
+// Start satisfies the trace.Tracer interface.
+func (tp *recordingTracerProvider) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	span := &recordingSpan{
+		Span: trace.SpanFromContext(context.Background()),
+		tp:   tp,
+		name: name,
+		sc: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{1},
+			SpanID:     trace.SpanID{byte(len(tp.spans) + 1)},
+			TraceFlags: trace.FlagsSampled,
+		}),
+		attrs: make(map[string]string),
+	}
+	cfg := trace.NewSpanStartConfig(opts...)
+	for _, kv := range cfg.Attributes() {
+		span.attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	tp.spans = append(tp.spans, span)
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+// Spans returns the started spans.
+func (tp *recordingTracerProvider) Spans() []*recordingSpan {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	return append([]*recordingSpan(nil), tp.spans...)
+}
+
+// recordingSpan is a recorded span.
+type recordingSpan struct {
+	trace.Span
+	tp    *recordingTracerProvider
+	name  string
+	sc    trace.SpanContext
+	attrs map[string]string
+	err   bool
+	ended bool
+}
+
+// SpanContext satisfies the trace.Span interface.
+func (span *recordingSpan) SpanContext() trace.SpanContext {
+	return span.sc
+}
+
+// IsRecording satisfies the trace.Span interface.
+func (span *recordingSpan) IsRecording() bool {
+	return true
+}
+
+// SetAttributes satisfies the trace.Span interface.
+func (span *recordingSpan) SetAttributes(kv ...attribute.KeyValue) {
+	span.tp.mu.Lock()
+	defer span.tp.mu.Unlock()
+	for _, a := range kv {
+		span.attrs[string(a.Key)] = a.Value.Emit()
+	}
+}
+
+// SetStatus satisfies the trace.Span interface.
+func (span *recordingSpan) SetStatus(code codes.Code, _ string) {
+	span.tp.mu.Lock()
+	defer span.tp.mu.Unlock()
+	span.err = code == codes.Error
+}
+
+// End satisfies the trace.Span interface.
+func (span *recordingSpan) End(...trace.SpanEndOption) {
+	span.tp.mu.Lock()
+	defer span.tp.mu.Unlock()
+	span.ended = true
+}
+
+func TestMetrics(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// http requests
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v2/rpc/echo" {
+			http.NotFound(w, req)
+			return
+		}
+		_, _ = io.Copy(w, req.Body)
+	}))
+	defer hs.Close()
+	// expvar names are unique to the test run
+	name := "nakamatest_metrics_" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	m := nakama.NewExpvarMetrics(name + "_http")
+	cl := nakama.New(nakama.WithURL(hs.URL), nakama.WithHttpKey("httpkey"), nakama.WithMetrics(m))
+	var res string
+	if err := cl.Rpc(ctx, "echo", "hello", &res); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if err := cl.Rpc(ctx, "missing", "", nil); err == nil {
+		t.Fatalf("expected error")
+	}
+	for _, test := range []struct {
+		path []string
+		exp  string
+	}{
+		{[]string{"http_requests"}, `{"RpcFunc": 2}`},
+		{[]string{"http_errors"}, `{"RpcFunc": 1}`},
+		{[]string{"http_bytes_sent"}, "5"},
+		{[]string{"http_bytes_received"}, "5"},
+		{[]string{"http_latency", "count"}, "2"},
+	} {
+		if s := expvarValue(append([]string{name + "_http"}, test.path...)...); s != test.exp {
+			t.Errorf("expected %v to be %s, got: %s", test.path, test.exp, s)
+		}
+	}
+	// realtime requests
+	srv := newTestServer(t)
+	srv.Handle("rpc", func(*Session, *rtapi.Envelope) (*rtapi.Envelope, error) {
+		return nil, errors.New("fail")
+	})
+	m = nakama.NewExpvarMetrics(name + "_realtime")
+	conn := newTestConn(t, srv,
+		nakama.WithConnMetrics(m),
+		nakama.WithConnPersist(true),
+		nakama.WithConnBackoff(10*time.Millisecond, 10*time.Millisecond),
+	)
+	if err := conn.Ping(ctx); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if err := conn.Rpc(ctx, "fail", "", nil); err == nil {
+		t.Fatalf("expected error")
+	}
+	// reconnect
+	waitSession(ctx, t, srv)
+	for _, sess := range srv.Sessions() {
+		_ = sess.Close()
+	}
+	for expvarValue(name+"_realtime", "reconnects") != "1" {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("expected reconnect, got: %v", ctx.Err())
+		case <-time.After(time.Millisecond):
+		}
+	}
+	if err := conn.Ping(ctx); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	for _, test := range []struct {
+		path []string
+		exp  string
+	}{
+		{[]string{"messages_sent", "ping"}, "2"},
+		{[]string{"messages_sent", "rpc"}, "1"},
+		{[]string{"messages_received", "pong"}, "2"},
+		{[]string{"messages_received", "error"}, "1"},
+		{[]string{"pending_requests"}, "0"},
+		{[]string{"reconnects"}, "1"},
+		{[]string{"realtime_errors"}, `{"rpc": 1}`},
+		{[]string{"realtime_latency", "count"}, "3"},
+	} {
+		if s := expvarValue(append([]string{name + "_realtime"}, test.path...)...); s != test.exp {
+			t.Errorf("expected %v to be %s, got: %s", test.path, test.exp, s)
+		}
+	}
+	if s := expvarValue(name+"_realtime", "bytes_sent"); s == "0" {
+		t.Errorf("expected bytes sent, got: %s", s)
+	}
+}
+
+// expvarValue returns the string value of the published expvar at the path
+// of map keys.
+func expvarValue(path ...string) string {
+	v := expvar.Get(path[0])
+	for _, key := range path[1:] {
+		m, ok := v.(*expvar.Map)
+		if !ok {
+			return ""
+		}
+		if v = m.Get(key); v == nil {
+			return ""
+		}
+	}
+	return v.String()
+}
+
+func TestNotificationsSince(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// page is the next cursor and number of notifications returned for a
+	// cursor
+	type page struct {
+		next  string
+		count int
+	}
+	var pages map[string]page
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		cursor := req.URL.Query().Get("cacheableCursor")
+		requested = append(requested, cursor)
+		p := pages[cursor]
+		res := &nkapi.NotificationList{CacheableCursor: p.next}
+		for i := 0; i < p.count; i++ {
+			res.Notifications = append(res.Notifications, &nkapi.Notification{Id: cursor + "-" + strconv.Itoa(i)})
+		}
+		buf, _ := protojson.Marshal(res)
+		_, _ = w.Write(buf)
+	}))
+	defer srv.Close()
+	cl := nakama.New(nakama.WithURL(srv.URL))
+	token := newToken(time.Now().Add(time.Hour))
+	if err := cl.SessionStart(&nakama.SessionResponse{Token: token, RefreshToken: token}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	for _, test := range []struct {
+		name      string
+		cursor    string
+		pages     map[string]page
+		exp       int
+		expCursor string
+		requests  int
+	}{
+		{"partial page", "", map[string]page{"": {"a", 10}}, 10, "a", 1},
+		{"full pages", "a", map[string]page{"a": {"b", 100}, "b": {"c", 100}, "c": {"d", 0}}, 200, "d", 3},
+		{"unchanged cursor", "a", map[string]page{"a": {"b", 100}, "b": {"b", 100}}, 200, "b", 2},
+		{"empty cursor", "a", map[string]page{"a": {"", 100}}, 100, "a", 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			pages, requested = test.pages, nil
+			notifications, cursor, err := cl.NotificationsSince(ctx, test.cursor)
+			switch {
+			case err != nil:
+				t.Fatalf("expected no error, got: %v", err)
+			case len(notifications) != test.exp || cursor != test.expCursor:
+				t.Errorf("expected %d notifications and cursor %q, got: %d %q", test.exp, test.expCursor, len(notifications), cursor)
+			case len(requested) != test.requests:
+				t.Errorf("expected %d requests, got: %q", test.requests, requested)
+			}
+		})
+	}
+}
+
+func TestChannelHistory(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// messages, most recent first
+	var messages []*nkapi.ChannelMessage
+	for i := 5; i > 0; i-- {
+		messages = append(messages, &nkapi.ChannelMessage{ChannelId: "c1", MessageId: "m" + strconv.Itoa(i)})
+	}
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v2/channel/c1" || req.URL.Query().Get("forward") != "false" {
+			http.NotFound(w, req)
+			return
+		}
+		limit, _ := strconv.Atoi(req.URL.Query().Get("limit"))
+		start, _ := strconv.Atoi(req.URL.Query().Get("cursor"))
+		end := start + limit
+		res := new(nkapi.ChannelMessageList)
+		if end < len(messages) {
+			res.NextCursor = strconv.Itoa(end)
+		} else {
+			end = len(messages)
+		}
+		res.Messages = messages[start:end]
+		buf, _ := protojson.Marshal(res)
+		_, _ = w.Write(buf)
+	}))
+	defer hs.Close()
+	cl := nakama.New(nakama.WithURL(hs.URL))
+	token := newToken(time.Now().Add(time.Hour))
+	if err := cl.SessionStart(&nakama.SessionResponse{Token: token, RefreshToken: token}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	ids := func(messages []*nkapi.ChannelMessage) []string {
+		var ids []string
+		for _, msg := range messages {
+			ids = append(ids, msg.MessageId)
+		}
+		return ids
+	}
+	// page
+	switch res, err := cl.ChannelMessagesList(ctx, "c1", 2, false, ""); {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case fmt.Sprint(ids(res.Messages)) != "[m5 m4]" || res.NextCursor != "2":
+		t.Errorf("expected m5 and m4, got: %v %q", ids(res.Messages), res.NextCursor)
+	}
+	// pager
+	var paged []string
+	p := cl.ChannelHistory("c1", 2)
+	for p.Next(ctx) {
+		paged = append(paged, ids(p.Page().Messages)...)
+	}
+	if err := p.Err(); err != nil || fmt.Sprint(paged) != "[m5 m4 m3 m2 m1]" {
+		t.Errorf("expected all messages, got: %v %v", paged, err)
+	}
+	// history followed by live messages
+	srv := newTestServer(t)
+	srv.Respond("channel_join", &rtapi.Envelope{
+		Message: &rtapi.Envelope_Channel{Channel: &rtapi.Channel{Id: "c1"}},
+	})
+	conn := newTestConn(t, srv)
+	h, err := conn.ChannelJoinHandle(ctx, "room", nakama.ChannelJoinRoom, true, false)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	hctx, hcancel := context.WithCancel(ctx)
+	defer hcancel()
+	ch, err := h.MessagesWithHistory(hctx, cl, 3)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	for _, msg := range []*nkapi.ChannelMessage{
+		// already in the history
+		{ChannelId: "c1", MessageId: "m5"},
+		{ChannelId: "c2", MessageId: "other"},
+		{ChannelId: "c1", MessageId: "m6"},
+	} {
+		if err := srv.Notify(ctx, &rtapi.Envelope{Message: &rtapi.Envelope_ChannelMessage{ChannelMessage: msg}}); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+	var received []string
+	for len(received) < 4 {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("expected messages, got: %v", received)
+		case msg := <-ch:
+			received = append(received, msg.MessageId)
+		}
+	}
+	if fmt.Sprint(received) != "[m3 m4 m5 m6]" {
+		t.Errorf("expected history and live messages, got: %v", received)
+	}
+	// closing the context closes the channel
+	hcancel()
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected messages closed after the context is closed")
+	case msg, ok := <-ch:
+		if ok {
+			t.Errorf("expected no message, got: %v", msg)
+		}
+	}
+}
+
+func TestDispatchPool(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	conn := newTestConn(t, srv, nakama.WithConnDispatchPool(4, 256, nil))
+	// received are the values received for each message type and key
+	var mu sync.Mutex
+	received := make(map[string][]string)
+	add := func(key, v string) {
+		// slow callbacks, so that workers run concurrently
+		time.Sleep(time.Duration(rand.Intn(100)) * time.Microsecond)
+		mu.Lock()
+		defer mu.Unlock()
+		received[key] = append(received[key], v)
+	}
+	conn.OnMatchData(ctx, func(msg *nakama.MatchDataMsg) {
+		add("match."+msg.MatchId, string(msg.Data))
+	})
+	conn.OnChannelMessage(ctx, func(msg *nakama.ChannelMessageMsg) {
+		add("channel."+msg.ChannelId, msg.Content)
+	})
+	conn.OnPartyData(ctx, func(msg *nakama.PartyDataMsg) {
+		add("party."+msg.PartyId, string(msg.Data))
+	})
+	conn.OnStreamData(ctx, func(msg *nakama.StreamDataMsg) {
+		add("stream."+msg.Stream.GetSubject(), msg.Data)
+	})
+	waitSession(ctx, t, srv)
+	const count = 50
+	keys := []string{"a", "b", "c"}
+	for i := 0; i < count; i++ {
+		v := strconv.Itoa(i)
+		for _, key := range keys {
+			for _, env := range []*rtapi.Envelope{
+				{Message: &rtapi.Envelope_MatchData{MatchData: &rtapi.MatchData{MatchId: key, Data: []byte(v)}}},
+				{Message: &rtapi.Envelope_ChannelMessage{ChannelMessage: &nkapi.ChannelMessage{ChannelId: key, Content: v}}},
+				{Message: &rtapi.Envelope_PartyData{PartyData: &rtapi.PartyData{PartyId: key, Data: []byte(v)}}},
+				{Message: &rtapi.Envelope_StreamData{StreamData: &rtapi.StreamData{Stream: &rtapi.Stream{Subject: key}, Data: v}}},
+			} {
+				if err := srv.Notify(ctx, env); err != nil {
+					t.Fatalf("expected no error, got: %v", err)
+				}
+			}
+		}
+	}
+	// responses are dispatched by the connection while workers are busy
+	if err := conn.Ping(ctx); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	for {
+		mu.Lock()
+		n := 0
+		for _, l := range received {
+			n += len(l)
+		}
+		mu.Unlock()
+		if n == count*len(keys)*4 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("expected %d notifications, got: %d", count*len(keys)*4, n)
+		case <-time.After(time.Millisecond):
+		}
+	}
+	var exp []string
+	for i := 0; i < count; i++ {
+		exp = append(exp, strconv.Itoa(i))
+	}
+	for key, l := range received {
+		if fmt.Sprint(l) != fmt.Sprint(exp) {
+			t.Errorf("expected %s notifications in order, got: %v", key, l)
+		}
+	}
+}
+
+func TestDispatchPoolOverflow(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	var mu sync.Mutex
+	var overflowed []string
+	conn := newTestConn(t, srv, nakama.WithConnDispatchPool(1, 1, func(env *rtapi.Envelope) {
+		mu.Lock()
+		defer mu.Unlock()
+		overflowed = append(overflowed, string(env.GetMatchData().GetData()))
+	}))
+	// the worker blocks in the first callback
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	var data []string
+	conn.OnMatchData(ctx, func(msg *nakama.MatchDataMsg) {
+		mu.Lock()
+		data = append(data, string(msg.Data))
+		mu.Unlock()
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+	})
+	waitSession(ctx, t, srv)
+	notify := func(v string) {
+		t.Helper()
+		if err := srv.Notify(ctx, &rtapi.Envelope{
+			Message: &rtapi.Envelope_MatchData{MatchData: &rtapi.MatchData{MatchId: "m1", Data: []byte(v)}},
+		}); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+	notify("1")
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected callback started")
+	case <-started:
+	}
+	// 2 is queued, and 3 overflows
+	notify("2")
+	notify("3")
+	// responses are dispatched inline while the worker is blocked
+	if err := conn.Ping(ctx); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	mu.Lock()
+	if fmt.Sprint(overflowed) != "[3]" {
+		t.Errorf("expected 3 overflowed, got: %v", overflowed)
+	}
+	mu.Unlock()
+	close(release)
+	for {
+		if err := conn.Ping(ctx); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		mu.Lock()
+		n := len(data)
+		mu.Unlock()
+		if n == 2 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("expected queued notification dispatched")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(data) != "[1 2]" {
+		t.Errorf("expected 1 and 2 dispatched, got: %v", data)
+	}
+}
+
+func TestPriority(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	srv.Respond("match_data_send", &rtapi.Envelope{})
+	srv.Respond("status_update", &rtapi.Envelope{})
+	srv.Handle("rpc", func(_ *Session, env *rtapi.Envelope) (*rtapi.Envelope, error) {
+		return env, nil
+	})
+	conn := newTestConn(t, srv, nakama.WithConnWriteBuffer(8))
+	// block the connection's run loop in a callback, so that the lanes fill
+	started, release := make(chan struct{}), make(chan struct{})
+	conn.OnMatchData(ctx, func(*nakama.MatchDataMsg) {
+		close(started)
+		<-release
+	})
+	waitSession(ctx, t, srv)
+	if err := srv.Notify(ctx, &rtapi.Envelope{
+		Message: &rtapi.Envelope_MatchData{MatchData: &rtapi.MatchData{MatchId: "m1"}},
+	}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected callback started")
+	case <-started:
+	}
+	sent := len(srv.Received())
+	errc := make(chan error, 8)
+	f := func(err error) {
+		errc <- err
+	}
+	// low and normal lanes
+	conn.StatusUpdateAsync(ctx, "s1", f)
+	conn.StatusUpdateAsync(ctx, "s2", f)
+	conn.RpcAsync(ctx, "n1", "", nil, f)
+	conn.RpcAsync(ctx, "n2", "", nil, f)
+	// overridden priorities
+	conn.MatchDataSendAsync(nakama.Prioritize(ctx, nakama.PriorityLow), "m1", 1, []byte("low"), true, nil, f)
+	conn.RpcAsync(nakama.Prioritize(ctx, nakama.PriorityRealtime), "realtime", "", nil, f)
+	time.Sleep(50 * time.Millisecond)
+	// realtime lane
+	conn.MatchDataSendAsync(ctx, "m1", 1, []byte("realtime"), true, nil, f)
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	for i := 0; i < 7; i++ {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("expected response, got: %v", ctx.Err())
+		case err := <-errc:
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+		}
+	}
+	// messages are written realtime first, then normal, then low
+	var written []string
+	priority := nakama.PriorityRealtime
+	for _, env := range srv.Received()[sent:] {
+		var name string
+		var p nakama.Priority
+		switch Type(env) {
+		case "match_data_send":
+			name = string(env.GetMatchDataSend().GetData())
+			if p = nakama.PriorityRealtime; name == "low" {
+				p = nakama.PriorityLow
+			}
+		case "rpc":
+			name = env.GetRpc().GetId()
+			if p = nakama.PriorityNormal; name == "realtime" {
+				p = nakama.PriorityRealtime
+			}
+		case "status_update":
+			name, p = env.GetStatusUpdate().GetStatus().GetValue(), nakama.PriorityLow
+		default:
+			continue
+		}
+		written = append(written, name)
+		if p < priority {
+			t.Errorf("expected %s written before lower priority messages", name)
+		}
+		priority = p
+	}
+	if len(written) != 7 {
+		t.Errorf("expected 7 messages written, got: %v", written)
+	}
+}
+
+func TestStreamHandle(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := newTestServer(t)
+	conn := newTestConn(t, srv)
+	stream := nakama.Stream{Mode: 10, Subject: "subject", Subcontext: "subcontext", Label: "label"}
+	h := conn.StreamHandle(ctx, stream, &rtapi.UserPresence{UserId: "u0", SessionId: "s0"})
+	var mu sync.Mutex
+	var data, devices, users []string
+	var events int
+	h.OnData(func(msg *nakama.StreamDataMsg) {
+		mu.Lock()
+		defer mu.Unlock()
+		if msg.StreamId() != stream {
+			t.Errorf("expected stream %v, got: %v", stream, msg.StreamId())
+		}
+		data = append(data, msg.Data)
+	})
+	h.OnPresenceEvent(func(*nakama.StreamPresenceEventMsg) {
+		mu.Lock()
+		defer mu.Unlock()
+		events++
+	})
+	ch := h.Data()
+	// typed decoding
+	nakama.OnStreamDataDecode(ctx, conn, stream, nakama.ProtojsonCodec, func(v *nkapi.AccountDevice, _ *nakama.StreamDataMsg) {
+		mu.Lock()
+		defer mu.Unlock()
+		devices = append(devices, v.GetId())
+	})
+	type user struct {
+		Id string `json:"id"`
+	}
+	nakama.OnStreamDataDecode(ctx, conn, stream, nakama.JsonCodec, func(v user, _ *nakama.StreamDataMsg) {
+		mu.Lock()
+		defer mu.Unlock()
+		users = append(users, v.Id)
+	})
+	waitSession(ctx, t, srv)
+	streamData := func(stream nakama.Stream, data string) *rtapi.Envelope {
+		return &rtapi.Envelope{Message: &rtapi.Envelope_StreamData{StreamData: &rtapi.StreamData{Stream: stream.Proto(), Data: data}}}
+	}
+	// streams differing by mode, subject, subcontext and label
+	other := []nakama.Stream{
+		{Mode: 11, Subject: "subject", Subcontext: "subcontext", Label: "label"},
+		{Mode: 10, Subject: "other", Subcontext: "subcontext", Label: "label"},
+		{Mode: 10, Subject: "subject", Subcontext: "other", Label: "label"},
+		{Mode: 10, Subject: "subject", Subcontext: "subcontext", Label: "other"},
+	}
+	envs := []*rtapi.Envelope{
+		streamData(stream, `{"id":"a"}`),
+		// not decodable
+		streamData(stream, `not json`),
+		{Message: &rtapi.Envelope_StreamPresenceEvent{StreamPresenceEvent: &rtapi.StreamPresenceEvent{
+			Stream: stream.Proto(),
+			Joins:  []*rtapi.UserPresence{{UserId: "u1", SessionId: "s1"}},
+			Leaves: []*rtapi.UserPresence{{UserId: "u0", SessionId: "s0"}},
+		}}},
+	}
+	for _, s := range other {
+		envs = append(envs, streamData(s, `{"id":"other"}`), &rtapi.Envelope{Message: &rtapi.Envelope_StreamPresenceEvent{StreamPresenceEvent: &rtapi.StreamPresenceEvent{
+			Stream: s.Proto(),
+			Joins:  []*rtapi.UserPresence{{UserId: "u2", SessionId: "s2"}},
+		}}})
+	}
+	envs = append(envs, streamData(stream, `{"id":"b"}`))
+	for _, env := range envs {
+		if err := srv.Notify(ctx, env); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+	// the ping response is received after the stream messages
+	if err := conn.Ping(ctx); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	mu.Lock()
+	switch {
+	case fmt.Sprint(data) != `[{"id":"a"} not json {"id":"b"}]`:
+		t.Errorf("expected only the stream's data, got: %v", data)
+	case fmt.Sprint(devices) != "[a b]" || fmt.Sprint(users) != "[a b]":
+		t.Errorf("expected decoded a and b, got: %v %v", devices, users)
+	case events != 1:
+		t.Errorf("expected 1 presence event, got: %d", events)
+	case h.Roster().Len() != 1 || !h.Roster().Contains("s1"):
+		t.Errorf("expected presence s1, got: %v", h.Presences())
+	}
+	mu.Unlock()
+	for _, exp := range []string{`{"id":"a"}`, `not json`, `{"id":"b"}`} {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("expected stream data")
+		case msg := <-ch:
+			if msg.Data != exp {
+				t.Errorf("expected %s, got: %s", exp, msg.Data)
+			}
+		}
+	}
+	// decode
+	msg := &nakama.StreamDataMsg{StreamData: rtapi.StreamData{Data: `{"id":"c"}`}}
+	var u user
+	if err := msg.Decode(nakama.JsonCodec, &u); err != nil || u.Id != "c" {
+		t.Errorf("expected c, got: %v %v", u, err)
+	}
+	msg.Data = "not json"
+	if err := msg.Decode(nakama.JsonCodec, &u); err == nil || !strings.Contains(err.Error(), "unable to decode stream data") {
+		t.Errorf("expected decode error, got: %v", err)
+	}
+	// closing the handle closes the data channel
+	h.Close()
+	select {
+	case <-ctx.Done():
+		t.Fatalf("expected data closed after closing")
+	case _, ok := <-ch:
+		if ok {
+			t.Errorf("expected no data")
+		}
+	}
+}
+
+func TestDialOptions(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv := NewServer(WithTLS())
+	defer srv.Close()
+	// without the server's root CA the handshake fails
+	if _, err := nakama.NewConn(ctx, nakama.WithConnUrl(srv.URL()), nakama.WithConnToken("token")); err == nil {
+		t.Fatalf("expected error dialing without the root CA")
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	var proxied atomic.Bool
+	_ = newTestConn(t, srv,
+		nakama.WithConnTLSConfig(&tls.Config{RootCAs: pool}),
+		nakama.WithConnDialHeaders(http.Header{"X-Test": []string{"test"}}),
+		nakama.WithConnSubprotocols("p1", "p2"),
+		nakama.WithConnProxy(func(*http.Request) (*url.URL, error) {
+			proxied.Store(true)
+			return nil, nil
+		}),
+	)
+	waitSession(ctx, t, srv)
+	sess := srv.Sessions()[0]
+	switch {
+	case sess.Header.Get("X-Test") != "test":
+		t.Errorf("expected dial header, got: %v", sess.Header)
+	case sess.Header.Get("Sec-WebSocket-Protocol") != "p1,p2":
+		t.Errorf("expected subprotocols p1,p2, got: %q", sess.Header.Get("Sec-WebSocket-Protocol"))
+	case !proxied.Load():
+		t.Errorf("expected proxy func to be called")
+	}
+}
+
+func TestTypes(t *testing.T) {
+	ts := time.Date(2022, 10, 15, 12, 30, 0, 500, time.UTC)
+	p := &rtapi.UserPresence{UserId: "u1", SessionId: "s1", Username: "bob", Persistence: true, Status: wrapperspb.String("away")}
+	tests := []struct {
+		name string
+		msg  proto.Message
+		// want is the expected round tripped message, when not msg
+		want proto.Message
+		conv func(proto.Message) (interface{}, proto.Message)
+		json string
+	}{
+		{
+			name: "presence",
+			msg:  p,
+			conv: func(msg proto.Message) (interface{}, proto.Message) {
+				v := nakama.PresenceOf(msg.(*rtapi.UserPresence))
+				return v, v.Proto()
+			},
+			json: `{"user_id":"u1","session_id":"s1","username":"bob","persistence":true,"status":"away"}`,
+		},
+		{
+			name: "presence nil status",
+			msg:  &rtapi.UserPresence{UserId: "u1", SessionId: "s1"},
+			conv: func(msg proto.Message) (interface{}, proto.Message) {
+				v := nakama.PresenceOf(msg.(*rtapi.UserPresence))
+				return v, v.Proto()
+			},
+			json: `{"user_id":"u1","session_id":"s1","username":""}`,
+		},
+		{
+			name: "presence empty status",
+			msg:  &rtapi.UserPresence{UserId: "u1", SessionId: "s1", Status: wrapperspb.String("")},
+			// an empty status is not distinguished from no status
+			want: &rtapi.UserPresence{UserId: "u1", SessionId: "s1"},
+			conv: func(msg proto.Message) (interface{}, proto.Message) {
+				v := nakama.PresenceOf(msg.(*rtapi.UserPresence))
+				return v, v.Proto()
+			},
+			json: `{"user_id":"u1","session_id":"s1","username":""}`,
+		},
+		{
+			name: "channel message",
+			msg: &nkapi.ChannelMessage{
+				ChannelId:  "c1",
+				MessageId:  "m1",
+				Code:       wrapperspb.Int32(2),
+				SenderId:   "u1",
+				Username:   "bob",
+				Content:    `{"a":1}`,
+				CreateTime: timestamppb.New(ts),
+				UpdateTime: timestamppb.New(ts.Add(time.Second)),
+				Persistent: wrapperspb.Bool(true),
+				RoomName:   "room",
+			},
+			conv: func(msg proto.Message) (interface{}, proto.Message) {
+				v := nakama.ChannelMessageOf(msg.(*nkapi.ChannelMessage))
+				return v, v.Proto()
+			},
+			json: `{"channel_id":"c1","message_id":"m1","code":2,"sender_id":"u1","username":"bob","content":"{\"a\":1}",` +
+				`"create_time":"2022-10-15T12:30:00.0000005Z","update_time":"2022-10-15T12:30:01.0000005Z","persistent":true,"room_name":"room"}`,
+		},
+		{
+			name: "channel message nil timestamps",
+			msg:  &nkapi.ChannelMessage{ChannelId: "c1", Code: wrapperspb.Int32(0), Persistent: wrapperspb.Bool(false)},
+			conv: func(msg proto.Message) (interface{}, proto.Message) {
+				v := nakama.ChannelMessageOf(msg.(*nkapi.ChannelMessage))
+				return v, v.Proto()
+			},
+			json: `{"channel_id":"c1","message_id":"","code":0,"sender_id":"","username":"","content":"",` +
+				`"create_time":"0001-01-01T00:00:00Z","update_time":"0001-01-01T00:00:00Z","persistent":false}`,
+		},
+		{
+			name: "match data",
+			msg:  &rtapi.MatchData{MatchId: "m1", Presence: p, OpCode: 3, Data: []byte("hi"), Reliable: true},
+			conv: func(msg proto.Message) (interface{}, proto.Message) {
+				v := nakama.MatchDataOf(msg.(*rtapi.MatchData))
+				return v, v.Proto()
+			},
+			json: `{"match_id":"m1","presence":{"user_id":"u1","session_id":"s1","username":"bob","persistence":true,"status":"away"},` +
+				`"op_code":3,"data":"aGk=","reliable":true}`,
+		},
+		{
+			name: "match data nil presence",
+			msg:  &rtapi.MatchData{MatchId: "m1", OpCode: 3},
+			conv: func(msg proto.Message) (interface{}, proto.Message) {
+				v := nakama.MatchDataOf(msg.(*rtapi.MatchData))
+				return v, v.Proto()
+			},
+			json: `{"match_id":"m1","op_code":3,"data":null,"reliable":false}`,
+		},
+		{
+			name: "party data",
+			msg:  &rtapi.PartyData{PartyId: "p1", Presence: p, OpCode: 4, Data: []byte("hi")},
+			conv: func(msg proto.Message) (interface{}, proto.Message) {
+				v := nakama.PartyDataOf(msg.(*rtapi.PartyData))
+				return v, v.Proto()
+			},
+			json: `{"party_id":"p1","presence":{"user_id":"u1","session_id":"s1","username":"bob","persistence":true,"status":"away"},` +
+				`"op_code":4,"data":"aGk="}`,
+		},
+		{
+			name: "user",
+			msg: &nkapi.User{
+				Id:          "u1",
+				Username:    "bob",
+				DisplayName: "Bob",
+				SteamId:     "steam",
+				Online:      true,
+				EdgeCount:   5,
+				CreateTime:  timestamppb.New(ts),
+				AppleId:     "apple",
+			},
+			conv: func(msg proto.Message) (interface{}, proto.Message) {
+				v := nakama.UserOf(msg.(*nkapi.User))
+				return v, v.Proto()
+			},
+			json: `{"id":"u1","username":"bob","display_name":"Bob","steam_id":"steam","online":true,"edge_count":5,` +
+				`"create_time":"2022-10-15T12:30:00.0000005Z","update_time":"0001-01-01T00:00:00Z","apple_id":"apple"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v, msg := test.conv(test.msg)
+			want := test.want
+			if want == nil {
+				want = test.msg
+			}
+			if !proto.Equal(msg, want) {
+				t.Errorf("expected %v, got: %v", want, msg)
+			}
+			buf, err := json.Marshal(v)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if s := string(buf); s != test.json {
+				t.Errorf("expected %s, got: %s", test.json, s)
+			}
+		})
+	}
+	// nil messages convert to nil
+	switch {
+	case nakama.PresenceOf(nil) != nil,
+		nakama.ChannelMessageOf(nil) != nil,
+		nakama.MatchDataOf(nil) != nil,
+		nakama.PartyDataOf(nil) != nil,
+		nakama.UserOf(nil) != nil:
+		t.Errorf("expected nil for nil messages")
+	case (*nakama.Presence)(nil).Proto() != nil,
+		(*nakama.ChannelMessage)(nil).Proto() != nil,
+		(*nakama.MatchData)(nil).Proto() != nil,
+		(*nakama.PartyData)(nil).Proto() != nil,
+		(*nakama.User)(nil).Proto() != nil:
+		t.Errorf("expected nil protos for nil values")
+	}
+}
+
+// waitSession waits for the server to register the connection's session.
+func waitSession(ctx context.Context, t testing.TB, srv *Server) {
+	t.Helper()
+	for len(srv.Sessions()) == 0 {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("expected session, got: %v", ctx.Err())
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func BenchmarkMatchData(b *testing.B) {
+	for _, format := range []string{"protobuf", "json"} {
+		b.Run(format, func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			srv := NewServer()
+			defer srv.Close()
+			conn, err := nakama.NewConn(
+				ctx,
+				nakama.WithConnUrl(srv.URL()),
+				nakama.WithConnToken("token"),
+				nakama.WithConnFormat(format),
+			)
+			if err != nil {
+				b.Fatalf("expected no error, got: %v", err)
+			}
+			defer conn.Close()
+			received := make(chan struct{}, 64)
+			conn.OnMatchData(ctx, func(*nakama.MatchDataMsg) {
+				received <- struct{}{}
+			})
+			env := &rtapi.Envelope{
+				Message: &rtapi.Envelope_MatchData{
+					MatchData: &rtapi.MatchData{
+						MatchId: "match",
+						OpCode:  1,
+						Data:    make([]byte, 64),
+					},
+				},
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := srv.Notify(ctx, env); err != nil {
+					b.Fatalf("expected no error, got: %v", err)
+				}
+				<-received
+			}
+		})
+	}
+}
+
+func TestNotificationInbox(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var cursors []string
+	deleted := make(chan []string, 1)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.Method == "GET" && req.URL.Path == "/v2/notification":
+			cursor := req.URL.Query().Get("cacheableCursor")
+			cursors = append(cursors, cursor)
+			if cursor == "" {
+				_, _ = w.Write([]byte(`{"notifications":[{"id":"n1"},{"id":"n2"}],"cacheable_cursor":"c1"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"notifications":[{"id":"n2"},{"id":"n3"}],"cacheable_cursor":"c2"}`))
+		case req.Method == "DELETE" && req.URL.Path == "/v2/notification":
+			deleted <- req.URL.Query()["ids"]
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer api.Close()
+	srv := newTestServer(t)
+	cl := nakama.New(nakama.WithURL(api.URL))
+	token := newToken(time.Now().Add(time.Hour))
+	if err := cl.SessionStart(&nakama.SessionResponse{Token: token, RefreshToken: token}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	conn, err := cl.NewConn(ctx, nakama.WithConnUrl(srv.URL()))
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	defer conn.Close()
+	inbox := conn.NotificationInbox(ctx, cl, "")
+	defer inbox.Close()
+	var mu sync.Mutex
+	var delivered, saved []string
+	inbox.OnNotification(func(n *nakama.Notification) {
+		mu.Lock()
+		defer mu.Unlock()
+		delivered = append(delivered, n.Id)
+	})
+	inbox.OnCursor(func(cursor string) {
+		mu.Lock()
+		defer mu.Unlock()
+		saved = append(saved, cursor)
+	})
+	if err := inbox.Sync(ctx); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	// realtime notifications already delivered are not repeated
+	if err := srv.Notify(ctx, &rtapi.Envelope{
+		Message: &rtapi.Envelope_Notifications{
+			Notifications: &rtapi.Notifications{
+				Notifications: []*nkapi.Notification{{Id: "n2"}, {Id: "n4"}},
+			},
+		},
+	}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	// the ping response is received after the notifications
+	if err := conn.Ping(ctx); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if err := inbox.Sync(ctx); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	mu.Lock()
+	switch {
+	case fmt.Sprint(delivered) != "[n1 n2 n4 n3]":
+		t.Errorf("expected n1 n2 n4 n3 delivered once, got: %v", delivered)
+	case fmt.Sprint(cursors) != "[ c1]":
+		t.Errorf("expected sync after each cursor, got: %q", cursors)
+	case fmt.Sprint(saved) != "[c1 c2]" || inbox.Cursor() != "c2":
+		t.Errorf("expected cursors c1 c2, got: %v %s", saved, inbox.Cursor())
+	}
+	mu.Unlock()
+	if err := inbox.Consume(ctx, "n1", "n4"); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if ids := <-deleted; fmt.Sprint(ids) != "[n1 n4]" {
+		t.Errorf("expected n1 n4 deleted, got: %v", ids)
+	}
+	var unconsumed []string
+	for _, n := range inbox.Unconsumed() {
+		unconsumed = append(unconsumed, n.Id)
+	}
+	if fmt.Sprint(unconsumed) != "[n2 n3]" {
+		t.Errorf("expected n2 n3 unconsumed, got: %v", unconsumed)
+	}
+}
+
+func TestLeaderboardView(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	pages := []string{
+		`{"records":[{"owner_id":"a","rank":"1","score":"30"},{"owner_id":"b","rank":"2","score":"20"},{"owner_id":"e","rank":"3","score":"10"},{"owner_id":"c","rank":"4","score":"5"}]}`,
+		`{"records":[{"owner_id":"b","rank":"1","score":"40"},{"owner_id":"a","rank":"2","score":"30"},{"owner_id":"e","rank":"3","score":"15"},{"owner_id":"d","rank":"4","score":"1"}]}`,
+	}
+	var requests int
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v2/leaderboard/board/owner/a" {
+			http.NotFound(w, req)
+			return
+		}
+		_, _ = w.Write([]byte(pages[requests]))
+		requests++
+	}))
+	defer api.Close()
+	cl := nakama.New(nakama.WithURL(api.URL))
+	token := newToken(time.Now().Add(time.Hour))
+	if err := cl.SessionStart(&nakama.SessionResponse{Token: token, RefreshToken: token}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	v := cl.LeaderboardView(ctx, nakama.LeaderboardRecordsAroundOwner("board", "a"), 0)
+	defer v.Close()
+	var dispatched []string
+	v.OnChange(func(change *nakama.LeaderboardChange) {
+		dispatched = append(dispatched, change.Type.String()+" "+change.Record.OwnerId)
+	})
+	// the first refresh loads the records without changes
+	if changes, err := v.Refresh(ctx); err != nil || len(changes) != 0 || len(v.Records()) != 4 {
+		t.Fatalf("expected 4 records and no changes, got: %v %v", changes, err)
+	}
+	changes, err := v.Refresh(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	var got []string
+	for _, change := range changes {
+		got = append(got, change.Type.String()+" "+change.Record.OwnerId)
+	}
+	exp := "RankUp b, RankDown a, ScoreChanged e, EntryNew d, EntryRemoved c"
+	switch {
+	case strings.Join(got, ", ") != exp:
+		t.Errorf("expected %q, got: %q", exp, strings.Join(got, ", "))
+	case strings.Join(dispatched, ", ") != exp:
+		t.Errorf("expected %q dispatched, got: %q", exp, strings.Join(dispatched, ", "))
+	case changes[2].Prev.GetScore() != 10 || changes[2].Record.GetScore() != 15:
+		t.Errorf("expected score change from 10 to 15, got: %v", changes[2])
+	}
+}
+
+func TestTournamentSchedule(t *testing.T) {
+	base := time.Unix(1_700_000_000, 0)
+	at := func(d time.Duration) uint32 {
+		return uint32(base.Add(d).Unix())
+	}
+	tournament := &nkapi.Tournament{
+		StartTime:   timestamppb.New(base),
+		EndTime:     timestamppb.New(base.Add(90 * time.Minute)),
+		Duration:    3600,
+		StartActive: at(time.Hour),
+		EndActive:   at(2 * time.Hour),
+		MaxSize:     10,
+		Size:        5,
+	}
+	s := nakama.TournamentScheduleOf(tournament)
+	if s.Duration != time.Hour || !s.EndActive.Equal(base.Add(2*time.Hour)) || s.Full {
+		t.Fatalf("expected schedule converted, got: %+v", s)
+	}
+	tests := []struct {
+		name      string
+		now       time.Duration
+		active    bool
+		remaining time.Duration
+	}{
+		{"before start", -time.Minute, false, 0},
+		{"before active window", 30 * time.Minute, false, 0},
+		{"active window start", time.Hour, true, 30 * time.Minute},
+		// the tournament ends before the active window
+		{"active window", 80 * time.Minute, true, 10 * time.Minute},
+		{"end", 90 * time.Minute, false, 0},
+		{"after active window", 3 * time.Hour, false, 0},
+	}
+	for _, test := range tests {
+		now := base.Add(test.now)
+		if active := s.IsActive(now); active != test.active {
+			t.Errorf("%s: expected active %t, got: %t", test.name, test.active, active)
+		}
+		if joinable := s.IsJoinable(now); joinable != test.active {
+			t.Errorf("%s: expected joinable %t, got: %t", test.name, test.active, joinable)
+		}
+		if remaining := s.Remaining(now); remaining != test.remaining {
+			t.Errorf("%s: expected remaining %v, got: %v", test.name, test.remaining, remaining)
+		}
+	}
+	// full tournaments are active, but not joinable
+	tournament.Size = 10
+	if s := nakama.TournamentScheduleOf(tournament); !s.Full || !s.IsActive(base.Add(time.Hour)) || s.IsJoinable(base.Add(time.Hour)) {
+		t.Errorf("expected full tournament not joinable, got: %+v", s)
+	}
+	// without an end, the active window is unbounded
+	if s := nakama.TournamentScheduleOf(&nkapi.Tournament{StartTime: timestamppb.New(base)}); !s.IsActive(base.Add(time.Hour)) || s.Remaining(base.Add(time.Hour)) != 0 {
+		t.Errorf("expected active tournament without remaining time, got: %+v", s)
+	}
+}
+
+func TestEnvelopeAllocs(t *testing.T) {
+	// guards against allocation regressions on the match data hot path
+	env := benchEnvelope()
+	buf, err := nakama.ProtoCodec.Marshal(env)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if n := testing.AllocsPerRun(100, func() {
+		_, _ = nakama.ProtoCodec.Marshal(env)
+	}); n > 1 {
+		t.Errorf("expected at most 1 marshal allocation, got: %v", n)
+	}
+	res := new(rtapi.Envelope)
+	if n := testing.AllocsPerRun(100, func() {
+		res.Reset()
+		_ = nakama.ProtoCodec.Unmarshal(buf, res)
+	}); n > 10 {
+		t.Errorf("expected at most 10 unmarshal allocations, got: %v", n)
+	}
+}
+
+func BenchmarkSendMatchData(b *testing.B) {
+	for _, format := range []string{"protobuf", "json"} {
+		b.Run(format, func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			srv, conn := newPipeConn(ctx, b, nakama.WithConnFormat(format))
+			defer srv.Close()
+			defer conn.Close()
+			srv.Respond("match_data_send", &rtapi.Envelope{})
+			data := make([]byte, 64)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := conn.MatchDataSend(ctx, "match", 1, data, false); err != nil {
+					b.Fatalf("expected no error, got: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRecvNotify(b *testing.B) {
+	for _, format := range []string{"protobuf", "json"} {
+		b.Run(format, func(b *testing.B) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			srv, conn := newPipeConn(ctx, b, nakama.WithConnFormat(format))
+			defer srv.Close()
+			defer conn.Close()
+			received := make(chan struct{}, 64)
+			conn.OnNotifications(ctx, func(*nakama.NotificationsMsg) {
+				received <- struct{}{}
+			})
+			waitSession(ctx, b, srv)
+			sess := srv.Sessions()[0]
+			env := &rtapi.Envelope{
+				Message: &rtapi.Envelope_Notifications{
+					Notifications: &rtapi.Notifications{
+						Notifications: []*nkapi.Notification{
+							{Id: "id", Subject: "subject", Content: `{"reward":100}`, Code: 1, SenderId: "sender"},
+						},
+					},
+				},
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := sess.Send(ctx, env); err != nil {
+					b.Fatalf("expected no error, got: %v", err)
+				}
+				<-received
+			}
+		})
+	}
+}
+
+func BenchmarkEnvelopeMarshal(b *testing.B) {
+	env := benchEnvelope()
+	for _, c := range benchCodecs() {
+		b.Run(c.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := c.codec.Marshal(env); err != nil {
+					b.Fatalf("expected no error, got: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkEnvelopeUnmarshal(b *testing.B) {
+	for _, c := range benchCodecs() {
+		b.Run(c.name, func(b *testing.B) {
+			buf, err := c.codec.Marshal(benchEnvelope())
+			if err != nil {
+				b.Fatalf("expected no error, got: %v", err)
+			}
+			env := new(rtapi.Envelope)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				env.Reset()
+				if err := c.codec.Unmarshal(buf, env); err != nil {
+					b.Fatalf("expected no error, got: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// benchEnvelope returns a match data envelope, as sent at a high rate.
+func benchEnvelope() *rtapi.Envelope {
+	return &rtapi.Envelope{
+		Message: &rtapi.Envelope_MatchData{
+			MatchData: &rtapi.MatchData{
+				MatchId:  "2c3b9c5c-6a0e-4a4e-9b3e-6d2f1c4a7e8b.nakama",
+				Presence: &rtapi.UserPresence{UserId: "user", SessionId: "session", Username: "username"},
+				OpCode:   1,
+				Data:     make([]byte, 64),
+				Reliable: true,
+			},
+		},
+	}
+}
+
+// benchCodecs returns the envelope codecs to benchmark.
+func benchCodecs() []struct {
+	name  string
+	codec nakama.EnvelopeCodec
+} {
+	return []struct {
+		name  string
+		codec nakama.EnvelopeCodec
+	}{
+		{"protobuf", nakama.ProtoCodec},
+		{"json", jsonCodec{}},
+	}
+}
+
+// jsonCodec is a protojson envelope codec, as used with the json format.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(env *rtapi.Envelope) ([]byte, error) {
+	return protojson.Marshal(env)
+}
+
+func (jsonCodec) Unmarshal(buf []byte, env *rtapi.Envelope) error {
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(buf, env)
+}
+
+// newTestServer creates a mock server logging to the test, closed when the
+// test completes.
+func newTestServer(t testing.TB) *Server {
+	t.Helper()
+	srv := NewServer(WithLogger(t.Logf))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newTestConn creates a connection to the server, closed when the test
+// completes, before the server is closed.
+func newTestConn(t testing.TB, srv *Server, opts ...nakama.ConnOption) *nakama.Conn {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	conn, err := nakama.NewConn(ctx, append([]nakama.ConnOption{
+		nakama.WithConnUrl(srv.URL()),
+		nakama.WithConnToken("token"),
+	}, opts...)...)
+	if err != nil {
+		cancel()
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+		cancel()
+	})
+	return conn
+}
+
+// newPipeConn creates a mock server served on an in-memory listener, and a
+// connection to the server, to benchmark without the network stack.
+func newPipeConn(ctx context.Context, tb testing.TB, opts ...nakama.ConnOption) (*Server, *nakama.Conn) {
+	tb.Helper()
+	l := newPipeListener()
+	srv := NewServer(WithListener(l))
+	cl := nakama.New(nakama.WithHttpClient(&http.Client{
+		Transport: &http.Transport{DialContext: l.DialContext},
+	}))
+	conn, err := cl.NewConn(ctx, append([]nakama.ConnOption{
+		nakama.WithConnUrl(srv.URL()),
+		nakama.WithConnToken("token"),
+	}, opts...)...)
+	if err != nil {
+		srv.Close()
+		tb.Fatalf("expected no error, got: %v", err)
+	}
+	return srv, conn
+}
+
+// pipeListener is an in-memory listener, accepting connections dialed with
+// DialContext.
+type pipeListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+// newPipeListener creates an in-memory listener.
+func newPipeListener() *pipeListener {
+	return &pipeListener{
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+// Accept satisfies the net.Listener interface.
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case nc := <-l.conns:
+		return nc, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close satisfies the net.Listener interface.
+func (l *pipeListener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+	})
+	return nil
+}
+
+// Addr satisfies the net.Listener interface.
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+// DialContext dials the listener, ignoring the address.
+func (l *pipeListener) DialContext(ctx context.Context, _, _ string) (net.Conn, error) {
+	client, server := net.Pipe()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-l.done:
+		return nil, net.ErrClosed
+	case l.conns <- server:
+		return client, nil
+	}
+}
+
+// pipeAddr is the address of a pipe listener.
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
+
+func newToken(exp time.Time) string {
+	buf, _ := json.Marshal(map[string]interface{}{"exp": exp.Unix()})
+	return "e30." + base64.RawURLEncoding.EncodeToString(buf) + ".sig"
+}
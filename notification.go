@@ -0,0 +1,157 @@
+package nakama
+
+import (
+	"context"
+	"sync"
+)
+
+// NotificationInbox tracks a user's notifications, combining the realtime
+// notifications received by a connection with the notifications retrieved
+// with the client. Notifications are delivered once, by id, and remain in
+// the inbox until consumed. Notifications missed while disconnected are
+// retrieved when the connection is reopened.
+type NotificationInbox struct {
+	cl         *Client
+	conn       *Conn
+	ctx        context.Context
+	cancel     func()
+	cursor     string
+	seen       map[string]bool
+	unconsumed []*Notification
+	mu         sync.Mutex
+	sync       sync.Mutex
+
+	notificationHandlers callbacks[*Notification]
+	cursorHandlers       callbacks[string]
+}
+
+// NotificationInbox creates a notification inbox, retrieving the
+// notifications after the cacheable cursor (such as a cursor previously
+// persisted from an OnCursor callback). When the cacheable cursor is empty,
+// all notifications are retrieved. The inbox's callbacks are removed when the
+// context is closed, or the inbox is closed.
+//
+// Add callbacks with OnNotification, and then call Sync to deliver the
+// retrieved notifications.
+func (conn *Conn) NotificationInbox(ctx context.Context, cl *Client, cacheableCursor string) *NotificationInbox {
+	ctx, cancel := context.WithCancel(ctx)
+	inbox := &NotificationInbox{
+		cl:     cl,
+		conn:   conn,
+		ctx:    ctx,
+		cancel: cancel,
+		cursor: cacheableCursor,
+		seen:   make(map[string]bool),
+	}
+	conn.OnNotifications(ctx, func(msg *NotificationsMsg) {
+		inbox.add(msg.Notifications.GetNotifications())
+	})
+	conn.OnConnect(ctx, func() {
+		go func() {
+			if err := inbox.Sync(ctx); err != nil && ctx.Err() == nil {
+				conn.logger.Log(LevelError, "unable to sync notifications", "err", err)
+			}
+		}()
+	})
+	return inbox
+}
+
+// add adds the notifications not yet seen, dispatching them to the
+// notification callbacks.
+func (inbox *NotificationInbox) add(notifications []*Notification) {
+	var added []*Notification
+	inbox.mu.Lock()
+	for _, n := range notifications {
+		if inbox.seen[n.Id] {
+			continue
+		}
+		inbox.seen[n.Id] = true
+		inbox.unconsumed = append(inbox.unconsumed, n)
+		added = append(added, n)
+	}
+	inbox.mu.Unlock()
+	for _, n := range added {
+		inbox.notificationHandlers.dispatch(n)
+	}
+}
+
+// Sync retrieves the notifications after the inbox's cacheable cursor,
+// delivering the notifications not yet seen, and updating the cursor.
+func (inbox *NotificationInbox) Sync(ctx context.Context) error {
+	inbox.sync.Lock()
+	defer inbox.sync.Unlock()
+	notifications, cursor, err := inbox.cl.NotificationsSince(ctx, inbox.Cursor())
+	if err != nil {
+		return err
+	}
+	inbox.add(notifications)
+	inbox.mu.Lock()
+	changed := cursor != inbox.cursor
+	inbox.cursor = cursor
+	inbox.mu.Unlock()
+	if changed {
+		inbox.cursorHandlers.dispatch(cursor)
+	}
+	return nil
+}
+
+// Cursor returns the inbox's cacheable cursor.
+func (inbox *NotificationInbox) Cursor() string {
+	inbox.mu.Lock()
+	defer inbox.mu.Unlock()
+	return inbox.cursor
+}
+
+// Unconsumed returns the notifications not yet consumed, in the order they
+// were received.
+func (inbox *NotificationInbox) Unconsumed() []*Notification {
+	inbox.mu.Lock()
+	defer inbox.mu.Unlock()
+	return append([]*Notification(nil), inbox.unconsumed...)
+}
+
+// Consume deletes the notifications, removing them from the inbox.
+func (inbox *NotificationInbox) Consume(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := inbox.cl.DeleteNotifications(ctx, ids...); err != nil {
+		return err
+	}
+	consumed := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		consumed[id] = true
+	}
+	inbox.mu.Lock()
+	defer inbox.mu.Unlock()
+	l := make([]*Notification, 0, len(inbox.unconsumed))
+	for _, n := range inbox.unconsumed {
+		if !consumed[n.Id] {
+			l = append(l, n)
+		}
+	}
+	inbox.unconsumed = l
+	for id := range consumed {
+		inbox.seen[id] = true
+	}
+	return nil
+}
+
+// OnNotification adds a callback for notifications delivered to the inbox.
+// Each notification is delivered once. The callback is removed when the inbox
+// is closed.
+func (inbox *NotificationInbox) OnNotification(f func(*Notification)) {
+	inbox.notificationHandlers.add(inbox.ctx, f)
+}
+
+// OnCursor adds a callback for changes to the inbox's cacheable cursor, such
+// as for persisting the cursor. The callback is removed when the inbox is
+// closed.
+func (inbox *NotificationInbox) OnCursor(f func(string)) {
+	inbox.cursorHandlers.add(inbox.ctx, f)
+}
+
+// Close removes the inbox's callbacks.
+func (inbox *NotificationInbox) Close() {
+	inbox.cancel()
+}
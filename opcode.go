@@ -0,0 +1,180 @@
+package nakama
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// OpCodeRegistry maps match data op codes to payload types, encoding and
+// decoding match data payloads. Register op codes with RegisterOpCode or
+// RegisterOpCodeCodec.
+type OpCodeRegistry struct {
+	ops map[OpType]*opCode
+	rw  sync.RWMutex
+}
+
+// opCode is a registered op code.
+type opCode struct {
+	encode func(interface{}) ([]byte, error)
+	decode func([]byte) (interface{}, error)
+}
+
+// NewOpCodeRegistry creates a op code registry.
+func NewOpCodeRegistry() *OpCodeRegistry {
+	return &OpCodeRegistry{
+		ops: make(map[OpType]*opCode),
+	}
+}
+
+// RegisterOpCode registers the op code's payload type T with the encoder and
+// decoder, replacing any previous registration of the op code.
+func RegisterOpCode[T any](r *OpCodeRegistry, op OpType, encode func(T) ([]byte, error), decode func([]byte) (T, error)) {
+	r.rw.Lock()
+	defer r.rw.Unlock()
+	r.ops[op] = &opCode{
+		encode: func(v interface{}) ([]byte, error) {
+			z, ok := v.(T)
+			if !ok {
+				var t T
+				return nil, fmt.Errorf("op code %d expects %T, got: %T", int32(op), t, v)
+			}
+			return encode(z)
+		},
+		decode: func(buf []byte) (interface{}, error) {
+			return decode(buf)
+		},
+	}
+}
+
+// RegisterOpCodeCodec registers the op code's payload type T, encoded and
+// decoded with the codec.
+func RegisterOpCodeCodec[T any](r *OpCodeRegistry, op OpType, codec RpcCodec) {
+	RegisterOpCode(r, op, func(v T) ([]byte, error) {
+		return codec.Marshal(v)
+	}, func(buf []byte) (T, error) {
+		var v T
+		err := codec.Unmarshal(buf, &v)
+		return v, err
+	})
+}
+
+// get returns the registered op code.
+func (r *OpCodeRegistry) get(op OpType) (*opCode, error) {
+	r.rw.RLock()
+	defer r.rw.RUnlock()
+	if o, ok := r.ops[op]; ok {
+		return o, nil
+	}
+	return nil, fmt.Errorf("op code %d is not registered", int32(op))
+}
+
+// Registered returns true when the op code is registered.
+func (r *OpCodeRegistry) Registered(op OpType) bool {
+	_, err := r.get(op)
+	return err == nil
+}
+
+// Encode encodes v as the op code's payload.
+func (r *OpCodeRegistry) Encode(op OpType, v interface{}) ([]byte, error) {
+	o, err := r.get(op)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := o.encode(v)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode op code %d: %w", int32(op), err)
+	}
+	return buf, nil
+}
+
+// Decode decodes the op code's payload.
+func (r *OpCodeRegistry) Decode(op OpType, buf []byte) (interface{}, error) {
+	o, err := r.get(op)
+	if err != nil {
+		return nil, err
+	}
+	v, err := o.decode(buf)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode op code %d: %w", int32(op), err)
+	}
+	return v, nil
+}
+
+// WithConnOpCodes is a nakama websocket connection option to set the op code
+// registry used by match handles to encode and decode typed match data (see
+// MatchHandle.SendTyped and MatchHandle.OnTyped).
+func WithConnOpCodes(r *OpCodeRegistry) ConnOption {
+	return func(conn *Conn) {
+		conn.opCodes = r
+	}
+}
+
+// opCodeRegistry returns the connection's op code registry, or an error when
+// no registry was set.
+func (conn *Conn) opCodeRegistry() (*OpCodeRegistry, error) {
+	if conn.opCodes == nil {
+		return nil, fmt.Errorf("no op code registry (see WithConnOpCodes)")
+	}
+	return conn.opCodes, nil
+}
+
+// SendTyped encodes v as the op code's payload with the connection's op code
+// registry, and sends it to the match. When presences are provided, the data
+// is only sent to those presences.
+func (h *MatchHandle) SendTyped(ctx context.Context, op OpType, v interface{}, reliable bool, presences ...*UserPresenceMsg) error {
+	r, err := h.conn.opCodeRegistry()
+	if err != nil {
+		return err
+	}
+	buf, err := r.Encode(op, v)
+	if err != nil {
+		return err
+	}
+	return h.SendData(ctx, op, buf, reliable, presences...)
+}
+
+// OnTyped adds a callback for data with a registered op code received from
+// the match, decoded with the connection's op code registry. Data with
+// unregistered op codes, or that cannot be decoded, is logged and dropped.
+// The callback is removed when the match is left.
+func (h *MatchHandle) OnTyped(f func(interface{}, *MatchDataMsg)) {
+	h.OnData(func(msg *MatchDataMsg) {
+		if v, ok := h.decode(msg); ok {
+			f(v, msg)
+		}
+	})
+}
+
+// decode decodes the match data with the connection's op code registry,
+// logging errors.
+func (h *MatchHandle) decode(msg *MatchDataMsg) (interface{}, bool) {
+	r, err := h.conn.opCodeRegistry()
+	if err == nil {
+		var v interface{}
+		if v, err = r.Decode(OpType(msg.OpCode), msg.Data); err == nil {
+			return v, true
+		}
+	}
+	h.conn.logger.Log(LevelError, "unable to decode match data", "match_id", msg.MatchId, "op_code", msg.OpCode, "err", err)
+	return nil, false
+}
+
+// OnMatchDataDecode adds a callback for data with the op code received from
+// the match, decoded as T with the connection's op code registry. Data that
+// cannot be decoded as T is logged and dropped. The callback is removed when
+// the match is left.
+func OnMatchDataDecode[T any](h *MatchHandle, op OpType, f func(T, *MatchDataMsg)) {
+	h.OnOpCode(op, func(msg *MatchDataMsg) {
+		v, ok := h.decode(msg)
+		if !ok {
+			return
+		}
+		z, ok := v.(T)
+		if !ok {
+			h.conn.logger.Log(LevelError, "unexpected match data type", "match_id", msg.MatchId, "op_code", msg.OpCode, "type", fmt.Sprintf("%T", v))
+			return
+		}
+		f(z, msg)
+	})
+}
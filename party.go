@@ -0,0 +1,319 @@
+package nakama
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/rtapi"
+)
+
+// PartyHandle is a handle to a joined party, tracking the party's leader,
+// members, and pending join requests, and scoping callbacks to the party.
+type PartyHandle struct {
+	conn      *Conn
+	party     *PartyMsg
+	ctx       context.Context
+	cancel    func()
+	leader    *rtapi.UserPresence
+	presences *PresenceSet
+	requests  *PresenceSet
+	rw        sync.RWMutex
+
+	leaderHandlers  callbacks[*rtapi.UserPresence]
+	joinHandlers    callbacks[*rtapi.UserPresence]
+	leaveHandlers   callbacks[*rtapi.UserPresence]
+	requestHandlers callbacks[*rtapi.UserPresence]
+}
+
+// PartyHandle creates a handle for a joined party, such as the party received
+// by an OnParty callback after joining. The handle's callbacks are removed
+// when the context is closed, or the party is left or closed.
+func (conn *Conn) PartyHandle(ctx context.Context, party *PartyMsg) *PartyHandle {
+	ctx, cancel := context.WithCancel(ctx)
+	h := &PartyHandle{
+		conn:      conn,
+		party:     party,
+		ctx:       ctx,
+		cancel:    cancel,
+		leader:    party.Leader,
+		presences: NewPresenceSet(party.Presences...),
+		requests:  NewPresenceSet(),
+	}
+	conn.OnPartyPresenceEvent(ctx, h.updatePresences)
+	conn.OnPartyLeader(ctx, h.updateLeader)
+	conn.OnPartyJoinRequest(ctx, h.updateRequests)
+	return h
+}
+
+// PartyCreateHandle sends a message to create a party, returning a handle to
+// the party.
+func (conn *Conn) PartyCreateHandle(ctx context.Context, open bool, maxSize int) (*PartyHandle, error) {
+	party, err := conn.PartyCreate(ctx, open, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	return conn.PartyHandle(context.Background(), party), nil
+}
+
+// updatePresences updates the party's members from a presence event.
+func (h *PartyHandle) updatePresences(msg *PartyPresenceEventMsg) {
+	if msg.PartyId != h.party.PartyId {
+		return
+	}
+	h.presences.Apply(msg)
+	h.requests.Remove(append(append([]*rtapi.UserPresence(nil), msg.Joins...), msg.Leaves...)...)
+	for _, p := range msg.Joins {
+		h.joinHandlers.dispatch(p)
+	}
+	for _, p := range msg.Leaves {
+		h.leaveHandlers.dispatch(p)
+	}
+}
+
+// updateLeader updates the party's leader.
+func (h *PartyHandle) updateLeader(msg *PartyLeaderMsg) {
+	if msg.PartyId != h.party.PartyId {
+		return
+	}
+	h.rw.Lock()
+	h.leader = msg.Presence
+	h.rw.Unlock()
+	h.leaderHandlers.dispatch(msg.Presence)
+}
+
+// updateRequests updates the party's pending join requests.
+func (h *PartyHandle) updateRequests(msg *PartyJoinRequestMsg) {
+	if msg.PartyId != h.party.PartyId {
+		return
+	}
+	h.requests.Add(msg.Presences...)
+	for _, p := range msg.Presences {
+		h.requestHandlers.dispatch(p)
+	}
+}
+
+// removeRequest removes a pending join request.
+func (h *PartyHandle) removeRequest(presence *UserPresenceMsg) {
+	h.requests.Remove(&presence.UserPresence)
+}
+
+// Id returns the party id.
+func (h *PartyHandle) Id() string {
+	return h.party.PartyId
+}
+
+// Party returns the party message the handle was created with.
+func (h *PartyHandle) Party() *PartyMsg {
+	return h.party
+}
+
+// Self returns the user's presence in the party.
+func (h *PartyHandle) Self() *rtapi.UserPresence {
+	return h.party.Self
+}
+
+// Leader returns the party's current leader.
+func (h *PartyHandle) Leader() *rtapi.UserPresence {
+	h.rw.RLock()
+	defer h.rw.RUnlock()
+	return h.leader
+}
+
+// Presences returns the party's current members.
+func (h *PartyHandle) Presences() []*rtapi.UserPresence {
+	return h.presences.Presences()
+}
+
+// Roster returns the set of the party's current members.
+func (h *PartyHandle) Roster() *PresenceSet {
+	return h.presences
+}
+
+// JoinRequests returns the party's pending join requests received while the
+// handle was open.
+func (h *PartyHandle) JoinRequests() []*rtapi.UserPresence {
+	return h.requests.Presences()
+}
+
+// Accept sends a message to accept a pending join request.
+func (h *PartyHandle) Accept(ctx context.Context, presence *UserPresenceMsg) error {
+	if err := h.conn.PartyAccept(ctx, h.party.PartyId, presence); err != nil {
+		return err
+	}
+	h.removeRequest(presence)
+	return nil
+}
+
+// Remove sends a message to remove a member, or reject a pending join
+// request.
+func (h *PartyHandle) Remove(ctx context.Context, presence *UserPresenceMsg) error {
+	if err := h.conn.PartyRemove(ctx, h.party.PartyId, presence); err != nil {
+		return err
+	}
+	h.removeRequest(presence)
+	return nil
+}
+
+// Promote sends a message to promote a member to party leader.
+func (h *PartyHandle) Promote(ctx context.Context, presence *UserPresenceMsg) (*PartyLeaderMsg, error) {
+	return h.conn.PartyPromote(ctx, h.party.PartyId, presence)
+}
+
+// DataSend sends data to all party members.
+func (h *PartyHandle) DataSend(ctx context.Context, opCode OpType, data []byte) error {
+	return PartyDataSend(h.party.PartyId, opCode, data).Send(ctx, h.conn)
+}
+
+// MatchmakerAdd sends a message to add the party to the matchmaker pool.
+func (h *PartyHandle) MatchmakerAdd(ctx context.Context, query string, minCount, maxCount int) (*PartyMatchmakerTicketMsg, error) {
+	return h.conn.PartyMatchmakerAdd(ctx, h.party.PartyId, query, minCount, maxCount)
+}
+
+// OnData adds a callback for data received from the party. The callback is
+// removed when the party is left.
+func (h *PartyHandle) OnData(f func(*PartyDataMsg)) {
+	id := h.party.PartyId
+	h.conn.OnPartyData(h.ctx, func(msg *PartyDataMsg) {
+		if msg.PartyId == id {
+			f(msg)
+		}
+	})
+}
+
+// OnLeaderChange adds a callback for party leadership changes. The callback
+// is removed when the party is left.
+func (h *PartyHandle) OnLeaderChange(f func(*rtapi.UserPresence)) {
+	h.leaderHandlers.add(h.ctx, f)
+}
+
+// OnMemberJoin adds a callback for members joining the party. The callback is
+// removed when the party is left.
+func (h *PartyHandle) OnMemberJoin(f func(*rtapi.UserPresence)) {
+	h.joinHandlers.add(h.ctx, f)
+}
+
+// OnMemberLeave adds a callback for members leaving the party. The callback
+// is removed when the party is left.
+func (h *PartyHandle) OnMemberLeave(f func(*rtapi.UserPresence)) {
+	h.leaveHandlers.add(h.ctx, f)
+}
+
+// OnJoinRequest adds a callback for join requests received by the party. The
+// callback is removed when the party is left.
+func (h *PartyHandle) OnJoinRequest(f func(*rtapi.UserPresence)) {
+	h.requestHandlers.add(h.ctx, f)
+}
+
+// Invite invites the user to the party, with the PartyInviteRpc rpc.
+func (h *PartyHandle) Invite(ctx context.Context, userId string) error {
+	req := partyInvite{PartyId: h.party.PartyId, UserId: userId}
+	if err := h.conn.Rpc(ctx, PartyInviteRpc, req, nil); err != nil {
+		return fmt.Errorf("unable to invite user %s to party %s: %w", userId, h.party.PartyId, err)
+	}
+	return nil
+}
+
+// Done returns a channel that is closed when the party is left or closed.
+func (h *PartyHandle) Done() <-chan struct{} {
+	return h.ctx.Done()
+}
+
+// Leave sends a message to leave the party, removing the handle's callbacks.
+func (h *PartyHandle) Leave(ctx context.Context) error {
+	defer h.cancel()
+	return h.conn.PartyLeave(ctx, h.party.PartyId)
+}
+
+// Close sends a message to close the party, removing the handle's callbacks.
+func (h *PartyHandle) Close(ctx context.Context) error {
+	defer h.cancel()
+	return h.conn.PartyClose(ctx, h.party.PartyId)
+}
+
+// PartyInviteRpc is the id of the rpc used to invite a user to a party. The
+// rpc is not built into nakama, and must be registered by the server runtime,
+// taking a json payload of {"party_id": string, "user_id": string},
+// returning an empty payload, and sending the user a notification with the
+// PartyInviteCode code and the payload as the notification's content.
+const PartyInviteRpc = "party_invite"
+
+// PartyInviteCode is the notification code of party invites (see
+// PartyInviteRpc).
+const PartyInviteCode = 100
+
+// partyInvite is the payload of a party invite.
+type partyInvite struct {
+	PartyId string `json:"party_id"`
+	UserId  string `json:"user_id,omitempty"`
+}
+
+// PartyInvite is a party invite received as a notification (see
+// OnPartyInvite).
+type PartyInvite struct {
+	// PartyId is the id of the party the user was invited to.
+	PartyId string
+	// SenderId is the id of the user that sent the invite.
+	SenderId string
+	// Notification is the invite's notification.
+	Notification *Notification
+
+	conn *Conn
+}
+
+// OnPartyInvite adds a callback for party invites received as notifications
+// with the PartyInviteCode code. The callback is removed when the context is
+// closed.
+func (conn *Conn) OnPartyInvite(ctx context.Context, f func(*PartyInvite)) {
+	conn.OnNotifications(ctx, func(msg *NotificationsMsg) {
+		for _, n := range msg.Notifications.GetNotifications() {
+			if n.Code != PartyInviteCode {
+				continue
+			}
+			var v partyInvite
+			if err := json.Unmarshal([]byte(n.Content), &v); err != nil || v.PartyId == "" {
+				conn.logger.Log(LevelWarn, "invalid party invite", "id", n.Id, "err", err)
+				continue
+			}
+			f(&PartyInvite{
+				PartyId:      v.PartyId,
+				SenderId:     n.SenderId,
+				Notification: n,
+				conn:         conn,
+			})
+		}
+	})
+}
+
+// Accept sends a message to join the invite's party, and deletes the invite's
+// notification when persistent. The joined party is received by OnParty
+// callbacks, once the join request is accepted when the party is closed.
+func (inv *PartyInvite) Accept(ctx context.Context) error {
+	if err := inv.conn.PartyJoin(ctx, inv.PartyId); err != nil {
+		return fmt.Errorf("unable to accept party invite: %w", err)
+	}
+	return inv.consume(ctx)
+}
+
+// Decline declines the invite, deleting the invite's notification when
+// persistent.
+func (inv *PartyInvite) Decline(ctx context.Context) error {
+	return inv.consume(ctx)
+}
+
+// consume deletes the invite's notification when persistent, with the
+// connection's client.
+func (inv *PartyInvite) consume(ctx context.Context) error {
+	if !inv.Notification.Persistent {
+		return nil
+	}
+	cl, err := inv.conn.client()
+	if err == nil {
+		err = cl.DeleteNotifications(ctx, inv.Notification.Id)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to delete party invite notification: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package nakama
+
+import (
+	"context"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/rtapi"
+)
+
+// PresenceEvent is the interface for presence events, satisfied by match,
+// channel, party, status, and stream presence events.
+type PresenceEvent interface {
+	GetJoins() []*rtapi.UserPresence
+	GetLeaves() []*rtapi.UserPresence
+}
+
+// PresenceChange is a change to a presence set.
+type PresenceChange struct {
+	Joins  []*rtapi.UserPresence
+	Leaves []*rtapi.UserPresence
+}
+
+// GetJoins satisfies the PresenceEvent interface.
+func (change *PresenceChange) GetJoins() []*rtapi.UserPresence {
+	return change.Joins
+}
+
+// GetLeaves satisfies the PresenceEvent interface.
+func (change *PresenceChange) GetLeaves() []*rtapi.UserPresence {
+	return change.Leaves
+}
+
+// PresenceSet is a set of presences, keyed by session id, in the order the
+// presences joined. A presence set is safe for concurrent use.
+type PresenceSet struct {
+	presences []*rtapi.UserPresence
+	rw        sync.RWMutex
+
+	changeHandlers callbacks[*PresenceChange]
+}
+
+// NewPresenceSet creates a presence set with the presences.
+func NewPresenceSet(presences ...*rtapi.UserPresence) *PresenceSet {
+	return &PresenceSet{
+		presences: updatePresences(nil, presences, nil),
+	}
+}
+
+// Apply applies the presence event's joins and leaves, notifying the change
+// callbacks of the presences that joined or left the set.
+func (s *PresenceSet) Apply(ev PresenceEvent) {
+	s.Update(ev.GetJoins(), ev.GetLeaves())
+}
+
+// Update adds the joins and removes the leaves, notifying the change
+// callbacks of the presences that joined or left the set. A presence both
+// joining and leaving is removed.
+func (s *PresenceSet) Update(joins, leaves []*rtapi.UserPresence) {
+	change := new(PresenceChange)
+	s.rw.Lock()
+	for _, p := range leaves {
+		if containsPresence(s.presences, p.SessionId) {
+			change.Leaves = append(change.Leaves, p)
+		}
+	}
+	for _, p := range joins {
+		if !containsPresence(s.presences, p.SessionId) && !containsPresence(leaves, p.SessionId) {
+			change.Joins = append(change.Joins, p)
+		}
+	}
+	s.presences = updatePresences(s.presences, joins, leaves)
+	s.rw.Unlock()
+	if len(change.Joins) != 0 || len(change.Leaves) != 0 {
+		s.changeHandlers.dispatch(change)
+	}
+}
+
+// Add adds the presences.
+func (s *PresenceSet) Add(presences ...*rtapi.UserPresence) {
+	s.Update(presences, nil)
+}
+
+// Remove removes the presences.
+func (s *PresenceSet) Remove(presences ...*rtapi.UserPresence) {
+	s.Update(nil, presences)
+}
+
+// Clear removes all presences.
+func (s *PresenceSet) Clear() {
+	s.Remove(s.Presences()...)
+}
+
+// Presences returns the presences.
+func (s *PresenceSet) Presences() []*rtapi.UserPresence {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	return append([]*rtapi.UserPresence(nil), s.presences...)
+}
+
+// Len returns the number of presences.
+func (s *PresenceSet) Len() int {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	return len(s.presences)
+}
+
+// Get returns the presence for the session id.
+func (s *PresenceSet) Get(sessionId string) (*rtapi.UserPresence, bool) {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	for _, p := range s.presences {
+		if p.SessionId == sessionId {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// Contains returns true when the set contains the session id.
+func (s *PresenceSet) Contains(sessionId string) bool {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	return containsPresence(s.presences, sessionId)
+}
+
+// User returns the presences of the user id.
+func (s *PresenceSet) User(userId string) []*rtapi.UserPresence {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	var presences []*rtapi.UserPresence
+	for _, p := range s.presences {
+		if p.UserId == userId {
+			presences = append(presences, p)
+		}
+	}
+	return presences
+}
+
+// OnChange adds a callback for presences joining or leaving the set. The
+// callback is removed when the context is closed.
+func (s *PresenceSet) OnChange(ctx context.Context, f func(*PresenceChange)) {
+	s.changeHandlers.add(ctx, f)
+}
+
+// Changes returns a channel receiving the presences joining or leaving the
+// set. The channel is closed when the context is closed.
+func (s *PresenceSet) Changes(ctx context.Context, opts ...SubscribeOption) <-chan *PresenceChange {
+	return subscribe(ctx, s.changeHandlers.add, opts...)
+}
+
+// updatePresences returns the presences with the joins added and the leaves
+// removed, matching presences by session id.
+func updatePresences(presences, joins, leaves []*rtapi.UserPresence) []*rtapi.UserPresence {
+	gone := make(map[string]bool, len(leaves)+len(joins))
+	for _, p := range leaves {
+		gone[p.SessionId] = true
+	}
+	for _, p := range joins {
+		gone[p.SessionId] = true
+	}
+	l := make([]*rtapi.UserPresence, 0, len(presences)+len(joins))
+	for _, p := range presences {
+		if !gone[p.SessionId] {
+			l = append(l, p)
+		}
+	}
+	for _, p := range joins {
+		if !containsPresence(leaves, p.SessionId) {
+			l = append(l, p)
+		}
+	}
+	return l
+}
+
+// containsPresence returns true when the presences contain the session id.
+func containsPresence(presences []*rtapi.UserPresence, sessionId string) bool {
+	for _, p := range presences {
+		if p.SessionId == sessionId {
+			return true
+		}
+	}
+	return false
+}
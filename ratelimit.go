@@ -0,0 +1,99 @@
+package nakama
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WithConnRateLimit is a nakama websocket connection option to limit the
+// rate of outgoing messages to msgsPerSec, allowing bursts of up to burst
+// messages. Match data and other messages have separate budgets, each with
+// the rate and burst, so that a burst of match data does not delay other
+// requests (see WithConnMatchDataRateLimit). Send waits for the rate limit
+// before the message is passed to the connection, delaying only the caller
+// instead of tripping the server's rate limits. Messages are not rate limited
+// by default.
+func WithConnRateLimit(msgsPerSec float64, burst int) ConnOption {
+	return func(conn *Conn) {
+		conn.limit = newRateLimiter(msgsPerSec, burst)
+		conn.matchLimit = newRateLimiter(msgsPerSec, burst)
+	}
+}
+
+// WithConnMatchDataRateLimit is a nakama websocket connection option to limit
+// the rate of outgoing match data messages to msgsPerSec, allowing bursts of
+// up to burst messages. See WithConnRateLimit.
+func WithConnMatchDataRateLimit(msgsPerSec float64, burst int) ConnOption {
+	return func(conn *Conn) {
+		conn.matchLimit = newRateLimiter(msgsPerSec, burst)
+	}
+}
+
+// limiter returns the rate limiter for the message.
+func (conn *Conn) limiter(msg EnvelopeBuilder) *rateLimiter {
+	if _, ok := msg.(*MatchDataSendMsg); ok {
+		return conn.matchLimit
+	}
+	return conn.limit
+}
+
+// rateLimiter is a token bucket rate limiter. A nil rate limiter does not
+// limit.
+type rateLimiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	mu     sync.Mutex
+}
+
+// newRateLimiter creates a token bucket rate limiter, with a full bucket.
+// Returns nil when the rate is not positive.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait takes a token, waiting until the token is available or the context
+// is closed, in which case the token is given back. Tokens are reserved when
+// wait is called, so that concurrent callers are delayed in order.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens--
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	case <-t.C:
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package nakama
 
 import (
 	"context"
+	"fmt"
 
 	nkapi "github.com/heroiclabs/nakama-common/api"
 	rtapi "github.com/heroiclabs/nakama-common/rtapi"
@@ -28,29 +29,42 @@ const (
 	ChannelJoinGroup ChannelJoinType = rtapi.ChannelJoin_GROUP
 )
 
-// ErrorCode is the error code type.
-type ErrorCode = rtapi.Error_Code
+// ErrorCode is the realtime error code type. ErrorCode values are errors,
+// matching a RealtimeError with the same code when used with errors.Is.
+type ErrorCode rtapi.Error_Code
 
 // ErrorCode values.
 const (
 	// An unexpected result from the server.
-	ErrRuntimeException ErrorCode = rtapi.Error_RUNTIME_EXCEPTION
+	ErrRuntimeException = ErrorCode(rtapi.Error_RUNTIME_EXCEPTION)
 	// The server received a message which is not recognised.
-	ErrUnrecognizedPlayload ErrorCode = rtapi.Error_UNRECOGNIZED_PAYLOAD
+	ErrUnrecognizedPayload = ErrorCode(rtapi.Error_UNRECOGNIZED_PAYLOAD)
+	// Deprecated: use ErrUnrecognizedPayload.
+	ErrUnrecognizedPlayload = ErrUnrecognizedPayload
 	// A message was expected but contains no content.
-	ErrMissingPayload ErrorCode = rtapi.Error_MISSING_PAYLOAD
+	ErrMissingPayload = ErrorCode(rtapi.Error_MISSING_PAYLOAD)
 	// Fields in the message have an invalid format.
-	ErrBadInput ErrorCode = rtapi.Error_BAD_INPUT
+	ErrBadInput = ErrorCode(rtapi.Error_BAD_INPUT)
 	// The match id was not found.
-	ErrMatchNotFound ErrorCode = rtapi.Error_MATCH_NOT_FOUND
+	ErrMatchNotFound = ErrorCode(rtapi.Error_MATCH_NOT_FOUND)
 	// The match join was rejected.
-	ErrMatchJoinRejected ErrorCode = rtapi.Error_MATCH_JOIN_REJECTED
+	ErrMatchJoinRejected = ErrorCode(rtapi.Error_MATCH_JOIN_REJECTED)
 	// The runtime function does not exist on the server.
-	ErrRuntimeFunctionNotFound ErrorCode = rtapi.Error_RUNTIME_FUNCTION_NOT_FOUND
+	ErrRuntimeFunctionNotFound = ErrorCode(rtapi.Error_RUNTIME_FUNCTION_NOT_FOUND)
 	// The runtime function executed with an error.
-	ErrRuntimeFunctionException ErrorCode = rtapi.Error_RUNTIME_FUNCTION_EXCEPTION
+	ErrRuntimeFunctionException = ErrorCode(rtapi.Error_RUNTIME_FUNCTION_EXCEPTION)
 )
 
+// String satisfies the fmt.Stringer interface.
+func (code ErrorCode) String() string {
+	return rtapi.Error_Code(code).String()
+}
+
+// Error satisfies the error interface.
+func (code ErrorCode) Error() string {
+	return fmt.Sprintf("realtime socket error %s (%d)", code.String(), int(code))
+}
+
 // ChannelMsg is a realtime channel message.
 type ChannelMsg struct {
 	rtapi.Channel
@@ -455,11 +469,11 @@ type MatchJoinMsg struct {
 }
 
 // MatchJoin creates a realtime message to join a match.
-func MatchJoin(token string) *MatchJoinMsg {
+func MatchJoin(matchId string) *MatchJoinMsg {
 	return &MatchJoinMsg{
 		MatchJoin: rtapi.MatchJoin{
-			Id: &rtapi.MatchJoin_Token{
-				Token: token,
+			Id: &rtapi.MatchJoin_MatchId{
+				MatchId: matchId,
 			},
 		},
 	}
@@ -817,6 +831,20 @@ func (msg *PartyCreateMsg) Async(ctx context.Context, conn *Conn, f func(*PartyM
 	}()
 }
 
+// PartyDataMsg is a realtime party data message.
+type PartyDataMsg struct {
+	rtapi.PartyData
+}
+
+// BuildEnvelope satisfies the EnvelopeBuilder interface.
+func (msg *PartyDataMsg) BuildEnvelope() *rtapi.Envelope {
+	return &rtapi.Envelope{
+		Message: &rtapi.Envelope_PartyData{
+			PartyData: &msg.PartyData,
+		},
+	}
+}
+
 // PartyDataSendMsg is a realtime message to send data to a party.
 type PartyDataSendMsg struct {
 	rtapi.PartyDataSend
@@ -1101,6 +1129,20 @@ func (msg *PartyMatchmakerTicketMsg) BuildEnvelope() *rtapi.Envelope {
 	}
 }
 
+// PartyPresenceEventMsg is a realtime party presence event message.
+type PartyPresenceEventMsg struct {
+	rtapi.PartyPresenceEvent
+}
+
+// BuildEnvelope satisfies the EnvelopeBuilder interface.
+func (msg *PartyPresenceEventMsg) BuildEnvelope() *rtapi.Envelope {
+	return &rtapi.Envelope{
+		Message: &rtapi.Envelope_PartyPresenceEvent{
+			PartyPresenceEvent: &msg.PartyPresenceEvent,
+		},
+	}
+}
+
 // PartyPromoteMsg is a realtime message to promote a new party leader.
 type PartyPromoteMsg struct {
 	rtapi.PartyPromote
@@ -1208,13 +1250,13 @@ func (msg *PingMsg) Async(ctx context.Context, conn *Conn, f func(error)) {
 	}()
 }
 
-// rpcMsg is a realtime rpc message.
-type rpcMsg struct {
+// rpcResponseMsg is a realtime rpc response message.
+type rpcResponseMsg struct {
 	nkapi.Rpc
 }
 
 // BuildEnvelope satisfies the EnvelopeBuilder interface.
-func (msg *rpcMsg) BuildEnvelope() *rtapi.Envelope {
+func (msg *rpcResponseMsg) BuildEnvelope() *rtapi.Envelope {
 	return &rtapi.Envelope{
 		Message: &rtapi.Envelope_Rpc{
 			Rpc: &msg.Rpc,
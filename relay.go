@@ -0,0 +1,165 @@
+package nakama
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/rtapi"
+)
+
+// RelaySequencer tags match data sent to a relayed match with a local
+// sequence number, and tracks the sequence numbers of data received from
+// each peer, dropping the echo of the user's own data, and stale or
+// duplicate data.
+type RelaySequencer struct {
+	h      *MatchHandle
+	ctx    context.Context
+	cancel func()
+	seq    uint32
+	send   sync.Mutex
+	peers  map[string]uint32
+	rw     sync.RWMutex
+
+	gapHandlers callbacks[*SequenceGap]
+}
+
+// SequenceGap is a gap in the sequence numbers of data received from a peer,
+// such as when unreliable data was lost.
+type SequenceGap struct {
+	Presence *rtapi.UserPresence
+	// Expected is the next expected sequence number.
+	Expected uint32
+	// Received is the received sequence number.
+	Received uint32
+}
+
+// Missed returns the number of missed sequence numbers.
+func (gap *SequenceGap) Missed() int {
+	return int(gap.Received - gap.Expected)
+}
+
+// RelayedData is match data received from a peer, with its sequence number
+// removed.
+type RelayedData struct {
+	*MatchDataMsg
+	// Seq is the peer's sequence number.
+	Seq uint32
+	// Payload is the data, without the sequence number.
+	Payload []byte
+}
+
+// NewRelaySequencer creates a relay sequencer for the match. The sequencer's
+// callbacks are removed when the match is left, or the sequencer is closed.
+func NewRelaySequencer(h *MatchHandle) *RelaySequencer {
+	ctx, cancel := context.WithCancel(h.ctx)
+	r := &RelaySequencer{
+		h:      h,
+		ctx:    ctx,
+		cancel: cancel,
+		peers:  make(map[string]uint32),
+	}
+	id := h.Id()
+	h.conn.OnMatchPresenceEvent(ctx, func(msg *MatchPresenceEventMsg) {
+		if msg.MatchId != id || len(msg.Leaves) == 0 {
+			return
+		}
+		r.rw.Lock()
+		defer r.rw.Unlock()
+		for _, p := range msg.Leaves {
+			delete(r.peers, p.SessionId)
+		}
+	})
+	return r
+}
+
+// SendData sends the data to the match, prefixed with the next sequence
+// number, returning the sequence number. When presences are provided, the
+// data is only sent to those presences.
+func (r *RelaySequencer) SendData(ctx context.Context, opCode OpType, data []byte, reliable bool, presences ...*UserPresenceMsg) (uint32, error) {
+	r.send.Lock()
+	defer r.send.Unlock()
+	seq := r.seq + 1
+	buf := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(data)), seq)
+	if err := r.h.SendData(ctx, opCode, append(buf, data...), reliable, presences...); err != nil {
+		return 0, err
+	}
+	r.seq = seq
+	return seq, nil
+}
+
+// OnData adds a callback for sequenced data received from peers. The echo of
+// the user's own data, and data with a sequence number not after the peer's
+// last received sequence number, are dropped. The callback is removed when
+// the sequencer is closed.
+//
+// A callback added with OnData tracks the peers' sequence numbers, so only
+// one should be added per sequencer.
+func (r *RelaySequencer) OnData(f func(*RelayedData)) {
+	r.h.conn.OnMatchDataMatch(r.ctx, r.h.Id(), func(msg *MatchDataMsg) {
+		if data, ok := r.recv(msg); ok {
+			f(data)
+		}
+	})
+}
+
+// recv removes the data's sequence number, updating the peer's last received
+// sequence number.
+func (r *RelaySequencer) recv(msg *MatchDataMsg) (*RelayedData, bool) {
+	sessionId := msg.GetPresence().GetSessionId()
+	if self := r.h.Self(); self != nil && sessionId == self.SessionId {
+		return nil, false
+	}
+	if len(msg.Data) < 4 {
+		r.h.conn.logger.Log(LevelWarn, "dropping unsequenced match data", "match_id", msg.MatchId, "op_code", msg.OpCode)
+		return nil, false
+	}
+	seq := binary.BigEndian.Uint32(msg.Data)
+	r.rw.Lock()
+	last, ok := r.peers[sessionId]
+	// compare with serial number arithmetic, so sequence numbers can wrap
+	if ok && int32(seq-last) <= 0 {
+		r.rw.Unlock()
+		return nil, false
+	}
+	r.peers[sessionId] = seq
+	r.rw.Unlock()
+	if ok && seq != last+1 {
+		r.gapHandlers.dispatch(&SequenceGap{
+			Presence: msg.Presence,
+			Expected: last + 1,
+			Received: seq,
+		})
+	}
+	return &RelayedData{
+		MatchDataMsg: msg,
+		Seq:          seq,
+		Payload:      msg.Data[4:],
+	}, true
+}
+
+// OnGap adds a callback for gaps in the sequence numbers received from peers.
+// The callback is removed when the sequencer is closed.
+func (r *RelaySequencer) OnGap(f func(*SequenceGap)) {
+	r.gapHandlers.add(r.ctx, f)
+}
+
+// Seq returns the last sent sequence number.
+func (r *RelaySequencer) Seq() uint32 {
+	r.send.Lock()
+	defer r.send.Unlock()
+	return r.seq
+}
+
+// PeerSeq returns the last sequence number received from the peer's session.
+func (r *RelaySequencer) PeerSeq(sessionId string) (uint32, bool) {
+	r.rw.RLock()
+	defer r.rw.RUnlock()
+	seq, ok := r.peers[sessionId]
+	return seq, ok
+}
+
+// Close removes the sequencer's callbacks.
+func (r *RelaySequencer) Close() {
+	r.cancel()
+}
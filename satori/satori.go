@@ -0,0 +1,229 @@
+// Package satori provides a client for the Satori liveops API, sharing the
+// session and http plumbing of the nakama package.
+package satori
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ascii8/nakama-go"
+)
+
+// Client is a satori client.
+type Client struct {
+	cl      *nakama.Client
+	refresh sync.Mutex
+}
+
+// New creates a satori client, using the nakama client options, such as
+// nakama.WithURL for the satori url, nakama.WithServerKey for the satori api
+// key, and nakama.WithSessionStore. Sessions are refreshed automatically with
+// the satori refresh endpoint.
+func New(opts ...nakama.Option) *Client {
+	return &Client{
+		cl: nakama.New(append(opts, nakama.WithRefreshAuto(false))...),
+	}
+}
+
+// Client returns the underlying nakama client, used for the client's session
+// and http requests.
+func (cl *Client) Client() *nakama.Client {
+	return cl.cl
+}
+
+// Do executes a http request with the session token, refreshing the session
+// when expired. The response is decoded into v with encoding/json, ignoring
+// unknown fields.
+func (cl *Client) Do(ctx context.Context, method, typ string, query url.Values, msg, v interface{}) error {
+	if err := cl.SessionRefresh(ctx); err != nil {
+		return err
+	}
+	if v == nil {
+		return cl.cl.Do(ctx, method, typ, true, query, msg, nil)
+	}
+	var buf []byte
+	if err := cl.cl.Do(ctx, method, typ, true, query, msg, &buf); err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, v)
+}
+
+// Authenticate authenticates the identity, creating the identity when it does
+// not exist, with the default and custom properties.
+func (cl *Client) Authenticate(ctx context.Context, id string, defaultProps, customProps map[string]string) error {
+	req := struct {
+		Id      string            `json:"id"`
+		Default map[string]string `json:"default,omitempty"`
+		Custom  map[string]string `json:"custom,omitempty"`
+	}{id, defaultProps, customProps}
+	res := new(nakama.SessionResponse)
+	if err := cl.cl.Do(ctx, "POST", "v1/authenticate", false, nil, req, res); err != nil {
+		return fmt.Errorf("unable to authenticate: %w", err)
+	}
+	return cl.cl.SessionStart(res)
+}
+
+// SessionRefresh refreshes the session when the session is expired.
+func (cl *Client) SessionRefresh(ctx context.Context) error {
+	cl.refresh.Lock()
+	defer cl.refresh.Unlock()
+	switch {
+	case cl.cl.SessionToken() == "":
+		return fmt.Errorf("unable to refresh session: no active session")
+	case !cl.cl.SessionExpired():
+		return nil
+	case cl.cl.SessionRefreshExpired():
+		return fmt.Errorf("unable to refresh session: refresh token expired")
+	}
+	req := map[string]string{
+		"refresh_token": cl.cl.SessionRefreshToken(),
+	}
+	res := new(nakama.SessionResponse)
+	if err := cl.cl.Do(ctx, "POST", "v1/authenticate/refresh", false, nil, req, res); err != nil {
+		return fmt.Errorf("unable to refresh session: %w", err)
+	}
+	if err := cl.cl.SessionStart(res); err != nil {
+		return fmt.Errorf("unable to refresh session: %w", err)
+	}
+	return nil
+}
+
+// Logout logs out the session.
+func (cl *Client) Logout(ctx context.Context) error {
+	token, refreshToken := cl.cl.SessionToken(), cl.cl.SessionRefreshToken()
+	if token == "" {
+		return nil
+	}
+	req := map[string]string{
+		"token":         token,
+		"refresh_token": refreshToken,
+	}
+	_ = cl.cl.Do(ctx, "POST", "v1/authenticate/logout", true, nil, req, nil)
+	cl.cl.SessionClear()
+	return nil
+}
+
+// Experiment is a satori experiment.
+type Experiment struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Experiments retrieves the identity's experiments, optionally filtered by
+// name.
+func (cl *Client) Experiments(ctx context.Context, names ...string) ([]*Experiment, error) {
+	var res struct {
+		Experiments []*Experiment `json:"experiments"`
+	}
+	if err := cl.Do(ctx, "GET", "v1/experiment", namesQuery(names), nil, &res); err != nil {
+		return nil, fmt.Errorf("unable to retrieve experiments: %w", err)
+	}
+	return res.Experiments, nil
+}
+
+// Flag is a satori feature flag.
+type Flag struct {
+	Name             string `json:"name"`
+	Value            string `json:"value"`
+	ConditionChanged bool   `json:"condition_changed"`
+}
+
+// Flags retrieves the identity's feature flags, optionally filtered by name.
+func (cl *Client) Flags(ctx context.Context, names ...string) ([]*Flag, error) {
+	var res struct {
+		Flags []*Flag `json:"flags"`
+	}
+	if err := cl.Do(ctx, "GET", "v1/flag", namesQuery(names), nil, &res); err != nil {
+		return nil, fmt.Errorf("unable to retrieve flags: %w", err)
+	}
+	return res.Flags, nil
+}
+
+// Flag retrieves the value of the named feature flag, or def when the flag
+// does not exist.
+func (cl *Client) Flag(ctx context.Context, name, def string) (string, error) {
+	flags, err := cl.Flags(ctx, name)
+	if err != nil {
+		return def, err
+	}
+	for _, flag := range flags {
+		if flag.Name == name {
+			return flag.Value, nil
+		}
+	}
+	return def, nil
+}
+
+// LiveEvent is a satori live event.
+type LiveEvent struct {
+	Id                 string `json:"id"`
+	Name               string `json:"name"`
+	Description        string `json:"description"`
+	Value              string `json:"value"`
+	ActiveStartTimeSec int64  `json:"active_start_time_sec,string"`
+	ActiveEndTimeSec   int64  `json:"active_end_time_sec,string"`
+}
+
+// ActiveStart returns when the live event's active window starts.
+func (ev *LiveEvent) ActiveStart() time.Time {
+	return time.Unix(ev.ActiveStartTimeSec, 0)
+}
+
+// ActiveEnd returns when the live event's active window ends.
+func (ev *LiveEvent) ActiveEnd() time.Time {
+	return time.Unix(ev.ActiveEndTimeSec, 0)
+}
+
+// LiveEvents retrieves the identity's active live events, optionally filtered
+// by name.
+func (cl *Client) LiveEvents(ctx context.Context, names ...string) ([]*LiveEvent, error) {
+	var res struct {
+		LiveEvents []*LiveEvent `json:"live_events"`
+	}
+	if err := cl.Do(ctx, "GET", "v1/live-event", namesQuery(names), nil, &res); err != nil {
+		return nil, fmt.Errorf("unable to retrieve live events: %w", err)
+	}
+	return res.LiveEvents, nil
+}
+
+// Event is a satori analytics event.
+type Event struct {
+	Name      string            `json:"name"`
+	Id        string            `json:"id,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Value     string            `json:"value,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// NewEvent creates an event with the current time.
+func NewEvent(name, value string, metadata map[string]string) *Event {
+	return &Event{
+		Name:      name,
+		Value:     value,
+		Metadata:  metadata,
+		Timestamp: time.Now(),
+	}
+}
+
+// Events publishes the events.
+func (cl *Client) Events(ctx context.Context, events ...*Event) error {
+	req := struct {
+		Events []*Event `json:"events"`
+	}{events}
+	if err := cl.Do(ctx, "POST", "v1/event", nil, req, nil); err != nil {
+		return fmt.Errorf("unable to publish events: %w", err)
+	}
+	return nil
+}
+
+// namesQuery returns the query for the names filter.
+func namesQuery(names []string) url.Values {
+	if len(names) == 0 {
+		return nil
+	}
+	return url.Values{"names": names}
+}
@@ -0,0 +1,74 @@
+package satori
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ascii8/nakama-go"
+)
+
+func TestClient(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	token := newToken(time.Now().Add(time.Hour))
+	var events []*Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v1/authenticate":
+			if key, _, _ := req.BasicAuth(); key != "apikey" {
+				http.Error(w, `{"code":16,"message":"bad key"}`, http.StatusUnauthorized)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{"token": token, "refresh_token": token})
+			return
+		}
+		if req.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, `{"code":16,"message":"bad token"}`, http.StatusUnauthorized)
+			return
+		}
+		switch req.URL.Path {
+		case "/v1/flag":
+			_, _ = w.Write([]byte(`{"flags":[{"name":"` + req.URL.Query().Get("names") + `","value":"on","change_reason":{}}]}`))
+		case "/v1/event":
+			var v struct {
+				Events []*Event `json:"events"`
+			}
+			_ = json.NewDecoder(req.Body).Decode(&v)
+			events = v.Events
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer srv.Close()
+	cl := New(
+		nakama.WithURL(srv.URL),
+		nakama.WithServerKey("apikey"),
+	)
+	if err := cl.Authenticate(ctx, "identity", nil, nil); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	switch v, err := cl.Flag(ctx, "feature", "off"); {
+	case err != nil:
+		t.Fatalf("expected no error, got: %v", err)
+	case v != "on":
+		t.Errorf("expected on, got: %q", v)
+	}
+	if err := cl.Events(ctx, NewEvent("level_up", "2", nil)); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(events) != 1 || events[0].Name != "level_up" || events[0].Value != "2" {
+		t.Errorf("expected level_up event, got: %v", events)
+	}
+}
+
+// newToken creates an unsigned jwt token with the expiry.
+func newToken(exp time.Time) string {
+	buf, _ := json.Marshal(map[string]interface{}{"exp": exp.Unix()})
+	return "e30." + base64.RawURLEncoding.EncodeToString(buf) + ".sig"
+}
@@ -0,0 +1,92 @@
+package nakama
+
+import (
+	"context"
+	"time"
+)
+
+// cleanupTimeout is the timeout for leaving or unfollowing after the context
+// passed to a scoped join or follow is closed.
+const cleanupTimeout = 5 * time.Second
+
+// ChannelJoinScoped sends a message to join a chat channel, sending a message
+// to leave the channel when the context is closed, such as for request scoped
+// bots and tests.
+func (conn *Conn) ChannelJoinScoped(ctx context.Context, target string, typ ChannelJoinType, persistence, hidden bool) (*ChannelMsg, error) {
+	channel, err := conn.ChannelJoin(ctx, target, typ, persistence, hidden)
+	if err != nil {
+		return nil, err
+	}
+	id := channel.Id
+	conn.cleanup(ctx, func(ctx context.Context) error {
+		conn.rw.RLock()
+		_, joined := conn.channels[id]
+		conn.rw.RUnlock()
+		if !joined {
+			return nil
+		}
+		return conn.ChannelLeave(ctx, id)
+	})
+	return channel, nil
+}
+
+// MatchJoinScoped sends a message to join a match, sending a message to leave
+// the match when the context is closed.
+func (conn *Conn) MatchJoinScoped(ctx context.Context, matchId string, metadata map[string]string) (*MatchMsg, error) {
+	match, err := conn.MatchJoin(ctx, matchId, metadata)
+	if err != nil {
+		return nil, err
+	}
+	id := match.MatchId
+	conn.cleanup(ctx, func(ctx context.Context) error {
+		conn.rw.RLock()
+		_, joined := conn.matches[id]
+		conn.rw.RUnlock()
+		if !joined {
+			return nil
+		}
+		return conn.MatchLeave(ctx, id)
+	})
+	return match, nil
+}
+
+// StatusFollowScoped sends a message to subscribe to user status updates,
+// sending a message to unfollow the users when the context is closed.
+func (conn *Conn) StatusFollowScoped(ctx context.Context, userIds ...string) (*StatusMsg, error) {
+	status, err := conn.StatusFollow(ctx, userIds...)
+	if err != nil {
+		return nil, err
+	}
+	conn.cleanup(ctx, func(ctx context.Context) error {
+		var followed []string
+		conn.rw.RLock()
+		for _, id := range userIds {
+			if conn.follows[id] {
+				followed = append(followed, id)
+			}
+		}
+		conn.rw.RUnlock()
+		if len(followed) == 0 {
+			return nil
+		}
+		return conn.StatusUnfollow(ctx, followed...)
+	})
+	return status, nil
+}
+
+// cleanup calls f when the context is closed, unless the connection is closed
+// first. Errors are logged.
+func (conn *Conn) cleanup(ctx context.Context, f func(context.Context) error) {
+	go func() {
+		select {
+		case <-conn.done:
+			return
+		case <-ctx.Done():
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+		defer cancel()
+		if err := f(ctx); err != nil {
+			conn.logger.Log(LevelWarn, "unable to clean up", "err", err)
+		}
+	}()
+}
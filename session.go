@@ -0,0 +1,151 @@
+package nakama
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// SessionStore is the interface for persisting session tokens.
+type SessionStore interface {
+	// Load loads the stored session, returning nil when there is no stored
+	// session.
+	Load() (*SessionResponse, error)
+	// Save stores the session.
+	Save(*SessionResponse) error
+	// Clear removes the stored session.
+	Clear() error
+}
+
+// MemorySessionStore is an in-memory session store.
+type MemorySessionStore struct {
+	token        string
+	refreshToken string
+	rw           sync.RWMutex
+}
+
+// NewMemorySessionStore creates a new in-memory session store.
+func NewMemorySessionStore() *MemorySessionStore {
+	return new(MemorySessionStore)
+}
+
+// Load satisfies the SessionStore interface.
+func (store *MemorySessionStore) Load() (*SessionResponse, error) {
+	store.rw.RLock()
+	defer store.rw.RUnlock()
+	if store.token == "" {
+		return nil, nil
+	}
+	return &SessionResponse{
+		Token:        store.token,
+		RefreshToken: store.refreshToken,
+	}, nil
+}
+
+// Save satisfies the SessionStore interface.
+func (store *MemorySessionStore) Save(session *SessionResponse) error {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+	store.token, store.refreshToken = session.Token, session.RefreshToken
+	return nil
+}
+
+// Clear satisfies the SessionStore interface.
+func (store *MemorySessionStore) Clear() error {
+	store.rw.Lock()
+	defer store.rw.Unlock()
+	store.token, store.refreshToken = "", ""
+	return nil
+}
+
+// FileSessionStore is a session store persisting the session tokens to a
+// json file.
+type FileSessionStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileSessionStore creates a new file session store for the path. The
+// file is created (with mode 0600) when the session is first saved.
+func NewFileSessionStore(path string) *FileSessionStore {
+	return &FileSessionStore{
+		path: path,
+	}
+}
+
+// fileSession is the json representation of a stored session.
+type fileSession struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Load satisfies the SessionStore interface.
+func (store *FileSessionStore) Load() (*SessionResponse, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	buf, err := os.ReadFile(store.path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("unable to load session: %w", err)
+	}
+	var s fileSession
+	if err := json.Unmarshal(buf, &s); err != nil {
+		return nil, fmt.Errorf("unable to load session: %w", err)
+	}
+	if s.Token == "" {
+		return nil, nil
+	}
+	return &SessionResponse{
+		Token:        s.Token,
+		RefreshToken: s.RefreshToken,
+	}, nil
+}
+
+// Save satisfies the SessionStore interface. The file is written atomically.
+func (store *FileSessionStore) Save(session *SessionResponse) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	buf, err := json.Marshal(fileSession{
+		Token:        session.Token,
+		RefreshToken: session.RefreshToken,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to save session: %w", err)
+	}
+	dir := filepath.Dir(store.path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("unable to save session: %w", err)
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(store.path)+".*")
+	if err != nil {
+		return fmt.Errorf("unable to save session: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return fmt.Errorf("unable to save session: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("unable to save session: %w", err)
+	}
+	if err := os.Rename(f.Name(), store.path); err != nil {
+		return fmt.Errorf("unable to save session: %w", err)
+	}
+	return nil
+}
+
+// Clear satisfies the SessionStore interface.
+func (store *FileSessionStore) Clear() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if err := os.Remove(store.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("unable to clear session: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,339 @@
+package nakama
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/rtapi"
+)
+
+// Differ computes and applies deltas between encoded states.
+type Differ interface {
+	// Diff returns the delta from prev to next.
+	Diff(prev, next []byte) ([]byte, error)
+	// Patch applies the delta to prev, returning next.
+	Patch(prev, delta []byte) ([]byte, error)
+}
+
+// BinaryDiffer is a Differ encoding the runs of changed bytes.
+var BinaryDiffer Differ = binaryDiffer{}
+
+// binaryDiffer is a binary run differ. A delta is the length of next,
+// followed by each run of changed bytes as its offset from the end of the
+// previous run, its length, and its bytes.
+type binaryDiffer struct{}
+
+// binaryDiffGap is the number of equal bytes that ends a run of changed
+// bytes. Shorter runs of equal bytes are included in the run, as encoding a
+// new run costs at least 2 bytes.
+const binaryDiffGap = 4
+
+// Diff satisfies the Differ interface.
+func (binaryDiffer) Diff(prev, next []byte) ([]byte, error) {
+	delta := binary.AppendUvarint(nil, uint64(len(next)))
+	changed := func(i int) bool {
+		return i >= len(prev) || prev[i] != next[i]
+	}
+	end := 0
+	for i := 0; i < len(next); {
+		if !changed(i) {
+			i++
+			continue
+		}
+		start, equal := i, 0
+		for ; i < len(next) && equal < binaryDiffGap; i++ {
+			if changed(i) {
+				equal = 0
+			} else {
+				equal++
+			}
+		}
+		stop := i - equal
+		delta = binary.AppendUvarint(delta, uint64(start-end))
+		delta = binary.AppendUvarint(delta, uint64(stop-start))
+		delta = append(delta, next[start:stop]...)
+		end = stop
+	}
+	return delta, nil
+}
+
+// Patch satisfies the Differ interface.
+func (binaryDiffer) Patch(prev, delta []byte) ([]byte, error) {
+	r := bytes.NewReader(delta)
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read delta length: %w", err)
+	}
+	next := make([]byte, n)
+	copy(next, prev)
+	end := uint64(0)
+	for r.Len() != 0 {
+		gap, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read delta offset: %w", err)
+		}
+		l, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read delta run: %w", err)
+		}
+		start := end + gap
+		if end = start + l; end > n || end < start {
+			return nil, errors.New("delta run out of range")
+		}
+		if _, err := io.ReadFull(r, next[start:end]); err != nil {
+			return nil, fmt.Errorf("unable to read delta run: %w", err)
+		}
+	}
+	return next, nil
+}
+
+// StateSync synchronizes a state value between the presences of a match,
+// sending snapshots of the encoded state at an interval, and deltas between
+// snapshots. Received snapshots and deltas are reassembled into the state of
+// each sending presence.
+type StateSync[T any] struct {
+	h          *MatchHandle
+	ctx        context.Context
+	cancel     func()
+	snapshotOp OpType
+	deltaOp    OpType
+	codec      RpcCodec
+	differ     Differ
+	interval   time.Duration
+	reliable   bool
+
+	// send is held while sending, and guards the sent state
+	send     sync.Mutex
+	prev     []byte
+	seq      uint32
+	snapshot time.Time
+	resync   atomic.Bool
+
+	mu     sync.Mutex
+	states map[string]*syncState
+
+	stateHandlers callbacks[*SyncedState[T]]
+}
+
+// syncState is the state received from a presence.
+type syncState struct {
+	buf []byte
+	seq uint32
+}
+
+// SyncedState is a state received from a presence.
+type SyncedState[T any] struct {
+	Presence *rtapi.UserPresence
+	State    T
+}
+
+// NewStateSync creates a state sync for the match, sending and receiving
+// snapshots and deltas with the op codes. A snapshot is sent when a presence
+// joins the match. The state sync's callbacks are removed when the match is
+// left, or the state sync is closed.
+func NewStateSync[T any](h *MatchHandle, snapshotOp, deltaOp OpType, opts ...StateSyncOption) *StateSync[T] {
+	ctx, cancel := context.WithCancel(h.ctx)
+	s := &StateSync[T]{
+		h:          h,
+		ctx:        ctx,
+		cancel:     cancel,
+		snapshotOp: snapshotOp,
+		deltaOp:    deltaOp,
+		codec:      JsonCodec,
+		differ:     BinaryDiffer,
+		interval:   time.Second,
+		reliable:   true,
+		states:     make(map[string]*syncState),
+	}
+	for _, o := range opts {
+		o(&stateSyncOptions{
+			codec:    &s.codec,
+			differ:   &s.differ,
+			interval: &s.interval,
+			reliable: &s.reliable,
+		})
+	}
+	id := h.Id()
+	h.conn.OnMatchDataOpCode(ctx, id, snapshotOp, s.recv)
+	h.conn.OnMatchDataOpCode(ctx, id, deltaOp, s.recv)
+	h.conn.OnMatchPresenceEvent(ctx, func(msg *MatchPresenceEventMsg) {
+		if msg.MatchId == id {
+			s.update(msg)
+		}
+	})
+	return s
+}
+
+// update forces a snapshot when presences join the match, and removes the
+// states of presences leaving the match.
+func (s *StateSync[T]) update(msg *MatchPresenceEventMsg) {
+	if len(msg.Joins) != 0 {
+		s.resync.Store(true)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range msg.Leaves {
+		delete(s.states, p.SessionId)
+	}
+}
+
+// Send sends the state to the match, as a snapshot when the snapshot
+// interval has elapsed (or a presence has joined the match), and otherwise
+// as a delta from the previously sent state. Nothing is sent when the state
+// is unchanged between snapshots.
+func (s *StateSync[T]) Send(ctx context.Context, state T) error {
+	buf, err := s.codec.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("unable to encode state: %w", err)
+	}
+	s.send.Lock()
+	defer s.send.Unlock()
+	op, reliable, body := s.snapshotOp, true, buf
+	switch now := time.Now(); {
+	case s.prev == nil, s.resync.Swap(false), now.Sub(s.snapshot) >= s.interval:
+		s.snapshot = now
+	case bytes.Equal(s.prev, buf):
+		return nil
+	default:
+		if body, err = s.differ.Diff(s.prev, buf); err != nil {
+			return fmt.Errorf("unable to diff state: %w", err)
+		}
+		op, reliable = s.deltaOp, s.reliable
+	}
+	// deltas are applied to the state of the previous sequence
+	data := binary.BigEndian.AppendUint32(nil, s.seq+1)
+	data = binary.BigEndian.AppendUint32(data, s.seq)
+	if err := s.h.SendData(ctx, op, append(data, body...), reliable); err != nil {
+		if op == s.snapshotOp {
+			s.resync.Store(true)
+		}
+		return err
+	}
+	s.prev = buf
+	s.seq++
+	return nil
+}
+
+// Resync forces the next sent state to be a snapshot.
+func (s *StateSync[T]) Resync() {
+	s.resync.Store(true)
+}
+
+// recv reassembles a received snapshot or delta, dispatching the state to the
+// state callbacks. Deltas not applying to the last received state are
+// dropped until the next snapshot.
+func (s *StateSync[T]) recv(msg *MatchDataMsg) {
+	if len(msg.Data) < 8 {
+		s.h.conn.logger.Log(LevelError, "invalid state sync message", "match_id", msg.MatchId, "op_code", msg.OpCode)
+		return
+	}
+	seq, base, body := binary.BigEndian.Uint32(msg.Data), binary.BigEndian.Uint32(msg.Data[4:]), msg.Data[8:]
+	key := msg.GetPresence().GetSessionId()
+	s.mu.Lock()
+	prev := s.states[key]
+	switch OpType(msg.OpCode) {
+	case s.snapshotOp:
+		body = append([]byte(nil), body...)
+	case s.deltaOp:
+		if prev == nil || prev.seq != base {
+			s.mu.Unlock()
+			return
+		}
+		var err error
+		if body, err = s.differ.Patch(prev.buf, body); err != nil {
+			s.mu.Unlock()
+			s.h.conn.logger.Log(LevelError, "unable to patch state", "match_id", msg.MatchId, "err", err)
+			return
+		}
+	}
+	s.states[key] = &syncState{buf: body, seq: seq}
+	s.mu.Unlock()
+	var state T
+	if err := s.codec.Unmarshal(body, &state); err != nil {
+		s.h.conn.logger.Log(LevelError, "unable to decode state", "match_id", msg.MatchId, "err", err)
+		return
+	}
+	s.stateHandlers.dispatch(&SyncedState[T]{
+		Presence: msg.Presence,
+		State:    state,
+	})
+}
+
+// State returns the last state received from the session, or from the
+// server for authoritative matches when the session id is empty.
+func (s *StateSync[T]) State(sessionId string) (T, bool) {
+	var state T
+	s.mu.Lock()
+	st := s.states[sessionId]
+	s.mu.Unlock()
+	if st == nil {
+		return state, false
+	}
+	if err := s.codec.Unmarshal(st.buf, &state); err != nil {
+		return state, false
+	}
+	return state, true
+}
+
+// OnState adds a callback for reassembled states received from the match.
+// The callback is removed when the state sync is closed.
+func (s *StateSync[T]) OnState(f func(*SyncedState[T])) {
+	s.stateHandlers.add(s.ctx, f)
+}
+
+// Close removes the state sync's callbacks.
+func (s *StateSync[T]) Close() {
+	s.cancel()
+}
+
+// StateSyncOption is a state sync option.
+type StateSyncOption func(*stateSyncOptions)
+
+// stateSyncOptions are the settable state sync fields, as options cannot be
+// generic.
+type stateSyncOptions struct {
+	codec    *RpcCodec
+	differ   *Differ
+	interval *time.Duration
+	reliable *bool
+}
+
+// WithStateSyncCodec is a state sync option to set the codec used to encode
+// the state. Defaults to JsonCodec.
+func WithStateSyncCodec(codec RpcCodec) StateSyncOption {
+	return func(opts *stateSyncOptions) {
+		*opts.codec = codec
+	}
+}
+
+// WithStateSyncDiffer is a state sync option to set the differ used to
+// compute deltas between encoded states. Defaults to BinaryDiffer.
+func WithStateSyncDiffer(differ Differ) StateSyncOption {
+	return func(opts *stateSyncOptions) {
+		*opts.differ = differ
+	}
+}
+
+// WithStateSyncInterval is a state sync option to set the interval between
+// snapshots. Defaults to 1 second.
+func WithStateSyncInterval(interval time.Duration) StateSyncOption {
+	return func(opts *stateSyncOptions) {
+		*opts.interval = interval
+	}
+}
+
+// WithStateSyncReliable is a state sync option to set whether deltas are sent
+// reliably. Snapshots are always sent reliably. When a delta is lost, the
+// receiver's state is not updated until the next snapshot. Defaults to true.
+func WithStateSyncReliable(reliable bool) StateSyncOption {
+	return func(opts *stateSyncOptions) {
+		*opts.reliable = reliable
+	}
+}
@@ -0,0 +1,138 @@
+package nakama
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ConnStats is a snapshot of a realtime connection's diagnostics, such as for
+// an in-game debug overlay.
+type ConnStats struct {
+	// State is the connection state.
+	State ConnState
+	// MessagesSent are the number of messages sent, by message type.
+	MessagesSent map[string]int
+	// MessagesReceived are the number of messages received, by message type.
+	MessagesReceived map[string]int
+	// BytesSent is the number of bytes sent.
+	BytesSent int64
+	// BytesReceived is the number of bytes received.
+	BytesReceived int64
+	// PendingRequests is the number of requests awaiting a response.
+	PendingRequests int
+	// Reconnects is the number of times the websocket was reopened.
+	Reconnects int
+	// LastError is the last request error or disconnect reason, if any.
+	LastError error
+	// LastErrorTime is when the last error occurred.
+	LastErrorTime time.Time
+	// Uptime is the time since the websocket was last opened, or 0 when not
+	// connected.
+	Uptime time.Duration
+	// RTT is the smoothed round-trip time of the keepalive pings (see
+	// Latency).
+	RTT time.Duration
+}
+
+// Stats returns a snapshot of the connection's diagnostics.
+func (conn *Conn) Stats() *ConnStats {
+	srtt, _ := conn.Latency()
+	conn.rw.RLock()
+	pending := len(conn.l)
+	conn.rw.RUnlock()
+	s := conn.stats.snapshot()
+	s.State, s.PendingRequests, s.RTT = conn.Status(), pending, srtt
+	return s
+}
+
+// connStats collects a connection's diagnostics.
+type connStats struct {
+	sent        map[string]int
+	received    map[string]int
+	bytesSent   int64
+	bytesRecv   int64
+	reconnects  int
+	lastErr     error
+	lastErrTime time.Time
+	connected   time.Time
+	mu          sync.Mutex
+}
+
+// messageSent records a sent message.
+func (s *connStats) messageSent(typ string, size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sent == nil {
+		s.sent = make(map[string]int)
+	}
+	s.sent[typ]++
+	s.bytesSent += int64(size)
+}
+
+// messageReceived records a received message.
+func (s *connStats) messageReceived(typ string, size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.received == nil {
+		s.received = make(map[string]int)
+	}
+	s.received[typ]++
+	s.bytesRecv += int64(size)
+}
+
+// opened records the websocket being opened.
+func (s *connStats) opened(reconnect bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connected = time.Now()
+	if reconnect {
+		s.reconnects++
+	}
+}
+
+// closed records the websocket being closed, with the disconnect reason.
+func (s *connStats) closed(reason *DisconnectReason) {
+	if reason.Cause != DisconnectCanceled {
+		s.error(reason)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connected = time.Time{}
+}
+
+// error records the error, ignoring canceled contexts.
+func (s *connStats) error(err error) {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastErr, s.lastErrTime = err, time.Now()
+}
+
+// snapshot returns a snapshot of the collected diagnostics.
+func (s *connStats) snapshot() *ConnStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := &ConnStats{
+		MessagesSent:     make(map[string]int, len(s.sent)),
+		MessagesReceived: make(map[string]int, len(s.received)),
+		BytesSent:        s.bytesSent,
+		BytesReceived:    s.bytesRecv,
+		Reconnects:       s.reconnects,
+		LastError:        s.lastErr,
+		LastErrorTime:    s.lastErrTime,
+	}
+	for k, v := range s.sent {
+		res.MessagesSent[k] = v
+	}
+	for k, v := range s.received {
+		res.MessagesReceived[k] = v
+	}
+	if !s.connected.IsZero() {
+		res.Uptime = time.Since(s.connected)
+	}
+	return res
+}
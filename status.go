@@ -0,0 +1,280 @@
+package nakama
+
+import (
+	"context"
+	"sync"
+
+	"github.com/heroiclabs/nakama-common/rtapi"
+	"golang.org/x/exp/maps"
+)
+
+// StatusTracker tracks the online presences of followed users, following the
+// users again after the websocket connection is reopened.
+type StatusTracker struct {
+	conn      *Conn
+	ctx       context.Context
+	cancel    func()
+	follows   map[string]bool
+	presences map[string][]*rtapi.UserPresence
+	rw        sync.RWMutex
+
+	changeHandlers callbacks[*StatusPresenceEventMsg]
+}
+
+// StatusTracker creates a status tracker. The tracker's callbacks are removed
+// when the context is closed, or the tracker is closed.
+func (conn *Conn) StatusTracker(ctx context.Context) *StatusTracker {
+	ctx, cancel := context.WithCancel(ctx)
+	t := &StatusTracker{
+		conn:      conn,
+		ctx:       ctx,
+		cancel:    cancel,
+		follows:   make(map[string]bool),
+		presences: make(map[string][]*rtapi.UserPresence),
+	}
+	conn.OnStatusPresenceEvent(ctx, t.update)
+	conn.OnDisconnect(ctx, func(*DisconnectReason) {
+		t.reset()
+	})
+	conn.OnConnect(ctx, func() {
+		go t.refollow()
+	})
+	return t
+}
+
+// update updates the presences of followed users from a presence event.
+func (t *StatusTracker) update(msg *StatusPresenceEventMsg) {
+	t.rw.Lock()
+	ev := &StatusPresenceEventMsg{}
+	// leaves are applied first, as status updates are sent as a leave and a
+	// join for the same session
+	for _, p := range msg.Leaves {
+		if t.follows[p.UserId] {
+			t.remove(p)
+			ev.Leaves = append(ev.Leaves, p)
+		}
+	}
+	for _, p := range msg.Joins {
+		if t.follows[p.UserId] {
+			t.presences[p.UserId] = updatePresences(t.presences[p.UserId], []*rtapi.UserPresence{p}, nil)
+			ev.Joins = append(ev.Joins, p)
+		}
+	}
+	t.rw.Unlock()
+	t.notify(ev)
+}
+
+// remove removes a presence. Must be called with the lock held.
+func (t *StatusTracker) remove(presence *rtapi.UserPresence) {
+	l := updatePresences(t.presences[presence.UserId], nil, []*rtapi.UserPresence{presence})
+	if len(l) == 0 {
+		delete(t.presences, presence.UserId)
+		return
+	}
+	t.presences[presence.UserId] = l
+}
+
+// reset removes all presences when the websocket connection is closed,
+// notifying the change callbacks of the removed presences.
+func (t *StatusTracker) reset() {
+	t.rw.Lock()
+	ev := &StatusPresenceEventMsg{}
+	for _, l := range t.presences {
+		ev.Leaves = append(ev.Leaves, l...)
+	}
+	t.presences = make(map[string][]*rtapi.UserPresence)
+	t.rw.Unlock()
+	t.notify(ev)
+}
+
+// refollow follows the followed users again after the websocket connection
+// is reopened.
+func (t *StatusTracker) refollow() {
+	t.rw.RLock()
+	userIds := maps.Keys(t.follows)
+	t.rw.RUnlock()
+	if len(userIds) == 0 {
+		return
+	}
+	if err := t.Follow(t.ctx, userIds...); err != nil {
+		t.conn.logger.Log(LevelError, "unable to refollow statuses", "err", err)
+	}
+}
+
+// notify dispatches a change to the change callbacks.
+func (t *StatusTracker) notify(ev *StatusPresenceEventMsg) {
+	if len(ev.Joins) != 0 || len(ev.Leaves) != 0 {
+		t.changeHandlers.dispatch(ev)
+	}
+}
+
+// Follow sends a message to follow the users' statuses, adding the users'
+// current presences.
+func (t *StatusTracker) Follow(ctx context.Context, userIds ...string) error {
+	t.rw.Lock()
+	for _, id := range userIds {
+		t.follows[id] = true
+	}
+	t.rw.Unlock()
+	msg, err := t.conn.StatusFollow(ctx, userIds...)
+	if err != nil {
+		return err
+	}
+	t.rw.Lock()
+	ev := &StatusPresenceEventMsg{}
+	for _, p := range msg.Presences {
+		if t.follows[p.UserId] && !containsPresence(t.presences[p.UserId], p.SessionId) {
+			t.presences[p.UserId] = append(t.presences[p.UserId], p)
+			ev.Joins = append(ev.Joins, p)
+		}
+	}
+	t.rw.Unlock()
+	t.notify(ev)
+	return nil
+}
+
+// Unfollow sends a message to unfollow the users' statuses, removing the
+// users' presences.
+func (t *StatusTracker) Unfollow(ctx context.Context, userIds ...string) error {
+	if err := t.conn.StatusUnfollow(ctx, userIds...); err != nil {
+		return err
+	}
+	t.rw.Lock()
+	for _, id := range userIds {
+		delete(t.follows, id)
+		delete(t.presences, id)
+	}
+	t.rw.Unlock()
+	return nil
+}
+
+// Followed returns the followed user ids.
+func (t *StatusTracker) Followed() []string {
+	t.rw.RLock()
+	defer t.rw.RUnlock()
+	return maps.Keys(t.follows)
+}
+
+// Online returns true when the user has at least one online presence.
+func (t *StatusTracker) Online(userId string) bool {
+	t.rw.RLock()
+	defer t.rw.RUnlock()
+	return len(t.presences[userId]) != 0
+}
+
+// Status returns the user's most recent status, and whether the user is
+// online.
+func (t *StatusTracker) Status(userId string) (string, bool) {
+	t.rw.RLock()
+	defer t.rw.RUnlock()
+	l := t.presences[userId]
+	if len(l) == 0 {
+		return "", false
+	}
+	return l[len(l)-1].GetStatus().GetValue(), true
+}
+
+// Presences returns the online presences of the followed users.
+func (t *StatusTracker) Presences() []*rtapi.UserPresence {
+	t.rw.RLock()
+	defer t.rw.RUnlock()
+	var presences []*rtapi.UserPresence
+	for _, l := range t.presences {
+		presences = append(presences, l...)
+	}
+	return presences
+}
+
+// OnChange adds a callback for changes to the followed users' presences. The
+// callback is removed when the tracker is closed.
+func (t *StatusTracker) OnChange(f func(*StatusPresenceEventMsg)) {
+	t.changeHandlers.add(t.ctx, f)
+}
+
+// Changes returns a channel receiving changes to the followed users'
+// presences. The channel is closed when the tracker is closed.
+func (t *StatusTracker) Changes(opts ...SubscribeOption) <-chan *StatusPresenceEventMsg {
+	return subscribe(t.ctx, t.changeHandlers.add, opts...)
+}
+
+// Close removes the tracker's callbacks. The followed users are not
+// unfollowed.
+func (t *StatusTracker) Close() {
+	t.cancel()
+}
+
+// OnlineStatus returns whether each user is online, using the tracked
+// presences of followed users, and an ephemeral status follow for the users
+// not followed by the tracker.
+func (t *StatusTracker) OnlineStatus(ctx context.Context, userIds ...string) (map[string]bool, error) {
+	online := make(map[string]bool, len(userIds))
+	var unknown []string
+	t.rw.RLock()
+	for _, id := range userIds {
+		if t.follows[id] {
+			online[id] = len(t.presences[id]) != 0
+		} else {
+			unknown = append(unknown, id)
+		}
+	}
+	t.rw.RUnlock()
+	if len(unknown) == 0 {
+		return online, nil
+	}
+	m, err := t.conn.OnlineStatus(ctx, unknown...)
+	if err != nil {
+		return nil, err
+	}
+	for id, v := range m {
+		online[id] = v
+	}
+	return online, nil
+}
+
+// OnlineStatus returns whether each user is online, by following the users'
+// statuses, and then unfollowing the users not previously followed by the
+// connection.
+func (conn *Conn) OnlineStatus(ctx context.Context, userIds ...string) (map[string]bool, error) {
+	var ephemeral []string
+	conn.rw.RLock()
+	for _, id := range userIds {
+		if !conn.follows[id] {
+			ephemeral = append(ephemeral, id)
+		}
+	}
+	conn.rw.RUnlock()
+	msg, err := conn.StatusFollow(ctx, userIds...)
+	if err != nil {
+		return nil, err
+	}
+	online := make(map[string]bool, len(userIds))
+	for _, id := range userIds {
+		online[id] = false
+	}
+	for _, p := range msg.Presences {
+		online[p.UserId] = true
+	}
+	if len(ephemeral) != 0 {
+		if err := conn.StatusUnfollow(ctx, ephemeral...); err != nil {
+			return nil, err
+		}
+	}
+	return online, nil
+}
+
+// OnlineStatus returns whether each user is online, as reported by the
+// users' accounts. Use Conn.OnlineStatus when a realtime connection is open.
+func (cl *Client) OnlineStatus(ctx context.Context, userIds ...string) (map[string]bool, error) {
+	res, err := cl.Users(ctx, userIds...)
+	if err != nil {
+		return nil, err
+	}
+	online := make(map[string]bool, len(userIds))
+	for _, id := range userIds {
+		online[id] = false
+	}
+	for _, u := range res.Users {
+		online[u.Id] = u.Online
+	}
+	return online, nil
+}
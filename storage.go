@@ -0,0 +1,126 @@
+package nakama
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// ErrStorageConflict is the error returned by StorageUpdate when the storage
+// object was concurrently modified on every attempt.
+var ErrStorageConflict = errors.New("storage version conflict")
+
+// IsStorageConflict returns true when the error is a storage write rejected
+// because the object's version did not match (see WithStorageVersion).
+func IsStorageConflict(err error) bool {
+	if errors.Is(err, ErrStorageConflict) {
+		return true
+	}
+	var cerr *ClientError
+	if !errors.As(err, &cerr) {
+		return false
+	}
+	switch cerr.Code {
+	case codes.FailedPrecondition, codes.Aborted, codes.AlreadyExists:
+		return true
+	case codes.InvalidArgument:
+		return strings.Contains(cerr.Message, "version check failed")
+	}
+	return false
+}
+
+// StorageUpdate reads the session user's storage object for the collection
+// and key, applies f to its json decoded value (the zero value when the
+// object does not exist), and writes the result with the read version. When
+// the object was concurrently modified, the update is retried, up to the
+// number of attempts (see WithUpdateAttempts). Returns the written value, or
+// an error wrapping ErrStorageConflict when every attempt conflicted.
+func StorageUpdate[T any](ctx context.Context, cl *Client, collection, key string, f func(old T) (T, error), opts ...UpdateOption) (T, error) {
+	o := &updateOptions{
+		attempts: 5,
+		backoff:  ExponentialBackoff(50*time.Millisecond, time.Second),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	var zero T
+	for attempt := 1; ; attempt++ {
+		old, err := ReadStorageValue[T](ctx, cl, collection, key, "")
+		if err != nil {
+			return zero, fmt.Errorf("unable to update storage object %s/%s: %w", collection, key, err)
+		}
+		var v T
+		version := "*"
+		if old != nil {
+			v, version = old.Value, old.Version
+		}
+		if v, err = f(v); err != nil {
+			return zero, err
+		}
+		_, err = WriteStorageValue(ctx, cl, collection, key, v, append(o.storageOpts, WithStorageVersion(version))...)
+		switch {
+		case err == nil:
+			return v, nil
+		case !IsStorageConflict(err):
+			return zero, fmt.Errorf("unable to update storage object %s/%s: %w", collection, key, err)
+		case attempt >= o.attempts:
+			return zero, fmt.Errorf("unable to update storage object %s/%s after %d attempts: %w", collection, key, attempt, ErrStorageConflict)
+		}
+		if o.conflict != nil {
+			o.conflict(attempt, err)
+		}
+		select {
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		case <-time.After(o.backoff(attempt)):
+		}
+	}
+}
+
+// updateOptions are storage update options.
+type updateOptions struct {
+	attempts    int
+	backoff     Backoff
+	conflict    func(int, error)
+	storageOpts []StorageOption
+}
+
+// UpdateOption is a storage update option.
+type UpdateOption func(*updateOptions)
+
+// WithUpdateAttempts is a storage update option to set the maximum number of
+// attempts (default: 5).
+func WithUpdateAttempts(attempts int) UpdateOption {
+	return func(o *updateOptions) {
+		o.attempts = attempts
+	}
+}
+
+// WithUpdateBackoff is a storage update option to set the backoff between
+// attempts (default: exponential from 50ms to 1s).
+func WithUpdateBackoff(backoff Backoff) UpdateOption {
+	return func(o *updateOptions) {
+		o.backoff = backoff
+	}
+}
+
+// WithUpdateConflict is a storage update option to set a callback called with
+// the attempt and error when a write conflicts, before the update is retried,
+// such as to log or count conflicts.
+func WithUpdateConflict(f func(attempt int, err error)) UpdateOption {
+	return func(o *updateOptions) {
+		o.conflict = f
+	}
+}
+
+// WithUpdateStorageOptions is a storage update option to set the storage
+// object write options, such as WithStoragePermissions.
+func WithUpdateStorageOptions(opts ...StorageOption) UpdateOption {
+	return func(o *updateOptions) {
+		o.storageOpts = append(o.storageOpts, opts...)
+	}
+}
@@ -0,0 +1,191 @@
+package nakama
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/heroiclabs/nakama-common/rtapi"
+)
+
+// StreamMode is a realtime stream mode.
+type StreamMode int32
+
+// StreamMode values.
+const (
+	StreamModeNotifications      StreamMode = 0
+	StreamModeStatus             StreamMode = 1
+	StreamModeChannel            StreamMode = 2
+	StreamModeGroup              StreamMode = 3
+	StreamModeDM                 StreamMode = 4
+	StreamModeMatchRelayed       StreamMode = 5
+	StreamModeMatchAuthoritative StreamMode = 6
+	StreamModeParty              StreamMode = 7
+)
+
+// String satisfies the fmt.Stringer interface.
+func (mode StreamMode) String() string {
+	switch mode {
+	case StreamModeNotifications:
+		return "Notifications"
+	case StreamModeStatus:
+		return "Status"
+	case StreamModeChannel:
+		return "Channel"
+	case StreamModeGroup:
+		return "Group"
+	case StreamModeDM:
+		return "DM"
+	case StreamModeMatchRelayed:
+		return "MatchRelayed"
+	case StreamModeMatchAuthoritative:
+		return "MatchAuthoritative"
+	case StreamModeParty:
+		return "Party"
+	}
+	return "StreamMode(" + strconv.Itoa(int(mode)) + ")"
+}
+
+// Stream identifies a realtime stream. Streams are comparable, and can be
+// used as map keys.
+type Stream struct {
+	Mode       StreamMode
+	Subject    string
+	Subcontext string
+	Label      string
+}
+
+// StreamOf returns the stream identity of a stream message.
+func StreamOf(stream *rtapi.Stream) Stream {
+	if stream == nil {
+		return Stream{}
+	}
+	return Stream{
+		Mode:       StreamMode(stream.Mode),
+		Subject:    stream.Subject,
+		Subcontext: stream.Subcontext,
+		Label:      stream.Label,
+	}
+}
+
+// Proto returns the stream as a stream message.
+func (stream Stream) Proto() *rtapi.Stream {
+	return &rtapi.Stream{
+		Mode:       int32(stream.Mode),
+		Subject:    stream.Subject,
+		Subcontext: stream.Subcontext,
+		Label:      stream.Label,
+	}
+}
+
+// String satisfies the fmt.Stringer interface.
+func (stream Stream) String() string {
+	return fmt.Sprintf("%s/%s/%s/%s", stream.Mode, stream.Subject, stream.Subcontext, stream.Label)
+}
+
+// StreamId returns the stream identity of the stream data.
+func (msg *StreamDataMsg) StreamId() Stream {
+	return StreamOf(msg.Stream)
+}
+
+// Decode decodes the stream data's payload to v using the codec.
+func (msg *StreamDataMsg) Decode(codec RpcCodec, v interface{}) error {
+	if err := codec.Unmarshal([]byte(msg.Data), v); err != nil {
+		return fmt.Errorf("unable to decode stream data: %w", err)
+	}
+	return nil
+}
+
+// StreamId returns the stream identity of the stream presence event.
+func (msg *StreamPresenceEventMsg) StreamId() Stream {
+	return StreamOf(msg.Stream)
+}
+
+// OnStreamDataDecode adds a stream data callback for a stream, decoding the
+// stream data's payload as T with the codec. Payloads that cannot be decoded
+// are logged and dropped. The callback is removed when the context is closed.
+func OnStreamDataDecode[T any](ctx context.Context, conn *Conn, stream Stream, codec RpcCodec, f func(T, *StreamDataMsg)) {
+	conn.OnStreamDataStream(ctx, stream, func(msg *StreamDataMsg) {
+		v, dst := rpcResponse[T]()
+		if err := msg.Decode(codec, dst); err != nil {
+			conn.logger.Log(LevelError, "unable to decode stream data", "stream", stream, "err", err)
+			return
+		}
+		f(*v, msg)
+	})
+}
+
+// StreamHandle is a handle to a realtime stream the user was joined to by
+// the server, tracking the stream's presences and scoping data and presence
+// callbacks to the stream.
+type StreamHandle struct {
+	conn      *Conn
+	stream    Stream
+	ctx       context.Context
+	cancel    func()
+	presences *PresenceSet
+}
+
+// StreamHandle creates a handle for a stream, with the stream's known
+// presences. The handle's callbacks are removed when the context is closed,
+// or the handle is closed.
+func (conn *Conn) StreamHandle(ctx context.Context, stream Stream, presences ...*rtapi.UserPresence) *StreamHandle {
+	ctx, cancel := context.WithCancel(ctx)
+	h := &StreamHandle{
+		conn:      conn,
+		stream:    stream,
+		ctx:       ctx,
+		cancel:    cancel,
+		presences: NewPresenceSet(presences...),
+	}
+	conn.OnStreamPresenceEventStream(ctx, stream, func(msg *StreamPresenceEventMsg) {
+		h.presences.Apply(msg)
+	})
+	return h
+}
+
+// Stream returns the stream identity.
+func (h *StreamHandle) Stream() Stream {
+	return h.stream
+}
+
+// Presences returns the stream's current presences.
+func (h *StreamHandle) Presences() []*rtapi.UserPresence {
+	return h.presences.Presences()
+}
+
+// Roster returns the set of the stream's current presences.
+func (h *StreamHandle) Roster() *PresenceSet {
+	return h.presences
+}
+
+// OnData adds a callback for data received on the stream. The callback is
+// removed when the handle is closed.
+func (h *StreamHandle) OnData(f func(*StreamDataMsg)) {
+	h.conn.OnStreamDataStream(h.ctx, h.stream, f)
+}
+
+// Data returns a channel receiving the data received on the stream. The
+// returned channel is closed when the handle is closed.
+func (h *StreamHandle) Data(opts ...SubscribeOption) <-chan *StreamDataMsg {
+	return subscribe(h.ctx, func(ctx context.Context, f func(*StreamDataMsg)) {
+		h.conn.OnStreamDataStream(ctx, h.stream, f)
+	}, opts...)
+}
+
+// OnPresenceEvent adds a callback for the stream's presence events. The
+// callback is removed when the handle is closed.
+func (h *StreamHandle) OnPresenceEvent(f func(*StreamPresenceEventMsg)) {
+	h.conn.OnStreamPresenceEventStream(h.ctx, h.stream, f)
+}
+
+// Done returns a channel that is closed when the handle is closed.
+func (h *StreamHandle) Done() <-chan struct{} {
+	return h.ctx.Done()
+}
+
+// Close removes the handle's callbacks. Streams are joined and left by the
+// server, so no message is sent.
+func (h *StreamHandle) Close() {
+	h.cancel()
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	testpb "github.com/ascii8/nakama-go/testdata/proto"
 	"github.com/heroiclabs/nakama-common/runtime"
@@ -19,6 +20,9 @@ func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runti
 	if err := initializer.RegisterRpc("protoTest", protoTest); err != nil {
 		return err
 	}
+	if err := initializer.RegisterRpc("sleep", sleep); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -64,3 +68,17 @@ func protoTest(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtim
 	}
 	return string(buf), nil
 }
+
+func sleep(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payloadstr string) (string, error) {
+	d, err := time.ParseDuration(strings.Trim(payloadstr, `"`))
+	if err != nil {
+		return "", err
+	}
+	logger.WithField("d", d).Info("sleep")
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-time.After(d):
+	}
+	return payloadstr, nil
+}
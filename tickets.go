@@ -0,0 +1,279 @@
+package nakama
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/rtapi"
+	"google.golang.org/protobuf/proto"
+)
+
+// Ticket is an active matchmaker ticket, added by the connection (see
+// ActiveTickets).
+type Ticket struct {
+	// Ticket is the ticket id.
+	Ticket string
+	// PartyId is the party id, for a party ticket.
+	PartyId string
+	// Query is the ticket's matchmaker query.
+	Query string
+	// MinCount is the ticket's minimum match size.
+	MinCount int
+	// MaxCount is the ticket's maximum match size.
+	MaxCount int
+	// Added is when the ticket was added.
+	Added time.Time
+}
+
+// TicketEventType is a matchmaker ticket event type.
+type TicketEventType int
+
+// TicketEventType values.
+const (
+	// TicketResolved is a ticket matched by the matchmaker.
+	TicketResolved TicketEventType = iota
+	// TicketRemoved is a ticket removed from the matchmaker pool, such as when
+	// the context passed to MatchmakerAddScoped was closed.
+	TicketRemoved
+	// TicketTimeout is a ticket removed from the matchmaker pool after not
+	// being matched before the ticket timeout (see WithConnTicketTimeout).
+	TicketTimeout
+	// TicketInvalidated is a ticket removed by the server when the websocket
+	// connection was closed.
+	TicketInvalidated
+)
+
+// String satisfies the fmt.Stringer interface.
+func (typ TicketEventType) String() string {
+	switch typ {
+	case TicketResolved:
+		return "Resolved"
+	case TicketRemoved:
+		return "Removed"
+	case TicketTimeout:
+		return "Timeout"
+	case TicketInvalidated:
+		return "Invalidated"
+	}
+	return "TicketEventType(" + strconv.Itoa(int(typ)) + ")"
+}
+
+// TicketEvent is a matchmaker ticket event, for a ticket no longer active.
+type TicketEvent struct {
+	Type   TicketEventType
+	Ticket *Ticket
+	// Matched is the matchmaker matched message, for a resolved ticket.
+	Matched *MatchmakerMatchedMsg
+}
+
+// activeTicket is a tracked matchmaker ticket.
+type activeTicket struct {
+	ticket *Ticket
+	timer  *time.Timer
+	done   chan struct{}
+}
+
+// ActiveTickets returns the matchmaker tickets added by the connection that
+// are not yet matched or removed, ordered by when they were added.
+func (conn *Conn) ActiveTickets() []*Ticket {
+	conn.tmu.Lock()
+	tickets := make([]*Ticket, 0, len(conn.tickets))
+	for _, t := range conn.tickets {
+		tickets = append(tickets, t.ticket)
+	}
+	conn.tmu.Unlock()
+	sort.Slice(tickets, func(i, j int) bool {
+		return tickets[i].Added.Before(tickets[j].Added)
+	})
+	return tickets
+}
+
+// MatchmakerAddScoped sends a message to add the user to the matchmaker pool,
+// removing the ticket from the pool when the context is closed before the
+// ticket is matched.
+func (conn *Conn) MatchmakerAddScoped(ctx context.Context, msg *MatchmakerAddMsg) (*MatchmakerTicketMsg, error) {
+	ticket, err := msg.Send(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	conn.scopeTicket(ctx, ticket.Ticket)
+	return ticket, nil
+}
+
+// PartyMatchmakerAddScoped sends a message to add the party to the
+// matchmaker pool, removing the ticket from the pool when the context is
+// closed before the ticket is matched.
+func (conn *Conn) PartyMatchmakerAddScoped(ctx context.Context, partyId, query string, minCount, maxCount int) (*PartyMatchmakerTicketMsg, error) {
+	ticket, err := conn.PartyMatchmakerAdd(ctx, partyId, query, minCount, maxCount)
+	if err != nil {
+		return nil, err
+	}
+	conn.scopeTicket(ctx, ticket.Ticket)
+	return ticket, nil
+}
+
+// OnTicket adds a callback for matchmaker ticket events, for the tickets
+// added by the connection. The callback is removed when the context is
+// closed.
+func (conn *Conn) OnTicket(ctx context.Context, f func(*TicketEvent)) {
+	conn.ticketHandlers.add(ctx, f)
+}
+
+// trackTicket tracks the matchmaker tickets added and removed by a sent
+// message and its response.
+func (conn *Conn) trackTicket(msg, v EnvelopeBuilder) {
+	switch m := msg.(type) {
+	case *MatchmakerAddMsg:
+		if res, ok := v.(*MatchmakerTicketMsg); ok && res.Ticket != "" {
+			conn.addTicket(&Ticket{
+				Ticket:   res.Ticket,
+				Query:    m.Query,
+				MinCount: int(m.MinCount),
+				MaxCount: int(m.MaxCount),
+			})
+		}
+	case *PartyMatchmakerAddMsg:
+		if res, ok := v.(*PartyMatchmakerTicketMsg); ok && res.Ticket != "" {
+			conn.addTicket(&Ticket{
+				Ticket:   res.Ticket,
+				PartyId:  m.PartyId,
+				Query:    m.Query,
+				MinCount: int(m.MinCount),
+				MaxCount: int(m.MaxCount),
+			})
+		}
+	case *MatchmakerRemoveMsg:
+		conn.removeTicket(m.Ticket, TicketRemoved, nil)
+	case *PartyMatchmakerRemoveMsg:
+		conn.removeTicket(m.Ticket, TicketRemoved, nil)
+	}
+}
+
+// addTicket adds an active ticket, starting the ticket timeout.
+func (conn *Conn) addTicket(ticket *Ticket) {
+	ticket.Added = time.Now()
+	t := &activeTicket{
+		ticket: ticket,
+		done:   make(chan struct{}),
+	}
+	if conn.ticketTimeout != 0 {
+		t.timer = time.AfterFunc(conn.ticketTimeout, func() {
+			conn.expireTicket(ticket.Ticket, TicketTimeout)
+		})
+	}
+	conn.tmu.Lock()
+	defer conn.tmu.Unlock()
+	if conn.tickets == nil {
+		conn.tickets = make(map[string]*activeTicket)
+	}
+	conn.tickets[ticket.Ticket] = t
+}
+
+// removeTicket removes an active ticket, dispatching the ticket event.
+func (conn *Conn) removeTicket(ticket string, typ TicketEventType, matched *MatchmakerMatchedMsg) {
+	if t := conn.takeTicket(ticket); t != nil {
+		conn.ticketHandlers.dispatch(&TicketEvent{
+			Type:    typ,
+			Ticket:  t.ticket,
+			Matched: matched,
+		})
+	}
+}
+
+// takeTicket removes an active ticket, without dispatching the ticket event.
+// Returns nil when the ticket is not active.
+func (conn *Conn) takeTicket(ticket string) *activeTicket {
+	conn.tmu.Lock()
+	t, ok := conn.tickets[ticket]
+	delete(conn.tickets, ticket)
+	conn.tmu.Unlock()
+	if !ok {
+		return nil
+	}
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	close(t.done)
+	return t
+}
+
+// resolveTicket removes the active ticket matched by the matchmaker.
+func (conn *Conn) resolveTicket(env *rtapi.Envelope) {
+	m := env.GetMatchmakerMatched()
+	conn.tmu.Lock()
+	_, ok := conn.tickets[m.GetTicket()]
+	conn.tmu.Unlock()
+	if !ok {
+		return
+	}
+	// copy the message, as the envelope is reused
+	matched := new(MatchmakerMatchedMsg)
+	proto.Merge(&matched.MatchmakerMatched, m)
+	conn.removeTicket(matched.Ticket, TicketResolved, matched)
+}
+
+// expireTicket removes the active ticket, sends a message to remove the
+// ticket from the matchmaker pool, and dispatches the ticket event.
+func (conn *Conn) expireTicket(ticket string, typ TicketEventType) {
+	t := conn.takeTicket(ticket)
+	if t == nil {
+		return
+	}
+	defer conn.ticketHandlers.dispatch(&TicketEvent{
+		Type:   typ,
+		Ticket: t.ticket,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), matchmakerRemoveTimeout)
+	defer cancel()
+	var err error
+	if t.ticket.PartyId != "" {
+		err = conn.PartyMatchmakerRemove(ctx, t.ticket.PartyId, ticket)
+	} else {
+		err = conn.MatchmakerRemove(ctx, ticket)
+	}
+	if err != nil {
+		conn.logger.Log(LevelWarn, "unable to remove matchmaker ticket", "ticket", ticket, "err", err)
+	}
+}
+
+// scopeTicket removes the active ticket when the context is closed.
+func (conn *Conn) scopeTicket(ctx context.Context, ticket string) {
+	conn.tmu.Lock()
+	t, ok := conn.tickets[ticket]
+	conn.tmu.Unlock()
+	if !ok {
+		return
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.expireTicket(ticket, TicketRemoved)
+		case <-t.done:
+		}
+	}()
+}
+
+// invalidateTickets removes the active tickets, as the server removes a
+// session's tickets when the websocket connection is closed.
+func (conn *Conn) invalidateTickets() {
+	conn.tmu.Lock()
+	tickets := make([]string, 0, len(conn.tickets))
+	for ticket := range conn.tickets {
+		tickets = append(tickets, ticket)
+	}
+	conn.tmu.Unlock()
+	for _, ticket := range tickets {
+		conn.removeTicket(ticket, TicketInvalidated, nil)
+	}
+}
+
+// WithConnTicketTimeout is a nakama websocket connection option to set the
+// timeout after which matchmaker tickets not yet matched are removed from the
+// matchmaker pool (see OnTicket).
+func WithConnTicketTimeout(timeout time.Duration) ConnOption {
+	return func(conn *Conn) {
+		conn.ticketTimeout = timeout
+	}
+}
@@ -0,0 +1,111 @@
+package nakama
+
+import (
+	"context"
+	"time"
+
+	nkapi "github.com/heroiclabs/nakama-common/api"
+)
+
+// TournamentSchedule is a tournament's schedule, converted from the
+// tournament's unix times. Nakama computes the active window and resets from
+// the tournament's reset schedule (a CRON expression that is not itself
+// returned by the API). Zero times are unset, such as the end of a tournament
+// without an end time.
+type TournamentSchedule struct {
+	// Start is when the tournament starts.
+	Start time.Time
+	// End is when the tournament is stopped.
+	End time.Time
+	// Duration is the duration of each active window.
+	Duration time.Duration
+	// StartActive is when the current or next active window starts.
+	StartActive time.Time
+	// EndActive is when the current or next active window ends.
+	EndActive time.Time
+	// PrevReset is when the tournament was last reset.
+	PrevReset time.Time
+	// NextReset is when the tournament is next reset.
+	NextReset time.Time
+	// Full is true when the tournament has reached its max size.
+	Full bool
+}
+
+// TournamentScheduleOf returns the tournament's schedule.
+func TournamentScheduleOf(t *nkapi.Tournament) *TournamentSchedule {
+	return &TournamentSchedule{
+		Start:       timeOf(t.StartTime),
+		End:         timeOf(t.EndTime),
+		Duration:    time.Duration(t.Duration) * time.Second,
+		StartActive: unixTimeOf(t.StartActive),
+		EndActive:   unixTimeOf(t.EndActive),
+		PrevReset:   unixTimeOf(t.PrevReset),
+		NextReset:   unixTimeOf(t.NextReset),
+		Full:        t.MaxSize != 0 && t.Size >= t.MaxSize,
+	}
+}
+
+// unixTimeOf converts unix seconds, returning the zero time when 0.
+func unixTimeOf(secs uint32) time.Time {
+	if secs == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(secs), 0)
+}
+
+// IsActive returns true when now is within the tournament's active window.
+func (s *TournamentSchedule) IsActive(now time.Time) bool {
+	switch {
+	case !s.Start.IsZero() && now.Before(s.Start),
+		!s.End.IsZero() && !now.Before(s.End),
+		!s.StartActive.IsZero() && now.Before(s.StartActive),
+		!s.EndActive.IsZero() && !now.Before(s.EndActive):
+		return false
+	}
+	return true
+}
+
+// IsJoinable returns true when the tournament is active at now, and is not
+// full.
+func (s *TournamentSchedule) IsJoinable(now time.Time) bool {
+	return !s.Full && s.IsActive(now)
+}
+
+// Remaining returns the time remaining in the active window at now, or 0
+// when the tournament is not active or the window has no end.
+func (s *TournamentSchedule) Remaining(now time.Time) time.Duration {
+	if !s.IsActive(now) {
+		return 0
+	}
+	end := s.EndActive
+	if end.IsZero() || !s.End.IsZero() && s.End.Before(end) {
+		end = s.End
+	}
+	if end.IsZero() {
+		return 0
+	}
+	return end.Sub(now)
+}
+
+// JoinTournaments joins the tournaments in the category range that are
+// joinable, and accepted by the filter (when not nil), returning the joined
+// tournaments.
+func (cl *Client) JoinTournaments(ctx context.Context, categoryStart, categoryEnd uint32, filter func(*nkapi.Tournament) bool) ([]*nkapi.Tournament, error) {
+	var joined []*nkapi.Tournament
+	p := Tournaments().
+		WithCategoryStart(categoryStart).
+		WithCategoryEnd(categoryEnd).
+		Pager(cl)
+	for p.Next(ctx) {
+		for _, t := range p.Page().Tournaments {
+			if !TournamentScheduleOf(t).IsJoinable(time.Now()) || filter != nil && !filter(t) {
+				continue
+			}
+			if err := cl.JoinTournament(ctx, t.Id); err != nil {
+				return joined, err
+			}
+			joined = append(joined, t)
+		}
+	}
+	return joined, p.Err()
+}
@@ -0,0 +1,102 @@
+package nakama
+
+import (
+	"context"
+	"errors"
+
+	"github.com/heroiclabs/nakama-common/rtapi"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the OpenTelemetry instrumentation name.
+const instrumentationName = "github.com/ascii8/nakama-go"
+
+// WithTracerProvider is a nakama client option to set the OpenTelemetry
+// tracer provider used to create a span for each http request. The span's
+// context is propagated to the server in the request headers, using the
+// global text map propagator (see otel.SetTextMapPropagator), making it
+// available to runtime RPCs via the request's headers.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(cl *Client) {
+		cl.tracer = tp.Tracer(instrumentationName)
+	}
+}
+
+// WithConnTracerProvider is a nakama websocket connection option to set the
+// OpenTelemetry tracer provider used to create a span for each realtime
+// request/response pair. Realtime rpcs have no headers, so when a metadata
+// injector is set (see WithConnMetadataInjector), the span's context is added
+// to the rpc's payload metadata using the global text map propagator.
+func WithConnTracerProvider(tp trace.TracerProvider) ConnOption {
+	return func(conn *Conn) {
+		conn.tracer = tp.Tracer(instrumentationName)
+	}
+}
+
+// startSpan starts a span for a http request.
+func (cl *Client) startSpan(ctx context.Context, name, method, typ string, size int) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.String("http.method", method),
+		attribute.String("nakama.path", typ),
+	}
+	if size >= 0 {
+		attrs = append(attrs, attribute.Int("nakama.request_size", size))
+	}
+	return cl.tracer.Start(ctx, "nakama "+name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// inject injects the span context of ctx in the carrier.
+func inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+}
+
+// startSpan starts a span for a realtime request of the message type. When no
+// tracer is set, a non-recording span is returned.
+func (conn *Conn) startSpan(ctx context.Context, typ string) (context.Context, trace.Span) {
+	if conn.tracer == nil {
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+	return conn.tracer.Start(ctx, "nakama.realtime "+typ, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("nakama.message_type", typ),
+	))
+}
+
+// traceMetadata returns the metadata with the span context of ctx injected.
+func traceMetadata(ctx context.Context, md map[string]string) map[string]string {
+	carrier := propagation.MapCarrier{}
+	inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return md
+	}
+	for k, v := range md {
+		carrier[k] = v
+	}
+	return carrier
+}
+
+// endSpan ends the span, recording the error and its codes.
+func endSpan(span trace.Span, err error) {
+	defer span.End()
+	var cerr *ClientError
+	var rerr *RealtimeError
+	switch {
+	case err == nil:
+		return
+	case errors.As(err, &cerr):
+		span.SetAttributes(
+			attribute.Int("http.status_code", cerr.StatusCode),
+			attribute.Int("nakama.error_code", int(cerr.Code)),
+		)
+	case errors.As(err, &rerr):
+		span.SetAttributes(
+			attribute.Int("nakama.error_code", int(rerr.Code)),
+			attribute.String("nakama.error_name", rtapi.Error_Code_name[int32(rerr.Code)]),
+		)
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,315 @@
+package nakama
+
+import (
+	"time"
+
+	nkapi "github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/rtapi"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Presence is a user's presence on a realtime stream.
+type Presence struct {
+	UserId      string `json:"user_id"`
+	SessionId   string `json:"session_id"`
+	Username    string `json:"username"`
+	Persistence bool   `json:"persistence,omitempty"`
+	Status      string `json:"status,omitempty"`
+}
+
+// PresenceOf converts a user presence message. Returns nil when the message
+// is nil.
+func PresenceOf(msg *rtapi.UserPresence) *Presence {
+	if msg == nil {
+		return nil
+	}
+	return &Presence{
+		UserId:      msg.UserId,
+		SessionId:   msg.SessionId,
+		Username:    msg.Username,
+		Persistence: msg.Persistence,
+		Status:      msg.GetStatus().GetValue(),
+	}
+}
+
+// PresencesOf converts user presence messages.
+func PresencesOf(msgs []*rtapi.UserPresence) []*Presence {
+	if msgs == nil {
+		return nil
+	}
+	presences := make([]*Presence, len(msgs))
+	for i, msg := range msgs {
+		presences[i] = PresenceOf(msg)
+	}
+	return presences
+}
+
+// Proto returns the presence as a user presence message.
+func (p *Presence) Proto() *rtapi.UserPresence {
+	if p == nil {
+		return nil
+	}
+	msg := &rtapi.UserPresence{
+		UserId:      p.UserId,
+		SessionId:   p.SessionId,
+		Username:    p.Username,
+		Persistence: p.Persistence,
+	}
+	if p.Status != "" {
+		msg.Status = wrapperspb.String(p.Status)
+	}
+	return msg
+}
+
+// ChannelMessage is a chat message sent on a channel.
+type ChannelMessage struct {
+	ChannelId  string    `json:"channel_id"`
+	MessageId  string    `json:"message_id"`
+	Code       int       `json:"code"`
+	SenderId   string    `json:"sender_id"`
+	Username   string    `json:"username"`
+	Content    string    `json:"content"`
+	CreateTime time.Time `json:"create_time"`
+	UpdateTime time.Time `json:"update_time"`
+	Persistent bool      `json:"persistent"`
+	RoomName   string    `json:"room_name,omitempty"`
+	GroupId    string    `json:"group_id,omitempty"`
+	UserIdOne  string    `json:"user_id_one,omitempty"`
+	UserIdTwo  string    `json:"user_id_two,omitempty"`
+}
+
+// ChannelMessageOf converts a channel message. Returns nil when the message
+// is nil.
+func ChannelMessageOf(msg *nkapi.ChannelMessage) *ChannelMessage {
+	if msg == nil {
+		return nil
+	}
+	return &ChannelMessage{
+		ChannelId:  msg.ChannelId,
+		MessageId:  msg.MessageId,
+		Code:       int(msg.GetCode().GetValue()),
+		SenderId:   msg.SenderId,
+		Username:   msg.Username,
+		Content:    msg.Content,
+		CreateTime: timeOf(msg.CreateTime),
+		UpdateTime: timeOf(msg.UpdateTime),
+		Persistent: msg.GetPersistent().GetValue(),
+		RoomName:   msg.RoomName,
+		GroupId:    msg.GroupId,
+		UserIdOne:  msg.UserIdOne,
+		UserIdTwo:  msg.UserIdTwo,
+	}
+}
+
+// ChannelMessagesOf converts channel messages.
+func ChannelMessagesOf(msgs []*nkapi.ChannelMessage) []*ChannelMessage {
+	if msgs == nil {
+		return nil
+	}
+	messages := make([]*ChannelMessage, len(msgs))
+	for i, msg := range msgs {
+		messages[i] = ChannelMessageOf(msg)
+	}
+	return messages
+}
+
+// Proto returns the message as a channel message.
+func (m *ChannelMessage) Proto() *nkapi.ChannelMessage {
+	if m == nil {
+		return nil
+	}
+	return &nkapi.ChannelMessage{
+		ChannelId:  m.ChannelId,
+		MessageId:  m.MessageId,
+		Code:       wrapperspb.Int32(int32(m.Code)),
+		SenderId:   m.SenderId,
+		Username:   m.Username,
+		Content:    m.Content,
+		CreateTime: timestampOf(m.CreateTime),
+		UpdateTime: timestampOf(m.UpdateTime),
+		Persistent: wrapperspb.Bool(m.Persistent),
+		RoomName:   m.RoomName,
+		GroupId:    m.GroupId,
+		UserIdOne:  m.UserIdOne,
+		UserIdTwo:  m.UserIdTwo,
+	}
+}
+
+// MatchData is data sent to a match.
+type MatchData struct {
+	MatchId  string    `json:"match_id"`
+	Presence *Presence `json:"presence,omitempty"`
+	OpCode   int64     `json:"op_code"`
+	Data     []byte    `json:"data"`
+	Reliable bool      `json:"reliable"`
+}
+
+// MatchDataOf converts a match data message. Returns nil when the message is
+// nil.
+func MatchDataOf(msg *rtapi.MatchData) *MatchData {
+	if msg == nil {
+		return nil
+	}
+	return &MatchData{
+		MatchId:  msg.MatchId,
+		Presence: PresenceOf(msg.Presence),
+		OpCode:   msg.OpCode,
+		Data:     msg.Data,
+		Reliable: msg.Reliable,
+	}
+}
+
+// Proto returns the data as a match data message.
+func (d *MatchData) Proto() *rtapi.MatchData {
+	if d == nil {
+		return nil
+	}
+	return &rtapi.MatchData{
+		MatchId:  d.MatchId,
+		Presence: d.Presence.Proto(),
+		OpCode:   d.OpCode,
+		Data:     d.Data,
+		Reliable: d.Reliable,
+	}
+}
+
+// PartyData is data sent to a party.
+type PartyData struct {
+	PartyId  string    `json:"party_id"`
+	Presence *Presence `json:"presence,omitempty"`
+	OpCode   int64     `json:"op_code"`
+	Data     []byte    `json:"data"`
+}
+
+// PartyDataOf converts a party data message. Returns nil when the message is
+// nil.
+func PartyDataOf(msg *rtapi.PartyData) *PartyData {
+	if msg == nil {
+		return nil
+	}
+	return &PartyData{
+		PartyId:  msg.PartyId,
+		Presence: PresenceOf(msg.Presence),
+		OpCode:   msg.OpCode,
+		Data:     msg.Data,
+	}
+}
+
+// Proto returns the data as a party data message.
+func (d *PartyData) Proto() *rtapi.PartyData {
+	if d == nil {
+		return nil
+	}
+	return &rtapi.PartyData{
+		PartyId:  d.PartyId,
+		Presence: d.Presence.Proto(),
+		OpCode:   d.OpCode,
+		Data:     d.Data,
+	}
+}
+
+// User is a user's public account information.
+type User struct {
+	Id                    string    `json:"id"`
+	Username              string    `json:"username"`
+	DisplayName           string    `json:"display_name,omitempty"`
+	AvatarUrl             string    `json:"avatar_url,omitempty"`
+	LangTag               string    `json:"lang_tag,omitempty"`
+	Location              string    `json:"location,omitempty"`
+	Timezone              string    `json:"timezone,omitempty"`
+	Metadata              string    `json:"metadata,omitempty"`
+	FacebookId            string    `json:"facebook_id,omitempty"`
+	GoogleId              string    `json:"google_id,omitempty"`
+	GamecenterId          string    `json:"gamecenter_id,omitempty"`
+	SteamId               string    `json:"steam_id,omitempty"`
+	Online                bool      `json:"online"`
+	EdgeCount             int       `json:"edge_count"`
+	CreateTime            time.Time `json:"create_time"`
+	UpdateTime            time.Time `json:"update_time"`
+	FacebookInstantGameId string    `json:"facebook_instant_game_id,omitempty"`
+	AppleId               string    `json:"apple_id,omitempty"`
+}
+
+// UserOf converts a user. Returns nil when the user is nil.
+func UserOf(msg *nkapi.User) *User {
+	if msg == nil {
+		return nil
+	}
+	return &User{
+		Id:                    msg.Id,
+		Username:              msg.Username,
+		DisplayName:           msg.DisplayName,
+		AvatarUrl:             msg.AvatarUrl,
+		LangTag:               msg.LangTag,
+		Location:              msg.Location,
+		Timezone:              msg.Timezone,
+		Metadata:              msg.Metadata,
+		FacebookId:            msg.FacebookId,
+		GoogleId:              msg.GoogleId,
+		GamecenterId:          msg.GamecenterId,
+		SteamId:               msg.SteamId,
+		Online:                msg.Online,
+		EdgeCount:             int(msg.EdgeCount),
+		CreateTime:            timeOf(msg.CreateTime),
+		UpdateTime:            timeOf(msg.UpdateTime),
+		FacebookInstantGameId: msg.FacebookInstantGameId,
+		AppleId:               msg.AppleId,
+	}
+}
+
+// UsersOf converts users.
+func UsersOf(msgs []*nkapi.User) []*User {
+	if msgs == nil {
+		return nil
+	}
+	users := make([]*User, len(msgs))
+	for i, msg := range msgs {
+		users[i] = UserOf(msg)
+	}
+	return users
+}
+
+// Proto returns the user as a user message.
+func (u *User) Proto() *nkapi.User {
+	if u == nil {
+		return nil
+	}
+	return &nkapi.User{
+		Id:                    u.Id,
+		Username:              u.Username,
+		DisplayName:           u.DisplayName,
+		AvatarUrl:             u.AvatarUrl,
+		LangTag:               u.LangTag,
+		Location:              u.Location,
+		Timezone:              u.Timezone,
+		Metadata:              u.Metadata,
+		FacebookId:            u.FacebookId,
+		GoogleId:              u.GoogleId,
+		GamecenterId:          u.GamecenterId,
+		SteamId:               u.SteamId,
+		Online:                u.Online,
+		EdgeCount:             int32(u.EdgeCount),
+		CreateTime:            timestampOf(u.CreateTime),
+		UpdateTime:            timestampOf(u.UpdateTime),
+		FacebookInstantGameId: u.FacebookInstantGameId,
+		AppleId:               u.AppleId,
+	}
+}
+
+// timeOf converts a timestamp, returning the zero time when the timestamp is
+// nil.
+func timeOf(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
+
+// timestampOf converts a time, returning nil when the time is zero.
+func timestampOf(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
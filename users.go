@@ -0,0 +1,283 @@
+package nakama
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+
+	nkapi "github.com/heroiclabs/nakama-common/api"
+)
+
+// SearchUsersRpc is the id of the rpc used to search users by partial
+// username. The rpc is not built into nakama, and must be registered by the
+// server runtime, taking a json payload of {"query": string, "limit": int},
+// and returning {"user_ids": [string]}.
+const SearchUsersRpc = "search_users"
+
+// maxUsersRequest is the maximum number of ids in a users request.
+const maxUsersRequest = 100
+
+// SearchUsers searches users by partial username, with the SearchUsersRpc
+// rpc, retrieving the matching users.
+func (cl *Client) SearchUsers(ctx context.Context, query string, limit int) ([]*nkapi.User, error) {
+	ids, err := cl.searchUserIds(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	return cl.usersBatch(ctx, ids)
+}
+
+// searchUserIds searches user ids by partial username.
+func (cl *Client) searchUserIds(ctx context.Context, query string, limit int) ([]string, error) {
+	req := struct {
+		Query string `json:"query"`
+		Limit int    `json:"limit,omitempty"`
+	}{query, limit}
+	var res struct {
+		UserIds []string `json:"user_ids"`
+	}
+	if err := cl.Rpc(ctx, SearchUsersRpc, req, &res); err != nil {
+		return nil, fmt.Errorf("unable to search users: %w", err)
+	}
+	return res.UserIds, nil
+}
+
+// usersBatch retrieves users by id, in batches, ordered as the ids.
+func (cl *Client) usersBatch(ctx context.Context, ids []string) ([]*nkapi.User, error) {
+	m := make(map[string]*nkapi.User, len(ids))
+	for i := 0; i < len(ids); i += maxUsersRequest {
+		res, err := cl.Users(ctx, ids[i:minInt(i+maxUsersRequest, len(ids))]...)
+		if err != nil {
+			return nil, fmt.Errorf("unable to retrieve users: %w", err)
+		}
+		for _, u := range res.Users {
+			m[u.Id] = u
+		}
+	}
+	users := make([]*nkapi.User, 0, len(m))
+	for _, id := range ids {
+		if u, ok := m[id]; ok {
+			users = append(users, u)
+		}
+	}
+	return users, nil
+}
+
+// minInt returns the smaller of a, b.
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// GroupMates retrieves the users that are members of the session user's
+// groups, excluding the session user, such as to suggest friends of friends.
+func (cl *Client) GroupMates(ctx context.Context) ([]*nkapi.User, error) {
+	userId := cl.SessionUserId()
+	seen := map[string]bool{userId: true}
+	var users []*nkapi.User
+	groups := UserGroups(userId).Pager(cl)
+	for groups.Next(ctx) {
+		for _, g := range groups.Page().UserGroups {
+			if GroupUserState(g.State.GetValue()) > GroupUserMember {
+				continue
+			}
+			members := GroupUsers(g.Group.GetId()).Pager(cl)
+			for members.Next(ctx) {
+				for _, u := range members.Page().GroupUsers {
+					if seen[u.User.GetId()] || GroupUserState(u.State.GetValue()) > GroupUserMember {
+						continue
+					}
+					seen[u.User.GetId()] = true
+					users = append(users, u.User)
+				}
+			}
+			if err := members.Err(); err != nil {
+				return nil, fmt.Errorf("unable to retrieve group users: %w", err)
+			}
+		}
+	}
+	if err := groups.Err(); err != nil {
+		return nil, fmt.Errorf("unable to retrieve user groups: %w", err)
+	}
+	return users, nil
+}
+
+// UserCache is a least recently used cache of users, batching retrieval of
+// the users not in the cache, such as to resolve user ids to display names.
+type UserCache struct {
+	cl   *Client
+	size int
+	l    *list.List
+	m    map[string]*list.Element
+	mu   sync.Mutex
+
+	invalidateHandlers callbacks[string]
+}
+
+// NewUserCache creates a user cache for the client, holding up to size users
+// (default: 1024).
+func NewUserCache(cl *Client, size int) *UserCache {
+	if size <= 0 {
+		size = 1024
+	}
+	return &UserCache{
+		cl:   cl,
+		size: size,
+		l:    list.New(),
+		m:    make(map[string]*list.Element),
+	}
+}
+
+// Users returns the users, retrieving the users not in the cache, ordered as
+// the ids. Users that do not exist are omitted.
+func (c *UserCache) Users(ctx context.Context, ids ...string) ([]*nkapi.User, error) {
+	var missing []string
+	c.mu.Lock()
+	for _, id := range ids {
+		if e, ok := c.m[id]; ok {
+			c.l.MoveToFront(e)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	c.mu.Unlock()
+	if len(missing) != 0 {
+		users, err := c.cl.usersBatch(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		c.Add(users...)
+		// return the retrieved users even if evicted by a concurrent add
+		m := make(map[string]*nkapi.User, len(users))
+		for _, u := range users {
+			m[u.Id] = u
+		}
+		return c.collect(ids, m), nil
+	}
+	return c.collect(ids, nil), nil
+}
+
+// collect returns the users in the cache or m, ordered as the ids.
+func (c *UserCache) collect(ids []string, m map[string]*nkapi.User) []*nkapi.User {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	users := make([]*nkapi.User, 0, len(ids))
+	for _, id := range ids {
+		if u, ok := m[id]; ok {
+			users = append(users, u)
+		} else if e, ok := c.m[id]; ok {
+			users = append(users, e.Value.(*nkapi.User))
+		}
+	}
+	return users
+}
+
+// User returns the user, retrieving it when not in the cache.
+func (c *UserCache) User(ctx context.Context, id string) (*nkapi.User, error) {
+	users, err := c.Users(ctx, id)
+	switch {
+	case err != nil:
+		return nil, err
+	case len(users) == 0:
+		return nil, fmt.Errorf("unable to retrieve user %s: %w", id, ErrNotFound)
+	}
+	return users[0], nil
+}
+
+// DisplayNames returns the display names of the users, by user id, falling
+// back to the username when the user has no display name.
+func (c *UserCache) DisplayNames(ctx context.Context, ids ...string) (map[string]string, error) {
+	users, err := c.Users(ctx, ids...)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(users))
+	for _, u := range users {
+		names[u.Id] = u.DisplayName
+		if u.DisplayName == "" {
+			names[u.Id] = u.Username
+		}
+	}
+	return names, nil
+}
+
+// Search searches users by partial username (see Client.SearchUsers), using
+// the cache to retrieve the matching users.
+func (c *UserCache) Search(ctx context.Context, query string, limit int) ([]*nkapi.User, error) {
+	ids, err := c.cl.searchUserIds(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	return c.Users(ctx, ids...)
+}
+
+// Add adds the users to the cache, such as users retrieved with a friends
+// list, replacing cached users with the same id.
+func (c *UserCache) Add(users ...*nkapi.User) {
+	var evicted []string
+	c.mu.Lock()
+	for _, u := range users {
+		if e, ok := c.m[u.Id]; ok {
+			e.Value = u
+			c.l.MoveToFront(e)
+			continue
+		}
+		c.m[u.Id] = c.l.PushFront(u)
+		if c.l.Len() > c.size {
+			e := c.l.Back()
+			id := c.l.Remove(e).(*nkapi.User).Id
+			delete(c.m, id)
+			evicted = append(evicted, id)
+		}
+	}
+	c.mu.Unlock()
+	for _, id := range evicted {
+		c.invalidateHandlers.dispatch(id)
+	}
+}
+
+// Invalidate removes the users from the cache, such as after a user's
+// account was updated.
+func (c *UserCache) Invalidate(ids ...string) {
+	var removed []string
+	c.mu.Lock()
+	for _, id := range ids {
+		if e, ok := c.m[id]; ok {
+			c.l.Remove(e)
+			delete(c.m, id)
+			removed = append(removed, id)
+		}
+	}
+	c.mu.Unlock()
+	for _, id := range removed {
+		c.invalidateHandlers.dispatch(id)
+	}
+}
+
+// Clear removes all users from the cache.
+func (c *UserCache) Clear() {
+	c.mu.Lock()
+	ids := make([]string, 0, len(c.m))
+	for id := range c.m {
+		ids = append(ids, id)
+	}
+	c.mu.Unlock()
+	c.Invalidate(ids...)
+}
+
+// Len returns the number of cached users.
+func (c *UserCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.l.Len()
+}
+
+// OnInvalidate adds a callback called with the id of each user removed from
+// the cache, whether invalidated or evicted. The callback is removed when the
+// context is closed.
+func (c *UserCache) OnInvalidate(ctx context.Context, f func(userId string)) {
+	c.invalidateHandlers.add(ctx, f)
+}
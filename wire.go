@@ -0,0 +1,72 @@
+package nakama
+
+import (
+	"fmt"
+
+	"github.com/heroiclabs/nakama-common/rtapi"
+)
+
+// WireHook is a hook for the raw bytes of a realtime envelope and the
+// envelope's message type (such as "match_data_send"). A hook may return
+// modified bytes, such as to add or verify a checksum or signature, or return
+// an error to prevent the message from being sent or dispatched. The bytes
+// must not be retained after the hook returns.
+type WireHook func(typ string, buf []byte) ([]byte, error)
+
+// WithConnBeforeSend is a nakama websocket connection option to add a hook
+// called with the marshaled bytes of each outgoing envelope, before the
+// bytes are written to the websocket connection. Hooks are called in the
+// order added.
+func WithConnBeforeSend(hook WireHook) ConnOption {
+	return func(conn *Conn) {
+		conn.beforeSend = append(conn.beforeSend, hook)
+	}
+}
+
+// WithConnAfterReceive is a nakama websocket connection option to add a hook
+// called with the bytes of each incoming envelope, after the bytes are read
+// from the websocket connection and unmarshaled. When a hook returns modified
+// bytes, the envelope is unmarshaled again from the modified bytes. Hooks are
+// called in the order added.
+func WithConnAfterReceive(hook WireHook) ConnOption {
+	return func(conn *Conn) {
+		conn.afterReceive = append(conn.afterReceive, hook)
+	}
+}
+
+// runBeforeSend runs the before send hooks, returning the bytes to write.
+func (conn *Conn) runBeforeSend(typ string, buf []byte) ([]byte, error) {
+	for _, hook := range conn.beforeSend {
+		var err error
+		if buf, err = hook(typ, buf); err != nil {
+			return nil, fmt.Errorf("unable to send %s: %w", typ, err)
+		}
+	}
+	return buf, nil
+}
+
+// runAfterReceive runs the after receive hooks, returning the envelope to
+// dispatch. The envelope is unmarshaled again when a hook modified the bytes.
+func (conn *Conn) runAfterReceive(env *rtapi.Envelope, buf []byte) (*rtapi.Envelope, error) {
+	typ, modified := envelopeType(env), false
+	for _, hook := range conn.afterReceive {
+		out, err := hook(typ, buf)
+		if err != nil {
+			putEnvelope(env)
+			return nil, fmt.Errorf("unable to receive %s: %w", typ, err)
+		}
+		if !sameBytes(out, buf) {
+			buf, modified = out, true
+		}
+	}
+	if !modified {
+		return env, nil
+	}
+	putEnvelope(env)
+	return conn.unmarshal(buf)
+}
+
+// sameBytes returns true when a and b are the same slice.
+func sameBytes(a, b []byte) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
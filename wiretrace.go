@@ -0,0 +1,150 @@
+package nakama
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/rtapi"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// traceMaxPayload is the maximum length of a traced payload, after which the
+// payload is truncated.
+const traceMaxPayload = 256
+
+// traceMaxPending is the maximum number of sent requests awaiting a response
+// whose send time is remembered for timing responses.
+const traceMaxPending = 1024
+
+// TraceRecord is a traced realtime envelope, written as a line of json by
+// WithConnTraceJSON.
+type TraceRecord struct {
+	Time      time.Time        `json:"time"`
+	Direction CaptureDirection `json:"direction"`
+	Cid       string           `json:"cid,omitempty"`
+	Type      string           `json:"type"`
+	Size      int              `json:"size"`
+	// Elapsed is the time since the request was sent, for a response.
+	Elapsed time.Duration `json:"elapsed,omitempty"`
+	// Payload is the envelope's json, truncated.
+	Payload string `json:"payload"`
+}
+
+// String satisfies the fmt.Stringer interface, formatting the record as a
+// line of text, as written by WithConnTrace.
+func (r TraceRecord) String() string {
+	arrow := "->"
+	if r.Direction == CaptureIn {
+		arrow = "<-"
+	}
+	cid := r.Cid
+	if cid == "" {
+		cid = "-"
+	}
+	s := fmt.Sprintf("%s %s %s cid=%s size=%d", r.Time.Format("15:04:05.000000"), arrow, r.Type, cid, r.Size)
+	if r.Elapsed != 0 {
+		s += " elapsed=" + r.Elapsed.Round(time.Microsecond).String()
+	}
+	return s + " " + r.Payload
+}
+
+// wireTrace writes traced envelopes.
+type wireTrace struct {
+	w       io.Writer
+	json    bool
+	pending map[string]time.Time
+	logger  func() Logger
+	mu      sync.Mutex
+}
+
+// record writes a trace record for the envelope.
+func (t *wireTrace) record(dir CaptureDirection, env *rtapi.Envelope, size int) {
+	now := time.Now()
+	r := TraceRecord{
+		Time:      now,
+		Direction: dir,
+		Cid:       env.Cid,
+		Type:      envelopeType(env),
+		Size:      size,
+		Payload:   tracePayload(env),
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case env.Cid == "":
+	case dir == CaptureOut:
+		if len(t.pending) >= traceMaxPending {
+			t.pending = nil
+		}
+		if t.pending == nil {
+			t.pending = make(map[string]time.Time)
+		}
+		t.pending[env.Cid] = now
+	default:
+		if sent, ok := t.pending[env.Cid]; ok {
+			r.Elapsed = now.Sub(sent)
+			delete(t.pending, env.Cid)
+		}
+	}
+	var err error
+	if t.json {
+		err = json.NewEncoder(t.w).Encode(r)
+	} else {
+		_, err = io.WriteString(t.w, r.String()+"\n")
+	}
+	if err != nil {
+		t.logger().Log(LevelError, "unable to trace envelope", "err", err)
+	}
+}
+
+// tracePayload returns the envelope's compact json, truncated.
+func tracePayload(env *rtapi.Envelope) string {
+	buf, err := protojson.Marshal(env)
+	if err != nil {
+		return strconv.Quote(err.Error())
+	}
+	var b bytes.Buffer
+	if err := json.Compact(&b, buf); err == nil {
+		buf = b.Bytes()
+	}
+	if len(buf) > traceMaxPayload {
+		return string(buf[:traceMaxPayload]) + "..."
+	}
+	return string(buf)
+}
+
+// WithConnTrace is a nakama websocket connection option to write every sent
+// and received envelope to w, as human-readable lines of text, with the
+// direction, cid, type, size, time elapsed since the request was sent (for
+// responses), and truncated json payload. Intended for debugging the
+// realtime protocol.
+func WithConnTrace(w io.Writer) ConnOption {
+	return func(conn *Conn) {
+		conn.trace = newWireTrace(conn, w, false)
+	}
+}
+
+// WithConnTraceJSON is a nakama websocket connection option to write every
+// sent and received envelope to w, as lines of json (see TraceRecord), for
+// use with tooling.
+func WithConnTraceJSON(w io.Writer) ConnOption {
+	return func(conn *Conn) {
+		conn.trace = newWireTrace(conn, w, true)
+	}
+}
+
+// newWireTrace creates a wire trace for the connection.
+func newWireTrace(conn *Conn, w io.Writer, asJSON bool) *wireTrace {
+	return &wireTrace{
+		w:    w,
+		json: asJSON,
+		logger: func() Logger {
+			return conn.logger
+		},
+	}
+}